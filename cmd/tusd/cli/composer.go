@@ -1,8 +1,12 @@
 package cli
 
 import (
+	"bufio"
 	"context"
+	"database/sql"
+	"encoding/base64"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -11,18 +15,34 @@ import (
 
 	"github.com/tus/tusd/v2/internal/s3log"
 	"github.com/tus/tusd/v2/pkg/azurestore"
+	"github.com/tus/tusd/v2/pkg/compressedstore"
+	"github.com/tus/tusd/v2/pkg/encryptedstore"
 	"github.com/tus/tusd/v2/pkg/filelocker"
+	"github.com/tus/tusd/v2/pkg/filequotastore"
 	"github.com/tus/tusd/v2/pkg/filestore"
 	"github.com/tus/tusd/v2/pkg/gcsstore"
 	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/memoryeventbus"
 	"github.com/tus/tusd/v2/pkg/memorylocker"
+	"github.com/tus/tusd/v2/pkg/memoryquotastore"
+	"github.com/tus/tusd/v2/pkg/memorystore"
 	"github.com/tus/tusd/v2/pkg/s3store"
+	"github.com/tus/tusd/v2/pkg/sftpstore"
+	"github.com/tus/tusd/v2/pkg/sqlinfostore"
+	"github.com/tus/tusd/v2/pkg/sqlquotastore"
+	"github.com/tus/tusd/v2/pkg/tieredstore"
+	"github.com/tus/tusd/v2/pkg/webdavstore"
 
 	"cloud.google.com/go/storage"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
 	"google.golang.org/api/option"
+	_ "modernc.org/sqlite"
 )
 
 var Composer *handler.StoreComposer
@@ -31,6 +51,12 @@ func CreateComposer() {
 	// Attempt to use S3 as a backend if the -s3-bucket option has been supplied.
 	// If not, we default to storing them locally on disk.
 	Composer = handler.NewStoreComposer()
+	infoStore := createInfoStore()
+	if infoStore != nil && Flags.S3Bucket == "" && Flags.GCSBucket == "" && Flags.AzStorage == "" &&
+		(Flags.SFTPAddress != "" || Flags.WebDAVEndpoint != "" || Flags.MemoryStore) {
+		stderr.Fatalf("The -info-store flag requires the file, S3, GCS or Azure storage")
+	}
+
 	if Flags.S3Bucket != "" {
 		// Derive credentials from default credential chain (env, shared, ec2 instance role)
 		// as per https://github.com/aws/aws-sdk-go#configuring-credentials
@@ -53,6 +79,9 @@ func CreateComposer() {
 		s3Client = s3.NewFromConfig(s3Config, func(o *s3.Options) {
 			o.UseAccelerate = Flags.S3TransferAcceleration
 
+			// Create spans for the S3 API calls, if tracing is enabled.
+			o.TracerProvider = s3store.NewTracerProvider(otel.GetTracerProvider())
+
 			// Disable HTTPS and only use HTTP (helpful for debugging requests).
 			o.EndpointOptions.DisableHTTPS = Flags.S3DisableSSL
 
@@ -71,11 +100,14 @@ func CreateComposer() {
 
 		store := s3store.New(Flags.S3Bucket, s3Client)
 		store.ObjectPrefix = Flags.S3ObjectPrefix
+		store.DeduplicationPrefix = Flags.S3DedupPrefix
+		store.PartialDownloads = Flags.S3PartialDownloads
 		store.PreferredPartSize = Flags.S3PartSize
 		store.MinPartSize = Flags.S3MinPartSize
 		store.MaxBufferedParts = Flags.S3MaxBufferedParts
 		store.DisableContentHashes = Flags.S3DisableContentHashes
 		store.SetConcurrentPartUploads(Flags.S3ConcurrentPartUploads)
+		store.InfoStore = infoStore
 		store.UseIn(Composer)
 
 		locker := memorylocker.New()
@@ -109,6 +141,7 @@ func CreateComposer() {
 
 		store := gcsstore.New(Flags.GCSBucket, service)
 		store.ObjectPrefix = Flags.GCSObjectPrefix
+		store.InfoStore = infoStore
 		store.UseIn(Composer)
 
 		locker := memorylocker.New()
@@ -152,8 +185,79 @@ func CreateComposer() {
 		store := azurestore.New(azService)
 		store.ObjectPrefix = Flags.AzObjectPrefix
 		store.Container = Flags.AzStorage
+		store.InfoStore = infoStore
+		store.UseIn(Composer)
+
+		locker := memorylocker.New()
+		locker.UseIn(Composer)
+	} else if Flags.SFTPAddress != "" {
+		if Flags.SFTPUser == "" || Flags.SFTPKeyFile == "" || Flags.SFTPKnownHostsFile == "" {
+			stderr.Fatalf("The -sftp-address flag requires -sftp-user, -sftp-key-file and -sftp-known-hosts-file")
+		}
+
+		key, err := os.ReadFile(Flags.SFTPKeyFile)
+		if err != nil {
+			stderr.Fatalf("Unable to read -sftp-key-file: %s", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			stderr.Fatalf("Unable to parse -sftp-key-file: %s", err)
+		}
+
+		hostKeyCallback, err := knownhosts.New(Flags.SFTPKnownHostsFile)
+		if err != nil {
+			stderr.Fatalf("Unable to read -sftp-known-hosts-file: %s", err)
+		}
+
+		printStartupLog("Using '%s' on 'sftp://%s@%s' as directory storage.\n", Flags.SFTPPath, Flags.SFTPUser, Flags.SFTPAddress)
+
+		pool := sftpstore.NewPool(sftpstore.SSHDialer(Flags.SFTPAddress, &ssh.ClientConfig{
+			User:            Flags.SFTPUser,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         Flags.NetworkTimeout,
+		}), Flags.SFTPMaxConnections)
+
+		store := sftpstore.New(Flags.SFTPPath, pool)
+		store.UseIn(Composer)
+
+		locker := memorylocker.New()
+		locker.UseIn(Composer)
+	} else if Flags.WebDAVEndpoint != "" {
+		endpoint, err := url.Parse(Flags.WebDAVEndpoint)
+		if err != nil {
+			stderr.Fatalf("Unable to parse -webdav-endpoint: %s", err)
+		}
+
+		writeMode := webdavstore.WriteMode(Flags.WebDAVWriteMode)
+		switch writeMode {
+		case webdavstore.WriteModeAuto, webdavstore.WriteModeContentRange, webdavstore.WriteModeSabre, webdavstore.WriteModeChunks:
+		default:
+			stderr.Fatalf("Unknown -webdav-write-mode: %s", Flags.WebDAVWriteMode)
+		}
+
+		printStartupLog("Using '%s' as WebDAV collection for storage.\n", endpoint.Redacted())
+
+		store := webdavstore.New(endpoint)
+		store.Username = Flags.WebDAVUser
+		store.Password = os.Getenv("WEBDAV_PASSWORD")
+		store.WriteMode = writeMode
+		store.ChunkSize = Flags.WebDAVChunkSize
+		store.UseIn(Composer)
+
+		locker := memorylocker.New()
+		locker.UseIn(Composer)
+	} else if Flags.MemoryStore {
+		printStartupLog("Using memory as storage. Uploads are lost when tusd exits.\n")
+
+		store := memorystore.New()
+		store.MaxMemory = Flags.MemoryStoreMaxSize
 		store.UseIn(Composer)
 
+		if Flags.MemoryStoreMaxSize > 0 {
+			printStartupLog("Using %.2fMB as maximum memory for uploads.\n", float64(Flags.MemoryStoreMaxSize)/1024/1024)
+		}
+
 		locker := memorylocker.New()
 		locker.UseIn(Composer)
 	} else {
@@ -171,6 +275,18 @@ func CreateComposer() {
 		store := filestore.New(dir)
 		store.DirModePerm = os.FileMode(Flags.DirPerms) & os.ModePerm
 		store.FileModePerm = os.FileMode(Flags.FilePerms) & os.ModePerm
+
+		if Flags.DedupDir != "" {
+			dedupDir, err := filepath.Abs(Flags.DedupDir)
+			if err != nil {
+				stderr.Fatalf("Unable to make absolute path: %s", err)
+			}
+
+			printStartupLog("Using '%s' as directory for deduplicated content.\n", dedupDir)
+			store.DeduplicationPath = dedupDir
+		}
+
+		store.InfoStore = infoStore
 		store.UseIn(Composer)
 
 		locker := filelocker.New(dir)
@@ -179,5 +295,215 @@ func CreateComposer() {
 		locker.UseIn(Composer)
 	}
 
+	if Flags.StagingDir != "" {
+		if Flags.S3Bucket == "" && Flags.GCSBucket == "" && Flags.AzStorage == "" {
+			stderr.Fatalf("The -staging-dir flag requires a cloud storage (-s3-bucket, -gcs-bucket or -azure-storage)")
+		}
+
+		dir, err := filepath.Abs(Flags.StagingDir)
+		if err != nil {
+			stderr.Fatalf("Unable to make absolute path: %s", err)
+		}
+
+		if err := os.MkdirAll(dir, os.FileMode(Flags.DirPerms)); err != nil {
+			stderr.Fatalf("Unable to ensure directory exists: %s", err)
+		}
+
+		staging := handler.NewStoreComposer()
+		stagingStore := filestore.New(dir)
+		stagingStore.DirModePerm = os.FileMode(Flags.DirPerms) & os.ModePerm
+		stagingStore.FileModePerm = os.FileMode(Flags.FilePerms) & os.ModePerm
+		stagingStore.UseIn(staging)
+
+		// Wrap the configured cloud storage, while keeping its locker.
+		final := Composer
+		Composer = handler.NewStoreComposer()
+		tieredstore.New(staging, final).UseIn(Composer)
+		Composer.UseLocker(final.Locker)
+
+		printStartupLog("Using '%s' as directory for staging uploads before moving them to cloud storage.\n", dir)
+	}
+
+	if Flags.EncryptionKeysFile != "" {
+		keys, err := readEncryptionKeys(Flags.EncryptionKeysFile)
+		if err != nil {
+			stderr.Fatalf("Unable to read -encryption-keys-file: %s", err)
+		}
+
+		// Wrap the configured storage backend, while keeping its locker.
+		inner := Composer
+		Composer = handler.NewStoreComposer()
+
+		store := encryptedstore.New(inner, keys)
+		store.SegmentSize = Flags.EncryptionSegmentSize
+		store.UseIn(Composer)
+		Composer.UseLocker(inner.Locker)
+
+		printStartupLog("Encrypting uploads at rest using the keys from '%s'.\n", Flags.EncryptionKeysFile)
+	}
+
+	if Flags.Compression != "" {
+		if Flags.Compression != compressedstore.AlgorithmGzip && Flags.Compression != compressedstore.AlgorithmZstd {
+			stderr.Fatalf("Unknown -compression algorithm: %s", Flags.Compression)
+		}
+
+		// Wrap the configured storage backend, while keeping its locker. Since this
+		// happens after enabling encryption, the data is compressed before it is encrypted.
+		inner := Composer
+		Composer = handler.NewStoreComposer()
+
+		store := compressedstore.New(inner)
+		store.Algorithm = Flags.Compression
+		store.BlockSize = Flags.CompressionBlockSize
+		store.UseIn(Composer)
+		Composer.UseLocker(inner.Locker)
+
+		if !inner.UsesMetadataUpdater {
+			printStartupLog("The storage backend does not support updating meta data, so uploads are stored without compression.\n")
+		} else {
+			printStartupLog("Compressing uploads using %s.\n", Flags.Compression)
+		}
+	}
+
+	if Flags.EnableUploadEvents {
+		bus := memoryeventbus.New()
+		bus.UseIn(Composer)
+
+		printStartupLog("Using in-memory event bus for upload events.\n")
+	}
+
+	if Flags.QuotaMetaDataKey != "" || Flags.QuotaLimit > 0 {
+		if Flags.QuotaDatabase != "" {
+			db, postgres := openDatabase("quota-database", Flags.QuotaDatabase)
+			store := sqlquotastore.New(db)
+			store.DollarPlaceholders = postgres
+
+			ctx, cancel := context.WithTimeout(context.Background(), Flags.NetworkTimeout)
+			if err := store.CreateTable(ctx); err != nil {
+				stderr.Fatalf("Unable to prepare -quota-database: %s", err)
+			}
+			cancel()
+
+			store.UseIn(Composer)
+			printStartupLog("Using SQL database for quota reservations.\n")
+		} else if Flags.QuotaFile != "" {
+			filequotastore.New(Flags.QuotaFile).UseIn(Composer)
+			printStartupLog("Using '%s' for quota reservations.\n", Flags.QuotaFile)
+		} else {
+			memoryquotastore.New().UseIn(Composer)
+			printStartupLog("Using in-memory store for quota reservations.\n")
+		}
+
+		printStartupLog("Using %.2fMB as quota limit.\n", float64(Flags.QuotaLimit)/1024/1024)
+	}
+
+	if Flags.DigestAlgorithms != "" {
+		if !Composer.UsesStateUpdater {
+			stderr.Fatalf("The storage backend does not support computing digests")
+		}
+
+		printStartupLog("Using %s as digest algorithms.\n", Flags.DigestAlgorithms)
+	}
+
 	printStartupLog("Using %.2fMB as maximum size.\n", float64(Flags.MaxSize)/1024/1024)
 }
+
+// createInfoStore connects to the database configured using -info-store and ensures
+// that the table exists. If the flag is not set, nil is returned.
+func createInfoStore() handler.InfoStore {
+	if Flags.InfoStore == "" {
+		return nil
+	}
+
+	db, postgres := openDatabase("info-store", Flags.InfoStore)
+	dialect := sqlinfostore.DialectSQLite
+	if postgres {
+		dialect = sqlinfostore.DialectPostgres
+	}
+
+	store := sqlinfostore.New(db, dialect)
+	if Flags.InfoStoreMetaDataKeys != "" {
+		for _, key := range strings.Split(Flags.InfoStoreMetaDataKeys, ",") {
+			store.MetaDataKeys = append(store.MetaDataKeys, strings.TrimSpace(key))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Flags.NetworkTimeout)
+	defer cancel()
+	if err := store.Migrate(ctx); err != nil {
+		stderr.Fatalf("Unable to prepare -info-store: %s", err)
+	}
+
+	printStartupLog("Using %s database for storing upload information.\n", dialect)
+
+	return store
+}
+
+// openDatabase opens the SQLite (sqlite:<path>) or PostgreSQL (postgres://...) database
+// configured using the flag. postgres reports whether a PostgreSQL database is used.
+func openDatabase(flag string, dsn string) (db *sql.DB, postgres bool) {
+	var err error
+	if path, ok := strings.CutPrefix(dsn, "sqlite:"); ok {
+		db, err = sql.Open("sqlite", path)
+	} else if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		postgres = true
+		db, err = sql.Open("pgx", dsn)
+	} else {
+		stderr.Fatalf("Unsupported -%s, must start with sqlite: or postgres://", flag)
+	}
+	if err != nil {
+		stderr.Fatalf("Unable to open -%s: %s", flag, err)
+	}
+	if !postgres {
+		// SQLite only supports a single writer at a time.
+		db.SetMaxOpenConns(1)
+	}
+
+	return db, postgres
+}
+
+// readEncryptionKeys reads the key encryption keys from the file. Each line contains the
+// key's ID and its base64-encoded value, separated by whitespace. Empty lines and lines
+// starting with # are ignored. The last key is used for encrypting new uploads.
+func readEncryptionKeys(path string) (*encryptedstore.KeyRing, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys := encryptedstore.NewKeyRing()
+	found := false
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d must contain a key ID and a key", line)
+		}
+
+		key, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d contains an invalid base64-encoded key: %w", line, err)
+		}
+
+		if err := keys.AddKey(fields[0], key); err != nil {
+			return nil, err
+		}
+		found = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if !found {
+		return nil, fmt.Errorf("file %s contains no keys", path)
+	}
+
+	return keys, nil
+}
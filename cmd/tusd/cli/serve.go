@@ -12,9 +12,11 @@ import (
 	"strings"
 	"syscall"
 
+	"github.com/tus/tusd/v2/pkg/clamdscanner"
 	tushandler "github.com/tus/tusd/v2/pkg/handler"
 	"github.com/tus/tusd/v2/pkg/hooks"
 	"github.com/tus/tusd/v2/pkg/hooks/plugin"
+	"github.com/tus/tusd/v2/pkg/icapscanner"
 )
 
 const (
@@ -30,6 +32,8 @@ const (
 // specified, in which case a different socket creation and binding mechanism
 // is put in place.
 func Serve() {
+	shutdownTracing := SetupTracing()
+
 	config := tushandler.Config{
 		MaxSize:                          Flags.MaxSize,
 		BasePath:                         Flags.Basepath,
@@ -37,13 +41,29 @@ func Serve() {
 		RespectForwardedHeaders:          Flags.BehindProxy,
 		EnableExperimentalProtocol:       Flags.ExperimentalProtocol,
 		DisableDownload:                  Flags.DisableDownload,
+		DownloadSigningKey:               getDownloadSigningKey(),
+		UploadTokenKey:                   getUploadTokenKey(),
 		DisableTermination:               Flags.DisableTermination,
+		EnableMetadataUpdate:             Flags.EnableMetadataUpdate,
 		DisableConcatenation:             Flags.DisableConcatenation,
+		EnableConcatenationUnfinished:    Flags.ConcatenationUnfinished,
 		StoreComposer:                    Composer,
 		UploadProgressInterval:           Flags.ProgressHooksInterval,
 		AcquireLockTimeout:               Flags.AcquireLockTimeout,
 		GracefulRequestCompletionTimeout: Flags.GracefulRequestCompletionTimeout,
 		NetworkTimeout:                   Flags.NetworkTimeout,
+		MaxBandwidth:                     Flags.MaxBandwidth,
+		MaxUploadBandwidth:               Flags.MaxUploadBandwidth,
+		MaxConcurrentUploads:             Flags.MaxConcurrentUploads,
+		MaxConcurrentUploadsPerClient:    Flags.MaxConcurrentUploadsPerClient,
+		MaxConcurrentUploadsPerKey:       Flags.MaxConcurrentUploadsPerKey,
+		QuotaMetaDataKey:                 Flags.QuotaMetaDataKey,
+		QuotaLimit:                       Flags.QuotaLimit,
+		DigestAlgorithms:                 splitList(Flags.DigestAlgorithms),
+		SniffContentType:                 Flags.SniffContentType,
+		AllowedContentTypes:              splitList(Flags.AllowedContentTypes),
+		RequireMatchingContentType:       Flags.RequireMatchingContentType,
+		VirusScanner:                     getVirusScanner(),
 	}
 
 	var handler *tushandler.Handler
@@ -180,6 +200,7 @@ func Serve() {
 		// ErrServerClosed means that http.Server.Shutdown was called due to an interruption signal.
 		// We wait until the interruption procedure is complete or times out and then exit main.
 		<-shutdownComplete
+		shutdownTracing()
 	} else {
 		// Any other error is relayed to the user.
 		stderr.Fatalf("Unable to serve: %s", err)
@@ -307,3 +328,45 @@ func getCorsConfig() *tushandler.CorsConfig {
 
 	return &config
 }
+
+// splitList splits a comma-separated flag value into its trimmed elements.
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	elements := strings.Split(value, ",")
+	for i, element := range elements {
+		elements[i] = strings.TrimSpace(element)
+	}
+
+	return elements
+}
+
+func getVirusScanner() tushandler.VirusScanner {
+	if Flags.ClamdAddress != "" && Flags.ICAPURL != "" {
+		stderr.Fatalf("The -clamd-address and -icap-url flags cannot be used together")
+	}
+
+	if Flags.ClamdAddress != "" {
+		network := "tcp"
+		if strings.HasPrefix(Flags.ClamdAddress, "/") {
+			network = "unix"
+		}
+
+		printStartupLog("Scanning uploads using clamd at %s.\n", Flags.ClamdAddress)
+		return clamdscanner.New(network, Flags.ClamdAddress)
+	}
+
+	if Flags.ICAPURL != "" {
+		scanner, err := icapscanner.New(Flags.ICAPURL)
+		if err != nil {
+			stderr.Fatalf("Invalid URL for -icap-url flag: %s", err)
+		}
+
+		printStartupLog("Scanning uploads using ICAP service at %s.\n", Flags.ICAPURL)
+		return scanner
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	tushandler "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// SignURL implements the sign-url subcommand, which prints signed download URLs
+// for the upload URLs passed as arguments.
+func SignURL(args []string) {
+	var keyFile, basePath, contentDisposition string
+	var expiresIn time.Duration
+
+	f := flag.NewFlagSet("sign-url", flag.ExitOnError)
+	f.Usage = func() {
+		fmt.Fprintf(f.Output(), "Usage: tusd sign-url [options] <upload URL>...\n\n")
+		f.PrintDefaults()
+	}
+	f.StringVar(&keyFile, "download-signing-key-file", "", "Path to the file containing the key for signed download URLs")
+	f.StringVar(&basePath, "base-path", "/files/", "Basepath of the HTTP server, used to extract the upload ID from the upload URL")
+	f.DurationVar(&expiresIn, "expires-in", time.Hour, "Duration for which the signed URL is valid")
+	f.StringVar(&contentDisposition, "content-disposition", "", "Value for the Content-Disposition header in the response, overriding the default one")
+	f.Parse(args)
+
+	if keyFile == "" || f.NArg() == 0 {
+		f.Usage()
+		os.Exit(2)
+	}
+
+	key, err := readSigningKey(keyFile)
+	if err != nil {
+		stderr.Fatalf("Unable to read -download-signing-key-file: %s", err)
+	}
+
+	expires := time.Now().Add(expiresIn)
+	for _, uploadURL := range f.Args() {
+		u, err := url.Parse(uploadURL)
+		if err != nil {
+			stderr.Fatalf("Invalid upload URL %s: %s", uploadURL, err)
+		}
+
+		_, id, ok := strings.Cut(u.Path, basePath)
+		id = strings.Trim(id, "/")
+		if !ok || id == "" {
+			stderr.Fatalf("Upload URL %s does not contain an upload ID after the base path %s", uploadURL, basePath)
+		}
+
+		signedURL, err := tushandler.SignDownloadURL(key, uploadURL, id, expires, contentDisposition)
+		if err != nil {
+			stderr.Fatalf("Unable to sign upload URL %s: %s", uploadURL, err)
+		}
+
+		fmt.Println(signedURL)
+	}
+}
+
+func getDownloadSigningKey() []byte {
+	if Flags.DownloadSigningKeyFile == "" {
+		return nil
+	}
+
+	key, err := readSigningKey(Flags.DownloadSigningKeyFile)
+	if err != nil {
+		stderr.Fatalf("Unable to read -download-signing-key-file: %s", err)
+	}
+
+	printStartupLog("Requiring signed URLs for downloads.\n")
+	return key
+}
+
+func getUploadTokenKey() []byte {
+	if Flags.UploadTokenKeyFile == "" {
+		return nil
+	}
+
+	key, err := readSigningKey(Flags.UploadTokenKeyFile)
+	if err != nil {
+		stderr.Fatalf("Unable to read -upload-token-key-file: %s", err)
+	}
+
+	printStartupLog("Requiring upload tokens for creating and modifying uploads.\n")
+	return key
+}
+
+// readSigningKey reads the key from the file, ignoring surrounding whitespace
+// such as a trailing newline.
+func readSigningKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	key := bytes.TrimSpace(data)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("file %s is empty", path)
+	}
+
+	return key, nil
+}
@@ -0,0 +1,73 @@
+package cli
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// SetupTracing configures the global OpenTelemetry tracer provider and propagator
+// using the exporter selected by the -tracing-exporter flag. The OTLP exporters and
+// the sampler can be further configured using the standard OTEL_* environment variables.
+// The returned function flushes the remaining spans and must be called before exiting.
+func SetupTracing() func() {
+	ctx := context.Background()
+
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch Flags.TracingExporter {
+	case "", "none":
+		return func() {}
+	case "stdout":
+		exporter, err = stdouttrace.New()
+	case "otlp-grpc":
+		exporter, err = otlptracegrpc.New(ctx)
+	case "otlp-http":
+		exporter, err = otlptracehttp.New(ctx)
+	default:
+		stderr.Fatalf("Unknown tracing exporter in -tracing-exporter flag: %s", Flags.TracingExporter)
+	}
+	if err != nil {
+		stderr.Fatalf("Unable to create tracing exporter: %s", err)
+	}
+
+	// Attributes from the OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES environment
+	// variables take precedence over our defaults.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			attribute.String("service.name", "tusd"),
+			attribute.String("service.version", VersionName),
+		),
+		resource.WithTelemetrySDK(),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		stderr.Fatalf("Unable to create tracing resource: %s", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	printStartupLog("Using %s as the tracing exporter.\n", Flags.TracingExporter)
+
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), Flags.ShutdownTimeout)
+		defer cancel()
+
+		if err := provider.Shutdown(ctx); err != nil {
+			stderr.Printf("Failed to flush traces: %s\n", err)
+		}
+	}
+}
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"os"
+
 	"github.com/tus/tusd/v2/cmd/tusd/cli"
 )
 
 func main() {
+	// The sign-url subcommand creates signed download URLs and does not start a server.
+	if len(os.Args) > 1 && os.Args[1] == "sign-url" {
+		cli.SignURL(os.Args[2:])
+		return
+	}
+
 	cli.ParseFlags()
 	cli.PrepareGreeting()
 
@@ -0,0 +1,55 @@
+// Package quotamap implements the bookkeeping of quota reservations in a map, which
+// is shared by the quota stores that keep all reservations in memory.
+package quotamap
+
+import (
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Map holds the reservations indexed by the upload ID. It is not safe for
+// concurrent use and must be protected by the caller.
+type Map map[string]handler.QuotaReservation
+
+// Reserve sets the reservation for the upload as described in handler.QuotaStore.
+func (m Map) Reserve(key string, id string, size int64, limit int64) error {
+	if limit > 0 {
+		usage := m.Usage(key)
+		if previous, ok := m[id]; ok && previous.Key == key {
+			usage.Reserved -= previous.Size
+		}
+
+		if usage.Reserved+size > limit {
+			return handler.ErrQuotaExceeded
+		}
+	}
+
+	reservation := m[id]
+	reservation.Key = key
+	reservation.ID = id
+	reservation.Size = size
+	reservation.Limit = limit
+	m[id] = reservation
+
+	return nil
+}
+
+// Use sets the number of received bytes for the upload, if it has a reservation.
+func (m Map) Use(id string, used int64) {
+	if reservation, ok := m[id]; ok {
+		reservation.Used = used
+		m[id] = reservation
+	}
+}
+
+// Usage sums up all reservations with the given key.
+func (m Map) Usage(key string) handler.QuotaUsage {
+	var usage handler.QuotaUsage
+	for _, reservation := range m {
+		if reservation.Key == key {
+			usage.Reserved += reservation.Size
+			usage.Used += reservation.Used
+		}
+	}
+
+	return usage
+}
@@ -171,3 +171,19 @@ func (l *loggingS3API) UploadPartCopy(ctx context.Context, input *s3.UploadPartC
 	l.logCall("UploadPartCopy", input, output, err, time.Since(start))
 	return output, err
 }
+
+// CopyObject implements the s3store.S3API interface
+func (l *loggingS3API) CopyObject(ctx context.Context, input *s3.CopyObjectInput, opt ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	start := time.Now()
+	output, err := l.Wrapped.CopyObject(ctx, input, opt...)
+	l.logCall("CopyObject", input, output, err, time.Since(start))
+	return output, err
+}
+
+// ListObjectsV2 implements the s3store.S3API interface
+func (l *loggingS3API) ListObjectsV2(ctx context.Context, input *s3.ListObjectsV2Input, opt ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	start := time.Now()
+	output, err := l.Wrapped.ListObjectsV2(ctx, input, opt...)
+	l.logCall("ListObjectsV2", input, output, err, time.Since(start))
+	return output, err
+}
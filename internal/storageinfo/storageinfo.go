@@ -0,0 +1,16 @@
+// Package storageinfo contains helpers for the storage information of uploads, which
+// data stores save in handler.FileInfo.Storage.
+package storageinfo
+
+import "maps"
+
+// Clone returns a copy of the storage information, to which entries can be added without
+// modifying the caller's map. Existing entries, e.g. added by a wrapping data store, are
+// preserved. If storage is nil, an empty map is returned.
+func Clone(storage map[string]string) map[string]string {
+	storage = maps.Clone(storage)
+	if storage == nil {
+		storage = make(map[string]string)
+	}
+	return storage
+}
@@ -36,6 +36,8 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
 	"github.com/tus/tusd/v2/pkg/handler"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -70,6 +72,9 @@ type AzConfig struct {
 	ContainerName       string
 	ContainerAccessType string
 	Endpoint            string
+	// TracerProvider is used to create OpenTelemetry spans for the calls to the
+	// Azure API. Defaults to the global tracer provider.
+	TracerProvider trace.TracerProvider
 }
 
 type AzBlob interface {
@@ -102,6 +107,10 @@ type InfoBlob struct {
 func NewAzureService(config *AzConfig) (AzService, error) {
 
 	serviceURL := fmt.Sprintf("%s/%s", config.Endpoint, config.ContainerName)
+	tracerProvider := config.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
 	clientOptions := &container.ClientOptions{
 		ClientOptions: azcore.ClientOptions{
 			Retry: policy.RetryOptions{
@@ -109,6 +118,7 @@ func NewAzureService(config *AzConfig) (AzService, error) {
 				RetryDelay:    100,  // Retry after 100ms initially
 				MaxRetryDelay: 5000, // Max retry delay 5 seconds
 			},
+			TracingProvider: newTracingProvider(tracerProvider),
 		},
 	}
 	var containerClient *container.Client
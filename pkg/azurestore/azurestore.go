@@ -8,9 +8,11 @@ import (
 	"fmt"
 	"io"
 	"io/fs"
+	"net/http"
 	"os"
 	"strings"
 
+	"github.com/tus/tusd/v2/internal/storageinfo"
 	"github.com/tus/tusd/v2/internal/uid"
 	"github.com/tus/tusd/v2/pkg/handler"
 )
@@ -24,8 +26,15 @@ type AzureStore struct {
 	// on disk during the upload. An empty string ("", the default value) will
 	// cause AzureStore to use the operating system's default temporary directory.
 	TemporaryDirectory string
+
+	// InfoStore, if set, is used to persist the uploads' FileInfo instead of
+	// the .info blobs in the container.
+	InfoStore handler.InfoStore
 }
 
+// errIncompleteUpload is used when a client attempts to download an incomplete upload
+var errIncompleteUpload = handler.NewError("ERR_INCOMPLETE_UPLOAD", "cannot stream non-finished upload", http.StatusBadRequest)
+
 type AzUpload struct {
 	ID          string
 	InfoBlob    AzBlob
@@ -33,6 +42,8 @@ type AzUpload struct {
 	InfoHandler *handler.FileInfo
 
 	tempDir string
+	// infoStore persists the info instead of InfoBlob, if set.
+	infoStore handler.InfoStore
 }
 
 func New(service AzService) *AzureStore {
@@ -47,6 +58,15 @@ func (store AzureStore) UseIn(composer *handler.StoreComposer) {
 	composer.UseCore(store)
 	composer.UseTerminater(store)
 	composer.UseLengthDeferrer(store)
+	composer.UseMetadataUpdater(store)
+	composer.UseStateUpdater(store)
+	composer.UseConcurrentReader(store)
+}
+
+// SupportsConcurrentReads returns true, since only finished uploads, whose blocks are
+// committed, can be read. Their data is not modified by later writes.
+func (store AzureStore) SupportsConcurrentReads() bool {
+	return true
 }
 
 func (store AzureStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
@@ -64,17 +84,19 @@ func (store AzureStore) NewUpload(ctx context.Context, info handler.FileInfo) (h
 		return nil, err
 	}
 
-	infoFile := store.keyWithPrefix(store.infoPath(info.ID))
-	infoBlob, err := store.Service.NewBlob(ctx, infoFile)
-	if err != nil {
-		return nil, err
+	var infoBlob AzBlob
+	if store.InfoStore == nil {
+		infoFile := store.keyWithPrefix(store.infoPath(info.ID))
+		infoBlob, err = store.Service.NewBlob(ctx, infoFile)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	info.Storage = map[string]string{
-		"Type":      "azurestore",
-		"Container": store.Container,
-		"Key":       store.keyWithPrefix(info.ID),
-	}
+	info.Storage = storageinfo.Clone(info.Storage)
+	info.Storage["Type"] = "azurestore"
+	info.Storage["Container"] = store.Container
+	info.Storage["Key"] = store.keyWithPrefix(info.ID)
 
 	azUpload := &AzUpload{
 		ID:          info.ID,
@@ -82,6 +104,7 @@ func (store AzureStore) NewUpload(ctx context.Context, info handler.FileInfo) (h
 		InfoBlob:    infoBlob,
 		BlockBlob:   blockBlob,
 		tempDir:     store.TemporaryDirectory,
+		infoStore:   store.InfoStore,
 	}
 
 	err = azUpload.writeInfo(ctx)
@@ -101,21 +124,31 @@ func (store AzureStore) NewUpload(ctx context.Context, info handler.FileInfo) (h
 
 func (store AzureStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
 	info := handler.FileInfo{}
-	infoFile := store.keyWithPrefix(store.infoPath(id))
-	infoBlob, err := store.Service.NewBlob(ctx, infoFile)
-	if err != nil {
-		return nil, err
-	}
+	var infoBlob AzBlob
+	if store.InfoStore != nil {
+		var err error
+		info, err = store.InfoStore.GetInfo(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		infoFile := store.keyWithPrefix(store.infoPath(id))
+		var err error
+		infoBlob, err = store.Service.NewBlob(ctx, infoFile)
+		if err != nil {
+			return nil, err
+		}
 
-	// Download the info file from Azure Storage
-	data, err := infoBlob.Download(ctx)
-	if err != nil {
-		return nil, err
-	}
-	defer data.Close()
+		// Download the info file from Azure Storage
+		data, err := infoBlob.Download(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer data.Close()
 
-	if err := json.NewDecoder(data).Decode(&info); err != nil {
-		return nil, err
+		if err := json.NewDecoder(data).Decode(&info); err != nil {
+			return nil, err
+		}
 	}
 
 	if info.Size > MaxBlockBlobSize {
@@ -145,6 +178,7 @@ func (store AzureStore) GetUpload(ctx context.Context, id string) (handler.Uploa
 		InfoBlob:    infoBlob,
 		BlockBlob:   blockBlob,
 		tempDir:     store.TemporaryDirectory,
+		infoStore:   store.InfoStore,
 	}, nil
 }
 
@@ -156,6 +190,14 @@ func (store AzureStore) AsLengthDeclarableUpload(upload handler.Upload) handler.
 	return upload.(*AzUpload)
 }
 
+func (store AzureStore) AsMetadataUpdatableUpload(upload handler.Upload) handler.MetadataUpdatableUpload {
+	return upload.(*AzUpload)
+}
+
+func (store AzureStore) AsStateUpdatableUpload(upload handler.Upload) handler.StateUpdatableUpload {
+	return upload.(*AzUpload)
+}
+
 func (upload *AzUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
 	// Create a temporary file for holding the uploaded data
 	file, err := os.CreateTemp(upload.tempDir, "tusd-az-tmp-")
@@ -193,6 +235,15 @@ func (upload *AzUpload) WriteChunk(ctx context.Context, offset int64, src io.Rea
 	}
 
 	upload.InfoHandler.Offset += n
+
+	// Keep the offset in the InfoStore up to date. It is only informational, since
+	// the offset is always calculated from the uncommitted blocks.
+	if upload.infoStore != nil {
+		if err := upload.infoStore.SaveInfo(ctx, *upload.InfoHandler); err != nil {
+			return n, err
+		}
+	}
+
 	return n, nil
 }
 
@@ -203,6 +254,16 @@ func (upload *AzUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
 		return *upload.InfoHandler, nil
 	}
 
+	if upload.infoStore != nil {
+		info, err := upload.infoStore.GetInfo(ctx, upload.ID)
+		if err != nil {
+			return info, err
+		}
+
+		upload.InfoHandler = &info
+		return info, nil
+	}
+
 	data, err := upload.InfoBlob.Download(ctx)
 	if err != nil {
 		return info, err
@@ -216,9 +277,26 @@ func (upload *AzUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
 	return info, nil
 }
 
-// Get the uploaded file from the Azure storage
+// Get the uploaded file from the Azure storage. Blocks are only committed once the upload
+// is finished and Azure does not allow reading uncommitted blocks. Therefore, the data of
+// unfinished uploads cannot be read.
 func (upload *AzUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
-	return upload.BlockBlob.Download(ctx)
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.SizeIsDeferred || info.Offset < info.Size {
+		return nil, errIncompleteUpload
+	}
+
+	r, err := upload.BlockBlob.Download(ctx)
+	if handlerErr, ok := err.(handler.Error); ok && handlerErr.ErrorCode == handler.ErrNotFound.ErrorCode {
+		// The info blob exists, so the upload has just not been finished yet.
+		return nil, errIncompleteUpload
+	}
+
+	return r, err
 }
 
 // Finish the file upload and commit the block list
@@ -228,7 +306,12 @@ func (upload *AzUpload) FinishUpload(ctx context.Context) error {
 
 func (upload *AzUpload) Terminate(ctx context.Context) error {
 	// Delete info file
-	err := upload.InfoBlob.Delete(ctx)
+	var err error
+	if upload.infoStore != nil {
+		err = upload.infoStore.DeleteInfo(ctx, upload.ID)
+	} else {
+		err = upload.InfoBlob.Delete(ctx)
+	}
 	if err != nil {
 		return err
 	}
@@ -243,11 +326,35 @@ func (upload *AzUpload) DeclareLength(ctx context.Context, length int64) error {
 	return upload.writeInfo(ctx)
 }
 
+func (upload *AzUpload) UpdateMetaData(ctx context.Context, metaData handler.MetaData) error {
+	// Ensure that the info has been loaded, so the other properties are not lost.
+	if _, err := upload.GetInfo(ctx); err != nil {
+		return err
+	}
+
+	upload.InfoHandler.MetaData = metaData
+	return upload.writeInfo(ctx)
+}
+
+func (upload *AzUpload) UpdateState(ctx context.Context, state handler.UploadState) error {
+	// Ensure that the info has been loaded, so the other properties are not lost.
+	if _, err := upload.GetInfo(ctx); err != nil {
+		return err
+	}
+
+	upload.InfoHandler.State = &state
+	return upload.writeInfo(ctx)
+}
+
 func (store AzureStore) infoPath(id string) string {
 	return id + InfoBlobSuffix
 }
 
 func (upload *AzUpload) writeInfo(ctx context.Context) error {
+	if upload.infoStore != nil {
+		return upload.infoStore.SaveInfo(ctx, *upload.InfoHandler)
+	}
+
 	data, err := json.Marshal(upload.InfoHandler)
 	if err != nil {
 		return err
@@ -21,6 +21,8 @@ import (
 var _ handler.DataStore = azurestore.AzureStore{}
 var _ handler.TerminaterDataStore = azurestore.AzureStore{}
 var _ handler.LengthDeferrerDataStore = azurestore.AzureStore{}
+var _ handler.MetadataUpdaterDataStore = azurestore.AzureStore{}
+var _ handler.StateUpdaterDataStore = azurestore.AzureStore{}
 
 const mockID = "123456789abcdefghijklmnopqrstuvwxyz"
 const mockContainer = "tusd"
@@ -253,7 +255,7 @@ func TestGetReader(t *testing.T) {
 		service.EXPECT().NewBlob(ctx, mockID+".info").Return(infoBlob, nil).Times(1),
 		infoBlob.EXPECT().Download(ctx).Return(newReadCloser(data), nil).Times(1),
 		service.EXPECT().NewBlob(ctx, mockID).Return(blockBlob, nil).Times(1),
-		blockBlob.EXPECT().GetOffset(ctx).Return(int64(0), nil).Times(1),
+		blockBlob.EXPECT().GetOffset(ctx).Return(mockSize, nil).Times(1),
 		blockBlob.EXPECT().Download(ctx).Return(newReadCloser([]byte(mockReaderData)), nil).Times(1),
 	)
 
@@ -266,6 +268,39 @@ func TestGetReader(t *testing.T) {
 	cancel()
 }
 
+func TestGetReaderNotFinished(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	service := NewMockAzService(mockCtrl)
+	store := azurestore.New(service)
+	store.Container = mockContainer
+
+	blockBlob := NewMockAzBlob(mockCtrl)
+	infoBlob := NewMockAzBlob(mockCtrl)
+
+	data, err := json.Marshal(mockTusdInfo)
+	assert.Nil(err)
+
+	gomock.InOrder(
+		service.EXPECT().NewBlob(ctx, mockID+".info").Return(infoBlob, nil).Times(1),
+		infoBlob.EXPECT().Download(ctx).Return(newReadCloser(data), nil).Times(1),
+		service.EXPECT().NewBlob(ctx, mockID).Return(blockBlob, nil).Times(1),
+		// The data of unfinished uploads is not downloaded
+		blockBlob.EXPECT().GetOffset(ctx).Return(int64(0), nil).Times(1),
+	)
+
+	upload, err := store.GetUpload(ctx, mockID)
+	assert.Nil(err)
+
+	reader, err := upload.GetReader(ctx)
+	assert.Nil(reader)
+	assert.Equal("ERR_INCOMPLETE_UPLOAD: cannot stream non-finished upload", err.Error())
+}
+
 func TestWriteChunk(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -435,6 +470,56 @@ func TestDeclareLength(t *testing.T) {
 	cancel()
 }
 
+func TestUpdateMetaData(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	ctx, cancel := context.WithCancel(ctx)
+
+	service := NewMockAzService(mockCtrl)
+	store := azurestore.New(service)
+	store.Container = mockContainer
+
+	blockBlob := NewMockAzBlob(mockCtrl)
+	assert.NotNil(blockBlob)
+
+	infoBlob := NewMockAzBlob(mockCtrl)
+	assert.NotNil(infoBlob)
+
+	data, err := json.Marshal(mockTusdInfo)
+	assert.Nil(err)
+
+	info := mockTusdInfo
+	info.MetaData = handler.MetaData{"foo": "baz"}
+
+	updatedData, err := json.Marshal(info)
+	assert.Nil(err)
+
+	r := bytes.NewReader(updatedData)
+
+	gomock.InOrder(
+		service.EXPECT().NewBlob(ctx, mockID+".info").Return(infoBlob, nil).Times(1),
+		infoBlob.EXPECT().Download(ctx).Return(newReadCloser(data), nil).Times(1),
+		service.EXPECT().NewBlob(ctx, mockID).Return(blockBlob, nil).Times(1),
+		blockBlob.EXPECT().GetOffset(ctx).Return(int64(0), nil).Times(1),
+		infoBlob.EXPECT().Upload(ctx, r).Return(nil).Times(1),
+	)
+
+	upload, err := store.GetUpload(ctx, mockID)
+	assert.Nil(err)
+
+	err = store.AsMetadataUpdatableUpload(upload).UpdateMetaData(ctx, handler.MetaData{"foo": "baz"})
+	assert.Nil(err)
+
+	info, err = upload.GetInfo(ctx)
+	assert.Nil(err)
+	assert.Equal(handler.MetaData{"foo": "baz"}, info.MetaData)
+
+	cancel()
+}
+
 func newReadCloser(b []byte) io.ReadCloser {
 	return io.NopCloser(bytes.NewReader(b))
 }
@@ -0,0 +1,95 @@
+package azurestore
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// newTracingProvider adapts an OpenTelemetry tracer provider for use in the Azure SDK,
+// so that spans are created for every Azure Blob Storage API call.
+func newTracingProvider(tp trace.TracerProvider) tracing.Provider {
+	return tracing.NewProvider(func(name, version string) tracing.Tracer {
+		t := tp.Tracer(name, trace.WithInstrumentationVersion(version))
+
+		return tracing.NewTracer(func(ctx context.Context, spanName string, options *tracing.SpanOptions) (context.Context, tracing.Span) {
+			var opts []trace.SpanStartOption
+			if options != nil {
+				opts = append(opts,
+					trace.WithSpanKind(convertSpanKind(options.Kind)),
+					trace.WithAttributes(convertAttributes(options.Attributes)...),
+				)
+			}
+
+			ctx, span := t.Start(ctx, spanName, opts...)
+			return ctx, newSpan(span)
+		}, &tracing.TracerOptions{
+			SpanFromContext: func(ctx context.Context) tracing.Span {
+				return newSpan(trace.SpanFromContext(ctx))
+			},
+		})
+	}, nil)
+}
+
+func newSpan(span trace.Span) tracing.Span {
+	return tracing.NewSpan(tracing.SpanImpl{
+		End: func() {
+			span.End()
+		},
+		SetAttributes: func(attrs ...tracing.Attribute) {
+			span.SetAttributes(convertAttributes(attrs)...)
+		},
+		AddEvent: func(name string, attrs ...tracing.Attribute) {
+			span.AddEvent(name, trace.WithAttributes(convertAttributes(attrs)...))
+		},
+		SetStatus: func(status tracing.SpanStatus, desc string) {
+			switch status {
+			case tracing.SpanStatusOK:
+				span.SetStatus(codes.Ok, desc)
+			case tracing.SpanStatusError:
+				span.SetStatus(codes.Error, desc)
+			}
+		},
+	})
+}
+
+func convertSpanKind(kind tracing.SpanKind) trace.SpanKind {
+	switch kind {
+	case tracing.SpanKindClient:
+		return trace.SpanKindClient
+	case tracing.SpanKindServer:
+		return trace.SpanKindServer
+	case tracing.SpanKindProducer:
+		return trace.SpanKindProducer
+	case tracing.SpanKindConsumer:
+		return trace.SpanKindConsumer
+	default:
+		return trace.SpanKindInternal
+	}
+}
+
+func convertAttributes(attrs []tracing.Attribute) []attribute.KeyValue {
+	result := make([]attribute.KeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		switch v := attr.Value.(type) {
+		case string:
+			result = append(result, attribute.String(attr.Key, v))
+		case bool:
+			result = append(result, attribute.Bool(attr.Key, v))
+		case int:
+			result = append(result, attribute.Int(attr.Key, v))
+		case int64:
+			result = append(result, attribute.Int64(attr.Key, v))
+		case float64:
+			result = append(result, attribute.Float64(attr.Key, v))
+		default:
+			result = append(result, attribute.String(attr.Key, fmt.Sprint(v)))
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,146 @@
+// Package clamdscanner scans uploads for malware using clamd, the daemon of ClamAV.
+//
+// The upload's data is streamed to clamd using the INSTREAM command, so it does not
+// need to be accessible by clamd on disk. Be aware that clamd rejects streams larger
+// than its StreamMaxLength setting, which must be raised accordingly. In this case,
+// the scan fails and the upload is not considered complete:
+//
+//	config := handler.Config{
+//		StoreComposer: composer,
+//		VirusScanner:  clamdscanner.New("tcp", "localhost:3310"),
+//	}
+package clamdscanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+const defaultChunkSize = 64 * 1024
+
+// ClamdScanner sends uploads to clamd for scanning.
+type ClamdScanner struct {
+	// Network and Address of clamd, as understood by net.Dial. For example,
+	// "tcp" and "localhost:3310" or "unix" and "/run/clamav/clamd.ctl".
+	Network string
+	Address string
+	// ChunkSize is the maximum size of the chunks, in which the data is sent.
+	ChunkSize int
+}
+
+// New creates a new scanner for clamd listening at the given address.
+func New(network string, address string) ClamdScanner {
+	return ClamdScanner{
+		Network:   network,
+		Address:   address,
+		ChunkSize: defaultChunkSize,
+	}
+}
+
+func (scanner ClamdScanner) Scan(ctx context.Context, data io.Reader) (handler.ScanResult, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, scanner.Network, scanner.Address)
+	if err != nil {
+		return handler.ScanResult{}, err
+	}
+	defer conn.Close()
+
+	// Interrupt blocking reads and writes once the context is cancelled.
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	if err := scanner.sendStream(conn, data); err != nil {
+		// clamd closes the connection if the stream exceeds its size limit, but sends
+		// a reply explaining the reason first.
+		if reply, replyErr := readReply(conn); replyErr == nil {
+			if _, parseErr := parseReply(reply); parseErr != nil {
+				return handler.ScanResult{}, parseErr
+			}
+		}
+		return handler.ScanResult{}, err
+	}
+
+	reply, err := readReply(conn)
+	if err != nil {
+		return handler.ScanResult{}, err
+	}
+
+	return parseReply(reply)
+}
+
+// sendStream sends the INSTREAM command followed by the data in chunks, each prefixed
+// with its length as a 4-byte unsigned integer in network byte order. A chunk of length
+// zero marks the end of the stream.
+func (scanner ClamdScanner) sendStream(conn net.Conn, data io.Reader) error {
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return err
+	}
+
+	chunkSize := scanner.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	buf := make([]byte, 4+chunkSize)
+	for {
+		n, err := io.ReadFull(data, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// readReply reads clamd's reply, which is terminated by a null character since the
+// command was prefixed with z.
+func readReply(conn net.Conn) (string, error) {
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSuffix(reply, "\x00"), nil
+}
+
+// parseReply interprets clamd's reply, such as "stream: OK" or
+// "stream: Eicar-Test-Signature FOUND".
+func parseReply(reply string) (handler.ScanResult, error) {
+	result, ok := strings.CutPrefix(reply, "stream: ")
+	if !ok {
+		return handler.ScanResult{}, fmt.Errorf("clamdscanner: scan failed: %s", reply)
+	}
+
+	if result == "OK" {
+		return handler.ScanResult{}, nil
+	}
+
+	if signature, ok := strings.CutSuffix(result, " FOUND"); ok {
+		return handler.ScanResult{
+			Infected:  true,
+			Signature: signature,
+		}, nil
+	}
+
+	return handler.ScanResult{}, fmt.Errorf("clamdscanner: scan failed: %s", result)
+}
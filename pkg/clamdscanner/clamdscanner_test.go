@@ -0,0 +1,95 @@
+package clamdscanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+var _ handler.VirusScanner = ClamdScanner{}
+
+// fakeClamd implements the INSTREAM command of clamd and reports all streams
+// containing the word EICAR as infected.
+func fakeClamd(t *testing.T, maxLength int) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+
+				command, err := reader.ReadString(0)
+				if err != nil || command != "zINSTREAM\x00" {
+					io.WriteString(conn, "UNKNOWN COMMAND\x00")
+					return
+				}
+
+				var data bytes.Buffer
+				for {
+					var length uint32
+					if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+						return
+					}
+					if length == 0 {
+						break
+					}
+					if _, err := io.CopyN(&data, reader, int64(length)); err != nil {
+						return
+					}
+					if data.Len() > maxLength {
+						io.WriteString(conn, "INSTREAM size limit exceeded. ERROR\x00")
+						return
+					}
+				}
+
+				if strings.Contains(data.String(), "EICAR") {
+					io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+				} else {
+					io.WriteString(conn, "stream: OK\x00")
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestScan(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	scanner := New("tcp", fakeClamd(t, 1024))
+	scanner.ChunkSize = 4
+
+	result, err := scanner.Scan(ctx, strings.NewReader("hello world"))
+	a.NoError(err)
+	a.Equal(handler.ScanResult{}, result)
+
+	result, err = scanner.Scan(ctx, strings.NewReader("hello EICAR world"))
+	a.NoError(err)
+	a.Equal(handler.ScanResult{
+		Infected:  true,
+		Signature: "Eicar-Test-Signature",
+	}, result)
+
+	_, err = scanner.Scan(ctx, strings.NewReader(strings.Repeat("a", 2048)))
+	a.Error(err)
+}
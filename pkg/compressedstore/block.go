@@ -0,0 +1,180 @@
+package compressedstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// ErrCorruptBlock is returned if a block cannot be decompressed to its recorded length.
+var ErrCorruptBlock = errors.New("compressedstore: corrupt block")
+
+// zstdEncoder and zstdDecoder are safe for concurrent use with EncodeAll and DecodeAll.
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compress appends the compressed data as a self-contained gzip member or zstd frame to dst.
+func compress(algorithm string, dst *bytes.Buffer, data []byte) error {
+	switch algorithm {
+	case AlgorithmGzip:
+		writer := gzip.NewWriter(dst)
+		if _, err := writer.Write(data); err != nil {
+			return err
+		}
+		return writer.Close()
+	case AlgorithmZstd:
+		dst.Write(zstdEncoder.EncodeAll(data, nil))
+		return nil
+	default:
+		return fmt.Errorf("compressedstore: unknown algorithm %q", algorithm)
+	}
+}
+
+// decompress returns the data of a single block, which must have the given size.
+func decompress(algorithm string, data []byte, size int64) ([]byte, error) {
+	var result []byte
+	switch algorithm {
+	case AlgorithmGzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+
+		// Read one more byte than expected to detect blocks, which are too long.
+		result, err = io.ReadAll(io.LimitReader(reader, size+1))
+		if err != nil {
+			return nil, err
+		}
+	case AlgorithmZstd:
+		var err error
+		result, err = zstdDecoder.DecodeAll(data, make([]byte, 0, size))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("compressedstore: unknown algorithm %q", algorithm)
+	}
+
+	if int64(len(result)) != size {
+		return nil, ErrCorruptBlock
+	}
+
+	return result, nil
+}
+
+// block describes a compressed block in the wrapped upload.
+type block struct {
+	// Offset is the position of the compressed block in the wrapped upload.
+	Offset int64
+	// CompressedLength is the number of bytes of the compressed block.
+	CompressedLength int64
+	// Length is the number of bytes of the uncompressed block.
+	Length int64
+}
+
+// MarshalJSON encodes the block as an array to keep the index small.
+func (b block) MarshalJSON() ([]byte, error) {
+	return json.Marshal([3]int64{b.Offset, b.CompressedLength, b.Length})
+}
+
+func (b *block) UnmarshalJSON(data []byte) error {
+	var values [3]int64
+	if err := json.Unmarshal(data, &values); err != nil {
+		return err
+	}
+
+	b.Offset, b.CompressedLength, b.Length = values[0], values[1], values[2]
+	return nil
+}
+
+// blockIndex is the state of a compressed upload, which is saved in the wrapped upload's
+// meta data.
+type blockIndex struct {
+	// Size and SizeIsDeferred describe the uncompressed upload.
+	Size           int64 `json:"size"`
+	SizeIsDeferred bool  `json:"sizeIsDeferred,omitempty"`
+	// Blocks lists the blocks in the order of their uncompressed data. The wrapped
+	// upload may contain additional data between the blocks after interrupted writes.
+	Blocks []block `json:"blocks"`
+}
+
+// length returns the number of uncompressed bytes in all blocks.
+func (index *blockIndex) length() int64 {
+	var length int64
+	for _, b := range index.Blocks {
+		length += b.Length
+	}
+	return length
+}
+
+// blockReader decompresses consecutive blocks read from the wrapped upload.
+type blockReader struct {
+	src       io.ReadCloser
+	algorithm string
+	blocks    []block
+	// position is the offset of src in the wrapped upload.
+	position int64
+	// skip is the number of bytes to skip at the beginning of the next block.
+	skip int64
+	// remaining is the number of bytes, which are still to be returned.
+	remaining int64
+	// buf holds the decompressed data, which has not been returned yet.
+	buf []byte
+}
+
+func (reader *blockReader) Read(p []byte) (int, error) {
+	for len(reader.buf) == 0 {
+		if reader.remaining <= 0 || len(reader.blocks) == 0 {
+			return 0, io.EOF
+		}
+
+		if err := reader.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, reader.buf)
+	reader.buf = reader.buf[n:]
+	reader.remaining -= int64(n)
+	return n, nil
+}
+
+// next reads and decompresses the next block.
+func (reader *blockReader) next() error {
+	b := reader.blocks[0]
+	reader.blocks = reader.blocks[1:]
+
+	// Skip data between the blocks, which remained from interrupted writes.
+	if gap := b.Offset - reader.position; gap > 0 {
+		if _, err := io.CopyN(io.Discard, reader.src, gap); err != nil {
+			return err
+		}
+	}
+
+	compressed := make([]byte, b.CompressedLength)
+	if _, err := io.ReadFull(reader.src, compressed); err != nil {
+		return err
+	}
+	reader.position = b.Offset + b.CompressedLength
+
+	data, err := decompress(reader.algorithm, compressed, b.Length)
+	if err != nil {
+		return err
+	}
+
+	data = data[min(reader.skip, int64(len(data))):]
+	reader.skip = 0
+	reader.buf = data[:min(reader.remaining, int64(len(data)))]
+	return nil
+}
+
+func (reader *blockReader) Close() error {
+	return reader.src.Close()
+}
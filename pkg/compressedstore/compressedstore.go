@@ -0,0 +1,580 @@
+// Package compressedstore provides a wrapper, which compresses the uploads' data before
+// passing it to another storage backend.
+//
+// CompressedStore wraps the data store, which has been set up in a separate composer:
+//
+//	inner := handler.NewStoreComposer()
+//	filestore.New("./uploads").UseIn(inner)
+//
+//	composer := handler.NewStoreComposer()
+//	compressedstore.New(inner).UseIn(composer)
+//	filelocker.New("./uploads").UseIn(composer)
+//
+// The data of every request is split into blocks of up to BlockSize bytes, which are
+// compressed independently using gzip or zstd. Each block is a complete gzip member or
+// zstd frame, so the stored data of an upload can also be decompressed as a whole using
+// common tools. Since every request ends a block, compression works best if clients send
+// large chunks.
+//
+// The position and lengths of all blocks are kept in a block index, which is used for
+// resuming uploads at their uncompressed offset and for reading ranges without
+// decompressing the preceding data. FileInfo.Storage cannot be changed after an upload
+// has been created, so the index is saved in the wrapped upload's FileInfo.State, from
+// which it is hidden in GetInfo. Therefore, the wrapped data store must implement
+// handler.StateUpdaterDataStore. Otherwise, all uploads are stored without compression.
+//
+// Uploads whose filetype meta data entry matches UncompressedTypes, for example images
+// and videos, are stored without compression, because their content usually does not
+// shrink further.
+//
+// Since the wrapped data store only holds compressed data, its content server is never used.
+// Instead, the handler serves downloads, including range requests, using the decompressed
+// data from GetReader and GetRangeReader. The wrapped data store must preserve the entries
+// in FileInfo.Storage passed to NewUpload, as all data stores in tusd do.
+package compressedstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"strings"
+	"time"
+
+	"github.com/tus/tusd/v2/internal/storageinfo"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+const (
+	// AlgorithmGzip compresses blocks using gzip.
+	AlgorithmGzip = "gzip"
+	// AlgorithmZstd compresses blocks using Zstandard.
+	AlgorithmZstd = "zstd"
+)
+
+// StorageKeyAlgorithm is the key of the compression algorithm in handler.FileInfo.Storage.
+// It is missing for uploads, which are stored without compression.
+const StorageKeyAlgorithm = "CompressionAlgorithm"
+
+// StateKeyIndex is the key of the JSON-encoded block index in handler.UploadState.Storage.
+const StateKeyIndex = "CompressionIndex"
+
+// DefaultBlockSize is the default maximum number of uncompressed bytes per block.
+const DefaultBlockSize = 1024 * 1024
+
+// DefaultUncompressedTypes lists file types, whose content usually is compressed already.
+var DefaultUncompressedTypes = []string{
+	"image/",
+	"video/",
+	"audio/",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-7z-compressed",
+	"application/x-bzip2",
+	"application/x-rar-compressed",
+	"application/x-xz",
+}
+
+// See the handler.DataStore interface for documentation about the different
+// methods.
+type CompressedStore struct {
+	// Algorithm is used for compressing new uploads. Existing uploads are read using
+	// the algorithm they have been written with.
+	Algorithm string
+	// BlockSize is the maximum number of uncompressed bytes, which are compressed
+	// together. Smaller blocks allow reading ranges more efficiently, while larger
+	// blocks compress better.
+	BlockSize int64
+	// UncompressedTypes lists file types, which are stored without compression. The
+	// file type is taken from the filetype meta data entry. Entries ending with a slash,
+	// such as "image/", match all subtypes.
+	UncompressedTypes []string
+
+	inner *handler.StoreComposer
+}
+
+// New creates a new store, which compresses the data before passing it to the data store
+// and extensions configured in the inner composer.
+func New(inner *handler.StoreComposer) *CompressedStore {
+	return &CompressedStore{
+		Algorithm:         AlgorithmZstd,
+		BlockSize:         DefaultBlockSize,
+		UncompressedTypes: DefaultUncompressedTypes,
+		inner:             inner,
+	}
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// all extensions, which are supported by the wrapped data store.
+func (store *CompressedStore) UseIn(composer *handler.StoreComposer) {
+	composer.UseCore(store)
+	composer.UseConcater(store)
+	composer.UseRangeReader(store)
+	if store.inner.UsesTerminater {
+		composer.UseTerminater(store)
+	}
+	if store.inner.UsesLengthDeferrer {
+		composer.UseLengthDeferrer(store)
+	}
+	if store.inner.UsesMetadataUpdater {
+		composer.UseMetadataUpdater(store)
+	}
+	if store.inner.UsesStateUpdater {
+		composer.UseStateUpdater(store)
+	}
+}
+
+// algorithmFor returns the algorithm for compressing a new upload, or an empty string
+// if the upload is stored without compression.
+func (store *CompressedStore) algorithmFor(info handler.FileInfo) string {
+	if !store.inner.UsesStateUpdater {
+		return ""
+	}
+
+	fileType, _, _ := strings.Cut(info.MetaData["filetype"], ";")
+	fileType = strings.ToLower(strings.TrimSpace(fileType))
+	for _, uncompressedType := range store.UncompressedTypes {
+		if fileType == uncompressedType || (strings.HasSuffix(uncompressedType, "/") && strings.HasPrefix(fileType, uncompressedType)) {
+			return ""
+		}
+	}
+
+	return store.Algorithm
+}
+
+func (store *CompressedStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	algorithm := store.algorithmFor(info)
+	if algorithm == "" {
+		upload, err := store.inner.Core.NewUpload(ctx, info)
+		if err != nil {
+			return nil, err
+		}
+
+		return &compressedUpload{
+			store:  store,
+			upload: upload,
+		}, nil
+	}
+
+	if algorithm != AlgorithmGzip && algorithm != AlgorithmZstd {
+		return nil, fmt.Errorf("compressedstore: unknown algorithm %q", algorithm)
+	}
+
+	index := &blockIndex{
+		Size:           info.Size,
+		SizeIsDeferred: info.SizeIsDeferred,
+	}
+
+	info.Storage = storageinfo.Clone(info.Storage)
+	info.Storage[StorageKeyAlgorithm] = algorithm
+
+	// The compressed size is only known once the upload is finished.
+	if store.inner.UsesLengthDeferrer {
+		info.Size = 0
+		info.SizeIsDeferred = true
+	}
+
+	upload, err := store.inner.Core.NewUpload(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	compressed := &compressedUpload{
+		store:     store,
+		upload:    upload,
+		algorithm: algorithm,
+		index:     index,
+	}
+	if err := compressed.saveIndex(ctx, nil); err != nil {
+		return nil, err
+	}
+
+	return compressed, nil
+}
+
+func (store *CompressedStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	upload, err := store.inner.Core.GetUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &compressedUpload{
+		store:  store,
+		upload: upload,
+	}, nil
+}
+
+func (store *CompressedStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
+	return upload.(*compressedUpload)
+}
+
+func (store *CompressedStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
+	return upload.(*compressedUpload)
+}
+
+func (store *CompressedStore) AsConcatableUpload(upload handler.Upload) handler.ConcatableUpload {
+	return upload.(*compressedUpload)
+}
+
+func (store *CompressedStore) AsRangeReadableUpload(upload handler.Upload) handler.RangeReadableUpload {
+	return upload.(*compressedUpload)
+}
+
+func (store *CompressedStore) AsMetadataUpdatableUpload(upload handler.Upload) handler.MetadataUpdatableUpload {
+	return upload.(*compressedUpload)
+}
+
+func (store *CompressedStore) AsStateUpdatableUpload(upload handler.Upload) handler.StateUpdatableUpload {
+	return upload.(*compressedUpload)
+}
+
+type compressedUpload struct {
+	store  *CompressedStore
+	upload handler.Upload
+
+	// algorithm and index are obtained from the upload's Storage and State once it
+	// has been fetched. The algorithm is empty for uploads stored without compression.
+	algorithm string
+	index     *blockIndex
+}
+
+// getInfo fetches the information from the wrapped upload, whose size and offset refer
+// to the compressed data. If not done yet, the upload's block index is loaded.
+func (upload *compressedUpload) getInfo(ctx context.Context) (handler.FileInfo, error) {
+	info, err := upload.upload.GetInfo(ctx)
+	if err != nil {
+		return info, err
+	}
+
+	if upload.index != nil {
+		return info, nil
+	}
+
+	upload.algorithm = info.Storage[StorageKeyAlgorithm]
+	if upload.algorithm == "" {
+		return info, nil
+	}
+
+	var encodedIndex string
+	if info.State != nil {
+		encodedIndex = info.State.Storage[StateKeyIndex]
+	}
+
+	var index blockIndex
+	if err := json.Unmarshal([]byte(encodedIndex), &index); err != nil {
+		return info, fmt.Errorf("compressedstore: invalid block index for upload %s: %w", info.ID, err)
+	}
+
+	upload.index = &index
+	return info, nil
+}
+
+// saveIndex stores the block index in the wrapped upload's state. The remaining entries
+// of the wrapped upload's current state are preserved.
+func (upload *compressedUpload) saveIndex(ctx context.Context, current *handler.UploadState) error {
+	encodedIndex, err := json.Marshal(upload.index)
+	if err != nil {
+		return err
+	}
+
+	var state handler.UploadState
+	if current != nil {
+		state = *current
+	}
+	state.Storage = storageinfo.Clone(state.Storage)
+	state.Storage[StateKeyIndex] = string(encodedIndex)
+
+	return upload.store.inner.StateUpdater.AsStateUpdatableUpload(upload.upload).UpdateState(ctx, state)
+}
+
+func (upload *compressedUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
+	info, err := upload.getInfo(ctx)
+	if err != nil || upload.algorithm == "" {
+		return info, err
+	}
+
+	info.Size = upload.index.Size
+	info.SizeIsDeferred = upload.index.SizeIsDeferred
+	info.Offset = upload.index.length()
+
+	// The block index is an implementation detail and not exposed, e.g. to hooks.
+	if info.State != nil {
+		state := *info.State
+		state.Storage = maps.Clone(state.Storage)
+		delete(state.Storage, StateKeyIndex)
+		if len(state.Storage) == 0 {
+			state.Storage = nil
+		}
+		info.State = &state
+	}
+	return info, nil
+}
+
+// WriteChunk compresses the data block by block. Each block is added to the index once it
+// has been written completely, so that data from interrupted writes is never read.
+func (upload *compressedUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	info, err := upload.getInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	if upload.algorithm == "" {
+		return upload.upload.WriteChunk(ctx, offset, src)
+	}
+
+	if length := upload.index.length(); offset != length {
+		return 0, fmt.Errorf("compressedstore: offset %d of upload %s does not match the stored length %d", offset, info.ID, length)
+	}
+
+	blockSize := upload.store.BlockSize
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+
+	buf := make([]byte, blockSize)
+	var compressed bytes.Buffer
+	position := info.Offset
+	var n int64
+	for {
+		read, readErr := io.ReadFull(src, buf)
+		if read > 0 {
+			compressed.Reset()
+			if err = compress(upload.algorithm, &compressed, buf[:read]); err != nil {
+				break
+			}
+
+			var written int64
+			written, err = upload.upload.WriteChunk(ctx, position, bytes.NewReader(compressed.Bytes()))
+			position += written
+			if err == nil && written != int64(compressed.Len()) {
+				err = io.ErrShortWrite
+			}
+			if err != nil {
+				break
+			}
+
+			upload.index.Blocks = append(upload.index.Blocks, block{
+				Offset:           position - written,
+				CompressedLength: written,
+				Length:           int64(read),
+			})
+			n += int64(read)
+		}
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			break
+		}
+		if readErr != nil {
+			err = readErr
+			break
+		}
+	}
+
+	if n > 0 {
+		if saveErr := upload.saveIndex(ctx, info.State); saveErr != nil {
+			return 0, saveErr
+		}
+	}
+
+	return n, err
+}
+
+func (upload *compressedUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	if _, err := upload.getInfo(ctx); err != nil {
+		return nil, err
+	}
+
+	if upload.algorithm == "" {
+		return upload.upload.GetReader(ctx)
+	}
+
+	return upload.GetRangeReader(ctx, 0, upload.index.length())
+}
+
+// GetRangeReader uses the block index to only read and decompress the blocks, which
+// overlap with the requested range.
+func (upload *compressedUpload) GetRangeReader(ctx context.Context, offset int64, length int64) (io.ReadCloser, error) {
+	if _, err := upload.getInfo(ctx); err != nil {
+		return nil, err
+	}
+
+	if upload.algorithm == "" {
+		return upload.getInnerRangeReader(ctx, offset, length)
+	}
+
+	// Find the blocks overlapping with the range.
+	blocks := upload.index.Blocks
+	var start int64
+	for len(blocks) > 0 && start+blocks[0].Length <= offset {
+		start += blocks[0].Length
+		blocks = blocks[1:]
+	}
+
+	length = max(min(length, upload.index.length()-offset), 0)
+	if len(blocks) == 0 || length == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+
+	end := start
+	for i, b := range blocks {
+		end += b.Length
+		if end >= offset+length {
+			blocks = blocks[:i+1]
+			break
+		}
+	}
+
+	first, last := blocks[0], blocks[len(blocks)-1]
+	src, err := upload.getInnerRangeReader(ctx, first.Offset, last.Offset+last.CompressedLength-first.Offset)
+	if err != nil {
+		return nil, err
+	}
+
+	return &blockReader{
+		src:       src,
+		algorithm: upload.algorithm,
+		blocks:    blocks,
+		position:  first.Offset,
+		skip:      offset - start,
+		remaining: length,
+	}, nil
+}
+
+// getInnerRangeReader reads the range from the wrapped upload. If the wrapped data store
+// cannot read ranges, the data preceding the range is skipped.
+func (upload *compressedUpload) getInnerRangeReader(ctx context.Context, offset int64, length int64) (io.ReadCloser, error) {
+	if upload.store.inner.UsesRangeReader {
+		return upload.store.inner.RangeReader.AsRangeReadableUpload(upload.upload).GetRangeReader(ctx, offset, length)
+	}
+
+	src, err := upload.upload.GetReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.CopyN(io.Discard, src, offset); err != nil {
+		src.Close()
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(src, length), src}, nil
+}
+
+func (upload *compressedUpload) ModTime(ctx context.Context) (time.Time, error) {
+	if !upload.store.inner.UsesRangeReader {
+		return time.Time{}, nil
+	}
+
+	return upload.store.inner.RangeReader.AsRangeReadableUpload(upload.upload).ModTime(ctx)
+}
+
+// FinishUpload declares the compressed size to the wrapped data store, which is only
+// known once all data has been written.
+func (upload *compressedUpload) FinishUpload(ctx context.Context) error {
+	info, err := upload.getInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	if upload.algorithm != "" && info.SizeIsDeferred && upload.store.inner.UsesLengthDeferrer {
+		err := upload.store.inner.LengthDeferrer.AsLengthDeclarableUpload(upload.upload).DeclareLength(ctx, info.Offset)
+		if err != nil {
+			return err
+		}
+
+		// A write without data lets the wrapped data store process data, which it buffered
+		// while the size was unknown, such as the incomplete part in s3store.
+		if _, err := upload.upload.WriteChunk(ctx, info.Offset, bytes.NewReader(nil)); err != nil {
+			return err
+		}
+	}
+
+	return upload.upload.FinishUpload(ctx)
+}
+
+func (upload *compressedUpload) Terminate(ctx context.Context) error {
+	return upload.store.inner.Terminater.AsTerminatableUpload(upload.upload).Terminate(ctx)
+}
+
+func (upload *compressedUpload) DeclareLength(ctx context.Context, length int64) error {
+	info, err := upload.getInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	if upload.algorithm == "" {
+		return upload.store.inner.LengthDeferrer.AsLengthDeclarableUpload(upload.upload).DeclareLength(ctx, length)
+	}
+
+	upload.index.Size = length
+	upload.index.SizeIsDeferred = false
+	return upload.saveIndex(ctx, info.State)
+}
+
+// ConcatUploads uses the wrapped data store's concatenation if no upload is compressed.
+// Otherwise, the partial uploads are decompressed and their data is written to the final
+// upload.
+func (upload *compressedUpload) ConcatUploads(ctx context.Context, partialUploads []handler.Upload) error {
+	if _, err := upload.getInfo(ctx); err != nil {
+		return err
+	}
+
+	innerUploads := make([]handler.Upload, 0, len(partialUploads))
+	for _, partialUpload := range partialUploads {
+		partial := partialUpload.(*compressedUpload)
+		if _, err := partial.getInfo(ctx); err != nil {
+			return err
+		}
+
+		if partial.algorithm == "" {
+			innerUploads = append(innerUploads, partial.upload)
+		}
+	}
+
+	if upload.algorithm == "" && upload.store.inner.UsesConcater && len(innerUploads) == len(partialUploads) {
+		return upload.store.inner.Concater.AsConcatableUpload(upload.upload).ConcatUploads(ctx, innerUploads)
+	}
+
+	readers := make([]io.Reader, 0, len(partialUploads))
+	for _, partialUpload := range partialUploads {
+		reader, err := partialUpload.GetReader(ctx)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		readers = append(readers, reader)
+	}
+
+	if _, err := upload.WriteChunk(ctx, 0, io.MultiReader(readers...)); err != nil {
+		return err
+	}
+
+	// The handler does not finish concatenated uploads, so the wrapped data store
+	// must be informed here that all data has been written.
+	return upload.FinishUpload(ctx)
+}
+
+func (upload *compressedUpload) UpdateMetaData(ctx context.Context, metaData handler.MetaData) error {
+	return upload.store.inner.MetadataUpdater.AsMetadataUpdatableUpload(upload.upload).UpdateMetaData(ctx, metaData)
+}
+
+func (upload *compressedUpload) UpdateState(ctx context.Context, state handler.UploadState) error {
+	if _, err := upload.getInfo(ctx); err != nil {
+		return err
+	}
+
+	if upload.algorithm == "" {
+		return upload.store.inner.StateUpdater.AsStateUpdatableUpload(upload.upload).UpdateState(ctx, state)
+	}
+
+	// The block index is hidden from the caller and must be preserved.
+	return upload.saveIndex(ctx, &state)
+}
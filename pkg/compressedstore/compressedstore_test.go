@@ -0,0 +1,360 @@
+package compressedstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/memorylocker"
+	"github.com/tus/tusd/v2/pkg/memorystore"
+)
+
+// Test interface implementations
+var _ handler.DataStore = &CompressedStore{}
+var _ handler.TerminaterDataStore = &CompressedStore{}
+var _ handler.ConcaterDataStore = &CompressedStore{}
+var _ handler.LengthDeferrerDataStore = &CompressedStore{}
+var _ handler.RangeReaderDataStore = &CompressedStore{}
+var _ handler.MetadataUpdaterDataStore = &CompressedStore{}
+var _ handler.StateUpdaterDataStore = &CompressedStore{}
+
+func newStore(algorithm string) (*CompressedStore, *memorystore.MemoryStore) {
+	inner := handler.NewStoreComposer()
+	memory := memorystore.New()
+	memory.UseIn(inner)
+
+	store := New(inner)
+	store.Algorithm = algorithm
+	store.BlockSize = 4
+	return store, memory
+}
+
+func readAll(t *testing.T, reader io.ReadCloser, err error) string {
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func TestCompressedStore(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmGzip, AlgorithmZstd} {
+		t.Run(algorithm, func(t *testing.T) {
+			a := assert.New(t)
+			ctx := context.Background()
+			store, memory := newStore(algorithm)
+
+			upload, err := store.NewUpload(ctx, handler.FileInfo{
+				ID:       "abc",
+				Size:     11,
+				MetaData: handler.MetaData{"foo": "bar"},
+			})
+			a.NoError(err)
+
+			info, err := upload.GetInfo(ctx)
+			a.NoError(err)
+			a.EqualValues(11, info.Size)
+			a.EqualValues(0, info.Offset)
+			a.False(info.SizeIsDeferred)
+			a.Equal(handler.MetaData{"foo": "bar"}, info.MetaData)
+			a.Equal(algorithm, info.Storage[StorageKeyAlgorithm])
+			a.Equal("memorystore", info.Storage["Type"])
+
+			n, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello"))
+			a.NoError(err)
+			a.EqualValues(5, n)
+
+			// Uploads resume at their uncompressed offset.
+			upload, err = store.GetUpload(ctx, "abc")
+			a.NoError(err)
+
+			info, err = upload.GetInfo(ctx)
+			a.NoError(err)
+			a.EqualValues(5, info.Offset)
+
+			n, err = upload.WriteChunk(ctx, 5, strings.NewReader(" world"))
+			a.NoError(err)
+			a.EqualValues(6, n)
+
+			a.NoError(upload.FinishUpload(ctx))
+
+			// The wrapped store only holds the compressed data.
+			innerUpload, err := memory.GetUpload(ctx, "abc")
+			a.NoError(err)
+			innerInfo, err := innerUpload.GetInfo(ctx)
+			a.NoError(err)
+			a.False(innerInfo.SizeIsDeferred)
+			a.Equal(innerInfo.Size, innerInfo.Offset)
+			a.Equal(handler.MetaData{"foo": "bar"}, innerInfo.MetaData)
+			a.Contains(innerInfo.State.Storage, StateKeyIndex)
+
+			innerReader, err := innerUpload.GetReader(ctx)
+			a.NotContains(readAll(t, innerReader, err), "hello")
+
+			upload, err = store.GetUpload(ctx, "abc")
+			a.NoError(err)
+
+			info, err = upload.GetInfo(ctx)
+			a.NoError(err)
+			a.EqualValues(11, info.Size)
+			a.EqualValues(11, info.Offset)
+
+			reader, err := upload.GetReader(ctx)
+			a.Equal("hello world", readAll(t, reader, err))
+
+			// Updating the meta data and state keeps the block index.
+			err = store.AsMetadataUpdatableUpload(upload).UpdateMetaData(ctx, handler.MetaData{"foo": "baz"})
+			a.NoError(err)
+			err = store.AsStateUpdatableUpload(upload).UpdateState(ctx, handler.UploadState{ContentType: "text/plain"})
+			a.NoError(err)
+
+			upload, err = store.GetUpload(ctx, "abc")
+			a.NoError(err)
+			info, err = upload.GetInfo(ctx)
+			a.NoError(err)
+			a.Equal(handler.MetaData{"foo": "baz"}, info.MetaData)
+			a.Equal(&handler.UploadState{ContentType: "text/plain"}, info.State)
+
+			reader, err = upload.GetReader(ctx)
+			a.Equal("hello world", readAll(t, reader, err))
+
+			err = store.AsTerminatableUpload(upload).Terminate(ctx)
+			a.NoError(err)
+
+			_, err = store.GetUpload(ctx, "abc")
+			a.Equal(handler.ErrNotFound, err)
+		})
+	}
+}
+
+func TestGetRangeReader(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _ := newStore(AlgorithmZstd)
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size: 11,
+	})
+	a.NoError(err)
+
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.NoError(err)
+
+	rangeReader := store.AsRangeReadableUpload(upload)
+	for _, test := range []struct {
+		offset   int64
+		length   int64
+		expected string
+	}{
+		{0, 11, "hello world"},
+		{0, 3, "hel"},
+		{3, 3, "lo "},
+		{4, 4, "o wo"},
+		{6, 5, "world"},
+		{10, 1, "d"},
+		{6, 100, "world"},
+		{11, 1, ""},
+	} {
+		reader, err := rangeReader.GetRangeReader(ctx, test.offset, test.length)
+		a.Equal(test.expected, readAll(t, reader, err))
+	}
+}
+
+func TestUncompressedTypes(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, memory := newStore(AlgorithmGzip)
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		ID:       "abc",
+		Size:     11,
+		MetaData: handler.MetaData{"filetype": "image/png"},
+	})
+	a.NoError(err)
+
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.NotContains(info.Storage, StorageKeyAlgorithm)
+
+	innerUpload, err := memory.GetUpload(ctx, "abc")
+	a.NoError(err)
+	innerReader, err := innerUpload.GetReader(ctx)
+	a.Equal("hello world", readAll(t, innerReader, err))
+
+	reader, err := store.AsRangeReadableUpload(upload).GetRangeReader(ctx, 6, 5)
+	a.Equal("world", readAll(t, reader, err))
+}
+
+func TestDeclareLength(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _ := newStore(AlgorithmZstd)
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		SizeIsDeferred: true,
+	})
+	a.NoError(err)
+
+	n, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello "))
+	a.NoError(err)
+	a.EqualValues(6, n)
+
+	err = store.AsLengthDeclarableUpload(upload).DeclareLength(ctx, 11)
+	a.NoError(err)
+
+	n, err = upload.WriteChunk(ctx, 6, strings.NewReader("world"))
+	a.NoError(err)
+	a.EqualValues(5, n)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.False(info.SizeIsDeferred)
+	a.EqualValues(11, info.Size)
+	a.EqualValues(11, info.Offset)
+
+	a.NoError(upload.FinishUpload(ctx))
+
+	reader, err := upload.GetReader(ctx)
+	a.Equal("hello world", readAll(t, reader, err))
+}
+
+func TestConcatUploads(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _ := newStore(AlgorithmGzip)
+
+	var partialUploads []handler.Upload
+	for _, content := range []string{"abcde", "fgh", "ij"} {
+		upload, err := store.NewUpload(ctx, handler.FileInfo{
+			Size:      int64(len(content)),
+			IsPartial: true,
+		})
+		a.NoError(err)
+
+		_, err = upload.WriteChunk(ctx, 0, strings.NewReader(content))
+		a.NoError(err)
+
+		partialUploads = append(partialUploads, upload)
+	}
+
+	finalUpload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size:    10,
+		IsFinal: true,
+	})
+	a.NoError(err)
+
+	err = store.AsConcatableUpload(finalUpload).ConcatUploads(ctx, partialUploads)
+	a.NoError(err)
+
+	info, err := finalUpload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(10, info.Offset)
+
+	reader, err := finalUpload.GetReader(ctx)
+	a.Equal("abcdefghij", readAll(t, reader, err))
+}
+
+func TestBlockReaderGaps(t *testing.T) {
+	a := assert.New(t)
+
+	var data bytes.Buffer
+	var blocks []block
+	for _, content := range []string{"hell", "o wo", "rld"} {
+		// Data from an interrupted write precedes each block.
+		data.WriteString("garbage")
+
+		var compressed bytes.Buffer
+		a.NoError(compress(AlgorithmZstd, &compressed, []byte(content)))
+
+		blocks = append(blocks, block{
+			Offset:           int64(data.Len()),
+			CompressedLength: int64(compressed.Len()),
+			Length:           int64(len(content)),
+		})
+		data.Write(compressed.Bytes())
+	}
+
+	reader := &blockReader{
+		src:       io.NopCloser(bytes.NewReader(data.Bytes())),
+		algorithm: AlgorithmZstd,
+		blocks:    blocks,
+		skip:      2,
+		remaining: 8,
+	}
+	a.Equal("llo worl", readAll(t, reader, nil))
+
+	// Blocks, which do not decompress to their recorded length, are rejected.
+	blocks[0].Length = 5
+	reader = &blockReader{
+		src:       io.NopCloser(bytes.NewReader(data.Bytes())),
+		algorithm: AlgorithmZstd,
+		blocks:    blocks,
+		remaining: 11,
+	}
+	_, err := io.ReadAll(reader)
+	a.Equal(ErrCorruptBlock, err)
+}
+
+func TestHandler(t *testing.T) {
+	a := assert.New(t)
+
+	inner := handler.NewStoreComposer()
+	memorystore.New().UseIn(inner)
+
+	composer := handler.NewStoreComposer()
+	store := New(inner)
+	store.BlockSize = 4
+	store.UseIn(composer)
+	memorylocker.New().UseIn(composer)
+
+	tusHandler, err := handler.NewHandler(handler.Config{
+		BasePath:      "/files/",
+		StoreComposer: composer,
+	})
+	a.NoError(err)
+
+	server := httptest.NewServer(http.StripPrefix("/files/", tusHandler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL+"/files/", strings.NewReader("hello"))
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Upload-Length", "11")
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	res, err := http.DefaultClient.Do(req)
+	a.NoError(err)
+	res.Body.Close()
+	a.Equal(http.StatusCreated, res.StatusCode)
+	a.Equal("5", res.Header.Get("Upload-Offset"))
+
+	location := res.Header.Get("Location")
+
+	req, _ = http.NewRequest("PATCH", location, strings.NewReader(" world"))
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Upload-Offset", "5")
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	res, err = http.DefaultClient.Do(req)
+	a.NoError(err)
+	res.Body.Close()
+	a.Equal(http.StatusNoContent, res.StatusCode)
+	a.Equal("11", res.Header.Get("Upload-Offset"))
+
+	req, _ = http.NewRequest("GET", location, nil)
+	req.Header.Set("Range", "bytes=3-7")
+	res, err = http.DefaultClient.Do(req)
+	a.NoError(err)
+	content, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	a.NoError(err)
+	a.Equal(http.StatusPartialContent, res.StatusCode)
+	a.Equal("lo wo", string(content))
+}
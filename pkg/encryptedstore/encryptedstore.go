@@ -0,0 +1,560 @@
+// Package encryptedstore provides a wrapper, which encrypts the uploads' data of another
+// storage backend at rest.
+//
+// EncryptedStore wraps the data store, which has been set up in a separate composer, and
+// encrypts all data before passing it on. Every upload receives its own random data key,
+// which is wrapped using a KeyProvider and saved in the upload's FileInfo.Storage:
+//
+//	inner := handler.NewStoreComposer()
+//	filestore.New("./uploads").UseIn(inner)
+//
+//	keys := encryptedstore.NewKeyRing()
+//	keys.AddKey("2024-01", key)
+//
+//	composer := handler.NewStoreComposer()
+//	encryptedstore.New(inner, keys).UseIn(composer)
+//	filelocker.New("./uploads").UseIn(composer)
+//
+// The data is split into segments, which are encrypted separately using AES-256-GCM. Only
+// complete segments are passed to the wrapped data store. If a request ends in the middle
+// of a segment, the incomplete segment is encrypted and saved in the upload's
+// FileInfo.State using the wrapped data store's StateUpdaterDataStore implementation. The
+// next request completes the segment and passes it on. If the length of the upload was
+// deferred, the saved segment is passed on once the upload is finished. If the wrapped data
+// store does not implement StateUpdaterDataStore, the incomplete segment is discarded
+// instead and the client resumes the upload at the segment's beginning, so clients must
+// send at least SegmentSize bytes per request.
+//
+// Since the wrapped data store only holds encrypted data, its content server is never used.
+// Instead, the handler serves downloads, including range requests, using the decrypted data
+// from GetReader and GetRangeReader. The wrapped data store must preserve the entries in
+// FileInfo.Storage passed to NewUpload, as all data stores in tusd do.
+package encryptedstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"maps"
+	"strconv"
+	"time"
+
+	"github.com/tus/tusd/v2/internal/storageinfo"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+const (
+	// StorageKeyKeyID is the key of the ID of the key encryption key in handler.FileInfo.Storage.
+	StorageKeyKeyID = "EncryptionKeyID"
+	// StorageKeyWrappedKey is the key of the base64-encoded, wrapped data key in handler.FileInfo.Storage.
+	StorageKeyWrappedKey = "EncryptionWrappedKey"
+	// StorageKeySegmentSize is the key of the segment size in handler.FileInfo.Storage.
+	StorageKeySegmentSize = "EncryptionSegmentSize"
+
+	// StateKeyTail is the key of the base64-encoded, encrypted incomplete segment in
+	// handler.UploadState.Storage.
+	StateKeyTail = "EncryptionTail"
+	// StateKeyTailIndex is the key of the incomplete segment's index in handler.UploadState.Storage.
+	StateKeyTailIndex = "EncryptionTailIndex"
+)
+
+// DefaultSegmentSize is the default number of plaintext bytes per encrypted segment.
+const DefaultSegmentSize = 64 * 1024
+
+// See the handler.DataStore interface for documentation about the different
+// methods.
+type EncryptedStore struct {
+	// SegmentSize is the number of plaintext bytes, which are encrypted together. Each
+	// segment adds 16 bytes for the authentication tag to the stored data. Changing the
+	// segment size only affects new uploads.
+	SegmentSize int64
+
+	inner *handler.StoreComposer
+	keys  KeyProvider
+}
+
+// New creates a new store, which encrypts the data before passing it to the data store
+// and extensions configured in the inner composer. The data keys are wrapped using keys.
+func New(inner *handler.StoreComposer, keys KeyProvider) *EncryptedStore {
+	return &EncryptedStore{
+		SegmentSize: DefaultSegmentSize,
+		inner:       inner,
+		keys:        keys,
+	}
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// all extensions, which are supported by the wrapped data store.
+func (store *EncryptedStore) UseIn(composer *handler.StoreComposer) {
+	composer.UseCore(store)
+	composer.UseConcater(store)
+	composer.UseRangeReader(store)
+	if store.inner.UsesTerminater {
+		composer.UseTerminater(store)
+	}
+	if store.inner.UsesLengthDeferrer {
+		composer.UseLengthDeferrer(store)
+	}
+	if store.inner.UsesMetadataUpdater {
+		composer.UseMetadataUpdater(store)
+	}
+	if store.inner.UsesStateUpdater {
+		composer.UseStateUpdater(store)
+	}
+}
+
+func (store *EncryptedStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, wrappedKey, err := store.keys.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("encryptedstore: unable to wrap data key: %w", err)
+	}
+
+	segmentSize := store.SegmentSize
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+
+	info.Storage = storageinfo.Clone(info.Storage)
+	info.Storage[StorageKeyKeyID] = keyID
+	info.Storage[StorageKeyWrappedKey] = base64.StdEncoding.EncodeToString(wrappedKey)
+	info.Storage[StorageKeySegmentSize] = strconv.FormatInt(segmentSize, 10)
+
+	if !info.SizeIsDeferred {
+		info.Size = encryptedLength(info.Size, segmentSize)
+	}
+
+	upload, err := store.inner.Core.NewUpload(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptedUpload{
+		store:       store,
+		upload:      upload,
+		aead:        aead,
+		segmentSize: segmentSize,
+	}, nil
+}
+
+func (store *EncryptedStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	upload, err := store.inner.Core.GetUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &encryptedUpload{
+		store:  store,
+		upload: upload,
+	}, nil
+}
+
+func (store *EncryptedStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
+	return upload.(*encryptedUpload)
+}
+
+func (store *EncryptedStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
+	return upload.(*encryptedUpload)
+}
+
+func (store *EncryptedStore) AsConcatableUpload(upload handler.Upload) handler.ConcatableUpload {
+	return upload.(*encryptedUpload)
+}
+
+func (store *EncryptedStore) AsRangeReadableUpload(upload handler.Upload) handler.RangeReadableUpload {
+	return upload.(*encryptedUpload)
+}
+
+func (store *EncryptedStore) AsMetadataUpdatableUpload(upload handler.Upload) handler.MetadataUpdatableUpload {
+	return upload.(*encryptedUpload)
+}
+
+func (store *EncryptedStore) AsStateUpdatableUpload(upload handler.Upload) handler.StateUpdatableUpload {
+	return upload.(*encryptedUpload)
+}
+
+type encryptedUpload struct {
+	store  *EncryptedStore
+	upload handler.Upload
+
+	// aead and segmentSize are obtained from the upload's Storage once it has been fetched.
+	aead        cipher.AEAD
+	segmentSize int64
+}
+
+// getInfo fetches the information from the wrapped upload, whose size and offset
+// refer to the encrypted data. If not done yet, the upload's data key is unwrapped.
+func (upload *encryptedUpload) getInfo(ctx context.Context) (handler.FileInfo, error) {
+	info, err := upload.upload.GetInfo(ctx)
+	if err != nil {
+		return info, err
+	}
+
+	if upload.aead != nil {
+		return info, nil
+	}
+
+	keyID, ok := info.Storage[StorageKeyKeyID]
+	if !ok {
+		return info, fmt.Errorf("encryptedstore: upload %s has no encryption key", info.ID)
+	}
+
+	wrappedKey, err := base64.StdEncoding.DecodeString(info.Storage[StorageKeyWrappedKey])
+	if err != nil {
+		return info, fmt.Errorf("encryptedstore: invalid wrapped key for upload %s: %w", info.ID, err)
+	}
+
+	segmentSize, err := strconv.ParseInt(info.Storage[StorageKeySegmentSize], 10, 64)
+	if err != nil || segmentSize <= 0 {
+		return info, fmt.Errorf("encryptedstore: invalid segment size for upload %s", info.ID)
+	}
+
+	dataKey, err := upload.store.keys.UnwrapKey(ctx, keyID, wrappedKey)
+	if err != nil {
+		return info, err
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return info, err
+	}
+
+	upload.aead = aead
+	upload.segmentSize = segmentSize
+	return info, nil
+}
+
+// getTail returns the plaintext of the incomplete segment saved in the wrapped upload's
+// state, if any.
+func (upload *encryptedUpload) getTail(info handler.FileInfo) ([]byte, error) {
+	if info.State == nil || info.State.Storage[StateKeyTail] == "" {
+		return nil, nil
+	}
+
+	index, err := strconv.ParseInt(info.State.Storage[StateKeyTailIndex], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("encryptedstore: invalid tail index for upload %s", info.ID)
+	}
+
+	// If the wrapped data store received the segment, but saving the state failed
+	// afterwards, the saved tail belongs to an earlier segment and is ignored.
+	if index != decryptedLength(info.Offset, upload.segmentSize)/upload.segmentSize {
+		return nil, nil
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(info.State.Storage[StateKeyTail])
+	if err != nil {
+		return nil, fmt.Errorf("encryptedstore: invalid tail for upload %s: %w", info.ID, err)
+	}
+
+	return openTail(upload.aead, index, sealed)
+}
+
+// saveTail replaces the incomplete segment in the wrapped upload's state. info is the
+// wrapped upload's information, whose remaining state is preserved.
+func (upload *encryptedUpload) saveTail(ctx context.Context, info handler.FileInfo, index int64, tail []byte) error {
+	var state handler.UploadState
+	if info.State != nil {
+		state = *info.State
+	}
+
+	state.Storage = maps.Clone(state.Storage)
+	delete(state.Storage, StateKeyTail)
+	delete(state.Storage, StateKeyTailIndex)
+	if len(tail) > 0 {
+		sealed, err := sealTail(upload.aead, index, tail)
+		if err != nil {
+			return err
+		}
+
+		if state.Storage == nil {
+			state.Storage = make(map[string]string)
+		}
+		state.Storage[StateKeyTail] = base64.StdEncoding.EncodeToString(sealed)
+		state.Storage[StateKeyTailIndex] = strconv.FormatInt(index, 10)
+	}
+	if len(state.Storage) == 0 {
+		state.Storage = nil
+	}
+
+	return upload.store.inner.StateUpdater.AsStateUpdatableUpload(upload.upload).UpdateState(ctx, state)
+}
+
+func (upload *encryptedUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
+	info, err := upload.getInfo(ctx)
+	if err != nil {
+		return info, err
+	}
+
+	tail, err := upload.getTail(info)
+	if err != nil {
+		return info, err
+	}
+
+	if !info.SizeIsDeferred {
+		info.Size = decryptedLength(info.Size, upload.segmentSize)
+	}
+	info.Offset = decryptedLength(info.Offset, upload.segmentSize) + int64(len(tail))
+
+	// The incomplete segment is an implementation detail and not exposed, e.g. to hooks.
+	if info.State != nil && info.State.Storage != nil {
+		state := *info.State
+		state.Storage = maps.Clone(state.Storage)
+		delete(state.Storage, StateKeyTail)
+		delete(state.Storage, StateKeyTailIndex)
+		if len(state.Storage) == 0 {
+			state.Storage = nil
+		}
+		info.State = &state
+	}
+	return info, nil
+}
+
+func (upload *encryptedUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	info, err := upload.getInfo(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	tail, err := upload.getTail(info)
+	if err != nil {
+		return 0, err
+	}
+
+	// The stored data must end at a segment boundary, after which the saved tail
+	// follows. Otherwise, the wrapped data store kept an incomplete segment after an error.
+	segmentSize := upload.segmentSize
+	stored := decryptedLength(info.Offset, segmentSize)
+	if stored%segmentSize != 0 || encryptedLength(stored, segmentSize) != info.Offset || offset != stored+int64(len(tail)) {
+		return 0, fmt.Errorf("encryptedstore: offset %d of upload %s is not at a segment boundary", offset, info.ID)
+	}
+
+	remaining := int64(-1)
+	if !info.SizeIsDeferred {
+		remaining = decryptedLength(info.Size, segmentSize) - stored
+	}
+
+	// The saved tail is completed using the new data and encrypted again as a whole.
+	reader := newEncryptingReader(io.MultiReader(bytes.NewReader(tail), src), upload.aead, segmentSize, stored/segmentSize, remaining)
+	n, err := upload.upload.WriteChunk(ctx, info.Offset, reader)
+	written := decryptedLength(info.Offset+n, segmentSize)
+
+	if !upload.store.inner.UsesStateUpdater {
+		// The incomplete segment cannot be saved and is discarded.
+		return written - offset, err
+	}
+
+	// Once a segment has been written, the saved tail is part of it. A new tail is only
+	// valid if all segments before it have been written.
+	newTail := tail
+	if n > 0 {
+		newTail = nil
+	}
+	if reader.done() && n == reader.produced {
+		newTail = reader.tail
+	}
+
+	if !bytes.Equal(newTail, tail) || (n > 0 && len(tail) > 0) {
+		if saveErr := upload.saveTail(ctx, info, written/segmentSize, newTail); saveErr != nil {
+			if n == 0 {
+				newTail = tail
+			} else {
+				newTail = nil
+			}
+			if err == nil {
+				err = saveErr
+			}
+		}
+	}
+
+	return written + int64(len(newTail)) - offset, err
+}
+
+func (upload *encryptedUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	info, err := upload.getInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tail, err := upload.getTail(info)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := upload.upload.GetReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	length := decryptedLength(info.Offset, upload.segmentSize)
+	return withTail(newDecryptingReader(src, upload.aead, upload.segmentSize, 0, 0, length), tail), nil
+}
+
+func (upload *encryptedUpload) GetRangeReader(ctx context.Context, offset int64, length int64) (io.ReadCloser, error) {
+	info, err := upload.getInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tail, err := upload.getTail(info)
+	if err != nil {
+		return nil, err
+	}
+
+	segmentSize := upload.segmentSize
+	size := decryptedLength(info.Offset, segmentSize)
+	length = max(min(length, size+int64(len(tail))-offset), 0)
+
+	// The part of the range covered by the saved tail is served from memory.
+	tail = tail[min(max(offset-size, 0), int64(len(tail))):max(offset+length-size, 0)]
+	length = max(min(length, size-offset), 0)
+	if length == 0 {
+		return io.NopCloser(bytes.NewReader(tail)), nil
+	}
+
+	// Read all segments, which overlap with the requested range.
+	index := offset / segmentSize
+	start := index * (segmentSize + tagSize)
+	end := encryptedLength(min((offset+length+segmentSize-1)/segmentSize*segmentSize, size), segmentSize)
+
+	var src io.ReadCloser
+	if upload.store.inner.UsesRangeReader {
+		src, err = upload.store.inner.RangeReader.AsRangeReadableUpload(upload.upload).GetRangeReader(ctx, start, max(end-start, 0))
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		src, err = upload.upload.GetReader(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := io.CopyN(io.Discard, src, start); err != nil {
+			src.Close()
+			return nil, err
+		}
+	}
+
+	return withTail(newDecryptingReader(src, upload.aead, segmentSize, index, offset-index*segmentSize, length), tail), nil
+}
+
+// withTail appends the plaintext of the saved tail to the decrypted data.
+func withTail(reader *decryptingReader, tail []byte) io.ReadCloser {
+	if len(tail) == 0 {
+		return reader
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(reader, bytes.NewReader(tail)), reader}
+}
+
+func (upload *encryptedUpload) ModTime(ctx context.Context) (time.Time, error) {
+	if !upload.store.inner.UsesRangeReader {
+		return time.Time{}, nil
+	}
+
+	return upload.store.inner.RangeReader.AsRangeReadableUpload(upload.upload).ModTime(ctx)
+}
+
+func (upload *encryptedUpload) FinishUpload(ctx context.Context) error {
+	info, err := upload.getInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	tail, err := upload.getTail(info)
+	if err != nil {
+		return err
+	}
+
+	// If the upload's length was deferred, its last segment was incomplete until the
+	// length has been declared and is passed on now.
+	if len(tail) > 0 {
+		index := decryptedLength(info.Offset, upload.segmentSize) / upload.segmentSize
+		segment := upload.aead.Seal(nil, segmentNonce(index), tail, nil)
+		if _, err := upload.upload.WriteChunk(ctx, info.Offset, bytes.NewReader(segment)); err != nil {
+			return err
+		}
+
+		if err := upload.saveTail(ctx, info, index+1, nil); err != nil {
+			return err
+		}
+	}
+
+	return upload.upload.FinishUpload(ctx)
+}
+
+func (upload *encryptedUpload) Terminate(ctx context.Context) error {
+	return upload.store.inner.Terminater.AsTerminatableUpload(upload.upload).Terminate(ctx)
+}
+
+func (upload *encryptedUpload) DeclareLength(ctx context.Context, length int64) error {
+	if _, err := upload.getInfo(ctx); err != nil {
+		return err
+	}
+
+	return upload.store.inner.LengthDeferrer.AsLengthDeclarableUpload(upload.upload).DeclareLength(ctx, encryptedLength(length, upload.segmentSize))
+}
+
+// ConcatUploads decrypts the partial uploads and encrypts their data again using the
+// final upload's key, since the encrypted data cannot be concatenated directly.
+func (upload *encryptedUpload) ConcatUploads(ctx context.Context, partialUploads []handler.Upload) error {
+	readers := make([]io.Reader, 0, len(partialUploads))
+	for _, partialUpload := range partialUploads {
+		reader, err := partialUpload.(*encryptedUpload).GetReader(ctx)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		readers = append(readers, reader)
+	}
+
+	if _, err := upload.WriteChunk(ctx, 0, io.MultiReader(readers...)); err != nil {
+		return err
+	}
+
+	// The handler does not finish concatenated uploads, so the wrapped data store
+	// must be informed here that all data has been written.
+	return upload.upload.FinishUpload(ctx)
+}
+
+func (upload *encryptedUpload) UpdateMetaData(ctx context.Context, metaData handler.MetaData) error {
+	return upload.store.inner.MetadataUpdater.AsMetadataUpdatableUpload(upload.upload).UpdateMetaData(ctx, metaData)
+}
+
+func (upload *encryptedUpload) UpdateState(ctx context.Context, state handler.UploadState) error {
+	// The saved tail is hidden from the caller and must be preserved.
+	info, err := upload.upload.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	state.Storage = maps.Clone(state.Storage)
+	delete(state.Storage, StateKeyTail)
+	delete(state.Storage, StateKeyTailIndex)
+	if info.State != nil && info.State.Storage[StateKeyTail] != "" {
+		if state.Storage == nil {
+			state.Storage = make(map[string]string)
+		}
+		state.Storage[StateKeyTail] = info.State.Storage[StateKeyTail]
+		state.Storage[StateKeyTailIndex] = info.State.Storage[StateKeyTailIndex]
+	}
+
+	return upload.store.inner.StateUpdater.AsStateUpdatableUpload(upload.upload).UpdateState(ctx, state)
+}
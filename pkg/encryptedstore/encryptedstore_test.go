@@ -0,0 +1,445 @@
+package encryptedstore
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/memorylocker"
+	"github.com/tus/tusd/v2/pkg/memorystore"
+)
+
+// Test interface implementations
+var _ handler.DataStore = &EncryptedStore{}
+var _ handler.TerminaterDataStore = &EncryptedStore{}
+var _ handler.ConcaterDataStore = &EncryptedStore{}
+var _ handler.LengthDeferrerDataStore = &EncryptedStore{}
+var _ handler.RangeReaderDataStore = &EncryptedStore{}
+var _ handler.MetadataUpdaterDataStore = &EncryptedStore{}
+var _ handler.StateUpdaterDataStore = &EncryptedStore{}
+
+func newKeyRing(t *testing.T, ids ...string) *KeyRing {
+	keys := NewKeyRing()
+	for _, id := range ids {
+		assert.NoError(t, keys.AddKey(id, bytes.Repeat([]byte(id[:1]), 32)))
+	}
+	return keys
+}
+
+func newStore(t *testing.T, keys KeyProvider) (*EncryptedStore, *memorystore.MemoryStore) {
+	inner := handler.NewStoreComposer()
+	memory := memorystore.New()
+	memory.UseIn(inner)
+
+	store := New(inner, keys)
+	store.SegmentSize = 4
+	return store, memory
+}
+
+func readAll(t *testing.T, reader io.ReadCloser, err error) string {
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func TestEncryptedStore(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, memory := newStore(t, newKeyRing(t, "a"))
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		ID:       "abc",
+		Size:     11,
+		MetaData: handler.MetaData{"foo": "bar"},
+	})
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(11, info.Size)
+	a.EqualValues(0, info.Offset)
+	a.Equal("a", info.Storage[StorageKeyKeyID])
+	a.Equal("4", info.Storage[StorageKeySegmentSize])
+	a.NotEmpty(info.Storage[StorageKeyWrappedKey])
+	a.Equal("memorystore", info.Storage["Type"])
+
+	// The incomplete segment at the end is saved in the wrapped upload's state.
+	n, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello w"))
+	a.NoError(err)
+	a.EqualValues(7, n)
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(7, info.Offset)
+	a.Empty(info.State.Storage)
+
+	innerUpload, err := memory.GetUpload(ctx, "abc")
+	a.NoError(err)
+	innerInfo, err := innerUpload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(4+tagSize, innerInfo.Offset)
+	a.Equal("1", innerInfo.State.Storage[StateKeyTailIndex])
+	a.NotContains(innerInfo.State.Storage[StateKeyTail], "o w")
+
+	reader, err := upload.GetReader(ctx)
+	a.Equal("hello w", readAll(t, reader, err))
+
+	// Other state is saved next to the incomplete segment.
+	err = store.AsStateUpdatableUpload(upload).UpdateState(ctx, handler.UploadState{ContentType: "text/plain"})
+	a.NoError(err)
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal(&handler.UploadState{ContentType: "text/plain"}, info.State)
+	a.EqualValues(7, info.Offset)
+
+	n, err = upload.WriteChunk(ctx, 7, strings.NewReader("orld"))
+	a.NoError(err)
+	a.EqualValues(4, n)
+
+	// The upload's last segment can be shorter.
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(11, info.Offset)
+	a.EqualValues(11, info.Size)
+
+	// The wrapped store only holds the encrypted data.
+	innerInfo, err = innerUpload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(11+3*tagSize, innerInfo.Size)
+	a.EqualValues(11+3*tagSize, innerInfo.Offset)
+	a.Equal(&handler.UploadState{ContentType: "text/plain"}, innerInfo.State)
+
+	innerReader, err := innerUpload.GetReader(ctx)
+	a.NotContains(readAll(t, innerReader, err), "hello")
+
+	// Uploads can be fetched and decrypted again.
+	upload, err = store.GetUpload(ctx, "abc")
+	a.NoError(err)
+
+	reader, err = upload.GetReader(ctx)
+	a.Equal("hello world", readAll(t, reader, err))
+
+	err = store.AsMetadataUpdatableUpload(upload).UpdateMetaData(ctx, handler.MetaData{"foo": "baz"})
+	a.NoError(err)
+
+	err = store.AsTerminatableUpload(upload).Terminate(ctx)
+	a.NoError(err)
+
+	_, err = store.GetUpload(ctx, "abc")
+	a.Equal(handler.ErrNotFound, err)
+}
+
+func TestGetRangeReader(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _ := newStore(t, newKeyRing(t, "a"))
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size: 11,
+	})
+	a.NoError(err)
+
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.NoError(err)
+
+	rangeReader := store.AsRangeReadableUpload(upload)
+	for _, test := range []struct {
+		offset   int64
+		length   int64
+		expected string
+	}{
+		{0, 11, "hello world"},
+		{0, 3, "hel"},
+		{3, 3, "lo "},
+		{4, 4, "o wo"},
+		{6, 5, "world"},
+		{10, 1, "d"},
+		{6, 100, "world"},
+	} {
+		reader, err := rangeReader.GetRangeReader(ctx, test.offset, test.length)
+		a.Equal(test.expected, readAll(t, reader, err))
+	}
+
+	// Ranges can include the incomplete segment of an unfinished upload.
+	upload, err = store.NewUpload(ctx, handler.FileInfo{
+		Size: 11,
+	})
+	a.NoError(err)
+
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello w"))
+	a.NoError(err)
+
+	rangeReader = store.AsRangeReadableUpload(upload)
+	for _, test := range []struct {
+		offset   int64
+		length   int64
+		expected string
+	}{
+		{0, 11, "hello w"},
+		{2, 4, "llo "},
+		{3, 3, "lo "},
+		{4, 2, "o "},
+		{5, 1, " "},
+		{7, 1, ""},
+	} {
+		reader, err := rangeReader.GetRangeReader(ctx, test.offset, test.length)
+		a.Equal(test.expected, readAll(t, reader, err))
+	}
+}
+
+func TestDeclareLength(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, memory := newStore(t, newKeyRing(t, "a"))
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		SizeIsDeferred: true,
+	})
+	a.NoError(err)
+
+	// Without a known size, the last segment is incomplete until the upload is finished.
+	n, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.NoError(err)
+	a.EqualValues(11, n)
+
+	err = store.AsLengthDeclarableUpload(upload).DeclareLength(ctx, 11)
+	a.NoError(err)
+
+	err = upload.FinishUpload(ctx)
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.False(info.SizeIsDeferred)
+	a.EqualValues(11, info.Size)
+	a.EqualValues(11, info.Offset)
+
+	innerUpload, err := memory.GetUpload(ctx, info.ID)
+	a.NoError(err)
+	innerInfo, err := innerUpload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(11+3*tagSize, innerInfo.Offset)
+	a.Nil(innerInfo.State.Storage)
+
+	reader, err := upload.GetReader(ctx)
+	a.Equal("hello world", readAll(t, reader, err))
+}
+
+func TestWithoutStateUpdater(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	inner := handler.NewStoreComposer()
+	inner.UseCore(memorystore.New())
+
+	store := New(inner, newKeyRing(t, "a"))
+	store.SegmentSize = 4
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size: 11,
+	})
+	a.NoError(err)
+
+	// The incomplete segment cannot be saved and is discarded.
+	n, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello w"))
+	a.NoError(err)
+	a.EqualValues(4, n)
+
+	n, err = upload.WriteChunk(ctx, 4, strings.NewReader("o world"))
+	a.NoError(err)
+	a.EqualValues(7, n)
+
+	reader, err := upload.GetReader(ctx)
+	a.Equal("hello world", readAll(t, reader, err))
+}
+
+func TestConcatUploads(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _ := newStore(t, newKeyRing(t, "a"))
+
+	var partialUploads []handler.Upload
+	for _, content := range []string{"abcde", "fgh", "ij"} {
+		upload, err := store.NewUpload(ctx, handler.FileInfo{
+			Size:      int64(len(content)),
+			IsPartial: true,
+		})
+		a.NoError(err)
+
+		_, err = upload.WriteChunk(ctx, 0, strings.NewReader(content))
+		a.NoError(err)
+
+		partialUploads = append(partialUploads, upload)
+	}
+
+	finalUpload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size:    10,
+		IsFinal: true,
+	})
+	a.NoError(err)
+
+	err = store.AsConcatableUpload(finalUpload).ConcatUploads(ctx, partialUploads)
+	a.NoError(err)
+
+	info, err := finalUpload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(10, info.Offset)
+
+	reader, err := finalUpload.GetReader(ctx)
+	a.Equal("abcdefghij", readAll(t, reader, err))
+}
+
+func TestKeyRotation(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	keys := newKeyRing(t, "a")
+	store, _ := newStore(t, keys)
+
+	oldUpload, err := store.NewUpload(ctx, handler.FileInfo{ID: "old", Size: 3})
+	a.NoError(err)
+	_, err = oldUpload.WriteChunk(ctx, 0, strings.NewReader("old"))
+	a.NoError(err)
+
+	// New uploads use the most recently added key.
+	a.NoError(keys.AddKey("b", bytes.Repeat([]byte("b"), 32)))
+
+	newUpload, err := store.NewUpload(ctx, handler.FileInfo{ID: "new", Size: 3})
+	a.NoError(err)
+	_, err = newUpload.WriteChunk(ctx, 0, strings.NewReader("new"))
+	a.NoError(err)
+
+	for id, expected := range map[string]string{"old": "old", "new": "new"} {
+		upload, err := store.GetUpload(ctx, id)
+		a.NoError(err)
+
+		info, err := upload.GetInfo(ctx)
+		a.NoError(err)
+		a.Equal(map[string]string{"old": "a", "new": "b"}[id], info.Storage[StorageKeyKeyID])
+
+		reader, err := upload.GetReader(ctx)
+		a.Equal(expected, readAll(t, reader, err))
+	}
+
+	// Uploads cannot be decrypted once their key is removed.
+	store.keys = newKeyRing(t, "b")
+	upload, err := store.GetUpload(ctx, "old")
+	a.NoError(err)
+	_, err = upload.GetInfo(ctx)
+	a.Equal(ErrUnknownKey, err)
+}
+
+func TestKeyRing(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	keys := NewKeyRing()
+
+	_, _, err := keys.WrapKey(ctx, []byte("data key"))
+	a.Error(err)
+
+	a.Error(keys.AddKey("a", []byte("too short")))
+	a.Error(keys.AddKey("", bytes.Repeat([]byte("a"), 32)))
+	a.NoError(keys.AddKey("a", bytes.Repeat([]byte("a"), 32)))
+	a.Error(keys.AddKey("a", bytes.Repeat([]byte("a"), 32)))
+
+	keyID, wrappedKey, err := keys.WrapKey(ctx, []byte("data key"))
+	a.NoError(err)
+	a.Equal("a", keyID)
+
+	dataKey, err := keys.UnwrapKey(ctx, "a", wrappedKey)
+	a.NoError(err)
+	a.Equal("data key", string(dataKey))
+
+	wrappedKey[len(wrappedKey)-1] ^= 1
+	_, err = keys.UnwrapKey(ctx, "a", wrappedKey)
+	a.Error(err)
+}
+
+func TestModifiedSegment(t *testing.T) {
+	a := assert.New(t)
+	aead, err := newAEAD(bytes.Repeat([]byte("k"), 32))
+	a.NoError(err)
+
+	encrypted, err := io.ReadAll(newEncryptingReader(strings.NewReader("hello world"), aead, 4, 0, 11))
+	a.NoError(err)
+	a.Len(encrypted, 11+3*tagSize)
+
+	// Swapping segments is detected, since their index is authenticated.
+	swapped := append(append([]byte{}, encrypted[20:40]...), encrypted[:20]...)
+	swapped = append(swapped, encrypted[40:]...)
+	_, err = io.ReadAll(newDecryptingReader(io.NopCloser(bytes.NewReader(swapped)), aead, 4, 0, 0, 11))
+	a.Equal(ErrDecryptionFailed, err)
+
+	encrypted[25] ^= 1
+	_, err = io.ReadAll(newDecryptingReader(io.NopCloser(bytes.NewReader(encrypted)), aead, 4, 0, 0, 11))
+	a.Equal(ErrDecryptionFailed, err)
+}
+
+func TestHandler(t *testing.T) {
+	a := assert.New(t)
+
+	inner := handler.NewStoreComposer()
+	memorystore.New().UseIn(inner)
+
+	composer := handler.NewStoreComposer()
+	store := New(inner, newKeyRing(t, "a"))
+	store.SegmentSize = 4
+	store.UseIn(composer)
+	memorylocker.New().UseIn(composer)
+
+	tusHandler, err := handler.NewHandler(handler.Config{
+		BasePath:      "/files/",
+		StoreComposer: composer,
+	})
+	a.NoError(err)
+
+	server := httptest.NewServer(http.StripPrefix("/files/", tusHandler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL+"/files/", strings.NewReader("hello"))
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Upload-Length", "11")
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	res, err := http.DefaultClient.Do(req)
+	a.NoError(err)
+	res.Body.Close()
+	a.Equal(http.StatusCreated, res.StatusCode)
+	a.Equal("5", res.Header.Get("Upload-Offset"))
+
+	location := res.Header.Get("Location")
+
+	// Requests smaller than a segment make progress as well.
+	for _, chunk := range []struct{ offset, body, expected string }{
+		{"5", " w", "7"},
+		{"7", "orld", "11"},
+	} {
+		req, _ = http.NewRequest("PATCH", location, strings.NewReader(chunk.body))
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Upload-Offset", chunk.offset)
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		res, err = http.DefaultClient.Do(req)
+		a.NoError(err)
+		res.Body.Close()
+		a.Equal(http.StatusNoContent, res.StatusCode)
+		a.Equal(chunk.expected, res.Header.Get("Upload-Offset"))
+	}
+
+	req, _ = http.NewRequest("GET", location, nil)
+	req.Header.Set("Range", "bytes=3-7")
+	res, err = http.DefaultClient.Do(req)
+	a.NoError(err)
+	content, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	a.NoError(err)
+	a.Equal(http.StatusPartialContent, res.StatusCode)
+	a.Equal("lo wo", string(content))
+}
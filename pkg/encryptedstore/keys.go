@@ -0,0 +1,121 @@
+package encryptedstore
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrUnknownKey is returned by KeyRing if a data key was wrapped using a key, which
+// is not part of the key ring.
+var ErrUnknownKey = errors.New("encryptedstore: unknown key encryption key")
+
+// KeyProvider protects the data keys, which are generated for every upload, using
+// key encryption keys (KEKs) under the application's control. Implementations can
+// keep the KEKs locally, as KeyRing does, or delegate to a key management service.
+//
+// Keys can be rotated by wrapping new data keys using a new KEK, while still being
+// able to unwrap data keys of existing uploads using the previous KEKs.
+type KeyProvider interface {
+	// WrapKey encrypts the data key using the current KEK. It returns the ID of the
+	// used KEK and the wrapped data key, which are saved in the upload's FileInfo.Storage.
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrappedKey []byte, err error)
+	// UnwrapKey decrypts a data key, which has been wrapped using the KEK with the given ID.
+	UnwrapKey(ctx context.Context, keyID string, wrappedKey []byte) (dataKey []byte, err error)
+}
+
+// KeyRing is a KeyProvider holding 256-bit KEKs in memory. Data keys are wrapped
+// using AES-256-GCM with the most recently added KEK. To rotate keys, add a new KEK
+// while keeping the previous ones, so that existing uploads can still be decrypted.
+type KeyRing struct {
+	mutex     sync.RWMutex
+	currentID string
+	keys      map[string]cipher.AEAD
+}
+
+// NewKeyRing creates a new, empty key ring.
+func NewKeyRing() *KeyRing {
+	return &KeyRing{
+		keys: make(map[string]cipher.AEAD),
+	}
+}
+
+// AddKey adds a 32-byte KEK with the given ID to the key ring and uses it for
+// wrapping new data keys.
+func (ring *KeyRing) AddKey(id string, key []byte) error {
+	if id == "" {
+		return errors.New("encryptedstore: key ID must not be empty")
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("encryptedstore: key %q must be 32 bytes long, but has %d bytes", id, len(key))
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+
+	ring.mutex.Lock()
+	defer ring.mutex.Unlock()
+
+	if _, ok := ring.keys[id]; ok {
+		return fmt.Errorf("encryptedstore: key %q already exists", id)
+	}
+
+	ring.keys[id] = aead
+	ring.currentID = id
+	return nil
+}
+
+func (ring *KeyRing) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	ring.mutex.RLock()
+	defer ring.mutex.RUnlock()
+
+	aead, ok := ring.keys[ring.currentID]
+	if !ok {
+		return "", nil, errors.New("encryptedstore: key ring is empty")
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", nil, err
+	}
+
+	// The key ID is authenticated, so that a wrapped key cannot be attributed to another KEK.
+	return ring.currentID, aead.Seal(nonce, nonce, dataKey, []byte(ring.currentID)), nil
+}
+
+func (ring *KeyRing) UnwrapKey(ctx context.Context, keyID string, wrappedKey []byte) ([]byte, error) {
+	ring.mutex.RLock()
+	aead, ok := ring.keys[keyID]
+	ring.mutex.RUnlock()
+
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+
+	if len(wrappedKey) < aead.NonceSize() {
+		return nil, errors.New("encryptedstore: wrapped key is too short")
+	}
+
+	nonce, ciphertext := wrappedKey[:aead.NonceSize()], wrappedKey[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, ciphertext, []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("encryptedstore: unable to unwrap data key: %w", err)
+	}
+
+	return dataKey, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
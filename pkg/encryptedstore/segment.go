@@ -0,0 +1,232 @@
+package encryptedstore
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// tagSize is the size of the authentication tag, which AES-GCM appends to every segment.
+const tagSize = 16
+
+// ErrDecryptionFailed is returned when reading an upload's data, if a segment cannot be
+// authenticated, e.g. because it has been modified or was encrypted using another key.
+var ErrDecryptionFailed = errors.New("encryptedstore: segment cannot be decrypted")
+
+// The upload's data is split into segments of segmentSize bytes, except for the last
+// one, which may be shorter. Each segment is encrypted separately and its
+// authentication tag is appended. Since the length of every encrypted segment is known,
+// offsets in the plaintext can be mapped to offsets in the stored data and vice versa.
+
+// encryptedLength returns the number of stored bytes for length bytes of plaintext.
+func encryptedLength(length int64, segmentSize int64) int64 {
+	segments := length / segmentSize
+	stored := segments * (segmentSize + tagSize)
+	if rest := length % segmentSize; rest > 0 {
+		stored += rest + tagSize
+	}
+	return stored
+}
+
+// decryptedLength returns the number of plaintext bytes contained in length stored bytes.
+// A trailing segment, which has only been stored partially, is not counted.
+func decryptedLength(length int64, segmentSize int64) int64 {
+	segments := length / (segmentSize + tagSize)
+	plain := segments * segmentSize
+	if rest := length % (segmentSize + tagSize); rest > tagSize {
+		plain += rest - tagSize
+	}
+	return plain
+}
+
+// segmentNonce derives the nonce from the segment's index. Since every upload has its
+// own data key, nonces are never reused and segments cannot be reordered.
+func segmentNonce(index int64) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[4:], uint64(index))
+	return nonce
+}
+
+// tailNonceSize is the size of the random nonce, which is stored with the encrypted tail.
+const tailNonceSize = 12
+
+// sealTail encrypts the plaintext of the incomplete segment with the given index. Since
+// the segment is sealed again whenever data is appended, a random nonce is used instead
+// of the one derived from the index. Its highest bit is set, so that it never equals the
+// nonce of a segment. The index is authenticated, so the tail cannot be moved to another
+// segment.
+func sealTail(aead cipher.AEAD, index int64, plain []byte) ([]byte, error) {
+	nonce := make([]byte, tailNonceSize, tailNonceSize+len(plain)+tagSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	nonce[0] |= 0x80
+
+	return aead.Seal(nonce, nonce, plain, segmentNonce(index)), nil
+}
+
+// openTail decrypts the tail, which has been sealed using sealTail for the same index.
+func openTail(aead cipher.AEAD, index int64, sealed []byte) ([]byte, error) {
+	if len(sealed) < tailNonceSize {
+		return nil, ErrDecryptionFailed
+	}
+
+	plain, err := aead.Open(nil, sealed[:tailNonceSize], sealed[tailNonceSize:], segmentNonce(index))
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+	return plain, nil
+}
+
+// encryptingReader reads plaintext from src and provides the encrypted segments. Only
+// complete segments are emitted. If src ends in the middle of a segment, which is not
+// the upload's last one, the incomplete segment is kept in tail, so that the stored data
+// always ends at a segment boundary and the tail can be prepended when writing is resumed.
+type encryptingReader struct {
+	src         io.Reader
+	aead        cipher.AEAD
+	segmentSize int64
+	// index is the index of the next segment.
+	index int64
+	// remaining is the number of plaintext bytes until the upload's end or -1 if the
+	// upload's size is deferred.
+	remaining int64
+
+	plain []byte
+	// buf holds the encrypted data of the current segment, which has not been read yet.
+	buf []byte
+	out []byte
+	err error
+
+	// produced is the number of encrypted bytes emitted so far.
+	produced int64
+	// tail is the plaintext of the incomplete segment, at which src ended.
+	tail []byte
+}
+
+func newEncryptingReader(src io.Reader, aead cipher.AEAD, segmentSize int64, index int64, remaining int64) *encryptingReader {
+	return &encryptingReader{
+		src:         src,
+		aead:        aead,
+		segmentSize: segmentSize,
+		index:       index,
+		remaining:   remaining,
+		plain:       make([]byte, segmentSize),
+		out:         make([]byte, 0, segmentSize+tagSize),
+	}
+}
+
+func (r *encryptingReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.err = r.nextSegment()
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+// done returns whether src has been read entirely and all segments have been emitted.
+func (r *encryptingReader) done() bool {
+	return r.err != nil && len(r.buf) == 0
+}
+
+func (r *encryptingReader) nextSegment() error {
+	size := r.segmentSize
+	if r.remaining >= 0 && r.remaining < size {
+		size = r.remaining
+	}
+	if size == 0 {
+		return io.EOF
+	}
+
+	n, err := io.ReadFull(r.src, r.plain[:size])
+	if err != nil {
+		// Keep the incomplete segment, even if reading failed, since the data
+		// received so far is valid.
+		r.tail = bytes.Clone(r.plain[:n])
+		if err == io.ErrUnexpectedEOF {
+			return io.EOF
+		}
+		return err
+	}
+
+	r.buf = r.aead.Seal(r.out[:0], segmentNonce(r.index), r.plain[:n], nil)
+	r.produced += int64(len(r.buf))
+	r.index++
+	if r.remaining >= 0 {
+		r.remaining -= int64(n)
+	}
+	return nil
+}
+
+// decryptingReader reads encrypted segments from src and provides their plaintext. The
+// first skip bytes of the first segment are dropped and at most length bytes are returned.
+type decryptingReader struct {
+	src  io.ReadCloser
+	aead cipher.AEAD
+	// index is the index of the next segment.
+	index     int64
+	skip      int64
+	remaining int64
+
+	segment []byte
+	// buf holds the decrypted data of the current segment, which has not been read yet.
+	buf []byte
+}
+
+func newDecryptingReader(src io.ReadCloser, aead cipher.AEAD, segmentSize int64, index int64, skip int64, length int64) *decryptingReader {
+	return &decryptingReader{
+		src:       src,
+		aead:      aead,
+		index:     index,
+		skip:      skip,
+		remaining: length,
+		segment:   make([]byte, segmentSize+tagSize),
+	}
+}
+
+func (r *decryptingReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.remaining <= 0 {
+			return 0, io.EOF
+		}
+
+		n, err := io.ReadFull(r.src, r.segment)
+		if err == io.EOF {
+			// The stored data ends before the expected length.
+			return 0, io.ErrUnexpectedEOF
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return 0, err
+		}
+
+		plain, err := r.aead.Open(r.segment[:0], segmentNonce(r.index), r.segment[:n], nil)
+		if err != nil {
+			return 0, ErrDecryptionFailed
+		}
+		r.index++
+
+		plain = plain[min(r.skip, int64(len(plain))):]
+		r.skip = 0
+		if int64(len(plain)) > r.remaining {
+			plain = plain[:r.remaining]
+		}
+		r.buf = plain
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.remaining -= int64(n)
+	return n, nil
+}
+
+func (r *decryptingReader) Close() error {
+	return r.src.Close()
+}
@@ -0,0 +1,164 @@
+// Package filequotastore provides a quota store based on the local file system.
+//
+// FileQuotaStore saves all quota reservations in a single JSON file, so that they
+// survive restarts of tusd. The file is read and rewritten for every modification,
+// which makes this store only suitable for a moderate number of uploads. It must
+// not be shared between multiple processes, since the access is only synchronized
+// within a single process. For setups with multiple tusd instances, use a quota
+// store backed by a database, such as the sqlquotastore package.
+package filequotastore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/tus/tusd/v2/internal/quotamap"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+var defaultFilePerm = os.FileMode(0664)
+
+// FileQuotaStore saves quota reservations in a JSON file.
+type FileQuotaStore struct {
+	// Path to the JSON file. The file is created if it does not exist, but its
+	// directory must exist.
+	Path string
+	// FilePerm is the permission used when writing the file.
+	FilePerm os.FileMode
+
+	mutex *sync.Mutex
+}
+
+// New creates a new file-based quota store, which saves its data in the file at
+// the given path.
+func New(path string) FileQuotaStore {
+	return FileQuotaStore{
+		Path:     path,
+		FilePerm: defaultFilePerm,
+		mutex:    &sync.Mutex{},
+	}
+}
+
+// UseIn adds this quota store to the passed composer.
+func (store FileQuotaStore) UseIn(composer *handler.StoreComposer) {
+	composer.UseQuotaStore(store)
+}
+
+func (store FileQuotaStore) Reserve(ctx context.Context, key string, id string, size int64, limit int64) error {
+	return store.update(func(reservations quotamap.Map) error {
+		return reservations.Reserve(key, id, size, limit)
+	})
+}
+
+func (store FileQuotaStore) Use(ctx context.Context, id string, used int64) error {
+	return store.update(func(reservations quotamap.Map) error {
+		reservations.Use(id, used)
+		return nil
+	})
+}
+
+func (store FileQuotaStore) Release(ctx context.Context, id string) error {
+	return store.update(func(reservations quotamap.Map) error {
+		delete(reservations, id)
+		return nil
+	})
+}
+
+func (store FileQuotaStore) GetReservation(ctx context.Context, id string) (handler.QuotaReservation, bool, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	reservations, err := store.read()
+	if err != nil {
+		return handler.QuotaReservation{}, false, err
+	}
+
+	reservation, ok := reservations[id]
+	return reservation, ok, nil
+}
+
+func (store FileQuotaStore) GetUsage(ctx context.Context, key string) (handler.QuotaUsage, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	reservations, err := store.read()
+	if err != nil {
+		return handler.QuotaUsage{}, err
+	}
+
+	return reservations.Usage(key), nil
+}
+
+// update reads the reservations, applies the modification and writes them back,
+// if the modification did not return an error.
+func (store FileQuotaStore) update(modify func(reservations quotamap.Map) error) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	reservations, err := store.read()
+	if err != nil {
+		return err
+	}
+
+	if err := modify(reservations); err != nil {
+		return err
+	}
+
+	return store.write(reservations)
+}
+
+// read loads the reservations from disk. A missing file is treated as no reservations.
+func (store FileQuotaStore) read() (quotamap.Map, error) {
+	reservations := make(quotamap.Map)
+
+	data, err := os.ReadFile(store.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return reservations, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &reservations); err != nil {
+		return nil, err
+	}
+
+	return reservations, nil
+}
+
+// write saves the reservations to disk. The data is first written to a temporary
+// file, which then replaces the original file, so that a crash does not leave a
+// partially written file behind.
+func (store FileQuotaStore) write(reservations quotamap.Map) error {
+	data, err := json.Marshal(reservations)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(store.Path), filepath.Base(store.Path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpPath := file.Name()
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, store.FilePerm); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return os.Rename(tmpPath, store.Path)
+}
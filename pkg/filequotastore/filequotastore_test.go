@@ -0,0 +1,54 @@
+package filequotastore
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+var _ handler.QuotaStore = FileQuotaStore{}
+
+func TestFileQuotaStore(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	path := filepath.Join(t.TempDir(), "quota.json")
+	store := New(path)
+
+	usage, err := store.GetUsage(ctx, "tenant")
+	a.NoError(err)
+	a.Equal(handler.QuotaUsage{}, usage)
+
+	a.NoError(store.Reserve(ctx, "tenant", "one", 60, 100))
+	a.NoError(store.Reserve(ctx, "tenant", "two", 40, 100))
+	a.Equal(handler.ErrQuotaExceeded, store.Reserve(ctx, "tenant", "three", 1, 100))
+	a.NoError(store.Use(ctx, "one", 20))
+
+	// A new store for the same file sees the previous reservations.
+	store = New(path)
+
+	reservation, ok, err := store.GetReservation(ctx, "one")
+	a.NoError(err)
+	a.True(ok)
+	a.Equal(handler.QuotaReservation{
+		Key:   "tenant",
+		ID:    "one",
+		Size:  60,
+		Used:  20,
+		Limit: 100,
+	}, reservation)
+
+	usage, err = store.GetUsage(ctx, "tenant")
+	a.NoError(err)
+	a.Equal(handler.QuotaUsage{Reserved: 100, Used: 20}, usage)
+
+	a.NoError(store.Release(ctx, "one"))
+	_, ok, err = store.GetReservation(ctx, "one")
+	a.NoError(err)
+	a.False(ok)
+
+	a.NoError(store.Reserve(ctx, "tenant", "three", 60, 100))
+}
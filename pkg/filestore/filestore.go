@@ -5,7 +5,14 @@
 // `[id].info` files are used to store the fileinfo in JSON format. The
 // `[id]` files without an extension contain the raw binary data uploaded.
 // No cleanup is performed so you may want to run a cronjob to ensure your disk
-// is not filled up with old and finished uploads.
+// is not filled up with old and finished uploads. If InfoStore is set, the
+// fileinfo is saved using it instead and no `[id].info` files are created.
+//
+// If DeduplicationPath is set, the content of finished uploads is hashed using
+// SHA-256 and stored in the `[hash]` file inside this directory. The upload's
+// binary file then is a hard link to the content-addressed file, so uploads with
+// identical content only occupy disk space once. The content-addressed file is
+// removed once the last upload referencing it has been terminated.
 //
 // Related to the filestore is the package filelocker, which provides a file-based
 // locking mechanism. The use of some locking method is recommended and further
@@ -14,6 +21,8 @@ package filestore
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -22,7 +31,10 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
+	"github.com/tus/tusd/v2/internal/storageinfo"
 	"github.com/tus/tusd/v2/internal/uid"
 	"github.com/tus/tusd/v2/pkg/handler"
 )
@@ -32,11 +44,17 @@ const (
 	StorageKeyPath = "Path"
 	// StorageKeyInfoPath is the key of the path of .info file in handler.FileInfo.Storage
 	StorageKeyInfoPath = "InfoPath"
+	// StorageKeyContentHash is the key of the SHA-256 hash of a deduplicated upload's
+	// content in handler.FileInfo.Storage
+	StorageKeyContentHash = "ContentHash"
 )
 
 const DefaultDirPerm = 0775
 const DefaultFilePerm = 0664
 
+// dedupMutex serializes adding and removing references to content-addressed files.
+var dedupMutex sync.Mutex
+
 // See the handler.DataStore interface for documentation about the different
 // methods.
 type FileStore struct {
@@ -53,6 +71,17 @@ type FileStore struct {
 	// and their .info files. Only the permission bits are used. If zero,
 	// DefaultFilePerm is used by New.
 	FileModePerm fs.FileMode
+
+	// DeduplicationPath is the relative or absolute path of the directory storing
+	// the content of finished uploads by its hash. If empty, uploads are not
+	// deduplicated. The directory must be located on the same file system as the
+	// uploads, since hard links are used for referencing the content. References
+	// are only counted correctly if a single tusd instance accesses the directory.
+	DeduplicationPath string
+
+	// InfoStore, if set, is used to persist the uploads' FileInfo instead of the
+	// .info files.
+	InfoStore handler.InfoStore
 }
 
 // New creates a new file based storage backend. The directory specified will
@@ -76,6 +105,10 @@ func (store FileStore) UseIn(composer *handler.StoreComposer) {
 	composer.UseConcater(store)
 	composer.UseLengthDeferrer(store)
 	composer.UseContentServer(store)
+	composer.UseMetadataUpdater(store)
+	composer.UseStateUpdater(store)
+	composer.UseRangeReader(store)
+	composer.UseConcurrentReader(store)
 }
 
 func (store FileStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
@@ -84,7 +117,10 @@ func (store FileStore) NewUpload(ctx context.Context, info handler.FileInfo) (ha
 	}
 
 	// The .info file's location can directly be deduced from the upload ID
-	infoPath := store.infoPath(info.ID)
+	var infoPath string
+	if store.InfoStore == nil {
+		infoPath = store.infoPath(info.ID)
+	}
 	// The binary file's location might be modified by the pre-create hook.
 	var binPath string
 	if info.Storage != nil && info.Storage[StorageKeyPath] != "" {
@@ -100,14 +136,24 @@ func (store FileStore) NewUpload(ctx context.Context, info handler.FileInfo) (ha
 		binPath = store.defaultBinPath(info.ID)
 	}
 
-	info.Storage = map[string]string{
-		"Type":             "filestore",
-		StorageKeyPath:     binPath,
-		StorageKeyInfoPath: infoPath,
+	info.Storage = storageinfo.Clone(info.Storage)
+	info.Storage["Type"] = "filestore"
+	info.Storage[StorageKeyPath] = binPath
+	if infoPath != "" {
+		info.Storage[StorageKeyInfoPath] = infoPath
 	}
 
-	// Create binary file with no content
-	if err := createFile(binPath, store.DirModePerm, store.FileModePerm, nil); err != nil {
+	// Create binary file with no content. With deduplication, the binary file of an
+	// existing upload might be a hard link to content shared with other uploads, so it
+	// must not be truncated if the ID has been reused, e.g. by the pre-create hook.
+	flag := os.O_TRUNC
+	if store.DeduplicationPath != "" {
+		flag = os.O_EXCL
+	}
+	if err := createFile(binPath, store.DirModePerm, store.FileModePerm, flag, nil); err != nil {
+		if errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("binary file for upload %s exists already", info.ID)
+		}
 		return nil, err
 	}
 
@@ -117,10 +163,12 @@ func (store FileStore) NewUpload(ctx context.Context, info handler.FileInfo) (ha
 		binPath:      binPath,
 		dirModePerm:  store.DirModePerm,
 		fileModePerm: store.FileModePerm,
+		dedupPath:    store.DeduplicationPath,
+		infoStore:    store.InfoStore,
 	}
 
 	// writeInfo creates the file by itself if necessary
-	if err := upload.writeInfo(); err != nil {
+	if err := upload.writeInfo(ctx); err != nil {
 		return nil, err
 	}
 
@@ -128,18 +176,27 @@ func (store FileStore) NewUpload(ctx context.Context, info handler.FileInfo) (ha
 }
 
 func (store FileStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
-	infoPath := store.infoPath(id)
-	data, err := os.ReadFile(infoPath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			// Interpret os.ErrNotExist as 404 Not Found
-			err = handler.ErrNotFound
-		}
-		return nil, err
-	}
 	var info handler.FileInfo
-	if err := json.Unmarshal(data, &info); err != nil {
-		return nil, err
+	var infoPath string
+	if store.InfoStore != nil {
+		var err error
+		info, err = store.InfoStore.GetInfo(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		infoPath = store.infoPath(id)
+		data, err := os.ReadFile(infoPath)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// Interpret os.ErrNotExist as 404 Not Found
+				err = handler.ErrNotFound
+			}
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &info); err != nil {
+			return nil, err
+		}
 	}
 
 	// If the info file contains a custom path to the binary file, we use that. If not, we
@@ -171,6 +228,8 @@ func (store FileStore) GetUpload(ctx context.Context, id string) (handler.Upload
 		infoPath:     infoPath,
 		dirModePerm:  store.DirModePerm,
 		fileModePerm: store.FileModePerm,
+		dedupPath:    store.DeduplicationPath,
+		infoStore:    store.InfoStore,
 	}, nil
 }
 
@@ -190,6 +249,24 @@ func (store FileStore) AsServableUpload(upload handler.Upload) handler.ServableU
 	return upload.(*fileUpload)
 }
 
+func (store FileStore) AsMetadataUpdatableUpload(upload handler.Upload) handler.MetadataUpdatableUpload {
+	return upload.(*fileUpload)
+}
+
+func (store FileStore) AsStateUpdatableUpload(upload handler.Upload) handler.StateUpdatableUpload {
+	return upload.(*fileUpload)
+}
+
+func (store FileStore) AsRangeReadableUpload(upload handler.Upload) handler.RangeReadableUpload {
+	return upload.(*fileUpload)
+}
+
+// SupportsConcurrentReads returns true, since data is only appended to the binary file,
+// so the data up to the upload's offset is not modified by later writes.
+func (store FileStore) SupportsConcurrentReads() bool {
+	return true
+}
+
 // defaultBinPath returns the path to the file storing the binary data, if it is
 // not customized using the pre-create hook.
 func (store FileStore) defaultBinPath(id string) string {
@@ -204,13 +281,17 @@ func (store FileStore) infoPath(id string) string {
 type fileUpload struct {
 	// info stores the current information about the upload
 	info handler.FileInfo
-	// infoPath is the path to the .info file
+	// infoPath is the path to the .info file. It is empty if infoStore is used.
 	infoPath string
 	// binPath is the path to the binary file (which has no extension)
 	binPath string
 
 	dirModePerm  fs.FileMode
 	fileModePerm fs.FileMode
+	// dedupPath is the directory for content-addressed files, if deduplication is enabled.
+	dedupPath string
+	// infoStore persists the info instead of the .info file, if set.
+	infoStore handler.InfoStore
 }
 
 func (upload *fileUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
@@ -232,14 +313,46 @@ func (upload *fileUpload) WriteChunk(ctx context.Context, offset int64, src io.R
 		return n, err
 	}
 
-	return n, file.Close()
+	if err := file.Close(); err != nil {
+		return n, err
+	}
+
+	return n, upload.saveOffset(ctx)
 }
 
 func (upload *fileUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
 	return os.Open(upload.binPath)
 }
 
+// GetRangeReader opens the binary file and only reads the requested section of it.
+func (upload *fileUpload) GetRangeReader(ctx context.Context, offset int64, length int64) (io.ReadCloser, error) {
+	file, err := os.Open(upload.binPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.NewSectionReader(file, offset, length), file}, nil
+}
+
+func (upload *fileUpload) ModTime(ctx context.Context) (time.Time, error) {
+	stat, err := os.Stat(upload.binPath)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return stat.ModTime(), nil
+}
+
 func (upload *fileUpload) Terminate(ctx context.Context) error {
+	hash := upload.info.Storage[StorageKeyContentHash]
+	if hash != "" {
+		dedupMutex.Lock()
+		defer dedupMutex.Unlock()
+	}
+
 	// We ignore errors indicating that the files cannot be found because we want
 	// to delete them anyways. The files might be removed by a cron job for cleaning up
 	// or some file might have been removed when tusd crashed during the termination.
@@ -248,11 +361,19 @@ func (upload *fileUpload) Terminate(ctx context.Context) error {
 		return err
 	}
 
-	err = os.Remove(upload.infoPath)
+	if upload.infoStore != nil {
+		err = upload.infoStore.DeleteInfo(ctx, upload.info.ID)
+	} else {
+		err = os.Remove(upload.infoPath)
+	}
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
+	if hash != "" {
+		return upload.releaseContent(hash)
+	}
+
 	return nil
 }
 
@@ -276,7 +397,8 @@ func (upload *fileUpload) ConcatUploads(ctx context.Context, uploads []handler.U
 		}
 	}
 
-	return
+	upload.info.Offset = upload.info.Size
+	return upload.saveOffset(ctx)
 }
 
 func (upload *fileUpload) appendTo(file *os.File) error {
@@ -296,19 +418,133 @@ func (upload *fileUpload) appendTo(file *os.File) error {
 func (upload *fileUpload) DeclareLength(ctx context.Context, length int64) error {
 	upload.info.Size = length
 	upload.info.SizeIsDeferred = false
-	return upload.writeInfo()
+	return upload.writeInfo(ctx)
+}
+
+func (upload *fileUpload) UpdateMetaData(ctx context.Context, metaData handler.MetaData) error {
+	upload.info.MetaData = metaData
+	return upload.writeInfo(ctx)
+}
+
+func (upload *fileUpload) UpdateState(ctx context.Context, state handler.UploadState) error {
+	upload.info.State = &state
+	return upload.writeInfo(ctx)
 }
 
 // writeInfo updates the entire information. Everything will be overwritten.
-func (upload *fileUpload) writeInfo() error {
+func (upload *fileUpload) writeInfo(ctx context.Context) error {
+	if upload.infoStore != nil {
+		return upload.infoStore.SaveInfo(ctx, upload.info)
+	}
+
 	data, err := json.Marshal(upload.info)
 	if err != nil {
 		return err
 	}
-	return createFile(upload.infoPath, upload.dirModePerm, upload.fileModePerm, data)
+	return createFile(upload.infoPath, upload.dirModePerm, upload.fileModePerm, os.O_TRUNC, data)
+}
+
+// saveOffset updates the offset in the InfoStore, if one is used. The .info file
+// is not rewritten, since the offset is always calculated from the binary file.
+func (upload *fileUpload) saveOffset(ctx context.Context) error {
+	if upload.infoStore == nil {
+		return nil
+	}
+	return upload.infoStore.SaveInfo(ctx, upload.info)
 }
 
 func (upload *fileUpload) FinishUpload(ctx context.Context) error {
+	if upload.dedupPath == "" || upload.info.Storage[StorageKeyContentHash] != "" {
+		return nil
+	}
+
+	return upload.deduplicate(ctx)
+}
+
+// deduplicate stores the upload's content in the content-addressed file. If a file
+// with the same content already exists, the upload's binary file is replaced with a
+// hard link to it.
+func (upload *fileUpload) deduplicate(ctx context.Context) error {
+	hash, err := hashFile(upload.binPath)
+	if err != nil {
+		return err
+	}
+	contentPath := filepath.Join(upload.dedupPath, hash)
+
+	dedupMutex.Lock()
+	defer dedupMutex.Unlock()
+
+	if err := os.MkdirAll(upload.dedupPath, upload.dirModePerm); err != nil {
+		return err
+	}
+
+	err = os.Link(upload.binPath, contentPath)
+	if errors.Is(err, fs.ErrExist) {
+		err = upload.linkContent(contentPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	if upload.info.Storage == nil {
+		upload.info.Storage = make(map[string]string)
+	}
+	upload.info.Storage[StorageKeyContentHash] = hash
+	return upload.writeInfo(ctx)
+}
+
+// linkContent replaces the upload's binary file with a hard link to the existing
+// content-addressed file.
+func (upload *fileUpload) linkContent(contentPath string) error {
+	binStat, err := os.Stat(upload.binPath)
+	if err != nil {
+		return err
+	}
+	contentStat, err := os.Stat(contentPath)
+	if err != nil {
+		return err
+	}
+
+	// The file might have been linked before the .info file could be updated.
+	if os.SameFile(binStat, contentStat) {
+		return nil
+	}
+
+	// The link is renamed over the binary file, so that readers always see the
+	// entire content.
+	tmpPath := upload.binPath + ".dedup"
+	if err := os.Link(contentPath, tmpPath); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, upload.binPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	return nil
+}
+
+// releaseContent removes the content-addressed file, if it is not referenced by
+// any upload anymore. The caller must hold dedupMutex.
+func (upload *fileUpload) releaseContent(hash string) error {
+	contentPath := filepath.Join(upload.dedupPath, hash)
+
+	links, err := linkCount(contentPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	// The only remaining link is the content-addressed file itself.
+	if links <= 1 {
+		err = os.Remove(contentPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -318,10 +554,27 @@ func (upload *fileUpload) ServeContent(ctx context.Context, w http.ResponseWrite
 	return nil
 }
 
-// createFile creates the file with the content. If the corresponding directory does not exist,
-// it is created. If the file already exists, its content is removed.
-func createFile(path string, dirPerm fs.FileMode, filePerm fs.FileMode, content []byte) error {
-	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, filePerm)
+// hashFile returns the hex-encoded SHA-256 hash of the file's content.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// createFile creates the file at path including its parent directories and writes the
+// content to it. flag is either os.O_TRUNC for replacing an existing file or os.O_EXCL
+// for failing if the file exists.
+func createFile(path string, dirPerm fs.FileMode, filePerm fs.FileMode, flag int, content []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|flag, filePerm)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// An upload ID containing slashes is mapped onto different directories on disk,
@@ -332,7 +585,7 @@ func createFile(path string, dirPerm fs.FileMode, filePerm fs.FileMode, content
 			}
 
 			// Try creating the file again.
-			file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, filePerm)
+			file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|flag, filePerm)
 			if err != nil {
 				// If that still doesn't work, error out.
 				return err
@@ -19,6 +19,9 @@ var _ handler.DataStore = FileStore{}
 var _ handler.TerminaterDataStore = FileStore{}
 var _ handler.ConcaterDataStore = FileStore{}
 var _ handler.LengthDeferrerDataStore = FileStore{}
+var _ handler.StateUpdaterDataStore = FileStore{}
+var _ handler.RangeReaderDataStore = FileStore{}
+var _ handler.ConcurrentReaderDataStore = FileStore{}
 
 func TestFilestore(t *testing.T) {
 	a := assert.New(t)
@@ -85,6 +88,19 @@ func TestFilestore(t *testing.T) {
 	a.NotEqual("", w.Header().Get("Last-Modified"))
 	a.Equal("hello", w.Body.String())
 
+	// Read range
+	rangeReader, err := store.AsRangeReadableUpload(upload).GetRangeReader(ctx, 6, 3)
+	a.NoError(err)
+
+	content, err = io.ReadAll(rangeReader)
+	a.NoError(err)
+	a.Equal("wor", string(content))
+	a.NoError(rangeReader.Close())
+
+	modTime, err := store.AsRangeReadableUpload(upload).ModTime(ctx)
+	a.NoError(err)
+	a.False(modTime.IsZero())
+
 	// Terminate upload
 	a.NoError(store.AsTerminatableUpload(upload).Terminate(ctx))
 
@@ -265,6 +281,72 @@ func TestDeclareLength(t *testing.T) {
 	a.Equal(false, updatedInfo.SizeIsDeferred)
 }
 
+func TestUpdateMetaData(t *testing.T) {
+	a := assert.New(t)
+
+	tmp, err := os.MkdirTemp("", "tusd-filestore-update-metadata-")
+	a.NoError(err)
+
+	store := New(tmp)
+	ctx := context.Background()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size:     10,
+		MetaData: handler.MetaData{"filename": "old.txt"},
+	})
+	a.NoError(err)
+
+	err = store.AsMetadataUpdatableUpload(upload).UpdateMetaData(ctx, handler.MetaData{"filename": "new.txt"})
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+
+	// The new meta data must also be visible after fetching the upload again.
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal(handler.MetaData{"filename": "new.txt"}, info.MetaData)
+	a.EqualValues(10, info.Size)
+}
+
+func TestUpdateState(t *testing.T) {
+	a := assert.New(t)
+
+	tmp, err := os.MkdirTemp("", "tusd-filestore-update-state-")
+	a.NoError(err)
+
+	store := New(tmp)
+	ctx := context.Background()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size:     10,
+		MetaData: handler.MetaData{"filename": "hello.txt"},
+	})
+	a.NoError(err)
+
+	state := handler.UploadState{
+		Digest: &handler.DigestState{
+			Offset: 5,
+			States: map[string][]byte{"sha-256": []byte("state")},
+		},
+	}
+	err = store.AsStateUpdatableUpload(upload).UpdateState(ctx, state)
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+
+	// The state must also be visible after fetching the upload again.
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal(&state, info.State)
+	a.Equal(handler.MetaData{"filename": "hello.txt"}, info.MetaData)
+}
+
 // TestCustomRelativePath tests whether the upload's destination can be customized
 // relative to the storage directory.
 func TestCustomRelativePath(t *testing.T) {
@@ -375,3 +457,126 @@ func TestCustomAbsolutePath(t *testing.T) {
 	a.NoError(err)
 	a.True(statInfo.Mode().IsRegular())
 }
+
+func TestPreserveStorage(t *testing.T) {
+	a := assert.New(t)
+
+	tmp, err := os.MkdirTemp("", "tusd-filestore-")
+	a.NoError(err)
+
+	store := New(tmp)
+	ctx := context.Background()
+
+	// Entries, which are unknown to the filestore, are kept.
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size: 42,
+		Storage: map[string]string{
+			"Custom": "value",
+		},
+	})
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal(4, len(info.Storage))
+	a.Equal("filestore", info.Storage["Type"])
+	a.Equal("value", info.Storage["Custom"])
+}
+
+func TestDeduplication(t *testing.T) {
+	a := assert.New(t)
+
+	tmp, err := os.MkdirTemp("", "tusd-filestore-")
+	a.NoError(err)
+
+	store := New(tmp)
+	store.DeduplicationPath = filepath.Join(tmp, ".dedup")
+	ctx := context.Background()
+
+	// Upload the same content twice
+	var uploads []handler.Upload
+	var infos []handler.FileInfo
+	for i := 0; i < 2; i++ {
+		upload, err := store.NewUpload(ctx, handler.FileInfo{Size: 11})
+		a.NoError(err)
+		_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+		a.NoError(err)
+		a.NoError(upload.FinishUpload(ctx))
+
+		// Finishing an upload repeatedly has no effect
+		a.NoError(upload.FinishUpload(ctx))
+
+		info, err := upload.GetInfo(ctx)
+		a.NoError(err)
+		a.Equal("b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", info.Storage[StorageKeyContentHash])
+
+		uploads = append(uploads, upload)
+		infos = append(infos, info)
+	}
+
+	// Both uploads are hard links to the content-addressed file
+	contentPath := filepath.Join(store.DeduplicationPath, infos[0].Storage[StorageKeyContentHash])
+	contentStat, err := os.Stat(contentPath)
+	a.NoError(err)
+	for _, info := range infos {
+		stat, err := os.Stat(info.Storage[StorageKeyPath])
+		a.NoError(err)
+		a.True(os.SameFile(contentStat, stat))
+	}
+
+	// The content is kept as long as an upload references it
+	a.NoError(store.AsTerminatableUpload(uploads[0]).Terminate(ctx))
+	_, err = os.Stat(contentPath)
+	a.NoError(err)
+
+	upload, err := store.GetUpload(ctx, infos[1].ID)
+	a.NoError(err)
+	reader, err := upload.GetReader(ctx)
+	a.NoError(err)
+	content, err := io.ReadAll(reader)
+	a.NoError(err)
+	a.Equal("hello world", string(content))
+	reader.Close()
+
+	a.NoError(store.AsTerminatableUpload(upload).Terminate(ctx))
+	_, err = os.Stat(contentPath)
+	a.True(os.IsNotExist(err))
+}
+
+func TestDeduplicationReusedID(t *testing.T) {
+	a := assert.New(t)
+
+	tmp := t.TempDir()
+	store := New(tmp)
+	store.DeduplicationPath = filepath.Join(tmp, ".dedup")
+	ctx := context.Background()
+
+	for _, id := range []string{"first", "second"} {
+		upload, err := store.NewUpload(ctx, handler.FileInfo{ID: id, Size: 11})
+		a.NoError(err)
+		_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+		a.NoError(err)
+		a.NoError(upload.FinishUpload(ctx))
+	}
+
+	// Creating an upload with an existing ID must fail instead of truncating the shared content
+	_, err := store.NewUpload(ctx, handler.FileInfo{ID: "first", Size: 5})
+	a.ErrorContains(err, "binary file for upload first exists already")
+
+	for _, id := range []string{"first", "second"} {
+		upload, err := store.GetUpload(ctx, id)
+		a.NoError(err)
+		reader, err := upload.GetReader(ctx)
+		a.NoError(err)
+		content, err := io.ReadAll(reader)
+		a.NoError(err)
+		reader.Close()
+		a.Equal("hello world", string(content))
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix && !windows
+
+package filestore
+
+import (
+	"errors"
+)
+
+// linkCount returns the number of hard links to the file.
+func linkCount(path string) (uint64, error) {
+	return 0, errors.New("filestore: counting hard links is not supported on this platform")
+}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package filestore
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// linkCount returns the number of hard links to the file.
+func linkCount(path string) (uint64, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+
+	sys, ok := stat.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, fmt.Errorf("filestore: unable to determine number of links to %s", path)
+	}
+
+	return uint64(sys.Nlink), nil
+}
@@ -0,0 +1,24 @@
+//go:build windows
+
+package filestore
+
+import (
+	"os"
+	"syscall"
+)
+
+// linkCount returns the number of hard links to the file.
+func linkCount(path string) (uint64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	var data syscall.ByHandleFileInformation
+	if err := syscall.GetFileInformationByHandle(syscall.Handle(file.Fd()), &data); err != nil {
+		return 0, err
+	}
+
+	return uint64(data.NumberOfLinks), nil
+}
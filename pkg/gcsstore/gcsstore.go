@@ -3,6 +3,7 @@
 // GCSStore is a storage backend that uses the GCSAPI interface in order to store uploads
 // on GCS. Uploads will be represented by two files in GCS; the data file will be stored
 // as an extensionless object [uid] and the JSON info file will stored as [uid].info.
+// If InfoStore is set, the info is saved using it instead of the [uid].info object.
 // In order to store uploads on GCS, make sure to specify the appropriate Google service
 // account file path in the GCS_SERVICE_ACCOUNT_FILE environment variable. Also make sure that
 // this service account file has the "https://www.googleapis.com/auth/devstorage.read_write"
@@ -23,6 +24,7 @@ import (
 	"sync/atomic"
 
 	"cloud.google.com/go/storage"
+	"github.com/tus/tusd/v2/internal/storageinfo"
 	"github.com/tus/tusd/v2/internal/uid"
 	"github.com/tus/tusd/v2/pkg/handler"
 )
@@ -41,6 +43,10 @@ type GCSStore struct {
 	// Service specifies an interface used to communicate with the Google
 	// cloud storage backend. Implementation can be seen in gcsservice file.
 	Service GCSAPI
+
+	// InfoStore, if set, is used to persist the uploads' FileInfo instead of
+	// the .info objects in the bucket.
+	InfoStore handler.InfoStore
 }
 
 // New constructs a new GCS storage backend using the supplied GCS bucket name
@@ -55,6 +61,8 @@ func New(bucket string, service GCSAPI) GCSStore {
 func (store GCSStore) UseIn(composer *handler.StoreComposer) {
 	composer.UseCore(store)
 	composer.UseTerminater(store)
+	composer.UseMetadataUpdater(store)
+	composer.UseStateUpdater(store)
 }
 
 func (store GCSStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
@@ -62,11 +70,10 @@ func (store GCSStore) NewUpload(ctx context.Context, info handler.FileInfo) (han
 		info.ID = uid.Uid()
 	}
 
-	info.Storage = map[string]string{
-		"Type":   "gcsstore",
-		"Bucket": store.Bucket,
-		"Key":    store.keyWithPrefix(info.ID),
-	}
+	info.Storage = storageinfo.Clone(info.Storage)
+	info.Storage["Type"] = "gcsstore"
+	info.Storage["Bucket"] = store.Bucket
+	info.Storage["Key"] = store.keyWithPrefix(info.ID)
 
 	err := store.writeInfo(ctx, store.keyWithPrefix(info.ID), info)
 	if err != nil {
@@ -89,6 +96,14 @@ func (store GCSStore) AsTerminatableUpload(upload handler.Upload) handler.Termin
 	return upload.(*gcsUpload)
 }
 
+func (store GCSStore) AsMetadataUpdatableUpload(upload handler.Upload) handler.MetadataUpdatableUpload {
+	return upload.(*gcsUpload)
+}
+
+func (store GCSStore) AsStateUpdatableUpload(upload handler.Upload) handler.StateUpdatableUpload {
+	return upload.(*gcsUpload)
+}
+
 func (upload gcsUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
 	id := upload.id
 	store := upload.store
@@ -129,6 +144,19 @@ func (upload gcsUpload) WriteChunk(ctx context.Context, offset int64, src io.Rea
 		return 0, err
 	}
 
+	// Keep the offset in the InfoStore up to date. It is only informational, since
+	// the offset is always calculated from the chunk objects.
+	if store.InfoStore != nil && n > 0 {
+		info, err := store.InfoStore.GetInfo(ctx, id)
+		if err != nil {
+			return n, err
+		}
+		info.Offset = offset + n
+		if err := store.InfoStore.SaveInfo(ctx, info); err != nil {
+			return n, err
+		}
+	}
+
 	return n, err
 }
 
@@ -138,29 +166,8 @@ func (upload gcsUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
 	id := upload.id
 	store := upload.store
 
-	info := handler.FileInfo{}
-	i := fmt.Sprintf("%s.info", store.keyWithPrefix(id))
-
-	params := GCSObjectParams{
-		Bucket: store.Bucket,
-		ID:     i,
-	}
-
-	r, err := store.Service.ReadObject(ctx, params)
+	info, err := store.readInfo(ctx, id)
 	if err != nil {
-		if errors.Is(err, storage.ErrObjectNotExist) {
-			return info, handler.ErrNotFound
-		}
-		return info, err
-	}
-	defer r.Close()
-
-	buf, err := io.ReadAll(r)
-	if err != nil {
-		return info, err
-	}
-
-	if err := json.Unmarshal(buf, &info); err != nil {
 		return info, err
 	}
 
@@ -196,7 +203,7 @@ func (upload gcsUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
 	for _, name := range names {
 		sem <- struct{}{}
 		wg.Add(1)
-		params = GCSObjectParams{
+		params := GCSObjectParams{
 			Bucket: store.Bucket,
 			ID:     name,
 		}
@@ -230,7 +237,45 @@ func (upload gcsUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
 	return info, nil
 }
 
+// readInfo reads the stored info, excluding the offset, from the .info object or
+// the InfoStore.
+func (store GCSStore) readInfo(ctx context.Context, id string) (handler.FileInfo, error) {
+	if store.InfoStore != nil {
+		return store.InfoStore.GetInfo(ctx, id)
+	}
+
+	info := handler.FileInfo{}
+	params := GCSObjectParams{
+		Bucket: store.Bucket,
+		ID:     fmt.Sprintf("%s.info", store.keyWithPrefix(id)),
+	}
+
+	r, err := store.Service.ReadObject(ctx, params)
+	if err != nil {
+		if errors.Is(err, storage.ErrObjectNotExist) {
+			return info, handler.ErrNotFound
+		}
+		return info, err
+	}
+	defer r.Close()
+
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return info, err
+	}
+
+	if err := json.Unmarshal(buf, &info); err != nil {
+		return info, err
+	}
+
+	return info, nil
+}
+
 func (store GCSStore) writeInfo(ctx context.Context, id string, info handler.FileInfo) error {
+	if store.InfoStore != nil {
+		return store.InfoStore.SaveInfo(ctx, info)
+	}
+
 	data, err := json.Marshal(info)
 	if err != nil {
 		return err
@@ -252,6 +297,26 @@ func (store GCSStore) writeInfo(ctx context.Context, id string, info handler.Fil
 	return nil
 }
 
+func (upload gcsUpload) UpdateMetaData(ctx context.Context, metaData handler.MetaData) error {
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+	info.MetaData = metaData
+
+	return upload.store.writeInfo(ctx, upload.store.keyWithPrefix(upload.id), info)
+}
+
+func (upload gcsUpload) UpdateState(ctx context.Context, state handler.UploadState) error {
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+	info.State = &state
+
+	return upload.store.writeInfo(ctx, upload.store.keyWithPrefix(upload.id), info)
+}
+
 func (upload gcsUpload) FinishUpload(ctx context.Context) error {
 	id := upload.id
 	store := upload.store
@@ -318,6 +383,13 @@ func (upload gcsUpload) Terminate(ctx context.Context) error {
 		return fmt.Errorf("gcsstore: failed to delete blob objects: %w", err)
 	}
 
+	if store.InfoStore != nil {
+		if err := store.InfoStore.DeleteInfo(ctx, id); err != nil {
+			return fmt.Errorf("gcsstore: failed to delete info: %w", err)
+		}
+		return nil
+	}
+
 	if err := store.Service.DeleteObject(ctx, GCSObjectParams{
 		Bucket: store.Bucket,
 		ID:     store.keyWithPrefix(id) + ".info",
@@ -328,6 +400,9 @@ func (upload gcsUpload) Terminate(ctx context.Context) error {
 	return nil
 }
 
+// GetReader returns a reader for the upload's data. If the upload has not been finished
+// yet, the chunk objects are not composed into the data object yet. In this case, the
+// chunk objects are read one after another, so that the data received so far is provided.
 func (upload gcsUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
 	id := upload.id
 	store := upload.store
@@ -337,7 +412,79 @@ func (upload gcsUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
 		ID:     store.keyWithPrefix(id),
 	}
 
-	return store.Service.ReadObject(ctx, params)
+	r, err := store.Service.ReadObject(ctx, params)
+	if err == nil || !errors.Is(err, storage.ErrObjectNotExist) {
+		return r, err
+	}
+
+	filterParams := GCSFilterParams{
+		Bucket: store.Bucket,
+		Prefix: fmt.Sprintf("%s_", store.keyWithPrefix(id)),
+	}
+
+	names, err := store.Service.FilterObjects(ctx, filterParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chunkReader{
+		ctx:   ctx,
+		store: store,
+		names: names,
+	}, nil
+}
+
+// chunkReader reads the chunk objects of an unfinished upload in order. Each chunk
+// object is only opened once the previous one has been read entirely.
+type chunkReader struct {
+	ctx   context.Context
+	store *GCSStore
+	names []string
+
+	current GCSReader
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.names) == 0 {
+				return 0, io.EOF
+			}
+
+			current, err := r.store.Service.ReadObject(r.ctx, GCSObjectParams{
+				Bucket: r.store.Bucket,
+				ID:     r.names[0],
+			})
+			if err != nil {
+				return 0, err
+			}
+
+			r.current = current
+			r.names = r.names[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			err = r.current.Close()
+			r.current = nil
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+
+	err := r.current.Close()
+	r.current = nil
+	return err
 }
 
 func (store GCSStore) keyWithPrefix(key string) string {
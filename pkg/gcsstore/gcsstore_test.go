@@ -5,6 +5,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"testing"
 
 	"cloud.google.com/go/storage"
@@ -256,6 +257,46 @@ func TestGetReader(t *testing.T) {
 	assert.Equal(mockReaderData, string(buf[:]))
 }
 
+func TestGetReaderUnfinished(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	service := NewMockGCSAPI(mockCtrl)
+	store := gcsstore.New(mockBucket, service)
+
+	ctx := context.Background()
+	gomock.InOrder(
+		service.EXPECT().ReadObject(ctx, gcsstore.GCSObjectParams{
+			Bucket: store.Bucket,
+			ID:     mockID,
+		}).Return(nil, storage.ErrObjectNotExist),
+		service.EXPECT().FilterObjects(ctx, gcsstore.GCSFilterParams{
+			Bucket: store.Bucket,
+			Prefix: mockID + "_",
+		}).Return([]string{mockID + "_0", mockID + "_1"}, nil),
+		service.EXPECT().ReadObject(ctx, gcsstore.GCSObjectParams{
+			Bucket: store.Bucket,
+			ID:     mockID + "_0",
+		}).Return(MockReader{bytes.NewReader([]byte("hello"))}, nil),
+		service.EXPECT().ReadObject(ctx, gcsstore.GCSObjectParams{
+			Bucket: store.Bucket,
+			ID:     mockID + "_1",
+		}).Return(MockReader{bytes.NewReader([]byte("world"))}, nil),
+	)
+
+	upload, err := store.GetUpload(ctx, mockID)
+	assert.Nil(err)
+
+	reader, err := upload.GetReader(ctx)
+	assert.Nil(err)
+
+	data, err := io.ReadAll(reader)
+	assert.Nil(err)
+	assert.Equal(mockReaderData, string(data))
+	assert.Nil(reader.Close())
+}
+
 func TestTerminate(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
@@ -286,6 +327,49 @@ func TestTerminate(t *testing.T) {
 	assert.Nil(err)
 }
 
+func TestUpdateMetaData(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	service := NewMockGCSAPI(mockCtrl)
+	store := gcsstore.New(mockBucket, service)
+
+	params := gcsstore.GCSObjectParams{
+		Bucket: store.Bucket,
+		ID:     fmt.Sprintf("%s.info", mockID),
+	}
+
+	filterParams := gcsstore.GCSFilterParams{
+		Bucket: store.Bucket,
+		Prefix: mockID,
+	}
+
+	r := MockReader{
+		bytes.NewReader([]byte(mockTusdInfoJson)),
+	}
+
+	updatedInfo := mockTusdInfo
+	updatedInfo.Offset = 0
+	updatedInfo.MetaData = handler.MetaData{"foo": "baz"}
+	data, err := json.Marshal(updatedInfo)
+	assert.Nil(err)
+	w := bytes.NewReader(data)
+
+	ctx := context.Background()
+	gomock.InOrder(
+		service.EXPECT().ReadObject(ctx, params).Return(r, nil),
+		service.EXPECT().FilterObjects(ctx, filterParams).Return([]string{}, nil),
+		service.EXPECT().WriteObject(ctx, params, w).Return(int64(w.Len()), nil),
+	)
+
+	upload, err := store.GetUpload(ctx, mockID)
+	assert.Nil(err)
+
+	err = store.AsMetadataUpdatableUpload(upload).UpdateMetaData(ctx, handler.MetaData{"foo": "baz"})
+	assert.Nil(err)
+}
+
 func TestFinishUpload(t *testing.T) {
 	mockCtrl := gomock.NewController(t)
 	defer mockCtrl.Finish()
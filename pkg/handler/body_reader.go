@@ -30,6 +30,8 @@ type bodyReader struct {
 	ctx          *httpContext
 	reader       io.ReadCloser
 	onReadDone   func()
+	// peeked contains data, which has been read using peek, but not yet consumed.
+	peeked []byte
 
 	// lock protects concurrent access to err.
 	lock sync.RWMutex
@@ -45,6 +47,12 @@ func newBodyReader(c *httpContext, maxSize int64) *bodyReader {
 }
 
 func (r *bodyReader) Read(b []byte) (int, error) {
+	if len(r.peeked) > 0 {
+		n := copy(b, r.peeked)
+		r.peeked = r.peeked[n:]
+		return n, nil
+	}
+
 	r.lock.RLock()
 	hasErrored := r.err != nil
 	r.lock.RUnlock()
@@ -116,6 +124,24 @@ func (r *bodyReader) Read(b []byte) (int, error) {
 	return n, nil
 }
 
+// peek reads up to n bytes from the request body without consuming them, i.e. they
+// are returned again by subsequent reads. If the body ends or an error occurs before,
+// fewer bytes are returned.
+func (r *bodyReader) peek(n int) []byte {
+	data := make([]byte, n)
+	read := 0
+	for read < n {
+		m, err := r.Read(data[read:])
+		read += m
+		if err != nil {
+			break
+		}
+	}
+
+	r.peeked = data[:read]
+	return r.peeked
+}
+
 func (r *bodyReader) hasError() error {
 	r.lock.RLock()
 	err := r.err
@@ -6,16 +6,29 @@ package handler
 type StoreComposer struct {
 	Core DataStore
 
-	UsesTerminater     bool
-	Terminater         TerminaterDataStore
-	UsesLocker         bool
-	Locker             Locker
-	UsesConcater       bool
-	Concater           ConcaterDataStore
-	UsesLengthDeferrer bool
-	LengthDeferrer     LengthDeferrerDataStore
-	ContentServer      ContentServerDataStore
-	UsesContentServer  bool
+	UsesTerminater       bool
+	Terminater           TerminaterDataStore
+	UsesLocker           bool
+	Locker               Locker
+	UsesConcater         bool
+	Concater             ConcaterDataStore
+	UsesLengthDeferrer   bool
+	LengthDeferrer       LengthDeferrerDataStore
+	ContentServer        ContentServerDataStore
+	UsesContentServer    bool
+	UsesRangeReader      bool
+	RangeReader          RangeReaderDataStore
+	UsesConcurrentReader bool
+	ConcurrentReader     ConcurrentReaderDataStore
+	UsesEventBus         bool
+	EventBus             EventBus
+	UsesQuotaStore       bool
+	QuotaStore           QuotaStore
+
+	UsesMetadataUpdater bool
+	MetadataUpdater     MetadataUpdaterDataStore
+	UsesStateUpdater    bool
+	StateUpdater        StateUpdaterDataStore
 }
 
 // NewStoreComposer creates a new and empty store composer.
@@ -58,6 +71,12 @@ func (store *StoreComposer) Capabilities() string {
 	} else {
 		str += "✗"
 	}
+	str += ` MetadataUpdater: `
+	if store.UsesMetadataUpdater {
+		str += "✓"
+	} else {
+		str += "✗"
+	}
 
 	return str
 }
@@ -92,3 +111,33 @@ func (store *StoreComposer) UseContentServer(ext ContentServerDataStore) {
 	store.UsesContentServer = ext != nil
 	store.ContentServer = ext
 }
+
+func (store *StoreComposer) UseRangeReader(ext RangeReaderDataStore) {
+	store.UsesRangeReader = ext != nil
+	store.RangeReader = ext
+}
+
+func (store *StoreComposer) UseConcurrentReader(ext ConcurrentReaderDataStore) {
+	store.UsesConcurrentReader = ext != nil
+	store.ConcurrentReader = ext
+}
+
+func (store *StoreComposer) UseEventBus(ext EventBus) {
+	store.UsesEventBus = ext != nil
+	store.EventBus = ext
+}
+
+func (store *StoreComposer) UseQuotaStore(ext QuotaStore) {
+	store.UsesQuotaStore = ext != nil
+	store.QuotaStore = ext
+}
+
+func (store *StoreComposer) UseMetadataUpdater(ext MetadataUpdaterDataStore) {
+	store.UsesMetadataUpdater = ext != nil
+	store.MetadataUpdater = ext
+}
+
+func (store *StoreComposer) UseStateUpdater(ext StateUpdaterDataStore) {
+	store.UsesStateUpdater = ext != nil
+	store.StateUpdater = ext
+}
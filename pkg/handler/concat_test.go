@@ -411,4 +411,267 @@ func TestConcat(t *testing.T) {
 			ResBody: "ERR_CONCATENATION_UNSUPPORTED: Upload-Concat header is not supported by server\n",
 		}).Run(handler, t)
 	})
+
+	SubTest(t, "ConcatenationUnfinished", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		SubTest(t, "ExtensionDiscovery", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			handler, _ := NewHandler(Config{
+				StoreComposer:                 composer,
+				EnableConcatenationUnfinished: true,
+			})
+
+			(&httpTest{
+				Method: "OPTIONS",
+				Code:   http.StatusOK,
+				ResHeader: map[string]string{
+					"Tus-Extension": "creation,creation-with-upload,termination,concatenation,concatenation-unfinished,creation-defer-length",
+				},
+			}).Run(handler, t)
+		})
+
+		SubTest(t, "CreateAndFinish", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			a := assert.New(t)
+
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			uploadA := NewMockFullUpload(ctrl)
+			uploadB := NewMockFullUpload(ctrl)
+			uploadC := NewMockFullUpload(ctrl)
+
+			infoA := FileInfo{ID: "a", IsPartial: true, Size: 5, Offset: 5}
+			infoB := FileInfo{ID: "b", IsPartial: true, Size: 5, Offset: 2}
+			infoC := FileInfo{
+				ID:             "foo",
+				Size:           10,
+				IsFinal:        true,
+				PartialUploads: []string{"a", "b"},
+				MetaData:       make(map[string]string),
+			}
+
+			gomock.InOrder(
+				// Creation of the final upload
+				store.EXPECT().GetUpload(gomock.Any(), "a").Return(uploadA, nil),
+				uploadA.EXPECT().GetInfo(gomock.Any()).Return(infoA, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "b").Return(uploadB, nil),
+				uploadB.EXPECT().GetInfo(gomock.Any()).Return(infoB, nil),
+				store.EXPECT().NewUpload(gomock.Any(), FileInfo{
+					Size:           10,
+					IsFinal:        true,
+					PartialUploads: []string{"a", "b"},
+					MetaData:       make(map[string]string),
+				}).Return(uploadC, nil),
+				uploadC.EXPECT().GetInfo(gomock.Any()).Return(infoC, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "a").Return(uploadA, nil),
+				uploadA.EXPECT().GetInfo(gomock.Any()).Return(infoA, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "b").Return(uploadB, nil),
+				uploadB.EXPECT().GetInfo(gomock.Any()).Return(infoB, nil),
+
+				// Status of the final upload
+				store.EXPECT().GetUpload(gomock.Any(), "foo").Return(uploadC, nil),
+				uploadC.EXPECT().GetInfo(gomock.Any()).Return(infoC, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "a").Return(uploadA, nil),
+				uploadA.EXPECT().GetInfo(gomock.Any()).Return(infoA, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "b").Return(uploadB, nil),
+				uploadB.EXPECT().GetInfo(gomock.Any()).Return(infoB, nil),
+
+				// Last partial upload finishes
+				store.EXPECT().GetUpload(gomock.Any(), "b").Return(uploadB, nil),
+				uploadB.EXPECT().GetInfo(gomock.Any()).Return(infoB, nil),
+				uploadB.EXPECT().WriteChunk(gomock.Any(), int64(2), NewReaderMatcher("abc")).Return(int64(3), nil),
+				uploadB.EXPECT().FinishUpload(gomock.Any()),
+
+				// Concatenation of the final upload
+				store.EXPECT().GetUpload(gomock.Any(), "foo").Return(uploadC, nil),
+				uploadC.EXPECT().GetInfo(gomock.Any()).Return(infoC, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "a").Return(uploadA, nil),
+				uploadA.EXPECT().GetInfo(gomock.Any()).Return(infoA, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "b").Return(uploadB, nil),
+				uploadB.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "b", IsPartial: true, Size: 5, Offset: 5}, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "a").Return(uploadA, nil),
+				uploadA.EXPECT().GetInfo(gomock.Any()).Return(infoA, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "b").Return(uploadB, nil),
+				uploadB.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "b", IsPartial: true, Size: 5, Offset: 5}, nil),
+				store.EXPECT().AsConcatableUpload(uploadC).Return(uploadC),
+				uploadC.EXPECT().ConcatUploads(gomock.Any(), []Upload{uploadA, uploadB}).Return(nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				BasePath:                      "files",
+				StoreComposer:                 composer,
+				EnableConcatenationUnfinished: true,
+				NotifyCompleteUploads:         true,
+			})
+
+			c := make(chan HookEvent, 2)
+			handler.CompleteUploads = c
+
+			(&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Upload-Concat": "final;/files/a /files/b",
+				},
+				Code: http.StatusCreated,
+			}).Run(handler, t)
+
+			a.Empty(c)
+
+			(&httpTest{
+				Method: "HEAD",
+				URL:    "foo",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+				},
+				Code: http.StatusOK,
+				ResHeader: map[string]string{
+					"Upload-Length": "10",
+					"Upload-Offset": "7",
+				},
+			}).Run(handler, t)
+
+			(&httpTest{
+				Method: "PATCH",
+				URL:    "b",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Content-Type":  "application/offset+octet-stream",
+					"Upload-Offset": "2",
+				},
+				ReqBody: strings.NewReader("abc"),
+				Code:    http.StatusNoContent,
+			}).Run(handler, t)
+
+			a.Equal("b", (<-c).Upload.ID)
+
+			info := (<-c).Upload
+			a.Equal("foo", info.ID)
+			a.EqualValues(10, info.Size)
+			a.EqualValues(10, info.Offset)
+			a.True(info.IsFinal)
+		})
+
+		SubTest(t, "StatusReportsProgress", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			uploadA := NewMockFullUpload(ctrl)
+			uploadB := NewMockFullUpload(ctrl)
+			uploadC := NewMockFullUpload(ctrl)
+
+			// The HEAD request only reports the progress, but does not concatenate the
+			// partial uploads even though they are finished.
+			gomock.InOrder(
+				store.EXPECT().GetUpload(gomock.Any(), "foo").Return(uploadC, nil),
+				uploadC.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+					ID:             "foo",
+					Size:           10,
+					IsFinal:        true,
+					PartialUploads: []string{"a", "b"},
+				}, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "a").Return(uploadA, nil),
+				uploadA.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "a", IsPartial: true, Size: 5, Offset: 5}, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "b").Return(uploadB, nil),
+				uploadB.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{ID: "b", IsPartial: true, Size: 5, Offset: 3}, nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				BasePath:                      "files",
+				StoreComposer:                 composer,
+				EnableConcatenationUnfinished: true,
+			})
+
+			(&httpTest{
+				Method: "HEAD",
+				URL:    "foo",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+				},
+				Code: http.StatusOK,
+				ResHeader: map[string]string{
+					"Upload-Length": "10",
+					"Upload-Offset": "8",
+				},
+			}).Run(handler, t)
+		})
+
+		SubTest(t, "RetryCompletesConcatenation", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			uploadA := NewMockFullUpload(ctrl)
+			uploadB := NewMockFullUpload(ctrl)
+			uploadC := NewMockFullUpload(ctrl)
+
+			infoA := FileInfo{ID: "a", IsPartial: true, Size: 5, Offset: 5}
+			infoB := FileInfo{ID: "b", IsPartial: true, Size: 5, Offset: 5}
+
+			gomock.InOrder(
+				store.EXPECT().GetUpload(gomock.Any(), "foo").Return(uploadC, nil),
+				uploadC.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+					ID:             "foo",
+					Size:           10,
+					IsFinal:        true,
+					PartialUploads: []string{"a", "b"},
+				}, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "a").Return(uploadA, nil),
+				uploadA.EXPECT().GetInfo(gomock.Any()).Return(infoA, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "b").Return(uploadB, nil),
+				uploadB.EXPECT().GetInfo(gomock.Any()).Return(infoB, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "a").Return(uploadA, nil),
+				uploadA.EXPECT().GetInfo(gomock.Any()).Return(infoA, nil),
+				store.EXPECT().GetUpload(gomock.Any(), "b").Return(uploadB, nil),
+				uploadB.EXPECT().GetInfo(gomock.Any()).Return(infoB, nil),
+				store.EXPECT().AsConcatableUpload(uploadC).Return(uploadC),
+				uploadC.EXPECT().ConcatUploads(gomock.Any(), []Upload{uploadA, uploadB}).Return(nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				BasePath:                      "files",
+				StoreComposer:                 composer,
+				EnableConcatenationUnfinished: true,
+			})
+
+			(&httpTest{
+				Method: "PATCH",
+				URL:    "foo",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Content-Type":  "application/offset+octet-stream",
+					"Upload-Offset": "10",
+				},
+				Code: http.StatusNoContent,
+				ResHeader: map[string]string{
+					"Upload-Offset": "10",
+				},
+			}).Run(handler, t)
+		})
+
+		SubTest(t, "CreateWithDeferredLengthFail", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			upload := NewMockFullUpload(ctrl)
+
+			gomock.InOrder(
+				store.EXPECT().GetUpload(gomock.Any(), "a").Return(upload, nil),
+				upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+					ID:             "a",
+					IsPartial:      true,
+					SizeIsDeferred: true,
+					Offset:         3,
+				}, nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				BasePath:                      "files",
+				StoreComposer:                 composer,
+				EnableConcatenationUnfinished: true,
+			})
+
+			(&httpTest{
+				Method: "POST",
+				ReqHeader: map[string]string{
+					"Tus-Resumable": "1.0.0",
+					"Upload-Concat": "final;/files/a",
+				},
+				Code: http.StatusBadRequest,
+			}).Run(handler, t)
+		})
+	})
 }
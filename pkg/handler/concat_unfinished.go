@@ -0,0 +1,236 @@
+package handler
+
+import (
+	"context"
+	"slices"
+	"sync"
+)
+
+// concatWaiters keeps track of final uploads, which have been created using the
+// concatenation-unfinished extension and whose partial uploads are not all finished yet.
+// Once a partial upload finishes, the final uploads waiting for it are looked up, so
+// that their concatenation can be completed eagerly. The registry is only kept in
+// memory. Final uploads, which are lost after a restart, are registered again once a
+// HEAD request for them is received. Entries are removed once the concatenation is
+// completed, or when the final upload or one of its partial uploads is terminated or
+// cannot be found anymore, e.g. because it expired.
+type concatWaiters struct {
+	mutex sync.Mutex
+	// finals maps the ID of a final upload to the IDs of its partial uploads.
+	finals map[string][]string
+}
+
+func newConcatWaiters() *concatWaiters {
+	return &concatWaiters{
+		finals: make(map[string][]string),
+	}
+}
+
+func (w *concatWaiters) add(finalID string, partialIDs []string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.finals[finalID] = partialIDs
+}
+
+func (w *concatWaiters) remove(finalID string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	delete(w.finals, finalID)
+}
+
+// removePartial removes all final uploads, which include the given partial upload.
+func (w *concatWaiters) removePartial(partialID string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for finalID, partialIDs := range w.finals {
+		if slices.Contains(partialIDs, partialID) {
+			delete(w.finals, finalID)
+		}
+	}
+}
+
+// waitingFor returns the IDs of all final uploads, which include the given partial upload.
+func (w *concatWaiters) waitingFor(partialID string) []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var finalIDs []string
+	for finalID, partialIDs := range w.finals {
+		if slices.Contains(partialIDs, partialID) {
+			finalIDs = append(finalIDs, finalID)
+		}
+	}
+
+	return finalIDs
+}
+
+// concatenationProgress sets the offset of a final upload, which has been created before
+// all of its partial uploads were finished, to the amount of data that the partial uploads
+// have received so far. Unlike completeConcatenation, it does not modify any upload, so it
+// can be used when handling read requests.
+func (handler *UnroutedHandler) concatenationProgress(c *httpContext, info FileInfo) (FileInfo, error) {
+	if !info.IsFinal || info.Offset == info.Size {
+		return info, nil
+	}
+
+	_, _, offset, err := handler.sizeOfUploads(c, info.PartialUploads, true)
+	if err != nil {
+		handler.forgetMissingPartials(info.ID, err)
+		return info, err
+	}
+
+	// Register the final upload again in case it has been lost after a restart.
+	handler.concatWaiters.add(info.ID, info.PartialUploads)
+	info.Offset = offset
+	return info, nil
+}
+
+// completeConcatenation concatenates the partial uploads of a final upload, which has been
+// created before all of its partial uploads were finished. If some partial uploads are still
+// in progress, nothing is concatenated and the returned info's offset is set to the amount of
+// data that the partial uploads have received so far. Otherwise, the partial uploads are
+// concatenated and the finish events are emitted for the final upload.
+// The caller must hold the lock for the final upload. To avoid deadlocks, locks are always
+// acquired for the final upload first and then for its partial uploads.
+func (handler *UnroutedHandler) completeConcatenation(c *httpContext, upload Upload, info FileInfo) (FileInfo, error) {
+	if !info.IsFinal || info.Offset == info.Size {
+		return info, nil
+	}
+
+	// First, check whether all partial uploads are finished without locking them. Otherwise,
+	// we would interrupt their ongoing PATCH requests every time a client polls the final upload.
+	_, size, offset, err := handler.sizeOfUploads(c, info.PartialUploads, true)
+	if err != nil {
+		handler.forgetMissingPartials(info.ID, err)
+		return info, err
+	}
+	if offset != size {
+		info.Offset = offset
+		return info, nil
+	}
+
+	// All partial uploads appear to be finished. Lock them to wait for their requests to
+	// complete, so that the data store has finished them before we concatenate them.
+	if handler.composer.UsesLocker {
+		for _, id := range info.PartialUploads {
+			lock, err := handler.lockConcatUpload(c, id)
+			if err != nil {
+				return info, err
+			}
+
+			defer lock.Unlock()
+		}
+	}
+
+	partialUploads, size, offset, err := handler.sizeOfUploads(c, info.PartialUploads, true)
+	if err != nil {
+		handler.forgetMissingPartials(info.ID, err)
+		return info, err
+	}
+	if offset != size {
+		info.Offset = offset
+		return info, nil
+	}
+
+	concatableUpload := handler.composer.Concater.AsConcatableUpload(upload)
+	if err := concatableUpload.ConcatUploads(c, partialUploads); err != nil {
+		return info, err
+	}
+	info.Offset = info.Size
+	handler.concatWaiters.remove(info.ID)
+
+	info, err = handler.inspectFinishedUpload(c, upload, info)
+	if err != nil {
+		return info, err
+	}
+
+	_, err = handler.emitFinishEvents(c, HTTPResponse{}, info)
+	return info, err
+}
+
+// forgetMissingPartials removes the final upload from the registry, if err indicates that
+// one of its partial uploads cannot be found anymore. Its concatenation can then never be
+// completed.
+func (handler *UnroutedHandler) forgetMissingPartials(finalID string, err error) {
+	if handlerErr, ok := err.(Error); ok && handlerErr.ErrorCode == ErrNotFound.ErrorCode {
+		handler.concatWaiters.remove(finalID)
+	}
+}
+
+// lockConcatUpload acquires the lock for an upload involved in a concatenation. Unlike
+// lockUpload, requests to release the lock are ignored since the concatenation is not
+// interruptible, but only holds the lock for a short period.
+func (handler *UnroutedHandler) lockConcatUpload(c *httpContext, id string) (lock Lock, err error) {
+	spanCtx, span := handler.startSpan(c, "AcquireLock")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	lock, err = handler.composer.Locker.NewLock(id)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancelContext := context.WithTimeout(spanCtx, handler.config.AcquireLockTimeout)
+	defer cancelContext()
+
+	if err := lock.Lock(ctx, func() {}); err != nil {
+		return nil, err
+	}
+
+	return lock, nil
+}
+
+// finalizeWaitingConcatenations completes the concatenation of all final uploads, which
+// were waiting for the partial upload that was finished in the current request. It must be
+// called after the lock for the partial upload has been released.
+func (handler *UnroutedHandler) finalizeWaitingConcatenations(c *httpContext) {
+	if handler.concatWaiters == nil || c.finishedPartialUpload == "" {
+		return
+	}
+
+	for _, finalID := range handler.concatWaiters.waitingFor(c.finishedPartialUpload) {
+		// Use a separate context, so that log entries and hook events refer to the final upload.
+		fc := *c
+		fc.log = c.log.With("id", finalID)
+
+		if err := handler.finalizeConcatenation(&fc, finalID); err != nil {
+			if handlerErr, ok := err.(Error); ok && handlerErr.ErrorCode == ErrNotFound.ErrorCode {
+				// The final upload has been terminated in the meantime.
+				handler.concatWaiters.remove(finalID)
+				continue
+			}
+
+			fc.log.ErrorContext(c, "ConcatenationError", "error", err)
+		}
+	}
+}
+
+// finalizeConcatenation locks the final upload with the given ID and completes its
+// concatenation if all partial uploads are finished.
+func (handler *UnroutedHandler) finalizeConcatenation(c *httpContext, id string) error {
+	if handler.composer.UsesLocker {
+		lock, err := handler.lockConcatUpload(c, id)
+		if err != nil {
+			return err
+		}
+
+		defer lock.Unlock()
+	}
+
+	upload, err := handler.composer.Core.GetUpload(c, id)
+	if err != nil {
+		return err
+	}
+
+	info, err := handler.getInfo(c, upload)
+	if err != nil {
+		return err
+	}
+
+	_, err = handler.completeConcatenation(c, upload, info)
+	return err
+}
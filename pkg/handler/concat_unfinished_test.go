@@ -0,0 +1,26 @@
+package handler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcatWaiters(t *testing.T) {
+	a := assert.New(t)
+
+	w := newConcatWaiters()
+	w.add("final-1", []string{"a", "b"})
+	w.add("final-2", []string{"b", "c"})
+	w.add("final-3", []string{"c"})
+
+	a.ElementsMatch([]string{"final-1", "final-2"}, w.waitingFor("b"))
+
+	// Terminating a partial upload removes all final uploads including it.
+	w.removePartial("b")
+	a.Empty(w.waitingFor("a"))
+	a.Equal([]string{"final-3"}, w.waitingFor("c"))
+
+	w.remove("final-3")
+	a.Empty(w.finals)
+}
@@ -0,0 +1,139 @@
+package handler
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var ErrTooManyUploads = NewError("ERR_TOO_MANY_UPLOADS", "too many concurrent uploads", http.StatusTooManyRequests)
+
+var reForwardedFor = regexp.MustCompile(`for="?\[?([^;,"\]]+)`)
+
+// concurrencyLimiter counts the requests which are currently receiving upload data,
+// in total as well as grouped by client address and by key. It does not block if a
+// limit is reached, but lets the caller reject the request.
+type concurrencyLimiter struct {
+	maxTotal     int
+	maxPerClient int
+	maxPerKey    int
+
+	mutex   sync.Mutex
+	total   int
+	clients map[string]int
+	keys    map[string]int
+}
+
+func newConcurrencyLimiter(config Config) *concurrencyLimiter {
+	return &concurrencyLimiter{
+		maxTotal:     config.MaxConcurrentUploads,
+		maxPerClient: config.MaxConcurrentUploadsPerClient,
+		maxPerKey:    config.MaxConcurrentUploadsPerKey,
+		clients:      make(map[string]int),
+		keys:         make(map[string]int),
+	}
+}
+
+// acquire reserves a slot for a request from the given client and with the given
+// key, which may be empty. If any limit is reached, false is returned and no slot
+// is reserved. Otherwise, release must be called once the request is done.
+func (l *concurrencyLimiter) acquire(client string, key string) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.maxTotal > 0 && l.total >= l.maxTotal {
+		return false
+	}
+	if l.maxPerClient > 0 && l.clients[client] >= l.maxPerClient {
+		return false
+	}
+	if key != "" && l.maxPerKey > 0 && l.keys[key] >= l.maxPerKey {
+		return false
+	}
+
+	l.total++
+	l.clients[client]++
+	if key != "" {
+		l.keys[key]++
+	}
+
+	return true
+}
+
+// release frees the slot reserved by acquire.
+func (l *concurrencyLimiter) release(client string, key string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.total--
+	decrementOrDelete(l.clients, client)
+	if key != "" {
+		decrementOrDelete(l.keys, key)
+	}
+}
+
+// decrementOrDelete decreases the counter in the map and removes the entry once
+// it reaches zero, so that the map does not grow with every client ever seen.
+func decrementOrDelete(m map[string]int, key string) {
+	if m[key] <= 1 {
+		delete(m, key)
+	} else {
+		m[key]--
+	}
+}
+
+// acquireUploadSlot reserves a slot for receiving upload data in the current request.
+// If a limit for concurrent uploads is reached, ErrTooManyUploads is returned including
+// a Retry-After header. Otherwise, the returned function must be called once the
+// data has been received.
+func (handler *UnroutedHandler) acquireUploadSlot(c *httpContext, key string) (func(), error) {
+	if handler.concurrencyLimiter == nil {
+		return func() {}, nil
+	}
+
+	client := getClientAddress(c.req, handler.config.RespectForwardedHeaders)
+
+	if !handler.concurrencyLimiter.acquire(client, key) {
+		c.log.WarnContext(c, "ConcurrencyLimitReached", "client", client, "key", key)
+
+		err := ErrTooManyUploads
+		err.HTTPResponse = err.HTTPResponse.MergeWith(HTTPResponse{
+			Header: HTTPHeader{
+				"Retry-After": strconv.Itoa(int(handler.config.ConcurrencyRetryAfter.Seconds())),
+			},
+		})
+		return nil, err
+	}
+
+	return func() {
+		handler.concurrencyLimiter.release(client, key)
+	}, nil
+}
+
+// getClientAddress returns the IP address of the client that sent the request. If
+// allowForwarded is true, the address from the X-Forwarded-For or Forwarded headers
+// is preferred.
+func getClientAddress(r *http.Request, allowForwarded bool) string {
+	if allowForwarded {
+		if h := r.Header.Get("X-Forwarded-For"); h != "" {
+			addr, _, _ := strings.Cut(h, ",")
+			return strings.TrimSpace(addr)
+		}
+
+		if h := r.Header.Get("Forwarded"); h != "" {
+			if r := reForwardedFor.FindStringSubmatch(h); len(r) == 2 {
+				return r[1]
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
@@ -0,0 +1,130 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestConcurrency(t *testing.T) {
+	SubTest(t, "TooManyUploads", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		writeStarted := make(chan struct{})
+		writeContinue := make(chan struct{})
+
+		store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil).Times(2)
+		upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+			ID:     "yes",
+			Offset: 0,
+			Size:   5,
+		}, nil).Times(2)
+		upload.EXPECT().WriteChunk(gomock.Any(), int64(0), gomock.Any()).DoAndReturn(func(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+			close(writeStarted)
+			<-writeContinue
+			data, err := io.ReadAll(src)
+			return int64(len(data)), err
+		})
+		upload.EXPECT().FinishUpload(gomock.Any())
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:        composer,
+			MaxConcurrentUploads: 1,
+		})
+
+		req := httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}
+
+		done := make(chan struct{})
+		go func() {
+			req.Run(handler, t)
+			close(done)
+		}()
+
+		<-writeStarted
+		a := assert.New(t)
+		a.Equal(int64(1), atomic.LoadInt64(handler.Metrics.UploadsActive))
+
+		// While the first request is receiving data, a second one must be rejected.
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusTooManyRequests,
+			ResHeader: map[string]string{
+				"Retry-After": "10",
+			},
+			ResBody: "ERR_TOO_MANY_UPLOADS: too many concurrent uploads\n",
+		}).Run(handler, t)
+
+		close(writeContinue)
+		<-done
+		a.Equal(int64(0), atomic.LoadInt64(handler.Metrics.UploadsActive))
+	})
+
+	SubTest(t, "PerKeyLimit", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   5,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+		)
+
+		var keys []string
+		handler, _ := NewHandler(Config{
+			StoreComposer:              composer,
+			MaxConcurrentUploadsPerKey: 1,
+			PreUploadReceiveCallback: func(hook HookEvent) (HTTPResponse, ReceiveChanges, error) {
+				keys = append(keys, "user-1")
+				return HTTPResponse{}, ReceiveChanges{ConcurrencyKey: "user-1"}, nil
+			},
+		})
+
+		// The slot is released after the request, so sequential requests with
+		// the same key are not affected.
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		assert.Equal(t, []string{"user-1"}, keys)
+	})
+}
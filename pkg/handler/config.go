@@ -2,10 +2,14 @@ package handler
 
 import (
 	"errors"
+	"net/http"
 	"net/url"
 	"regexp"
 	"time"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/slog"
 )
 
@@ -28,14 +32,34 @@ type Config struct {
 	// See https://datatracker.ietf.org/doc/draft-ietf-httpbis-resumable-upload/
 	EnableExperimentalProtocol bool
 	// DisableDownload indicates whether the server will refuse downloads of the
-	// uploaded file, by not mounting the GET handler.
+	// uploaded file, by not mounting the GET handler. This also disables the
+	// upload event stream.
 	DisableDownload bool
+	// DownloadSigningKey, if not empty, restricts downloads to GET requests carrying a
+	// valid and unexpired signature in their query parameters. Such URLs can be
+	// created using SignDownloadURL with the same key.
+	DownloadSigningKey []byte
+	// UploadTokenKey, if not empty, requires all requests for creating and modifying
+	// uploads to carry an upload token signed with this key. Tokens are created using
+	// SignUploadToken and restrict the new upload's size, meta data and ID. Later
+	// requests for an upload must carry a token with the same subject.
+	UploadTokenKey []byte
+	// EnableMetadataUpdate allows clients to replace the meta data of existing uploads
+	// using PUT requests to <upload URL>/metadata. It requires a data store implementing
+	// MetadataUpdaterDataStore. Use PreUpdateMetadataCallback to authorize such requests.
+	EnableMetadataUpdate bool
 	// DisableTermination indicates whether the server will refuse termination
 	// requests of the uploaded file, by not mounting the DELETE handler.
 	DisableTermination bool
 	// DisableConcatenation indicates whether the server will refuse POST requests
 	// for creating uploads that use the concatenation extension.
 	DisableConcatenation bool
+	// EnableConcatenationUnfinished enables the concatenation-unfinished extension, which
+	// allows clients to create a final upload before all of its partial uploads are finished.
+	// The final upload reports the progress of its partial uploads on HEAD requests and is
+	// completed automatically once the last partial upload finishes.
+	// It has no effect if the concatenation extension is disabled or unsupported by the data store.
+	EnableConcatenationUnfinished bool
 	// Cors can be used to customize the handling of Cross-Origin Resource Sharing (CORS).
 	// See the CorsConfig struct for more details.
 	// Defaults to DefaultCorsConfig.
@@ -52,15 +76,28 @@ type Config struct {
 	// NotifyCreatedUploads indicates whether sending notifications about
 	// the upload having been created using the CreatedUploads channel should be enabled.
 	NotifyCreatedUploads bool
+	// NotifyUpdatedMetadata indicates whether sending notifications about updates
+	// of an upload's meta data using the UpdatedMetadata channel should be enabled.
+	NotifyUpdatedMetadata bool
 	// UploadProgressInterval specifies the interval at which the upload progress
 	// notifications are sent to the UploadProgress channel, if enabled.
 	// Defaults to 1s.
 	UploadProgressInterval time.Duration
 	// Logger is the logger to use internally, mostly for printing requests.
 	Logger *slog.Logger
+	// TracerProvider is used to create OpenTelemetry spans for requests and the
+	// operations performed while handling them, such as acquiring locks and interacting
+	// with the data store. Defaults to the global tracer provider, which does not record
+	// any spans unless it is configured by the application.
+	TracerProvider trace.TracerProvider
+	// Propagator is used to extract the trace context from incoming requests, so that
+	// the spans are connected to the trace of the client. Defaults to the global
+	// text map propagator.
+	Propagator propagation.TextMapPropagator
 	// Respect the X-Forwarded-Host, X-Forwarded-Proto and Forwarded headers
 	// potentially set by proxies when generating an absolute URL in the
-	// response to POST requests.
+	// response to POST requests. In addition, the X-Forwarded-For header is
+	// used to identify clients for MaxConcurrentUploadsPerClient.
 	RespectForwardedHeaders bool
 	// PreUploadCreateCallback will be invoked before a new upload is created, if the
 	// property is supplied. If the callback returns no error, the upload will be created
@@ -85,6 +122,90 @@ type Config struct {
 	// If the error is non-nil, the error will be forwarded to the client. Furthermore,
 	// HTTPResponse will be ignored and the error value can contain values for the HTTP response.
 	PreUploadTerminateCallback func(hook HookEvent) (HTTPResponse, error)
+	// PreUpdateMetadataCallback will be invoked on PUT requests to <upload URL>/metadata
+	// before the upload's meta data is replaced. The event's upload contains the new meta
+	// data from the request. If the callback returns no error, the meta data is updated,
+	// optionally replaced by FileInfoChanges.MetaData. Other fields of FileInfoChanges
+	// are ignored. If the error is non-nil, the update is rejected and the error is
+	// sent to the client.
+	PreUpdateMetadataCallback func(hook HookEvent) (HTTPResponse, FileInfoChanges, error)
+	// PreUploadReceiveCallback will be invoked before data for an upload is received, i.e.
+	// for every PATCH request and for POST requests containing upload data. This allows
+	// the application to reject the transfer or adjust how the data is received.
+	// If the callback returns no error, the ReceiveChanges are applied to the current request
+	// and optional values from HTTPResponse will be contained in the HTTP response.
+	// If the error is non-nil, no data is received and the error will be forwarded to the client.
+	// Furthermore, HTTPResponse will be ignored and the error value can contain values for the
+	// HTTP response.
+	PreUploadReceiveCallback func(hook HookEvent) (HTTPResponse, ReceiveChanges, error)
+	// MaxBandwidth defines how many bytes per second may be received across all uploads
+	// handled by this handler. If its value is 0 or smaller, no limit will be enforced.
+	MaxBandwidth int64
+	// MaxUploadBandwidth defines how many bytes per second may be received for a single
+	// upload. The limit can be overridden for individual requests using the
+	// PreUploadReceiveCallback. If its value is 0 or smaller, no limit will be enforced.
+	MaxUploadBandwidth int64
+	// MaxConcurrentUploads defines how many requests may receive upload data at the same
+	// time. Further requests are rejected with the 429 Too Many Requests status code.
+	// If its value is 0 or smaller, no limit will be enforced.
+	MaxConcurrentUploads int
+	// MaxConcurrentUploadsPerClient is similar to MaxConcurrentUploads, but applies to
+	// the requests from each client address individually. If RespectForwardedHeaders is
+	// set, the address is taken from the X-Forwarded-For or Forwarded headers.
+	MaxConcurrentUploadsPerClient int
+	// MaxConcurrentUploadsPerKey is similar to MaxConcurrentUploads, but applies to
+	// all requests with the same concurrency key, which is supplied by the
+	// PreUploadReceiveCallback using ReceiveChanges.ConcurrencyKey. Requests without
+	// a key are not subject to this limit.
+	MaxConcurrentUploadsPerKey int
+	// ConcurrencyRetryAfter is the duration sent in the Retry-After header when a
+	// request is rejected because a limit for concurrent uploads has been reached.
+	// Defaults to 10s.
+	ConcurrencyRetryAfter time.Duration
+	// QuotaMetaDataKey is the name of the meta data field, whose value identifies the
+	// quota that a new upload belongs to (e.g. a tenant or user ID). The quota key can
+	// also be set by the PreUploadCreateCallback using FileInfoChanges.QuotaKey. Quotas
+	// are only enforced if a QuotaStore is configured in the StoreComposer.
+	QuotaMetaDataKey string
+	// QuotaLimit defines how many bytes all uploads in a single quota may occupy
+	// together. It can be overridden for individual uploads using FileInfoChanges.QuotaLimit.
+	// If its value is 0 or smaller, the usage is tracked, but no limit will be enforced.
+	QuotaLimit int64
+	// DigestAlgorithms lists the algorithms for computing digests of the uploaded data,
+	// which are exposed in FileInfo.Digests for finished uploads and in the Repr-Digest
+	// and Digest headers of GET responses. The data is hashed while it is received, so
+	// it does not have to be read again. Supported algorithms are "md5", "sha", "sha-256"
+	// and "sha-512". Digests are only computed if the data store implements
+	// StateUpdaterDataStore, which saves the progress of hashing with the upload.
+	DigestAlgorithms []string
+	// SniffContentType enables detecting the MIME type of uploads from their first bytes,
+	// instead of trusting the filetype meta data supplied by the client. The detected type
+	// is exposed in FileInfo.DetectedContentType and preferred for the Content-Type and
+	// Content-Disposition headers of GET responses.
+	SniffContentType bool
+	// ContentTypeDetector detects the MIME type from the first bytes of an upload, which
+	// are at most 512 bytes long. It may return an empty string if it does not recognize
+	// the type. Defaults to http.DetectContentType.
+	ContentTypeDetector func(data []byte) string
+	// AllowedContentTypes lists the MIME types, which uploads may have according to
+	// their detected type. An entry may also match a group of types, such as "image/*".
+	// Uploads with other types are rejected and terminated. If empty, all types are allowed.
+	// Only used if SniffContentType is enabled.
+	AllowedContentTypes []string
+	// RequireMatchingContentType rejects and terminates uploads, whose detected type does
+	// not match the type declared in the filetype meta data. Generic types, which are
+	// detected if the type is not recognized (application/octet-stream and text/plain),
+	// are not considered a mismatch. Only used if SniffContentType is enabled.
+	RequireMatchingContentType bool
+	// VirusScanner scans the data of finished uploads for malware before the finish
+	// events are emitted. Infected uploads are terminated and the client receives an
+	// error. The result is saved with the upload and recorded in the meta data field
+	// named by VirusScanMetaDataKey, which is available to the pre-finish and post-finish
+	// hooks. Uploads are only served in GET requests once they have been found clean. If
+	// the upload could not be scanned, the scan is repeated when the client retries its
+	// request. The data store must implement StateUpdaterDataStore. If nil, uploads are
+	// not scanned.
+	VirusScanner VirusScanner
 	// GracefulRequestCompletionTimeout is the timeout for operations to complete after an HTTP
 	// request has ended (successfully or by error). For example, if an HTTP request is interrupted,
 	// instead of stopping immediately, the handler and data store will be given some additional
@@ -144,10 +265,10 @@ var DefaultCorsConfig = CorsConfig{
 	Disable:          false,
 	AllowOrigin:      regexp.MustCompile(".*"),
 	AllowCredentials: false,
-	AllowMethods:     "POST, HEAD, PATCH, OPTIONS, GET, DELETE",
-	AllowHeaders:     "Authorization, Origin, X-Requested-With, X-Request-ID, X-HTTP-Method-Override, Content-Type, Upload-Length, Upload-Offset, Tus-Resumable, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Complete, Upload-Draft-Interop-Version",
+	AllowMethods:     "POST, HEAD, PATCH, OPTIONS, GET, DELETE, PUT",
+	AllowHeaders:     "Authorization, Origin, X-Requested-With, X-Request-ID, X-HTTP-Method-Override, Content-Type, Upload-Length, Upload-Offset, Tus-Resumable, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Complete, Upload-Draft-Interop-Version, Upload-Token",
 	MaxAge:           "86400",
-	ExposeHeaders:    "Upload-Offset, Location, Upload-Length, Tus-Version, Tus-Resumable, Tus-Max-Size, Tus-Extension, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Complete, Upload-Draft-Interop-Version",
+	ExposeHeaders:    "Upload-Offset, Location, Upload-Length, Tus-Version, Tus-Resumable, Tus-Max-Size, Tus-Extension, Upload-Metadata, Upload-Defer-Length, Upload-Concat, Upload-Incomplete, Upload-Complete, Upload-Draft-Interop-Version, Digest, Repr-Digest",
 }
 
 func (config *Config) validate() error {
@@ -155,6 +276,14 @@ func (config *Config) validate() error {
 		config.Logger = slog.Default()
 	}
 
+	if config.TracerProvider == nil {
+		config.TracerProvider = otel.GetTracerProvider()
+	}
+
+	if config.Propagator == nil {
+		config.Propagator = otel.GetTextMapPropagator()
+	}
+
 	base := config.BasePath
 	uri, err := url.Parse(base)
 	if err != nil {
@@ -197,9 +326,25 @@ func (config *Config) validate() error {
 		config.NetworkTimeout = 60 * time.Second
 	}
 
+	if config.ConcurrencyRetryAfter <= 0 {
+		config.ConcurrencyRetryAfter = 10 * time.Second
+	}
+
 	if config.Cors == nil {
 		config.Cors = &DefaultCorsConfig
 	}
 
+	if err := validateDigestAlgorithms(config.DigestAlgorithms); err != nil {
+		return err
+	}
+
+	if config.VirusScanner != nil && !config.StoreComposer.UsesStateUpdater {
+		return errors.New("tusd: VirusScanner requires a data store implementing StateUpdaterDataStore")
+	}
+
+	if config.ContentTypeDetector == nil {
+		config.ContentTypeDetector = http.DetectContentType
+	}
+
 	return nil
 }
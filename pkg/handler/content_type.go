@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// sniffLen is the maximum number of bytes used for detecting the content type,
+// matching what http.DetectContentType considers.
+const sniffLen = 512
+
+var (
+	ErrContentTypeNotAllowed = NewError("ERR_CONTENT_TYPE_NOT_ALLOWED", "upload's content type is not allowed", http.StatusUnsupportedMediaType)
+	ErrContentTypeMismatch   = NewError("ERR_CONTENT_TYPE_MISMATCH", "upload's content does not match its declared type", http.StatusUnsupportedMediaType)
+)
+
+// sniffBody detects the content type from the request body if the request contains
+// the upload's first bytes. The bytes are only peeked at, so that they are still
+// passed to the data store. If the request does not contain enough data, the type
+// is detected once the upload is finished instead.
+func (handler *UnroutedHandler) sniffBody(c *httpContext, upload Upload, info *FileInfo) error {
+	if !handler.config.SniffContentType || info.IsPartial || info.Offset != 0 {
+		return nil
+	}
+
+	n := int64(sniffLen)
+	if !info.SizeIsDeferred && info.Size < n {
+		n = info.Size
+	}
+	if n == 0 {
+		return nil
+	}
+
+	data := c.body.peek(int(n))
+	if int64(len(data)) < n {
+		return nil
+	}
+
+	if err := handler.detectContentType(c, info, data); err != nil {
+		return err
+	}
+
+	handler.saveContentType(c, upload, info)
+	return nil
+}
+
+// finishContentType detects the content type of a finished upload by reading its first
+// bytes, unless the type has already been detected while receiving them. Partial
+// uploads are skipped, since their data is only a part of the final upload.
+func (handler *UnroutedHandler) finishContentType(c *httpContext, upload Upload, info *FileInfo) error {
+	if !handler.config.SniffContentType || info.IsPartial || info.DetectedContentType != "" || info.Size == 0 {
+		return nil
+	}
+
+	data, err := readUploadPrefix(c, upload, info.Size)
+	if err != nil {
+		// The upload itself has been completed successfully, so we only log the error.
+		c.log.ErrorContext(c, "ContentTypeError", "error", err)
+		return nil
+	}
+
+	if err := handler.detectContentType(c, info, data); err != nil {
+		return err
+	}
+
+	handler.saveContentType(c, upload, info)
+	return nil
+}
+
+// detectContentType sets the detected content type in the upload's info and checks it
+// against the allowed and declared types.
+func (handler *UnroutedHandler) detectContentType(c *httpContext, info *FileInfo, data []byte) error {
+	contentType := handler.config.ContentTypeDetector(data)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	info.DetectedContentType = contentType
+
+	c.log.InfoContext(c, "ContentTypeDetected", "contentType", contentType)
+
+	if len(handler.config.AllowedContentTypes) > 0 && !contentTypeAllowed(contentType, handler.config.AllowedContentTypes) {
+		return ErrContentTypeNotAllowed
+	}
+
+	if handler.config.RequireMatchingContentType && !contentTypeMatches(contentType, info.MetaData["filetype"]) {
+		return ErrContentTypeMismatch
+	}
+
+	return nil
+}
+
+// saveContentType saves the detected content type with the upload, so that it does not
+// have to be detected again when the upload is downloaded and is available to hooks.
+// Errors are only logged, since the type can still be detected from the upload's data.
+func (handler *UnroutedHandler) saveContentType(c *httpContext, upload Upload, info *FileInfo) {
+	if !handler.composer.UsesStateUpdater {
+		return
+	}
+
+	contentType := info.DetectedContentType
+	if err := handler.updateState(c, upload, info, func(s *UploadState) { s.ContentType = contentType }); err != nil {
+		c.log.ErrorContext(c, "ContentTypeError", "error", err)
+	}
+}
+
+// rejectContentType terminates an upload, whose content type has been rejected, so
+// that its data is not kept or processed further.
+func (handler *UnroutedHandler) rejectContentType(c *httpContext, upload Upload, info FileInfo) {
+	c.log.WarnContext(c, "ContentTypeRejected", "contentType", info.DetectedContentType)
+	handler.discardUpload(c, upload, info)
+}
+
+// uploadContentType returns the detected content type of an upload for serving it. If
+// the type has not been saved with the upload, e.g. because the data store does not
+// implement StateUpdaterDataStore, it is detected again from the upload's data.
+func (handler *UnroutedHandler) uploadContentType(c *httpContext, upload Upload, info FileInfo) string {
+	if !handler.config.SniffContentType || info.IsPartial || info.DetectedContentType != "" || info.Offset == 0 {
+		return info.DetectedContentType
+	}
+
+	data, err := readUploadPrefix(c, upload, info.Offset)
+	if err != nil {
+		c.log.WarnContext(c, "ContentTypeError", "error", err)
+		return ""
+	}
+
+	contentType := handler.config.ContentTypeDetector(data)
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return contentType
+}
+
+// readUploadPrefix reads up to sniffLen bytes from the beginning of the upload's data,
+// but not more than the given length.
+func readUploadPrefix(c *httpContext, upload Upload, length int64) ([]byte, error) {
+	if length > sniffLen {
+		length = sniffLen
+	}
+
+	src, err := upload.GetReader(c)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	data := make([]byte, length)
+	n, err := io.ReadFull(src, data)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+
+	return data[:n], err
+}
+
+// contentTypeAllowed checks whether the content type matches one of the allowed
+// types. An allowed type may end with "/*" to match all subtypes.
+func contentTypeAllowed(contentType string, allowed []string) bool {
+	mediaType := parseMediaType(contentType)
+	for _, allowedType := range allowed {
+		allowedType = strings.ToLower(allowedType)
+		if prefix, ok := strings.CutSuffix(allowedType, "*"); ok && strings.HasPrefix(mediaType, prefix) {
+			return true
+		}
+		if mediaType == allowedType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// contentTypeMatches checks whether the detected content type matches the declared one.
+// If no type is declared or the detector only recognized a generic type, they match.
+func contentTypeMatches(detected string, declared string) bool {
+	if declared == "" {
+		return true
+	}
+
+	detectedType := parseMediaType(detected)
+	if detectedType == "application/octet-stream" || detectedType == "text/plain" {
+		return true
+	}
+
+	return detectedType == parseMediaType(declared)
+}
+
+// parseMediaType returns the lower-cased media type without parameters.
+func parseMediaType(contentType string) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType, _, _ = strings.Cut(contentType, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	}
+
+	return mediaType
+}
@@ -0,0 +1,239 @@
+package handler_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestContentType(t *testing.T) {
+	pngHeader := "\x89PNG\r\n\x1a\n"
+
+	SubTest(t, "DetectWhileReceiving", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UseStateUpdater(store)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   8,
+				MetaData: map[string]string{
+					"filetype": "image/png",
+				},
+			}, nil),
+			// The detected type is saved with the upload.
+			store.EXPECT().AsStateUpdatableUpload(upload).Return(upload),
+			upload.EXPECT().UpdateState(gomock.Any(), UploadState{
+				ContentType: "image/png",
+			}),
+			// The peeked bytes must still be passed to the data store.
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher(pngHeader)).Return(int64(8), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:              composer,
+			NotifyCompleteUploads:      true,
+			SniffContentType:           true,
+			AllowedContentTypes:        []string{"image/*"},
+			RequireMatchingContentType: true,
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.CompleteUploads = c
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader(pngHeader),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "8",
+			},
+		}).Run(handler, t)
+
+		event := <-c
+		assert.Equal(t, "image/png", event.Upload.DetectedContentType)
+	})
+
+	SubTest(t, "RejectNotAllowed", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   20,
+			}, nil),
+			store.EXPECT().AsTerminatableUpload(upload).Return(upload),
+			upload.EXPECT().Terminate(gomock.Any()).Return(nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:       composer,
+			SniffContentType:    true,
+			AllowedContentTypes: []string{"image/*"},
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("<html>evil</html>..."),
+			Code:    http.StatusUnsupportedMediaType,
+			ResBody: "ERR_CONTENT_TYPE_NOT_ALLOWED: upload's content type is not allowed\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "RejectMismatchOnFinish", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		// The first request only contained a part of the bytes needed for detecting
+		// the type, so it is detected by reading the data once the upload is finished.
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 4,
+				Size:   8,
+				MetaData: map[string]string{
+					"filetype": "image/jpeg",
+				},
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(4), NewReaderMatcher(pngHeader[4:])).Return(int64(4), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+			upload.EXPECT().GetReader(gomock.Any()).Return(&closingStringReader{
+				Reader: strings.NewReader(pngHeader),
+			}, nil),
+			store.EXPECT().AsTerminatableUpload(upload).Return(upload),
+			upload.EXPECT().Terminate(gomock.Any()).Return(nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:              composer,
+			SniffContentType:           true,
+			RequireMatchingContentType: true,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "4",
+			},
+			ReqBody: strings.NewReader(pngHeader[4:]),
+			Code:    http.StatusUnsupportedMediaType,
+			ResBody: "ERR_CONTENT_TYPE_MISMATCH: upload's content does not match its declared type\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "DownloadPrefersDetectedType", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 17,
+				Size:   17,
+				MetaData: map[string]string{
+					"filetype": "image/png",
+					"filename": "image.png",
+				},
+			}, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(&closingStringReader{
+				Reader: strings.NewReader("<html>evil</html>"),
+			}, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(&closingStringReader{
+				Reader: strings.NewReader("<html>evil</html>"),
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:    composer,
+			SniffContentType: true,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ResHeader: map[string]string{
+				"Content-Type":        "text/html; charset=utf-8",
+				"Content-Disposition": `attachment;filename="image.png"`,
+			},
+			Code:    http.StatusOK,
+			ResBody: "<html>evil</html>",
+		}).Run(handler, t)
+	})
+	SubTest(t, "DownloadUsesSavedType", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UseStateUpdater(store)
+
+		// The type has been saved with the upload, so the data is only read once
+		// for serving it.
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 17,
+				Size:   17,
+				MetaData: map[string]string{
+					"filetype": "image/png",
+					"filename": "image.png",
+				},
+				State: &UploadState{
+					ContentType: "text/html; charset=utf-8",
+				},
+			}, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(&closingStringReader{
+				Reader: strings.NewReader("<html>evil</html>"),
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:    composer,
+			SniffContentType: true,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ResHeader: map[string]string{
+				"Content-Type":        "text/html; charset=utf-8",
+				"Content-Disposition": `attachment;filename="image.png"`,
+			},
+			Code:    http.StatusOK,
+			ResBody: "<html>evil</html>",
+		}).Run(handler, t)
+	})
+}
@@ -30,6 +30,10 @@ type httpContext struct {
 	// log is the logger for this request. It gets extended with more properties as the
 	// request progresses and is identified.
 	log *slog.Logger
+
+	// finishedPartialUpload is the ID of the partial upload that was finished during this
+	// request. It is used to complete final uploads waiting for it.
+	finishedPartialUpload string
 }
 
 // newContext constructs a new httpContext for the given request. This should only be done once
@@ -4,6 +4,7 @@ import (
 	"context"
 	"io"
 	"net/http"
+	"time"
 )
 
 type MetaData map[string]string
@@ -33,6 +34,21 @@ type FileInfo struct {
 	// for example a file path. The available values vary depending on what data
 	// store is used. This map may also be nil.
 	Storage map[string]string
+	// Digests contains the hex-encoded digests of the upload's data, keyed by the
+	// algorithm's name (e.g. "sha-256"). They are only available once the upload has
+	// been finished and if Config.DigestAlgorithms is configured and the data store
+	// implements StateUpdaterDataStore. They are saved in State, so data stores do not
+	// need to save this field.
+	Digests map[string]string `json:",omitempty"`
+	// DetectedContentType is the MIME type detected from the first bytes of the upload's
+	// data, if Config.SniffContentType is enabled. It is only available once the first
+	// bytes have been received. It is saved in State, so data stores do not need to save
+	// this field.
+	DetectedContentType string `json:",omitempty"`
+	// State contains information about the upload which is computed by the handler,
+	// such as the progress of computing digests. It is saved using StateUpdaterDataStore
+	// and data stores must preserve it when saving other properties of the upload.
+	State *UploadState `json:",omitempty"`
 
 	// stopUpload is a callback for communicating that an upload should by stopped
 	// and interrupt the writes to DataStore#WriteChunk.
@@ -80,6 +96,38 @@ type FileInfoChanges struct {
 	// Please be aware that this behavior is currently not supported by any data store in
 	// the github.com/tus/tusd package.
 	Storage map[string]string
+
+	// If BandwidthLimit is larger than zero, it replaces Config.MaxUploadBandwidth for
+	// the upload data included in the creation request (see the creation-with-upload
+	// extension). It is not stored with the upload, so it does not apply to later PATCH
+	// requests. Use ReceiveChanges from Config.PreUploadReceiveCallback for those.
+	BandwidthLimit int64
+
+	// If QuotaKey is not empty, it identifies the quota that the upload belongs to,
+	// replacing the value from the meta data field defined in Config.QuotaMetaDataKey.
+	// This is only respected if a QuotaStore is configured.
+	QuotaKey string
+
+	// If QuotaLimit is larger than zero, it replaces Config.QuotaLimit for the
+	// upload's quota. The limit is stored with the upload's reservation and also
+	// applies to later PATCH requests.
+	QuotaLimit int64
+}
+
+// ReceiveChanges collects changes that should be applied to a single request which
+// transfers upload data, as returned from the PreUploadReceiveCallback. In contrast to
+// FileInfoChanges, these changes are not saved with the upload and only affect the
+// current request.
+type ReceiveChanges struct {
+	// If BandwidthLimit is larger than zero, it replaces Config.MaxUploadBandwidth as the
+	// maximum number of bytes per second that are received for the upload during this
+	// request. The global limit from Config.MaxBandwidth is still enforced.
+	BandwidthLimit int64
+
+	// If ConcurrencyKey is not empty, the request counts towards the limit defined in
+	// Config.MaxConcurrentUploadsPerKey for all requests with the same key, for
+	// example to limit the number of concurrent uploads per user.
+	ConcurrencyKey string
 }
 
 type Upload interface {
@@ -95,7 +143,8 @@ type Upload interface {
 	GetInfo(ctx context.Context) (FileInfo, error)
 	// GetReader returns an io.ReadCloser which allows iterating of the content of an
 	// upload. It should attempt to provide a reader even if the upload has not
-	// been finished yet but it's not required.
+	// been finished yet but it's not required. In this case, the reader provides
+	// the data received so far, i.e. up to the upload's current offset.
 	GetReader(ctx context.Context) (io.ReadCloser, error)
 	// FinisherDataStore is the interface which can be implemented by DataStores
 	// which need to do additional operations once an entire upload has been
@@ -164,6 +213,52 @@ type LengthDeclarableUpload interface {
 	DeclareLength(ctx context.Context, length int64) error
 }
 
+// MetadataUpdaterDataStore is the interface that must be implemented if the meta data
+// of existing uploads should be changeable. The handler then accepts PUT requests to
+// <upload URL>/metadata, which replace the upload's meta data.
+type MetadataUpdaterDataStore interface {
+	AsMetadataUpdatableUpload(upload Upload) MetadataUpdatableUpload
+}
+
+type MetadataUpdatableUpload interface {
+	// UpdateMetaData replaces the upload's meta data with the given one. Subsequent
+	// calls to GetInfo must return the new meta data.
+	UpdateMetaData(ctx context.Context, metaData MetaData) error
+}
+
+// UploadState contains information about an upload which is computed by the handler
+// and saved together with the upload, so that it is available to all tusd instances
+// sharing the storage.
+type UploadState struct {
+	// Digest is the progress of computing the digests of the upload's data.
+	Digest *DigestState `json:",omitempty"`
+	// ContentType is the MIME type detected from the upload's data, if
+	// Config.SniffContentType is enabled.
+	ContentType string `json:",omitempty"`
+	// VirusScan is the result of scanning the finished upload using Config.VirusScanner.
+	// It is "clean" or the name of the detected malware and empty as long as the upload
+	// has not been scanned successfully.
+	VirusScan string `json:",omitempty"`
+	// Storage contains information saved by data stores, which wrap another data store
+	// and keep their state in the wrapped one, e.g. the encryptedstore package. Such
+	// data stores hide their entries in GetInfo and preserve them in UpdateState.
+	// The handler does not interpret the entries.
+	Storage map[string]string `json:",omitempty"`
+}
+
+// StateUpdaterDataStore is the interface that must be implemented if the handler should
+// save information about uploads, which is required for computing digests (see
+// Config.DigestAlgorithms) and scanning uploads for malware (see Config.VirusScanner).
+type StateUpdaterDataStore interface {
+	AsStateUpdatableUpload(upload Upload) StateUpdatableUpload
+}
+
+type StateUpdatableUpload interface {
+	// UpdateState replaces the upload's state with the given one. Subsequent calls to
+	// GetInfo must return the new state in FileInfo.State.
+	UpdateState(ctx context.Context, state UploadState) error
+}
+
 // Locker is the interface required for custom lock persisting mechanisms.
 // Common ways to store this information is in memory, on disk or using an
 // external service, such as Redis.
@@ -205,8 +300,57 @@ type ServableUpload interface {
 }
 
 // ContentServerDataStore is the interface for DataStores that can serve content directly.
-// When the handler serves a GET request, it will pass the request to ServeContent
-// and delegate its handling to the DataStore, instead of using GetReader to obtain the content.
+// When the handler serves a GET request for a finished upload, it will pass the request to
+// ServeContent and delegate its handling to the DataStore, instead of using GetReader to
+// obtain the content. Unfinished uploads are always served using GetReader or
+// RangeReaderDataStore.
 type ContentServerDataStore interface {
 	AsServableUpload(upload Upload) ServableUpload
 }
+
+type RangeReadableUpload interface {
+	// GetRangeReader returns an io.ReadCloser for the upload's data, which starts at
+	// the given offset and provides at most length bytes. It allows the handler to
+	// serve range requests without reading the data preceding the requested range.
+	GetRangeReader(ctx context.Context, offset int64, length int64) (io.ReadCloser, error)
+	// ModTime returns the time at which the upload's data was last modified. It is
+	// used for the Last-Modified header and to evaluate If-Modified-Since and
+	// If-Unmodified-Since conditions. The zero time can be returned if it is unknown.
+	ModTime(ctx context.Context) (time.Time, error)
+}
+
+// RangeReaderDataStore is the interface for DataStores that can read an upload's
+// data starting at an arbitrary offset. If a DataStore does not implement
+// ContentServerDataStore, the handler serves range requests for GET requests itself.
+// With this interface, it can seek directly to the requested range. Otherwise, it
+// uses GetReader and skips over the data preceding the requested range.
+type RangeReaderDataStore interface {
+	AsRangeReadableUpload(upload Upload) RangeReadableUpload
+}
+
+// ConcurrentReaderDataStore is the interface for DataStores, which allow reading an
+// unfinished upload while data is written to it by another request. By default, the
+// handler acquires the upload's lock for GET requests, so that the data is not modified
+// while it is read. If the DataStore supports concurrent reads, GET requests do not
+// acquire the lock and therefore do not interrupt an ongoing PATCH request.
+type ConcurrentReaderDataStore interface {
+	// SupportsConcurrentReads reports whether GetReader and GetRangeReader provide a
+	// consistent view of the data up to the offset returned by GetInfo, even if data
+	// is written to the upload at the same time.
+	SupportsConcurrentReads() bool
+}
+
+// InfoStore is the interface for persisting the FileInfo of uploads separately from
+// their data. Data stores, such as filestore and s3store, can delegate the storage of
+// FileInfo structs to an InfoStore instead of saving them alongside the upload's data,
+// for example in a database to allow querying uploads.
+type InfoStore interface {
+	// SaveInfo creates or replaces the stored FileInfo for the upload with info.ID.
+	SaveInfo(ctx context.Context, info FileInfo) error
+	// GetInfo returns the stored FileInfo for the upload. If no information is stored
+	// for the ID, ErrNotFound must be returned.
+	GetInfo(ctx context.Context, id string) (FileInfo, error)
+	// DeleteInfo removes the stored FileInfo for the upload. Deleting information for
+	// an unknown ID is not an error.
+	DeleteInfo(ctx context.Context, id string) error
+}
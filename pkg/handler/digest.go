@@ -0,0 +1,298 @@
+package handler
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strings"
+)
+
+// digestAlgorithms contains the supported algorithms for Config.DigestAlgorithms. They are
+// named according to the Hash Algorithms for HTTP Digest Fields registry from IANA.
+var digestAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha":     sha1.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// DigestState describes the progress of computing the digests of an upload's data.
+type DigestState struct {
+	// Offset is the number of bytes, counted from the beginning of the upload, which
+	// have been hashed.
+	Offset int64
+	// States contains the serialized internal state of the hash function for each
+	// algorithm, so that hashing can be continued by another process.
+	States map[string][]byte
+	// Digests contains the hex-encoded digests for each algorithm once the upload
+	// has been finished. Afterwards, States is no longer needed and empty.
+	Digests map[string]string
+}
+
+// validateDigestAlgorithms checks whether all configured digest algorithms are supported.
+func validateDigestAlgorithms(algorithms []string) error {
+	for _, algorithm := range algorithms {
+		if _, ok := digestAlgorithms[algorithm]; !ok {
+			return fmt.Errorf("tusd: unsupported digest algorithm %q", algorithm)
+		}
+	}
+
+	return nil
+}
+
+// uploadDigest computes the digests for the data received in a single request.
+type uploadDigest struct {
+	hashes map[string]hash.Hash
+	// written is the number of bytes that have been hashed in this request.
+	written int64
+}
+
+func (d *uploadDigest) Write(p []byte) (int, error) {
+	for _, h := range d.hashes {
+		h.Write(p)
+	}
+
+	d.written += int64(len(p))
+	return len(p), nil
+}
+
+// restoreDigest creates the hash functions for the configured algorithms and restores
+// their state from the given DigestState. If state is nil, new hash functions are created.
+func (handler *UnroutedHandler) restoreDigest(state *DigestState) (*uploadDigest, error) {
+	d := &uploadDigest{
+		hashes: make(map[string]hash.Hash, len(handler.config.DigestAlgorithms)),
+	}
+
+	for _, algorithm := range handler.config.DigestAlgorithms {
+		h := digestAlgorithms[algorithm]()
+		if state != nil {
+			data, ok := state.States[algorithm]
+			if !ok {
+				return nil, fmt.Errorf("tusd: digest state for %s is missing", algorithm)
+			}
+
+			if err := h.(encoding.BinaryUnmarshaler).UnmarshalBinary(data); err != nil {
+				return nil, err
+			}
+		}
+
+		d.hashes[algorithm] = h
+	}
+
+	return d, nil
+}
+
+// startDigest prepares hashing the data received for the upload. It returns nil if no
+// digests are computed or if the saved state does not match the upload's offset. In
+// the latter case, the digests are computed by reading the data once the upload finishes.
+func (handler *UnroutedHandler) startDigest(c *httpContext, info FileInfo) *uploadDigest {
+	if !handler.usesDigests() || info.IsPartial {
+		return nil
+	}
+
+	var d *uploadDigest
+	var err error
+	state := info.digestState()
+	switch {
+	case state != nil && state.Offset == info.Offset && len(state.Digests) == 0:
+		d, err = handler.restoreDigest(state)
+	case info.Offset == 0:
+		d, err = handler.restoreDigest(nil)
+	}
+	if err != nil {
+		c.log.ErrorContext(c, "DigestError", "error", err)
+		return nil
+	}
+
+	return d
+}
+
+// saveDigest saves the progress of hashing after the data store has written the
+// received data. If the number of hashed bytes does not match the number of written
+// bytes, the state is not saved since it would be inconsistent. If the upload is
+// complete, the state is only kept in info, since finishDigest saves the final digests.
+func (handler *UnroutedHandler) saveDigest(c *httpContext, upload Upload, info *FileInfo, d *uploadDigest, offset int64, bytesWritten int64) {
+	if d == nil || d.written != bytesWritten {
+		return
+	}
+
+	state := DigestState{
+		Offset: offset + bytesWritten,
+		States: make(map[string][]byte, len(d.hashes)),
+	}
+	for algorithm, h := range d.hashes {
+		data, err := h.(encoding.BinaryMarshaler).MarshalBinary()
+		if err != nil {
+			c.log.ErrorContext(c, "DigestError", "error", err)
+			return
+		}
+
+		state.States[algorithm] = data
+	}
+
+	if !info.SizeIsDeferred && state.Offset == info.Size {
+		info.setState(func(s *UploadState) { s.Digest = &state })
+		return
+	}
+
+	if err := handler.updateState(c, upload, info, func(s *UploadState) { s.Digest = &state }); err != nil {
+		c.log.ErrorContext(c, "DigestError", "error", err)
+	}
+}
+
+// finishDigest computes the final digests of a finished upload and saves them with the
+// upload. If the data has not been hashed entirely while it was received, e.g. because
+// the upload has been created by concatenation or a previous state was lost, the
+// upload's data is read to compute the digests. Errors are only logged, since the
+// upload itself has been completed successfully.
+func (handler *UnroutedHandler) finishDigest(c *httpContext, upload Upload, info *FileInfo) map[string]string {
+	if !handler.usesDigests() || info.IsPartial {
+		return nil
+	}
+
+	digests, err := handler.computeDigests(c, upload, *info)
+	if err != nil {
+		c.log.ErrorContext(c, "DigestError", "error", err)
+		return nil
+	}
+
+	state := DigestState{
+		Offset:  info.Size,
+		Digests: digests,
+	}
+	if err := handler.updateState(c, upload, info, func(s *UploadState) { s.Digest = &state }); err != nil {
+		c.log.ErrorContext(c, "DigestError", "error", err)
+	}
+
+	return digests
+}
+
+func (handler *UnroutedHandler) computeDigests(c *httpContext, upload Upload, info FileInfo) (map[string]string, error) {
+	state := info.digestState()
+	if state != nil && state.Offset == info.Size && len(state.Digests) > 0 {
+		return state.Digests, nil
+	}
+
+	var d *uploadDigest
+	var err error
+	if state != nil && state.Offset == info.Size {
+		d, err = handler.restoreDigest(state)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		c.log.InfoContext(c, "DigestFromReader")
+
+		d, err = handler.restoreDigest(nil)
+		if err != nil {
+			return nil, err
+		}
+
+		if info.Size > 0 {
+			src, err := upload.GetReader(c)
+			if err != nil {
+				return nil, err
+			}
+			defer src.Close()
+
+			if _, err := io.CopyN(d, src, info.Size); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	digests := make(map[string]string, len(d.hashes))
+	for algorithm, h := range d.hashes {
+		digests[algorithm] = hex.EncodeToString(h.Sum(nil))
+	}
+
+	return digests, nil
+}
+
+// usesDigests returns whether digests are computed for uploads.
+func (handler *UnroutedHandler) usesDigests() bool {
+	return handler.composer.UsesStateUpdater && len(handler.config.DigestAlgorithms) > 0
+}
+
+// digestState returns the saved progress of hashing the upload's data or nil if none is available.
+func (info FileInfo) digestState() *DigestState {
+	if info.State == nil {
+		return nil
+	}
+
+	return info.State.Digest
+}
+
+// savedDigests returns the digests of a finished upload, which have been saved with the upload.
+func (info FileInfo) savedDigests() map[string]string {
+	if state := info.digestState(); state != nil {
+		return state.Digests
+	}
+
+	return nil
+}
+
+// setDigestHeaders sets the Repr-Digest header (RFC 9530) and the legacy Digest
+// header (RFC 3230) for the given digests.
+func setDigestHeaders(header HTTPHeader, digests map[string]string) {
+	if len(digests) == 0 {
+		return
+	}
+
+	algorithms := make([]string, 0, len(digests))
+	for algorithm := range digests {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+
+	reprDigest := make([]string, 0, len(algorithms))
+	digest := make([]string, 0, len(algorithms))
+	for _, algorithm := range algorithms {
+		sum, err := hex.DecodeString(digests[algorithm])
+		if err != nil {
+			continue
+		}
+
+		value := base64.StdEncoding.EncodeToString(sum)
+		reprDigest = append(reprDigest, algorithm+"=:"+value+":")
+		digest = append(digest, strings.ToUpper(algorithm)+"="+value)
+	}
+
+	header["Repr-Digest"] = strings.Join(reprDigest, ", ")
+	header["Digest"] = strings.Join(digest, ",")
+}
+
+// hashingReader passes all data read from the underlying reader to a hash function.
+type hashingReader struct {
+	reader io.ReadCloser
+	digest *uploadDigest
+}
+
+// hash wraps the request body, so that all data read from it is hashed.
+func (r *bodyReader) hash(d *uploadDigest) {
+	r.reader = &hashingReader{
+		reader: r.reader,
+		digest: d,
+	}
+}
+
+func (r *hashingReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	if n > 0 {
+		r.digest.Write(b[:n])
+	}
+
+	return n, err
+}
+
+func (r *hashingReader) Close() error {
+	return r.reader.Close()
+}
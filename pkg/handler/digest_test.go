@@ -0,0 +1,190 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestDigest(t *testing.T) {
+	helloWorldDigests := map[string]string{
+		"md5":     "5eb63bbbe01eeed093cb22bb8f5acdc3",
+		"sha-256": "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+	}
+
+	SubTest(t, "InvalidAlgorithm", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		_, err := NewHandler(Config{
+			StoreComposer:    composer,
+			DigestAlgorithms: []string{"crc32"},
+		})
+		assert.EqualError(t, err, `tusd: unsupported digest algorithm "crc32"`)
+	})
+
+	SubTest(t, "ComputeWhileReceiving", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+		a := assert.New(t)
+
+		composer.UseStateUpdater(store)
+
+		// The state saved after the first request is returned by the data store
+		// for the second request, as it would be for another tusd instance.
+		var state UploadState
+		saveState := func(ctx context.Context, s UploadState) error {
+			state = s
+			return nil
+		}
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   11,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello ")).Return(int64(6), nil),
+			store.EXPECT().AsStateUpdatableUpload(upload).Return(upload),
+			upload.EXPECT().UpdateState(gomock.Any(), gomock.Any()).DoAndReturn(saveState),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).DoAndReturn(func(ctx context.Context) (FileInfo, error) {
+				return FileInfo{
+					ID:     "yes",
+					Offset: 6,
+					Size:   11,
+					State:  &state,
+				}, nil
+			}),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(6), NewReaderMatcher("world")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+			store.EXPECT().AsStateUpdatableUpload(upload).Return(upload),
+			upload.EXPECT().UpdateState(gomock.Any(), gomock.Any()).DoAndReturn(saveState),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).DoAndReturn(func(ctx context.Context) (FileInfo, error) {
+				return FileInfo{
+					ID:     "yes",
+					Offset: 11,
+					Size:   11,
+					State:  &state,
+				}, nil
+			}),
+			upload.EXPECT().GetReader(gomock.Any()).Return(&closingStringReader{
+				Reader: strings.NewReader("hello world"),
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			NotifyCompleteUploads: true,
+			DigestAlgorithms:      []string{"sha-256", "md5"},
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.CompleteUploads = c
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello "),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		a.Equal(int64(6), state.Digest.Offset)
+		a.Len(state.Digest.States, 2)
+		a.Empty(state.Digest.Digests)
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "6",
+			},
+			ReqBody: strings.NewReader("world"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		event := <-c
+		a.Equal(helloWorldDigests, event.Upload.Digests)
+		a.Equal(int64(11), state.Digest.Offset)
+		a.Empty(state.Digest.States)
+		a.Equal(helloWorldDigests, state.Digest.Digests)
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ResHeader: map[string]string{
+				"Repr-Digest": "md5=:XrY7u+Ae7tCTyyK7j1rNww==:, sha-256=:uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=:",
+				"Digest":      "MD5=XrY7u+Ae7tCTyyK7j1rNww==,SHA-256=uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=",
+			},
+			Code:    http.StatusOK,
+			ResBody: "hello world",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "ComputeFromReader", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UseStateUpdater(store)
+
+		// No state is saved for the upload, e.g. because it has been created before
+		// digests were enabled, so the data must be read once the upload is finished.
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 6,
+				Size:   11,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(6), NewReaderMatcher("world")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+			upload.EXPECT().GetReader(gomock.Any()).Return(&closingStringReader{
+				Reader: strings.NewReader("hello world"),
+			}, nil),
+			store.EXPECT().AsStateUpdatableUpload(upload).Return(upload),
+			upload.EXPECT().UpdateState(gomock.Any(), UploadState{
+				Digest: &DigestState{
+					Offset:  11,
+					Digests: helloWorldDigests,
+				},
+			}),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			NotifyCompleteUploads: true,
+			DigestAlgorithms:      []string{"sha-256", "md5"},
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.CompleteUploads = c
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "6",
+			},
+			ReqBody: strings.NewReader("world"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		event := <-c
+		assert.Equal(t, helloWorldDigests, event.Upload.Digests)
+	})
+}
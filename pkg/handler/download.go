@@ -0,0 +1,197 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// serveUploadContent serves the upload's data for a GET request if the data store does
+// not implement ContentServerDataStore. It relies on http.ServeContent for handling
+// range requests and conditional requests (If-Range, If-None-Match, If-Modified-Since etc).
+func (handler *UnroutedHandler) serveUploadContent(c *httpContext, resp HTTPResponse, upload Upload, info FileInfo) error {
+	content := &uploadReadSeeker{
+		ctx:    c,
+		upload: upload,
+		size:   info.Offset,
+	}
+
+	var modTime time.Time
+	if handler.composer.UsesRangeReader {
+		content.rangeReader = handler.composer.RangeReader.AsRangeReadableUpload(upload)
+
+		var err error
+		modTime, err = content.rangeReader.ModTime(c)
+		if err != nil {
+			return err
+		}
+	} else {
+		// Obtain the reader before sending any response, so that errors (e.g. if the
+		// upload cannot be found) can still be reported to the client.
+		if err := content.openReader(); err != nil {
+			return err
+		}
+	}
+	defer content.Close()
+
+	header := c.res.Header()
+	for key, value := range resp.Header {
+		// The Content-Length is determined by http.ServeContent depending on the requested ranges.
+		if key != "Content-Length" {
+			header.Set(key, value)
+		}
+	}
+	header.Set("ETag", uploadETag(info))
+
+	// Use loggingResponseWriter to get the ResponseOutgoing log entry that
+	// normally handler.sendResp would produce.
+	loggingW := &loggingResponseWriter{ResponseWriter: c.res, logger: c.log}
+
+	http.ServeContent(loggingW, c.req, "", modTime, content)
+
+	// http.ServeContent does not report errors from reading the content, so we
+	// return them here to at least log them.
+	return content.err
+}
+
+// uploadETag generates an entity tag for the upload's data. Since uploads are only
+// appended to, the ID, offset and size identify the served data sufficiently.
+func uploadETag(info FileInfo) string {
+	sum := sha256.Sum256([]byte(info.ID + ":" + strconv.FormatInt(info.Offset, 10) + ":" + strconv.FormatInt(info.Size, 10)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// uploadReadSeeker provides an io.ReadSeeker for the upload's data, which is needed
+// by http.ServeContent. The underlying reader is opened lazily, once data is read
+// after seeking. If the data store implements RangeReaderDataStore, a new reader is
+// opened directly at the requested offset. Otherwise, the reader from GetReader is
+// used and the data preceding the requested offset is skipped. If the requested offset
+// lies behind the reader's current position, GetReader is called again.
+type uploadReadSeeker struct {
+	ctx         context.Context
+	upload      Upload
+	rangeReader RangeReadableUpload
+	size        int64
+
+	// offset is the position for the next Read, as set by Seek.
+	offset int64
+	// reader is the currently open reader, which is positioned at readerOffset.
+	reader       io.ReadCloser
+	readerOffset int64
+
+	// err is the first error that occurred while reading.
+	err error
+}
+
+func (rs *uploadReadSeeker) Read(p []byte) (int, error) {
+	if rs.err != nil {
+		return 0, rs.err
+	}
+
+	if rs.offset >= rs.size {
+		return 0, io.EOF
+	}
+
+	if rs.reader == nil || rs.readerOffset != rs.offset {
+		if err := rs.seekReader(); err != nil {
+			rs.err = err
+			return 0, err
+		}
+	}
+
+	// Do not read beyond the size, which has been announced to http.ServeContent.
+	if remaining := rs.size - rs.offset; int64(len(p)) > remaining {
+		p = p[:remaining]
+	}
+
+	n, err := rs.reader.Read(p)
+	rs.offset += int64(n)
+	rs.readerOffset += int64(n)
+	if err != nil && err != io.EOF {
+		rs.err = err
+	}
+
+	return n, err
+}
+
+func (rs *uploadReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += rs.offset
+	case io.SeekEnd:
+		offset += rs.size
+	default:
+		return 0, errors.New("tusd: invalid whence")
+	}
+
+	if offset < 0 {
+		return 0, errors.New("tusd: negative position")
+	}
+
+	rs.offset = offset
+	return offset, nil
+}
+
+func (rs *uploadReadSeeker) Close() error {
+	if rs.reader == nil {
+		return nil
+	}
+
+	err := rs.reader.Close()
+	rs.reader = nil
+	return err
+}
+
+// seekReader positions the underlying reader at the current offset.
+func (rs *uploadReadSeeker) seekReader() error {
+	if rs.rangeReader != nil {
+		if err := rs.Close(); err != nil {
+			return err
+		}
+
+		reader, err := rs.rangeReader.GetRangeReader(rs.ctx, rs.offset, rs.size-rs.offset)
+		if err != nil {
+			return err
+		}
+
+		rs.reader = reader
+		rs.readerOffset = rs.offset
+		return nil
+	}
+
+	if rs.reader == nil || rs.readerOffset > rs.offset {
+		if err := rs.openReader(); err != nil {
+			return err
+		}
+	}
+
+	n, err := io.CopyN(io.Discard, rs.reader, rs.offset-rs.readerOffset)
+	rs.readerOffset += n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// openReader opens a new reader using GetReader, which is positioned at the beginning
+// of the upload's data.
+func (rs *uploadReadSeeker) openReader() error {
+	if err := rs.Close(); err != nil {
+		return err
+	}
+
+	reader, err := rs.upload.GetReader(rs.ctx)
+	if err != nil {
+		return err
+	}
+
+	rs.reader = reader
+	rs.readerOffset = 0
+	return nil
+}
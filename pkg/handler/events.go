@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// UploadEventType describes the kind of change an UploadEvent represents.
+type UploadEventType string
+
+const (
+	// UploadEventProgress is emitted regularly while data for an upload is received.
+	// Its interval is controlled by Config.UploadProgressInterval.
+	UploadEventProgress UploadEventType = "progress"
+	// UploadEventFinish is emitted once all data for an upload has been received.
+	UploadEventFinish UploadEventType = "finish"
+	// UploadEventTerminate is emitted after an upload has been terminated.
+	UploadEventTerminate UploadEventType = "terminate"
+	// UploadEventStop is emitted when an upload has been stopped by the server,
+	// for example by a post-receive hook. See FileInfo.StopUpload.
+	UploadEventStop UploadEventType = "stop"
+)
+
+// UploadEvent is a notification about a change in an upload's state. It is
+// distributed over an EventBus and fed from the same places in the handler which
+// emit the UploadProgress, CompleteUploads and TerminatedUploads notifications.
+type UploadEvent struct {
+	// Type is the kind of change.
+	Type UploadEventType
+	// Upload contains information about the upload after the change. For progress
+	// events, Offset is the number of bytes that have been received by the server,
+	// which may be higher than the number of bytes saved by the data store.
+	Upload FileInfo
+}
+
+// EventBus is the interface required for distributing upload events between the
+// request that causes an event (e.g. a PATCH request) and the requests that observe
+// it (see UnroutedHandler.GetEvents). If multiple tusd instances serve the same
+// uploads, the event bus must deliver events across these instances, for example
+// by using an external message broker. If only a single process is involved, the
+// memoryeventbus package can be used.
+type EventBus interface {
+	// Publish delivers an event to all current subscribers of the event's upload.
+	// Publish is called from the request handlers, so implementations must not wait
+	// for subscribers to receive the event. Instead, they should drop progress events
+	// or end the subscription of subscribers that are lagging behind.
+	Publish(ctx context.Context, event UploadEvent) error
+	// Subscribe returns a channel on which all events for the upload with the given
+	// ID are received until the context is cancelled. Afterwards, the channel must
+	// be closed by the implementation.
+	Subscribe(ctx context.Context, id string) (<-chan UploadEvent, error)
+}
+
+// uploadEventData is the JSON representation of an UploadEvent as sent to clients
+// in the data field of a Server-Sent Event. Storage details are left out intentionally.
+type uploadEventData struct {
+	ID             string
+	Size           int64
+	SizeIsDeferred bool
+	Offset         int64
+	MetaData       MetaData
+}
+
+// GetEvents streams the events for an upload to the client using Server-Sent Events
+// (see https://html.spec.whatwg.org/multipage/server-sent-events.html). The upload
+// ID is taken from the request path after removing an optional "/events" suffix.
+// The first event describes the upload's current state. The stream ends after the
+// upload has been finished, terminated or stopped, or if the client disconnects.
+// An EventBus must be configured in the store composer. Like downloads, the stream
+// requires a signed URL if Config.DownloadSigningKey is set, and the subject's upload
+// token if Config.UploadTokenKey is set. This is not part of the specification.
+func (handler *UnroutedHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	c := handler.getContext(w, r)
+
+	if !handler.composer.UsesEventBus {
+		handler.sendError(c, ErrNotImplemented)
+		return
+	}
+
+	id, err := extractIDFromPath(strings.TrimSuffix(strings.TrimRight(r.URL.Path, "/"), "/events"))
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+	c.log = c.log.With("id", id)
+	setSpanUploadID(c, id)
+
+	// The event stream exposes the upload's meta data, so it is protected in the same
+	// way as downloading the upload.
+	if len(handler.config.DownloadSigningKey) > 0 {
+		if _, err := handler.verifyDownloadSignature(c, id); err != nil {
+			handler.sendError(c, err)
+			return
+		}
+	}
+
+	// Subscribe before fetching the upload's state, so that no event between
+	// retrieving the state and subscribing is missed.
+	ctx, cancelSubscription := context.WithCancel(c)
+	defer cancelSubscription()
+
+	events, err := handler.composer.EventBus.Subscribe(ctx, id)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	// The upload is intentionally not locked since this request is long-lived and
+	// would otherwise block all requests writing to the upload.
+	upload, err := handler.composer.Core.GetUpload(c, id)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	info, err := handler.getInfo(c, upload)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	if err := handler.checkUploadTokenSubject(c, info); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	c.log.InfoContext(c, "ResponseOutgoing", "status", http.StatusOK)
+
+	initialEvent := UploadEvent{
+		Type:   UploadEventProgress,
+		Upload: info,
+	}
+	if !info.SizeIsDeferred && info.Offset == info.Size {
+		initialEvent.Type = UploadEventFinish
+	}
+
+	if !handler.writeEvent(c, initialEvent) || initialEvent.Type != UploadEventProgress {
+		return
+	}
+
+	// Regularly send comments, so that proxies and clients do not consider the
+	// connection dead while no data is transferred for the upload.
+	heartbeat := time.NewTicker(handler.config.NetworkTimeout / 2)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Done():
+			return
+		case <-heartbeat.C:
+			if !handler.writeEventStream(c, ": heartbeat\n\n") {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+
+			if !handler.writeEvent(c, event) || event.Type != UploadEventProgress {
+				return
+			}
+		}
+	}
+}
+
+// writeEvent sends a single event in the Server-Sent Events format to the client.
+// It returns false if the event could not be sent and the stream should be closed.
+func (handler *UnroutedHandler) writeEvent(c *httpContext, event UploadEvent) bool {
+	data, err := json.Marshal(uploadEventData{
+		ID:             event.Upload.ID,
+		Size:           event.Upload.Size,
+		SizeIsDeferred: event.Upload.SizeIsDeferred,
+		Offset:         event.Upload.Offset,
+		MetaData:       event.Upload.MetaData,
+	})
+	if err != nil {
+		c.log.ErrorContext(c, "EventEncodeError", "error", err)
+		return false
+	}
+
+	return handler.writeEventStream(c, "event: "+string(event.Type)+"\ndata: "+string(data)+"\n\n")
+}
+
+// writeEventStream writes the raw message to the event stream and flushes it, so
+// that it reaches the client immediately.
+func (handler *UnroutedHandler) writeEventStream(c *httpContext, message string) bool {
+	// The stream can be open for much longer than the write deadline set in the
+	// middleware, so we extend it for every message.
+	if err := c.resC.SetWriteDeadline(time.Now().Add(2 * handler.config.NetworkTimeout)); err != nil {
+		c.log.WarnContext(c, "NetworkControlError", "error", err)
+	}
+
+	if _, err := c.res.Write([]byte(message)); err != nil {
+		c.log.WarnContext(c, "EventWriteError", "error", err)
+		return false
+	}
+
+	if err := c.resC.Flush(); err != nil {
+		c.log.WarnContext(c, "EventWriteError", "error", err)
+		return false
+	}
+
+	return true
+}
+
+// publishEvent passes an event for the upload to the event bus, if one is configured.
+// Errors are only logged since they are not relevant to the client causing the event.
+func (handler *UnroutedHandler) publishEvent(c *httpContext, typ UploadEventType, info FileInfo) {
+	if !handler.composer.UsesEventBus {
+		return
+	}
+
+	// The event might be published after the request has ended (e.g. the last progress
+	// event), so we do not want the request's cancellation to affect the delivery.
+	ctx := context.WithoutCancel(c)
+	if err := handler.composer.EventBus.Publish(ctx, UploadEvent{Type: typ, Upload: info}); err != nil {
+		c.log.WarnContext(c, "EventPublishError", "type", typ, "error", err)
+	}
+}
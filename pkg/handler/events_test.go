@@ -0,0 +1,302 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// staticEventBus is an EventBus whose subscriptions return a fixed list of
+// events and which records all published events.
+type staticEventBus struct {
+	events    []UploadEvent
+	published chan UploadEvent
+}
+
+func (bus *staticEventBus) Publish(ctx context.Context, event UploadEvent) error {
+	bus.published <- event
+	return nil
+}
+
+func (bus *staticEventBus) Subscribe(ctx context.Context, id string) (<-chan UploadEvent, error) {
+	c := make(chan UploadEvent, len(bus.events))
+	for _, event := range bus.events {
+		c <- event
+	}
+	return c, nil
+}
+
+func TestEvents(t *testing.T) {
+	SubTest(t, "StreamEvents", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "foo/yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "foo/yes",
+				Offset: 0,
+				Size:   10,
+			}, nil),
+		)
+
+		composer.UseEventBus(&staticEventBus{
+			events: []UploadEvent{
+				{Type: UploadEventProgress, Upload: FileInfo{ID: "foo/yes", Offset: 5, Size: 10}},
+				{Type: UploadEventTerminate, Upload: FileInfo{ID: "foo/yes", Offset: 5, Size: 10}},
+				{Type: UploadEventProgress, Upload: FileInfo{ID: "foo/yes", Offset: 8, Size: 10}},
+			},
+		})
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		res := (&httpTest{
+			Method: "GET",
+			URL:    "foo/yes/events",
+			Code:   http.StatusOK,
+			ResHeader: map[string]string{
+				"Content-Type":  "text/event-stream",
+				"Cache-Control": "no-store",
+			},
+		}).Run(handler, t)
+
+		assert.Equal(t, strings.Join([]string{
+			"event: progress\ndata: {\"ID\":\"foo/yes\",\"Size\":10,\"SizeIsDeferred\":false,\"Offset\":0,\"MetaData\":null}\n\n",
+			"event: progress\ndata: {\"ID\":\"foo/yes\",\"Size\":10,\"SizeIsDeferred\":false,\"Offset\":5,\"MetaData\":null}\n\n",
+			"event: terminate\ndata: {\"ID\":\"foo/yes\",\"Size\":10,\"SizeIsDeferred\":false,\"Offset\":5,\"MetaData\":null}\n\n",
+		}, ""), res.Body.String())
+	})
+
+	SubTest(t, "FinishedUpload", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 10,
+				Size:   10,
+				MetaData: MetaData{
+					"filename": "hello.txt",
+				},
+			}, nil),
+		)
+
+		composer.UseEventBus(&staticEventBus{})
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method:  "GET",
+			URL:     "yes/events",
+			Code:    http.StatusOK,
+			ResBody: "event: finish\ndata: {\"ID\":\"yes\",\"Size\":10,\"SizeIsDeferred\":false,\"Offset\":10,\"MetaData\":{\"filename\":\"hello.txt\"}}\n\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "NotFound", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		store.EXPECT().GetUpload(gomock.Any(), "no").Return(nil, ErrNotFound)
+
+		composer.UseEventBus(&staticEventBus{})
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "no/events",
+			Code:   http.StatusNotFound,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "DisableDownload", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		composer.UseEventBus(&staticEventBus{})
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:   composer,
+			DisableDownload: true,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes/events",
+			Code:   http.StatusMethodNotAllowed,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "DownloadSignatureRequired", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		composer.UseEventBus(&staticEventBus{})
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:      composer,
+			DownloadSigningKey: []byte("secret"),
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes/events",
+			Code:   http.StatusForbidden,
+		}).Run(handler, t)
+
+		url, err := SignDownloadURL([]byte("secret"), "yes/events", "yes", time.Now().Add(time.Hour), "")
+		assert.NoError(t, err)
+
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 10,
+				Size:   10,
+			}, nil),
+		)
+
+		(&httpTest{
+			Method:  "GET",
+			URL:     url,
+			Code:    http.StatusOK,
+			ResBody: "event: finish\ndata: {\"ID\":\"yes\",\"Size\":10,\"SizeIsDeferred\":false,\"Offset\":10,\"MetaData\":null}\n\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "UploadTokenSubjectMismatch", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 10,
+				Size:   10,
+				MetaData: MetaData{
+					UploadTokenSubjectMetaDataKey: "user-1",
+				},
+			}, nil),
+		)
+
+		composer.UseEventBus(&staticEventBus{})
+
+		key := []byte("secret")
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			UploadTokenKey: key,
+		})
+
+		token, err := SignUploadToken(key, UploadToken{
+			Subject:   "user-2",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		})
+		assert.NoError(t, err)
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes/events",
+			ReqHeader: map[string]string{
+				"Upload-Token": token,
+			},
+			Code: http.StatusForbidden,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "PublishFinish", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   10,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(5), NewReaderMatcher("hello")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+		)
+
+		bus := &staticEventBus{
+			published: make(chan UploadEvent, 10),
+		}
+		composer.UseEventBus(bus)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		event := <-bus.published
+		a.Equal(UploadEventFinish, event.Type)
+		a.Equal("yes", event.Upload.ID)
+		a.EqualValues(10, event.Upload.Offset)
+	})
+
+	SubTest(t, "PublishTerminate", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "foo").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 10,
+			}, nil),
+			store.EXPECT().AsTerminatableUpload(upload).Return(upload),
+			upload.EXPECT().Terminate(gomock.Any()).Return(nil),
+		)
+
+		bus := &staticEventBus{
+			published: make(chan UploadEvent, 10),
+		}
+		composer.UseEventBus(bus)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "DELETE",
+			URL:    "foo",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusNoContent,
+		}).Run(handler, t)
+
+		event := <-bus.published
+		assert.Equal(t, UploadEventTerminate, event.Type)
+		assert.Equal(t, "foo", event.Upload.ID)
+	})
+}
@@ -1,11 +1,15 @@
 package handler_test
 
 import (
+	"context"
+	"io"
 	"net/http"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
 	. "github.com/tus/tusd/v2/pkg/handler"
 )
 
@@ -19,6 +23,34 @@ func (reader *closingStringReader) Close() error {
 	return nil
 }
 
+// rangeReaderStore implements RangeReaderDataStore for uploads whose data is
+// provided as a string.
+type rangeReaderStore struct {
+	data    string
+	modTime time.Time
+	offsets []int64
+}
+
+func (store *rangeReaderStore) AsRangeReadableUpload(upload Upload) RangeReadableUpload {
+	return store
+}
+
+func (store *rangeReaderStore) GetRangeReader(ctx context.Context, offset int64, length int64) (io.ReadCloser, error) {
+	store.offsets = append(store.offsets, offset)
+	return io.NopCloser(strings.NewReader(store.data[offset : offset+length])), nil
+}
+
+func (store *rangeReaderStore) ModTime(ctx context.Context) (time.Time, error) {
+	return store.modTime, nil
+}
+
+// concurrentReaderStore implements ConcurrentReaderDataStore.
+type concurrentReaderStore struct{}
+
+func (concurrentReaderStore) SupportsConcurrentReads() bool {
+	return true
+}
+
 func TestGet(t *testing.T) {
 	SubTest(t, "Download", func(t *testing.T, store *MockFullDataStore, _ *StoreComposer) {
 		reader := &closingStringReader{
@@ -72,6 +104,43 @@ func TestGet(t *testing.T) {
 		}
 	})
 
+	SubTest(t, "ConcurrentReader", func(t *testing.T, store *MockFullDataStore, _ *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		locker := NewMockFullLocker(ctrl)
+		upload := NewMockFullUpload(ctrl)
+
+		// No expectations are set for the locker, since downloads must not interrupt
+		// uploads, which are still in progress.
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				Offset: 5,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(io.NopCloser(strings.NewReader("hello")), nil),
+		)
+
+		composer := NewStoreComposer()
+		composer.UseCore(store)
+		composer.UseLocker(locker)
+		composer.UseConcurrentReader(concurrentReaderStore{})
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ResHeader: map[string]string{
+				"Content-Length": "5",
+			},
+			Code:    http.StatusOK,
+			ResBody: "hello",
+		}).Run(handler, t)
+	})
+
 	SubTest(t, "EmptyDownload", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
 		ctrl := gomock.NewController(t)
 		defer ctrl.Finish()
@@ -164,4 +233,166 @@ func TestGet(t *testing.T) {
 			ResBody: "",
 		}).Run(handler, t)
 	})
+
+	SubTest(t, "Range", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+		reader := &closingStringReader{
+			Reader: strings.NewReader("hello world"),
+		}
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 11,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(reader, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Range": "bytes=6-",
+			},
+			Code: http.StatusPartialContent,
+			ResHeader: map[string]string{
+				"Content-Length": "5",
+				"Content-Range":  "bytes 6-10/11",
+				"Content-Type":   "application/octet-stream",
+			},
+			ResBody: "world",
+		}).Run(handler, t)
+
+		assert.True(t, reader.closed)
+	})
+
+	SubTest(t, "ETag", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		a := assert.New(t)
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		info := FileInfo{
+			ID:     "yes",
+			Offset: 5,
+			Size:   20,
+		}
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(info, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(io.NopCloser(strings.NewReader("hello")), nil),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(info, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(io.NopCloser(strings.NewReader("hello")), nil),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 10,
+				Size:   20,
+			}, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(io.NopCloser(strings.NewReader("hello world")), nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		res := (&httpTest{
+			Method:  "GET",
+			URL:     "yes",
+			Code:    http.StatusOK,
+			ResBody: "hello",
+		}).Run(handler, t)
+
+		etag := res.Header().Get("ETag")
+		a.NotEmpty(etag)
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"If-None-Match": etag,
+			},
+			Code: http.StatusNotModified,
+		}).Run(handler, t)
+
+		// Once more data has been uploaded, the ETag changes.
+		res = (&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"If-None-Match": etag,
+			},
+			Code:    http.StatusOK,
+			ResBody: "hello worl",
+		}).Run(handler, t)
+		a.NotEqual(etag, res.Header().Get("ETag"))
+	})
+
+	SubTest(t, "RangeReader", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		a := assert.New(t)
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		modTime := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		rangeReader := &rangeReaderStore{
+			data:    "hello world",
+			modTime: modTime,
+		}
+		composer.UseRangeReader(rangeReader)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 11,
+				Size:   11,
+			}, nil),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 11,
+				Size:   11,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Range": "bytes=6-9",
+			},
+			Code: http.StatusPartialContent,
+			ResHeader: map[string]string{
+				"Content-Range": "bytes 6-9/11",
+				"Last-Modified": "Tue, 02 Jan 2024 03:04:05 GMT",
+			},
+			ResBody: "worl",
+		}).Run(handler, t)
+
+		a.Equal([]int64{6}, rangeReader.offsets)
+
+		(&httpTest{
+			Method: "GET",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"If-Modified-Since": "Tue, 02 Jan 2024 03:04:05 GMT",
+			},
+			Code: http.StatusNotModified,
+		}).Run(handler, t)
+	})
 }
@@ -56,6 +56,12 @@ func NewHandler(config Config) (*Handler, error) {
 			case method == "PATCH" && r.URL.Path != "":
 				// Upload apppending
 				handler.PatchFile(w, r)
+			case method == "PUT" && config.EnableMetadataUpdate && config.StoreComposer.UsesMetadataUpdater && strings.HasSuffix(path, "/metadata"):
+				// Metadata update
+				handler.PutMetadata(w, r)
+			case method == "GET" && config.StoreComposer.UsesEventBus && !config.DisableDownload && strings.HasSuffix(path, "/events"):
+				// Upload event stream
+				handler.GetEvents(w, r)
 			case method == "GET" && r.URL.Path != "" && !config.DisableDownload:
 				// Upload download
 				handler.GetFile(w, r)
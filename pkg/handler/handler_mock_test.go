@@ -64,6 +64,34 @@ func (mr *MockFullDataStoreMockRecorder) AsLengthDeclarableUpload(upload interfa
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsLengthDeclarableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsLengthDeclarableUpload), upload)
 }
 
+// AsMetadataUpdatableUpload mocks base method.
+func (m *MockFullDataStore) AsMetadataUpdatableUpload(upload handler.Upload) handler.MetadataUpdatableUpload {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AsMetadataUpdatableUpload", upload)
+	ret0, _ := ret[0].(handler.MetadataUpdatableUpload)
+	return ret0
+}
+
+// AsMetadataUpdatableUpload indicates an expected call of AsMetadataUpdatableUpload.
+func (mr *MockFullDataStoreMockRecorder) AsMetadataUpdatableUpload(upload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsMetadataUpdatableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsMetadataUpdatableUpload), upload)
+}
+
+// AsStateUpdatableUpload mocks base method.
+func (m *MockFullDataStore) AsStateUpdatableUpload(upload handler.Upload) handler.StateUpdatableUpload {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AsStateUpdatableUpload", upload)
+	ret0, _ := ret[0].(handler.StateUpdatableUpload)
+	return ret0
+}
+
+// AsStateUpdatableUpload indicates an expected call of AsStateUpdatableUpload.
+func (mr *MockFullDataStoreMockRecorder) AsStateUpdatableUpload(upload interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AsStateUpdatableUpload", reflect.TypeOf((*MockFullDataStore)(nil).AsStateUpdatableUpload), upload)
+}
+
 // AsTerminatableUpload mocks base method.
 func (m *MockFullDataStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
 	m.ctrl.T.Helper()
@@ -217,6 +245,34 @@ func (mr *MockFullUploadMockRecorder) Terminate(ctx interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Terminate", reflect.TypeOf((*MockFullUpload)(nil).Terminate), ctx)
 }
 
+// UpdateMetaData mocks base method.
+func (m *MockFullUpload) UpdateMetaData(ctx context.Context, metaData handler.MetaData) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateMetaData", ctx, metaData)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateMetaData indicates an expected call of UpdateMetaData.
+func (mr *MockFullUploadMockRecorder) UpdateMetaData(ctx, metaData interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateMetaData", reflect.TypeOf((*MockFullUpload)(nil).UpdateMetaData), ctx, metaData)
+}
+
+// UpdateState mocks base method.
+func (m *MockFullUpload) UpdateState(ctx context.Context, state handler.UploadState) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateState", ctx, state)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// UpdateState indicates an expected call of UpdateState.
+func (mr *MockFullUploadMockRecorder) UpdateState(ctx, state interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateState", reflect.TypeOf((*MockFullUpload)(nil).UpdateState), ctx, state)
+}
+
 // WriteChunk mocks base method.
 func (m *MockFullUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
 	m.ctrl.T.Helper()
@@ -145,7 +145,7 @@ func TestHead(t *testing.T) {
 	})
 
 	SubTest(t, "ExperimentalProtocol", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
-		for _, interopVersion := range []string{"3", "4", "5", "6"} {
+		for _, interopVersion := range []string{"3", "4", "5", "6", "7", "8"} {
 			SubTest(t, "InteropVersion"+interopVersion, func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
 				SubTest(t, "IncompleteUpload", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
 					ctrl := gomock.NewController(t)
@@ -177,7 +177,7 @@ func TestHead(t *testing.T) {
 							"Upload-Draft-Interop-Version": interopVersion,
 							"Upload-Offset":                "5",
 							"Upload-Length":                "10",
-							"Upload-Limit":                 "min-size=0,max-size=10",
+							"Upload-Limit":                 ietfUploadLimit(10, interopVersion),
 						}, false, interopVersion),
 					}).Run(handler, t)
 				})
@@ -212,7 +212,7 @@ func TestHead(t *testing.T) {
 							"Upload-Draft-Interop-Version": interopVersion,
 							"Upload-Offset":                "10",
 							"Upload-Length":                "10",
-							"Upload-Limit":                 "min-size=0,max-size=10",
+							"Upload-Limit":                 ietfUploadLimit(10, interopVersion),
 						}, true, interopVersion),
 					}).Run(handler, t)
 				})
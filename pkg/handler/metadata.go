@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+)
+
+var ErrMetadataUpdateRejected = NewError("ERR_METADATA_UPDATE_REJECTED", "metadata update has been rejected by server", http.StatusBadRequest)
+
+// PutMetadata handles PUT requests to <upload URL>/metadata, which replace the upload's
+// meta data with the one from the Upload-Metadata header. Fields managed by the handler,
+// such as the virus scan result, are kept unchanged. This is not part of the tus
+// specification and requires Config.EnableMetadataUpdate and a data store implementing
+// MetadataUpdaterDataStore.
+func (handler *UnroutedHandler) PutMetadata(w http.ResponseWriter, r *http.Request) {
+	c := handler.getContext(w, r)
+
+	if !handler.config.EnableMetadataUpdate || !handler.composer.UsesMetadataUpdater {
+		handler.sendError(c, ErrNotImplemented)
+		return
+	}
+
+	id, err := extractIDFromPath(strings.TrimSuffix(strings.TrimRight(r.URL.Path, "/"), "/metadata"))
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+	c.log = c.log.With("id", id)
+	setSpanUploadID(c, id)
+
+	if handler.composer.UsesLocker {
+		lock, err := handler.lockUpload(c, id)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
+		defer lock.Unlock()
+	}
+
+	upload, err := handler.composer.Core.GetUpload(c, id)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	info, err := handler.getInfo(c, upload)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	if err := handler.checkUploadTokenSubject(c, info); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	previousMetaData := info.MetaData
+	info.MetaData = ParseMetadataHeader(r.Header.Get("Upload-Metadata"))
+
+	resp := HTTPResponse{
+		StatusCode: http.StatusNoContent,
+	}
+
+	if handler.config.PreUpdateMetadataCallback != nil {
+		resp2, changes, err := handler.config.PreUpdateMetadataCallback(newHookEvent(c, info))
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+		resp = resp.MergeWith(resp2)
+
+		if changes.MetaData != nil {
+			info.MetaData = changes.MetaData
+		}
+	}
+
+	// Neither the client nor the hook may change the fields managed by the handler.
+	for _, key := range handler.protectedMetaDataKeys() {
+		if value, ok := previousMetaData[key]; ok {
+			info.MetaData[key] = value
+		} else {
+			delete(info.MetaData, key)
+		}
+	}
+
+	if err := handler.updateMetadata(c, upload, info.MetaData); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	c.log.InfoContext(c, "MetadataUpdated")
+
+	if handler.config.NotifyUpdatedMetadata {
+		handler.UpdatedMetadata <- newHookEvent(c, info)
+	}
+
+	handler.sendResp(c, resp)
+}
+
+// protectedMetaDataKeys returns the meta data fields, which are managed by the handler
+// and therefore cannot be changed using PutMetadata:
+// - the subject of the upload token, which the upload is bound to,
+// - the result of the virus scan,
+// - the field identifying the upload's quota, and
+// - the declared type and name of the file, if the content type is detected, since
+// they have been checked against the upload's data and determine how it is served.
+func (handler *UnroutedHandler) protectedMetaDataKeys() []string {
+	keys := []string{UploadTokenSubjectMetaDataKey, VirusScanMetaDataKey}
+
+	if handler.config.QuotaMetaDataKey != "" {
+		keys = append(keys, handler.config.QuotaMetaDataKey)
+	}
+
+	if handler.config.SniffContentType {
+		keys = append(keys, "filetype", "filename")
+	}
+
+	return keys
+}
+
+// updateMetadata replaces the meta data of the upload using the data store.
+func (handler *UnroutedHandler) updateMetadata(c *httpContext, upload Upload, metaData MetaData) (err error) {
+	ctx, span := handler.startSpan(c, "UpdateMetadata")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	updatableUpload := handler.composer.MetadataUpdater.AsMetadataUpdatableUpload(upload)
+	return updatableUpload.UpdateMetaData(ctx, metaData)
+}
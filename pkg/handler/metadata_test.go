@@ -0,0 +1,227 @@
+package handler_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestMetadataUpdate(t *testing.T) {
+	SubTest(t, "Update", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UseMetadataUpdater(store)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:       "yes",
+				Offset:   5,
+				Size:     5,
+				MetaData: map[string]string{"filename": "old.txt"},
+			}, nil),
+			store.EXPECT().AsMetadataUpdatableUpload(upload).Return(upload),
+			upload.EXPECT().UpdateMetaData(gomock.Any(), MetaData{
+				"filename": "new.txt",
+				"caption":  "hello",
+			}).Return(nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:        composer,
+			EnableMetadataUpdate: true,
+		})
+
+		(&httpTest{
+			Method: "PUT",
+			URL:    "yes/metadata",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Metadata": "filename bmV3LnR4dA==,caption aGVsbG8=",
+			},
+			Code: http.StatusNoContent,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "HookChangesMetadata", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UseMetadataUpdater(store)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:       "yes",
+				Offset:   5,
+				Size:     5,
+				MetaData: map[string]string{"filename": "old.txt"},
+			}, nil),
+			store.EXPECT().AsMetadataUpdatableUpload(upload).Return(upload),
+			upload.EXPECT().UpdateMetaData(gomock.Any(), MetaData{
+				"filename": "new.txt",
+				"owner":    "alice",
+			}).Return(nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:        composer,
+			EnableMetadataUpdate: true,
+			PreUpdateMetadataCallback: func(event HookEvent) (HTTPResponse, FileInfoChanges, error) {
+				assert.Equal(t, MetaData{"filename": "new.txt"}, event.Upload.MetaData)
+
+				return HTTPResponse{
+					Header: HTTPHeader{"X-Custom": "foo"},
+				}, FileInfoChanges{
+					MetaData: MetaData{
+						"filename": event.Upload.MetaData["filename"],
+						"owner":    "alice",
+					},
+				}, nil
+			},
+		})
+
+		(&httpTest{
+			Method: "PUT",
+			URL:    "yes/metadata",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Metadata": "filename bmV3LnR4dA==",
+			},
+			Code: http.StatusNoContent,
+			ResHeader: map[string]string{
+				"X-Custom": "foo",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "KeepProtectedKeys", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UseMetadataUpdater(store)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   5,
+				MetaData: map[string]string{
+					"filetype":           "image/png",
+					VirusScanMetaDataKey: "clean",
+					"tenant":             "a",
+				},
+			}, nil),
+			store.EXPECT().AsMetadataUpdatableUpload(upload).Return(upload),
+			upload.EXPECT().UpdateMetaData(gomock.Any(), MetaData{
+				"filetype":           "image/png",
+				VirusScanMetaDataKey: "clean",
+				"tenant":             "a",
+				"caption":            "hello",
+			}).Return(nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			EnableMetadataUpdate:  true,
+			SniffContentType:      true,
+			QuotaMetaDataKey:      "tenant",
+			NotifyUpdatedMetadata: true,
+			PreUpdateMetadataCallback: func(event HookEvent) (HTTPResponse, FileInfoChanges, error) {
+				return HTTPResponse{}, FileInfoChanges{
+					MetaData: MetaData{
+						"caption":                     event.Upload.MetaData["caption"],
+						"filename":                    "evil.html",
+						UploadTokenSubjectMetaDataKey: "user-2",
+					},
+				}, nil
+			},
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.UpdatedMetadata = c
+
+		(&httpTest{
+			Method: "PUT",
+			URL:    "yes/metadata",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				// filetype text/html, virusscan infected, tenant b, caption hello
+				"Upload-Metadata": "filetype dGV4dC9odG1s,virusscan aW5mZWN0ZWQ=,tenant Yg==,caption aGVsbG8=",
+			},
+			Code: http.StatusNoContent,
+		}).Run(handler, t)
+
+		event := <-c
+		a := assert.New(t)
+		a.Equal("yes", event.Upload.ID)
+		a.Equal(MetaData{
+			"filetype":           "image/png",
+			VirusScanMetaDataKey: "clean",
+			"tenant":             "a",
+			"caption":            "hello",
+		}, event.Upload.MetaData)
+	})
+
+	SubTest(t, "HookRejectsUpdate", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UseMetadataUpdater(store)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   5,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:        composer,
+			EnableMetadataUpdate: true,
+			PreUpdateMetadataCallback: func(event HookEvent) (HTTPResponse, FileInfoChanges, error) {
+				return HTTPResponse{}, FileInfoChanges{}, ErrMetadataUpdateRejected
+			},
+		})
+
+		(&httpTest{
+			Method: "PUT",
+			URL:    "yes/metadata",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Metadata": "filename bmV3LnR4dA==",
+			},
+			Code:    http.StatusBadRequest,
+			ResBody: "ERR_METADATA_UPDATE_REJECTED: metadata update has been rejected by server\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "NotEnabled", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		composer.UseMetadataUpdater(store)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PUT",
+			URL:    "yes/metadata",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Metadata": "filename bmV3LnR4dA==",
+			},
+			Code: http.StatusMethodNotAllowed,
+		}).Run(handler, t)
+	})
+}
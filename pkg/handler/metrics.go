@@ -4,6 +4,7 @@ import (
 	"maps"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // Metrics provides numbers about the usage of the tusd handler. Since these may
@@ -20,6 +21,14 @@ type Metrics struct {
 	UploadsFinished   *uint64
 	UploadsCreated    *uint64
 	UploadsTerminated *uint64
+	// UploadsActive is the number of requests currently receiving upload data.
+	UploadsActive *int64
+	// UploadsThrottled is the number of requests currently receiving data while
+	// being subject to a bandwidth limit.
+	UploadsThrottled *int64
+	// ThrottleDelay is the total time in nanoseconds that requests have been delayed
+	// due to bandwidth limits.
+	ThrottleDelay *uint64
 }
 
 // incRequestsTotal increases the counter for this request method atomically by
@@ -57,6 +66,32 @@ func (m Metrics) incUploadsTerminated() {
 	atomic.AddUint64(m.UploadsTerminated, 1)
 }
 
+// incUploadsActive increases the gauge for active uploads atomically by one.
+func (m Metrics) incUploadsActive() {
+	atomic.AddInt64(m.UploadsActive, 1)
+}
+
+// decUploadsActive decreases the gauge for active uploads atomically by one.
+func (m Metrics) decUploadsActive() {
+	atomic.AddInt64(m.UploadsActive, -1)
+}
+
+// incUploadsThrottled increases the gauge for throttled uploads atomically by one.
+func (m Metrics) incUploadsThrottled() {
+	atomic.AddInt64(m.UploadsThrottled, 1)
+}
+
+// decUploadsThrottled decreases the gauge for throttled uploads atomically by one.
+func (m Metrics) decUploadsThrottled() {
+	atomic.AddInt64(m.UploadsThrottled, -1)
+}
+
+// addThrottleDelay increases the total throttle delay atomically by the specified
+// duration.
+func (m Metrics) addThrottleDelay(delay time.Duration) {
+	atomic.AddUint64(m.ThrottleDelay, uint64(delay))
+}
+
 func newMetrics() Metrics {
 	return Metrics{
 		RequestsTotal: map[string]*uint64{
@@ -72,6 +107,9 @@ func newMetrics() Metrics {
 		UploadsFinished:   new(uint64),
 		UploadsCreated:    new(uint64),
 		UploadsTerminated: new(uint64),
+		UploadsActive:     new(int64),
+		UploadsThrottled:  new(int64),
+		ThrottleDelay:     new(uint64),
 	}
 }
 
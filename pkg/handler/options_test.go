@@ -56,16 +56,19 @@ func TestOptions(t *testing.T) {
 			MaxSize:                    400,
 		})
 
-		(&httpTest{
-			Method: "OPTIONS",
-			ReqHeader: map[string]string{
-				"Upload-Draft-Interop-Version": "6",
-			},
-			ResHeader: map[string]string{
-				"Upload-Limit": "min-size=0,max-size=400",
-			},
-			Code: http.StatusOK,
-		}).Run(handler, t)
+		for _, interopVersion := range []string{"6", "7", "8"} {
+			(&httpTest{
+				Method: "OPTIONS",
+				ReqHeader: map[string]string{
+					"Upload-Draft-Interop-Version": interopVersion,
+				},
+				ResHeader: map[string]string{
+					"Upload-Draft-Interop-Version": interopVersion,
+					"Upload-Limit":                 "min-size=0,max-size=400",
+				},
+				Code: http.StatusOK,
+			}).Run(handler, t)
+		}
 	})
 
 	SubTest(t, "DisableConcatenation", func(t *testing.T, store *MockFullDataStore, _ *StoreComposer) {
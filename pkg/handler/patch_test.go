@@ -816,7 +816,7 @@ func TestPatch(t *testing.T) {
 	})
 
 	SubTest(t, "ExperimentalProtocol", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
-		for _, interopVersion := range []string{"3", "4", "5", "6"} {
+		for _, interopVersion := range []string{"3", "4", "5", "6", "7", "8"} {
 			SubTest(t, "InteropVersion"+interopVersion, func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
 				SubTest(t, "CompleteUploadWithKnownSize", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
 					ctrl := gomock.NewController(t)
@@ -993,4 +993,110 @@ func TestPatch(t *testing.T) {
 			})
 		}
 	})
+
+	SubTest(t, "ExperimentalProtocolProblemDetails", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
+		SubTest(t, "MismatchingOffset", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			upload := NewMockFullUpload(ctrl)
+
+			gomock.InOrder(
+				store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+				upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+					ID:     "yes",
+					Offset: 5,
+					Size:   10,
+				}, nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				StoreComposer:              composer,
+				EnableExperimentalProtocol: true,
+			})
+
+			(&httpTest{
+				Method: "PATCH",
+				URL:    "yes",
+				ReqHeader: map[string]string{
+					"Upload-Draft-Interop-Version": "7",
+					"Content-Type":                 "application/partial-upload",
+					"Upload-Offset":                "3",
+				},
+				ReqBody: strings.NewReader("hello"),
+				Code:    http.StatusConflict,
+				ResHeader: map[string]string{
+					"Content-Type": "application/problem+json",
+				},
+				ResBody: `{"expected-offset":5,"provided-offset":3,"title":"mismatched offset","type":"https://iana.org/assignments/http-problem-types#mismatching-upload-offset"}`,
+			}).Run(handler, t)
+		})
+
+		SubTest(t, "CompletedUpload", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			upload := NewMockFullUpload(ctrl)
+
+			gomock.InOrder(
+				store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+				upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+					ID:     "yes",
+					Offset: 10,
+					Size:   10,
+				}, nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				StoreComposer:              composer,
+				EnableExperimentalProtocol: true,
+			})
+
+			(&httpTest{
+				Method: "PATCH",
+				URL:    "yes",
+				ReqHeader: map[string]string{
+					"Upload-Draft-Interop-Version": "8",
+					"Content-Type":                 "application/partial-upload",
+					"Upload-Offset":                "10",
+				},
+				Code: http.StatusBadRequest,
+				ResHeader: map[string]string{
+					"Content-Type": "application/problem+json",
+				},
+				ResBody: `{"title":"upload is already completed","type":"https://iana.org/assignments/http-problem-types#completed-upload"}`,
+			}).Run(handler, t)
+		})
+
+		SubTest(t, "OlderInteropVersion", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			upload := NewMockFullUpload(ctrl)
+
+			gomock.InOrder(
+				store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+				upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+					ID:     "yes",
+					Offset: 5,
+					Size:   10,
+				}, nil),
+			)
+
+			handler, _ := NewHandler(Config{
+				StoreComposer:              composer,
+				EnableExperimentalProtocol: true,
+			})
+
+			(&httpTest{
+				Method: "PATCH",
+				URL:    "yes",
+				ReqHeader: map[string]string{
+					"Upload-Draft-Interop-Version": "6",
+					"Content-Type":                 "application/partial-upload",
+					"Upload-Offset":                "3",
+				},
+				ReqBody: strings.NewReader("hello"),
+				Code:    http.StatusConflict,
+				ResBody: "ERR_MISMATCHED_OFFSET: mismatched offset\n",
+			}).Run(handler, t)
+		})
+	})
 }
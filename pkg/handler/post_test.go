@@ -585,7 +585,7 @@ func TestPost(t *testing.T) {
 	})
 
 	SubTest(t, "ExperimentalProtocol", func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
-		for _, interopVersion := range []string{"3", "4", "5", "6"} {
+		for _, interopVersion := range []string{"3", "4", "5", "6", "7", "8"} {
 			SubTest(t, "InteropVersion"+interopVersion, func(t *testing.T, _ *MockFullDataStore, _ *StoreComposer) {
 				SubTest(t, "CompleteUpload", func(t *testing.T, store *MockFullDataStore, _ *StoreComposer) {
 					ctrl := gomock.NewController(t)
@@ -642,7 +642,7 @@ func TestPost(t *testing.T) {
 							"Upload-Draft-Interop-Version": interopVersion,
 							"Location":                     "http://tus.io/files/foo",
 							"Upload-Offset":                "11",
-							"Upload-Limit":                 "min-size=0,max-size=11",
+							"Upload-Limit":                 ietfUploadLimit(11, interopVersion),
 						},
 					}).Run(handler, t)
 
@@ -654,7 +654,7 @@ func TestPost(t *testing.T) {
 								"Upload-Draft-Interop-Version": []string{interopVersion},
 								"Location":                     []string{"http://tus.io/files/foo"},
 								"X-Content-Type-Options":       []string{"nosniff"},
-								"Upload-Limit":                 []string{"min-size=0,max-size=11"},
+								"Upload-Limit":                 []string{ietfUploadLimit(11, interopVersion)},
 							},
 						},
 					}, res.InformationalResponses)
@@ -772,7 +772,7 @@ func TestPost(t *testing.T) {
 								"Upload-Draft-Interop-Version": interopVersion,
 								"Location":                     "http://tus.io/files/foo",
 								"Upload-Offset":                "11",
-								"Upload-Limit":                 "min-size=0,max-size=11",
+								"Upload-Limit":                 ietfUploadLimit(11, interopVersion),
 							},
 						}).Run(handler, t)
 					})
@@ -796,7 +796,7 @@ func TestPost(t *testing.T) {
 							},
 							ReqBody: strings.NewReader("hello world"),
 							Code:    http.StatusBadRequest,
-							ResBody: "ERR_INVALID_UPLOAD_LENGTH: missing or invalid Upload-Length header\n",
+							ResBody: ietfProblemBody("ERR_INVALID_UPLOAD_LENGTH: missing or invalid Upload-Length header\n", interopVersion, `{"title":"missing or invalid Upload-Length header","type":"https://iana.org/assignments/http-problem-types#inconsistent-upload-length"}`),
 						}).Run(handler, t)
 					})
 
@@ -847,7 +847,7 @@ func TestPost(t *testing.T) {
 								"Upload-Draft-Interop-Version": interopVersion,
 								"Location":                     "http://tus.io/files/foo",
 								"Upload-Offset":                "6",
-								"Upload-Limit":                 "min-size=0,max-size=11",
+								"Upload-Limit":                 ietfUploadLimit(11, interopVersion),
 							},
 						}).Run(handler, t)
 					})
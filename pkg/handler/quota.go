@@ -0,0 +1,250 @@
+package handler
+
+import (
+	"context"
+	"math"
+	"net/http"
+
+	"github.com/tus/tusd/v2/internal/uid"
+)
+
+var ErrQuotaExceeded = NewError("ERR_QUOTA_EXCEEDED", "storage quota exceeded", http.StatusRequestEntityTooLarge)
+
+// QuotaReservation describes the storage space that is reserved for a single upload
+// in a quota.
+type QuotaReservation struct {
+	// Key identifies the quota that the upload belongs to, e.g. a tenant or user ID.
+	Key string
+	// ID is the upload's ID.
+	ID string
+	// Size is the number of bytes reserved for the upload. For uploads with a known
+	// length, this is the upload's size. For uploads with a deferred length, the
+	// reservation grows as data is received.
+	Size int64
+	// Used is the number of bytes that have been received for the upload.
+	Used int64
+	// Limit is the maximum number of bytes that all uploads in the quota may reserve
+	// together, as it applied when the upload was created. A value of 0 or smaller
+	// means that no limit is enforced and the reservations are only tracked.
+	Limit int64
+}
+
+// QuotaUsage summarizes all reservations in a quota.
+type QuotaUsage struct {
+	// Reserved is the sum of reserved bytes of all uploads in the quota.
+	Reserved int64
+	// Used is the sum of received bytes of all uploads in the quota.
+	Used int64
+}
+
+// QuotaStore is the interface required for tracking how much storage space is
+// reserved and used by uploads, grouped by a quota key. The handler reserves
+// space when an upload is created and while data is received, and releases it
+// when an upload is terminated. Uploads which are removed by other means (e.g.
+// after they expired) must be released by the application by calling Release.
+// Implementations must be safe for concurrent use. If multiple tusd instances
+// share uploads, they must also share the quota store.
+type QuotaStore interface {
+	// Reserve sets the number of reserved bytes for the upload with the given ID
+	// in the quota identified by key, replacing a previous reservation for this
+	// upload. If the sum of all reservations in the quota would exceed the limit
+	// afterwards, ErrQuotaExceeded must be returned and a previous reservation must
+	// be kept unchanged. The check and the modification must be atomic. A limit of
+	// 0 or smaller disables the check.
+	Reserve(ctx context.Context, key string, id string, size int64, limit int64) error
+	// Use records that the given number of bytes have been received for the upload.
+	// It is a no-op if the upload has no reservation.
+	Use(ctx context.Context, id string, used int64) error
+	// Release removes the upload's reservation. It is a no-op if the upload has no
+	// reservation.
+	Release(ctx context.Context, id string) error
+	// GetReservation returns the upload's reservation. If the upload has no
+	// reservation, ok is false and no error is returned.
+	GetReservation(ctx context.Context, id string) (reservation QuotaReservation, ok bool, err error)
+	// GetUsage returns the sums of all reservations in the quota identified by key.
+	GetUsage(ctx context.Context, key string) (QuotaUsage, error)
+}
+
+// reserveUploadQuota reserves space for a new upload before it is created. The
+// quota key is taken from the pre-create changes or the meta data field specified
+// in Config.QuotaMetaDataKey. Since the upload's ID is required for the reservation,
+// an ID is assigned to the upload if none has been set by the pre-create callback.
+// It returns nil if no quota applies to the upload.
+func (handler *UnroutedHandler) reserveUploadQuota(c *httpContext, info *FileInfo, changes FileInfoChanges) (*QuotaReservation, error) {
+	if !handler.composer.UsesQuotaStore {
+		return nil, nil
+	}
+
+	key := changes.QuotaKey
+	if key == "" && handler.config.QuotaMetaDataKey != "" {
+		key = info.MetaData[handler.config.QuotaMetaDataKey]
+	}
+	if key == "" {
+		return nil, nil
+	}
+
+	limit := handler.config.QuotaLimit
+	if changes.QuotaLimit > 0 {
+		limit = changes.QuotaLimit
+	}
+
+	if info.ID == "" {
+		info.ID = uid.Uid()
+	}
+
+	reservation := &QuotaReservation{
+		Key:   key,
+		ID:    info.ID,
+		Limit: limit,
+	}
+	if !info.SizeIsDeferred {
+		reservation.Size = info.Size
+	}
+
+	if err := handler.composer.QuotaStore.Reserve(c, key, reservation.ID, reservation.Size, limit); err != nil {
+		return nil, err
+	}
+
+	c.log.InfoContext(c, "QuotaReserved", "key", key, "size", reservation.Size, "limit", limit)
+	return reservation, nil
+}
+
+// moveUploadQuota updates the reservation after the upload has been created, in
+// case the data store did not use the assigned upload ID. If the space cannot be
+// reserved under the new ID, the space is still recorded for the upload, so that it
+// remains accounted for until abortUploadQuota removes the upload.
+func (handler *UnroutedHandler) moveUploadQuota(c *httpContext, reservation *QuotaReservation, info FileInfo) error {
+	if reservation == nil || reservation.ID == info.ID {
+		return nil
+	}
+
+	handler.releaseQuota(c, reservation.ID)
+	reservation.ID = info.ID
+
+	err := handler.composer.QuotaStore.Reserve(c, reservation.Key, reservation.ID, reservation.Size, reservation.Limit)
+	if err != nil {
+		if forceErr := handler.composer.QuotaStore.Reserve(context.WithoutCancel(c), reservation.Key, reservation.ID, reservation.Size, 0); forceErr != nil {
+			c.log.WarnContext(c, "QuotaUpdateError", "error", forceErr)
+		}
+	}
+
+	return err
+}
+
+// abortUploadQuota is called if the creation of an upload fails after its space has
+// been reserved. It terminates the upload and releases its reservation. If the upload
+// cannot be terminated, the reservation is kept, so that the upload cannot exceed
+// its quota later on.
+func (handler *UnroutedHandler) abortUploadQuota(c *httpContext, reservation *QuotaReservation, upload Upload) {
+	if reservation == nil || !handler.composer.UsesTerminater {
+		return
+	}
+
+	if err := handler.composer.Terminater.AsTerminatableUpload(upload).Terminate(context.WithoutCancel(c)); err != nil {
+		c.log.ErrorContext(c, "QuotaTerminateError", "error", err.Error())
+		return
+	}
+
+	handler.releaseQuota(c, reservation.ID)
+}
+
+// reserveChunkQuota ensures that the upload's reservation covers the data that can
+// be received in the current request. For uploads with a known length, this is the
+// upload's size. For uploads with a deferred length, the reservation is extended by
+// maxSize, which is reduced to the remaining space in the quota if it is unbounded.
+// It returns the reservation (or nil if no quota applies) and the adjusted maxSize.
+func (handler *UnroutedHandler) reserveChunkQuota(c *httpContext, info FileInfo, offset int64, maxSize int64) (*QuotaReservation, int64, error) {
+	if !handler.composer.UsesQuotaStore {
+		return nil, maxSize, nil
+	}
+
+	reservation, ok, err := handler.composer.QuotaStore.GetReservation(c, info.ID)
+	if err != nil {
+		return nil, maxSize, err
+	}
+	if !ok {
+		return nil, maxSize, nil
+	}
+
+	size := info.Size
+	if info.SizeIsDeferred {
+		if maxSize == math.MaxInt64 && reservation.Limit > 0 {
+			usage, err := handler.composer.QuotaStore.GetUsage(c, reservation.Key)
+			if err != nil {
+				return nil, maxSize, err
+			}
+
+			available := reservation.Limit - usage.Reserved + reservation.Size - offset
+			if available <= 0 {
+				return nil, maxSize, ErrQuotaExceeded
+			}
+			maxSize = available
+		}
+
+		if maxSize > math.MaxInt64-offset {
+			// No limit applies to the upload, so there is nothing to reserve.
+			return &reservation, maxSize, nil
+		}
+		size = offset + maxSize
+	}
+
+	if size > reservation.Size {
+		if err := handler.composer.QuotaStore.Reserve(c, reservation.Key, reservation.ID, size, reservation.Limit); err != nil {
+			return nil, maxSize, err
+		}
+		reservation.Size = size
+	}
+
+	return &reservation, maxSize, nil
+}
+
+// reserveLengthQuota updates the reservation of an upload with a deferred length once
+// its length is declared. The reservation is replaced by the declared length, so the
+// length is rejected with ErrQuotaExceeded if it does not fit into the quota.
+func (handler *UnroutedHandler) reserveLengthQuota(c *httpContext, info FileInfo, length int64) error {
+	if !handler.composer.UsesQuotaStore {
+		return nil
+	}
+
+	reservation, ok, err := handler.composer.QuotaStore.GetReservation(c, info.ID)
+	if err != nil || !ok {
+		return err
+	}
+
+	return handler.composer.QuotaStore.Reserve(c, reservation.Key, reservation.ID, length, reservation.Limit)
+}
+
+// updateChunkQuota records the received bytes after a chunk has been written. For
+// uploads with a deferred length, the reservation is reduced to the received bytes,
+// releasing the space that was reserved but not used by the request.
+func (handler *UnroutedHandler) updateChunkQuota(c *httpContext, reservation *QuotaReservation, info FileInfo, newOffset int64) {
+	if reservation == nil {
+		return
+	}
+
+	// The upload's context might already be cancelled, but we still want to record
+	// the received data.
+	ctx := context.WithoutCancel(c)
+
+	if info.SizeIsDeferred && reservation.Size > newOffset {
+		if err := handler.composer.QuotaStore.Reserve(ctx, reservation.Key, reservation.ID, newOffset, reservation.Limit); err != nil {
+			c.log.WarnContext(c, "QuotaUpdateError", "error", err)
+		}
+	}
+
+	if err := handler.composer.QuotaStore.Use(ctx, reservation.ID, newOffset); err != nil {
+		c.log.WarnContext(c, "QuotaUpdateError", "error", err)
+	}
+}
+
+// releaseQuota removes the upload's reservation, if a quota store is configured.
+// Errors are only logged since they are not relevant to the client.
+func (handler *UnroutedHandler) releaseQuota(c *httpContext, id string) {
+	if !handler.composer.UsesQuotaStore {
+		return
+	}
+
+	if err := handler.composer.QuotaStore.Release(context.WithoutCancel(c), id); err != nil {
+		c.log.WarnContext(c, "QuotaReleaseError", "error", err)
+	}
+}
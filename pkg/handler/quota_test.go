@@ -0,0 +1,287 @@
+package handler_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	. "github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/memoryquotastore"
+)
+
+func TestQuota(t *testing.T) {
+	SubTest(t, "CreateWithinQuota", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		quotaStore := memoryquotastore.New()
+		quotaStore.UseIn(composer)
+
+		var id string
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, info FileInfo) (Upload, error) {
+				// An ID must be assigned before the upload is created, so that the
+				// space can be reserved for it.
+				id = info.ID
+				return upload, nil
+			}),
+			upload.EXPECT().GetInfo(gomock.Any()).DoAndReturn(func(ctx context.Context) (FileInfo, error) {
+				return FileInfo{
+					ID:   id,
+					Size: 300,
+					MetaData: map[string]string{
+						"tenant": "a",
+					},
+				}, nil
+			}),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:    composer,
+			BasePath:         "/files/",
+			QuotaMetaDataKey: "tenant",
+			QuotaLimit:       500,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "300",
+				"Upload-Metadata": "tenant YQ==",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.NotEmpty(id)
+
+		reservation, ok, err := quotaStore.GetReservation(context.Background(), id)
+		a.NoError(err)
+		a.True(ok)
+		a.Equal(QuotaReservation{
+			Key:   "a",
+			ID:    id,
+			Size:  300,
+			Limit: 500,
+		}, reservation)
+	})
+
+	SubTest(t, "CreateExceedsQuota", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		quotaStore := memoryquotastore.New()
+		quotaStore.UseIn(composer)
+		assert.NoError(t, quotaStore.Reserve(context.Background(), "a", "existing", 300, 500))
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+			QuotaLimit:    500,
+			PreUploadCreateCallback: func(hook HookEvent) (HTTPResponse, FileInfoChanges, error) {
+				return HTTPResponse{}, FileInfoChanges{QuotaKey: "a"}, nil
+			},
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+			},
+			Code:    http.StatusRequestEntityTooLarge,
+			ResBody: "ERR_QUOTA_EXCEEDED: storage quota exceeded\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "CreateFailsAfterReserving", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		quotaStore := memoryquotastore.New()
+		quotaStore.UseIn(composer)
+
+		var id string
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, info FileInfo) (Upload, error) {
+				id = info.ID
+				return upload, nil
+			}),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{}, ErrNotFound),
+			store.EXPECT().AsTerminatableUpload(upload).Return(upload),
+			upload.EXPECT().Terminate(gomock.Any()).Return(nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			BasePath:      "/files/",
+			QuotaLimit:    500,
+			PreUploadCreateCallback: func(hook HookEvent) (HTTPResponse, FileInfoChanges, error) {
+				return HTTPResponse{}, FileInfoChanges{QuotaKey: "a"}, nil
+			},
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+			},
+			Code: http.StatusNotFound,
+		}).Run(handler, t)
+
+		// The failed upload does not keep its reservation.
+		_, ok, err := quotaStore.GetReservation(context.Background(), id)
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	SubTest(t, "DeclareLengthExceedsQuota", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		quotaStore := memoryquotastore.New()
+		quotaStore.UseIn(composer)
+		assert.NoError(t, quotaStore.Reserve(context.Background(), "a", "yes", 5, 10))
+		assert.NoError(t, quotaStore.Reserve(context.Background(), "a", "other", 3, 10))
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:             "yes",
+				Offset:         5,
+				SizeIsDeferred: true,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		// Only two more bytes fit into the quota.
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+				"Upload-Length": "10",
+			},
+			Code:    http.StatusRequestEntityTooLarge,
+			ResBody: "ERR_QUOTA_EXCEEDED: storage quota exceeded\n",
+		}).Run(handler, t)
+
+		reservation, _, err := quotaStore.GetReservation(context.Background(), "yes")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(5), reservation.Size)
+	})
+
+	SubTest(t, "PatchDeferredLength", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		quotaStore := memoryquotastore.New()
+		quotaStore.UseIn(composer)
+		assert.NoError(t, quotaStore.Reserve(context.Background(), "a", "yes", 0, 10))
+		assert.NoError(t, quotaStore.Reserve(context.Background(), "a", "other", 3, 10))
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:             "yes",
+				Offset:         0,
+				SizeIsDeferred: true,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:             "yes",
+				Offset:         5,
+				SizeIsDeferred: true,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "5",
+			},
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		reservation, _, err := quotaStore.GetReservation(context.Background(), "yes")
+		a.NoError(err)
+		a.Equal(int64(5), reservation.Size)
+		a.Equal(int64(5), reservation.Used)
+
+		// Only two bytes are left in the quota.
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":  "1.0.0",
+				"Content-Type":   "application/offset+octet-stream",
+				"Upload-Offset":  "5",
+				"Content-Length": "5",
+			},
+			ReqBody: strings.NewReader("world"),
+			Code:    http.StatusRequestEntityTooLarge,
+			ResBody: "ERR_QUOTA_EXCEEDED: storage quota exceeded\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "TerminateReleases", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		quotaStore := memoryquotastore.New()
+		quotaStore.UseIn(composer)
+		assert.NoError(t, quotaStore.Reserve(context.Background(), "a", "foo", 10, 10))
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "foo").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "foo",
+				Size: 10,
+			}, nil),
+			store.EXPECT().AsTerminatableUpload(upload).Return(upload),
+			upload.EXPECT().Terminate(gomock.Any()).Return(nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+		})
+
+		(&httpTest{
+			Method: "DELETE",
+			URL:    "foo",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+			},
+			Code: http.StatusNoContent,
+		}).Run(handler, t)
+
+		_, ok, err := quotaStore.GetReservation(context.Background(), "foo")
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+}
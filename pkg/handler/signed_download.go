@@ -0,0 +1,84 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrDownloadSignatureInvalid = NewError("ERR_DOWNLOAD_SIGNATURE_INVALID", "download signature is missing or invalid", http.StatusForbidden)
+	ErrDownloadURLExpired       = NewError("ERR_DOWNLOAD_URL_EXPIRED", "download URL has expired", http.StatusForbidden)
+)
+
+// Names of the query parameters used for signed download URLs.
+const (
+	downloadExpiresParam     = "expires"
+	downloadDispositionParam = "disposition"
+	downloadSignatureParam   = "signature"
+)
+
+// SignDownloadURL returns the upload URL with query parameters appended, which allow
+// downloading the upload with the given ID until the expiration time, if the handler
+// is configured with the same key in Config.DownloadSigningKey. If contentDisposition
+// is not empty, it is used as the Content-Disposition header in the response instead
+// of the value derived from the upload's meta data.
+func SignDownloadURL(key []byte, uploadURL string, id string, expires time.Time, contentDisposition string) (string, error) {
+	u, err := url.Parse(uploadURL)
+	if err != nil {
+		return "", err
+	}
+
+	expiresStr := strconv.FormatInt(expires.Unix(), 10)
+
+	query := u.Query()
+	query.Set(downloadExpiresParam, expiresStr)
+	if contentDisposition != "" {
+		query.Set(downloadDispositionParam, contentDisposition)
+	} else {
+		query.Del(downloadDispositionParam)
+	}
+	query.Set(downloadSignatureParam, downloadSignature(key, id, expiresStr, contentDisposition))
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// downloadSignature computes the HMAC over the upload ID, expiration time and
+// the overridden Content-Disposition value.
+func downloadSignature(key []byte, id string, expires string, contentDisposition string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(id + "\n" + expires + "\n" + contentDisposition))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyDownloadSignature checks whether the GET request carries a valid, unexpired
+// signature for the upload. It returns the signed Content-Disposition value, which
+// should override the default one if it is not empty.
+func (handler *UnroutedHandler) verifyDownloadSignature(c *httpContext, id string) (string, error) {
+	query := c.req.URL.Query()
+	expiresStr := query.Get(downloadExpiresParam)
+	contentDisposition := query.Get(downloadDispositionParam)
+	signature := query.Get(downloadSignatureParam)
+
+	expected := downloadSignature(handler.config.DownloadSigningKey, id, expiresStr, contentDisposition)
+	if signature == "" || !hmac.Equal([]byte(signature), []byte(expected)) {
+		c.log.WarnContext(c, "DownloadSignatureInvalid")
+		return "", ErrDownloadSignatureInvalid
+	}
+
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil {
+		return "", ErrDownloadSignatureInvalid
+	}
+
+	if time.Now().Unix() > expires {
+		return "", ErrDownloadURLExpired
+	}
+
+	return contentDisposition, nil
+}
@@ -0,0 +1,117 @@
+package handler_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestSignedDownload(t *testing.T) {
+	key := []byte("secret")
+
+	SubTest(t, "ValidSignature", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   5,
+				MetaData: map[string]string{
+					"filename": "file.jpg",
+					"filetype": "image/jpeg",
+				},
+			}, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(&closingStringReader{
+				Reader: strings.NewReader("hello"),
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:      composer,
+			DownloadSigningKey: key,
+		})
+
+		url, err := SignDownloadURL(key, "yes", "yes", time.Now().Add(time.Hour), `attachment;filename="hello.jpg"`)
+		assert.NoError(t, err)
+
+		(&httpTest{
+			Method: "GET",
+			URL:    url,
+			Code:   http.StatusOK,
+			ResHeader: map[string]string{
+				"Content-Type":        "image/jpeg",
+				"Content-Disposition": `attachment;filename="hello.jpg"`,
+			},
+			ResBody: "hello",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "MissingSignature", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:      composer,
+			DownloadSigningKey: key,
+		})
+
+		(&httpTest{
+			Method:  "GET",
+			URL:     "yes",
+			Code:    http.StatusForbidden,
+			ResBody: "ERR_DOWNLOAD_SIGNATURE_INVALID: download signature is missing or invalid\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "TamperedParameters", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:      composer,
+			DownloadSigningKey: key,
+		})
+
+		// The signature is only valid for another upload.
+		url, err := SignDownloadURL(key, "yes", "no", time.Now().Add(time.Hour), "")
+		assert.NoError(t, err)
+
+		(&httpTest{
+			Method:  "GET",
+			URL:     url,
+			Code:    http.StatusForbidden,
+			ResBody: "ERR_DOWNLOAD_SIGNATURE_INVALID: download signature is missing or invalid\n",
+		}).Run(handler, t)
+
+		// The signature was created using a different key.
+		url, err = SignDownloadURL([]byte("other"), "yes", "yes", time.Now().Add(time.Hour), "")
+		assert.NoError(t, err)
+
+		(&httpTest{
+			Method:  "GET",
+			URL:     url,
+			Code:    http.StatusForbidden,
+			ResBody: "ERR_DOWNLOAD_SIGNATURE_INVALID: download signature is missing or invalid\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "Expired", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:      composer,
+			DownloadSigningKey: key,
+		})
+
+		url, err := SignDownloadURL(key, "yes", "yes", time.Now().Add(-time.Minute), "")
+		assert.NoError(t, err)
+
+		(&httpTest{
+			Method:  "GET",
+			URL:     url,
+			Code:    http.StatusForbidden,
+			ResBody: "ERR_DOWNLOAD_URL_EXPIRED: download URL has expired\n",
+		}).Run(handler, t)
+	})
+}
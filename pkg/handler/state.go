@@ -0,0 +1,52 @@
+package handler
+
+import "context"
+
+// getInfo retrieves the upload's information from the data store inside its own span.
+// The properties, which are saved in the upload's state, are filled in.
+func (handler *UnroutedHandler) getInfo(ctx context.Context, upload Upload) (FileInfo, error) {
+	ctx, span := handler.startSpan(ctx, "GetInfo")
+	info, err := upload.GetInfo(ctx)
+	endSpan(span, err)
+	if err != nil {
+		return info, err
+	}
+
+	info.applyState()
+	return info, nil
+}
+
+// applyState fills in the properties of the FileInfo, which are derived from the
+// upload's state.
+func (info *FileInfo) applyState() {
+	if info.State == nil {
+		return
+	}
+
+	info.Digests = info.savedDigests()
+	info.DetectedContentType = info.State.ContentType
+}
+
+// setState applies the given modification to a copy of the upload's state and assigns
+// the result to info.State. The previous state is not modified, since it may be shared
+// with other copies of the FileInfo.
+func (info *FileInfo) setState(update func(state *UploadState)) {
+	var state UploadState
+	if info.State != nil {
+		state = *info.State
+	}
+
+	update(&state)
+	info.State = &state
+}
+
+// updateState modifies the upload's state and saves it using the data store.
+func (handler *UnroutedHandler) updateState(c *httpContext, upload Upload, info *FileInfo, update func(state *UploadState)) (err error) {
+	ctx, span := handler.startSpan(c, "UpdateState")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	info.setState(update)
+	return handler.composer.StateUpdater.AsStateUpdatableUpload(upload).UpdateState(ctx, *info.State)
+}
@@ -168,4 +168,35 @@ func TestTerminate(t *testing.T) {
 			Code: http.StatusNotImplemented,
 		}).Run(http.HandlerFunc(handler.DelFile), t)
 	})
+
+	SubTest(t, "ExperimentalProtocol", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		for _, interopVersion := range []string{"6", "7", "8"} {
+			SubTest(t, "InteropVersion"+interopVersion, func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+				ctrl := gomock.NewController(t)
+				defer ctrl.Finish()
+				upload := NewMockFullUpload(ctrl)
+
+				gomock.InOrder(
+					store.EXPECT().GetUpload(gomock.Any(), "foo").Return(upload, nil),
+					store.EXPECT().AsTerminatableUpload(upload).Return(upload),
+					upload.EXPECT().Terminate(gomock.Any()).Return(nil),
+				)
+
+				handler, _ := NewHandler(Config{
+					StoreComposer:              composer,
+					EnableExperimentalProtocol: true,
+				})
+
+				// Uploads are cancelled without the Tus-Resumable header.
+				(&httpTest{
+					Method: "DELETE",
+					URL:    "foo",
+					ReqHeader: map[string]string{
+						"Upload-Draft-Interop-Version": interopVersion,
+					},
+					Code: http.StatusNoContent,
+				}).Run(handler, t)
+			})
+		}
+	})
 }
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"math"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// newBandwidthLimiter creates a token bucket allowing the given number of bytes per
+// second. The bucket holds at most one second worth of data.
+func newBandwidthLimiter(bytesPerSecond int64) *rate.Limiter {
+	burst := int(min(bytesPerSecond, math.MaxInt32))
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+}
+
+// throttledReader is an io.ReadCloser, which limits the rate at which data can be read
+// from the underlying reader using one or multiple token buckets. After data has been
+// read, it waits until all buckets can supply the corresponding number of tokens. This
+// way, the sender is slowed down by TCP's flow control as the request body is not
+// consumed.
+type throttledReader struct {
+	ctx      context.Context
+	reader   io.ReadCloser
+	limiters []*rate.Limiter
+	metrics  Metrics
+}
+
+// throttle wraps the request body, so that reading from it is limited by the given
+// token buckets.
+func (r *bodyReader) throttle(limiters []*rate.Limiter, metrics Metrics) {
+	r.reader = &throttledReader{
+		ctx:      r.ctx,
+		reader:   r.reader,
+		limiters: limiters,
+		metrics:  metrics,
+	}
+}
+
+func (r *throttledReader) Read(b []byte) (int, error) {
+	// A token bucket cannot supply more tokens at once than its burst size, so we
+	// must not read more than that.
+	for _, limiter := range r.limiters {
+		if burst := limiter.Burst(); len(b) > burst {
+			b = b[:burst]
+		}
+	}
+
+	n, err := r.reader.Read(b)
+	if n <= 0 {
+		return n, err
+	}
+
+	start := time.Now()
+	for _, limiter := range r.limiters {
+		if waitErr := limiter.WaitN(r.ctx, n); waitErr != nil {
+			// The data has already been read, so we still return it. But the waiting
+			// error takes precedence, since we cannot continue reading.
+			if err == nil || err == io.EOF {
+				err = waitErr
+			}
+			break
+		}
+	}
+	r.metrics.addThrottleDelay(time.Since(start))
+
+	return n, err
+}
+
+func (r *throttledReader) Close() error {
+	return r.reader.Close()
+}
+
+// bandwidthLimiters returns the token buckets that should be used to limit the
+// data transfer of a single request. The per-upload limit is applied to a new bucket,
+// since only one request can transfer data for an upload at a time.
+func (handler *UnroutedHandler) bandwidthLimiters(uploadBandwidth int64) []*rate.Limiter {
+	var limiters []*rate.Limiter
+	if handler.bandwidthLimiter != nil {
+		limiters = append(limiters, handler.bandwidthLimiter)
+	}
+
+	if uploadBandwidth > 0 {
+		limiters = append(limiters, newBandwidthLimiter(uploadBandwidth))
+	}
+
+	return limiters
+}
@@ -0,0 +1,154 @@
+package handler_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestThrottle(t *testing.T) {
+	SubTest(t, "UploadBandwidth", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		var body string
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   200,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), gomock.Any()).DoAndReturn(func(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+				data, err := io.ReadAll(src)
+				body = string(data)
+				return int64(len(data)), err
+			}),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:      composer,
+			MaxUploadBandwidth: 100,
+		})
+
+		start := time.Now()
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader(strings.Repeat("a", 200)),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "200",
+			},
+		}).Run(handler, t)
+
+		a := assert.New(t)
+		a.Equal(strings.Repeat("a", 200), body)
+		// The first 100 bytes are available immediately, the remaining 100 bytes
+		// require one more second.
+		a.GreaterOrEqual(time.Since(start), 900*time.Millisecond)
+		a.Greater(atomic.LoadUint64(handler.Metrics.ThrottleDelay), uint64(0))
+		a.Equal(int64(0), atomic.LoadInt64(handler.Metrics.UploadsThrottled))
+	})
+
+	SubTest(t, "PreReceiveOverride", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   5,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:      composer,
+			MaxUploadBandwidth: 1,
+			PreUploadReceiveCallback: func(hook HookEvent) (HTTPResponse, ReceiveChanges, error) {
+				a := assert.New(t)
+				a.Equal("yes", hook.Upload.ID)
+
+				return HTTPResponse{
+					Header: HTTPHeader{"X-Bandwidth": "1MB/s"},
+				}, ReceiveChanges{BandwidthLimit: 1024 * 1024}, nil
+			},
+		})
+
+		// With the configured limit of 1 byte/s, receiving five bytes would take
+		// at least four seconds. The override from the callback avoids this.
+		start := time.Now()
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusNoContent,
+			ResHeader: map[string]string{
+				"Upload-Offset": "5",
+				"X-Bandwidth":   "1MB/s",
+			},
+		}).Run(handler, t)
+
+		assert.Less(t, time.Since(start), time.Second)
+	})
+
+	SubTest(t, "PreReceiveReject", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   5,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			PreUploadReceiveCallback: func(hook HookEvent) (HTTPResponse, ReceiveChanges, error) {
+				return HTTPResponse{}, ReceiveChanges{}, ErrUploadReceiveRejected
+			},
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "0",
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusBadRequest,
+			ResBody: "ERR_UPLOAD_RECEIVE_REJECTED: receiving upload data has been rejected by server\n",
+		}).Run(handler, t)
+	})
+}
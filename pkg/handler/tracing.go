@@ -0,0 +1,61 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope used for all spans created by the handler.
+const tracerName = "github.com/tus/tusd/v2/pkg/handler"
+
+// startRequestSpan extracts a potential trace context from the request headers and starts
+// the server span for the request. The returned request carries the span in its context.
+func (handler *UnroutedHandler) startRequestSpan(r *http.Request) (*http.Request, trace.Span) {
+	ctx := handler.config.Propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := handler.tracer.Start(ctx, r.Method,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			attribute.String("http.request.method", r.Method),
+			attribute.String("url.path", r.URL.Path),
+			attribute.String("user_agent.original", r.UserAgent()),
+		),
+	)
+
+	return r.WithContext(ctx), span
+}
+
+// startSpan starts a child span of the span contained in ctx. The span must be ended
+// by the caller, for example using endSpan.
+func (handler *UnroutedHandler) startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return handler.tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records a potential error in the span and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// setSpanUploadID attaches the upload ID to the request's span, once it is known.
+func setSpanUploadID(ctx context.Context, id string) {
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("tus.upload.id", id))
+}
+
+// setSpanStatus records the status code of the response in the request's span. Server
+// errors mark the span as failed, while client errors do not, following the OpenTelemetry
+// semantic conventions for HTTP servers.
+func setSpanStatus(ctx context.Context, statusCode int) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int("http.response.status_code", statusCode))
+	if statusCode >= 500 {
+		span.SetStatus(codes.Error, http.StatusText(statusCode))
+	}
+}
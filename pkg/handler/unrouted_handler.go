@@ -3,9 +3,10 @@ package handler
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
+	"maps"
 	"math"
 	"mime"
 	"net/http"
@@ -14,7 +15,10 @@ import (
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/slog"
+	"golang.org/x/time/rate"
 )
 
 const UploadLengthDeferred = "1"
@@ -29,6 +33,23 @@ const (
 	interopVersion4 draftVersion = "4" // From draft version -02
 	interopVersion5 draftVersion = "5" // From draft version -03
 	interopVersion6 draftVersion = "6" // From draft version -04 and -05
+	interopVersion7 draftVersion = "7" // From draft version -06
+	interopVersion8 draftVersion = "8" // From draft version -07 and -08
+)
+
+// isAtLeast returns whether the interop version v is the same or newer than min.
+func (v draftVersion) isAtLeast(min draftVersion) bool {
+	a, _ := strconv.Atoi(string(v))
+	b, _ := strconv.Atoi(string(min))
+	return a >= b
+}
+
+// Problem types for error responses, which are used starting from interop version 7.
+// See https://datatracker.ietf.org/doc/html/rfc9457
+const (
+	problemTypeMismatchingOffset        = "https://iana.org/assignments/http-problem-types#mismatching-upload-offset"
+	problemTypeCompletedUpload          = "https://iana.org/assignments/http-problem-types#completed-upload"
+	problemTypeInconsistentUploadLength = "https://iana.org/assignments/http-problem-types#inconsistent-upload-length"
 )
 
 var (
@@ -61,10 +82,12 @@ var (
 	ErrUploadStoppedByServer            = NewError("ERR_UPLOAD_STOPPED", "upload has been stopped by server", http.StatusBadRequest)
 	ErrUploadRejectedByServer           = NewError("ERR_UPLOAD_REJECTED", "upload creation has been rejected by server", http.StatusBadRequest)
 	ErrUploadTerminationRejected        = NewError("ERR_UPLOAD_TERMINATION_REJECTED", "upload termination has been rejected by server", http.StatusBadRequest)
+	ErrUploadReceiveRejected            = NewError("ERR_UPLOAD_RECEIVE_REJECTED", "receiving upload data has been rejected by server", http.StatusBadRequest)
 	ErrUploadInterrupted                = NewError("ERR_UPLOAD_INTERRUPTED", "upload has been interrupted by another request for this upload resource", http.StatusBadRequest)
 	ErrServerShutdown                   = NewError("ERR_SERVER_SHUTDOWN", "request has been interrupted because the server is shutting down", http.StatusServiceUnavailable)
 	ErrOriginNotAllowed                 = NewError("ERR_ORIGIN_NOT_ALLOWED", "request origin is not allowed", http.StatusForbidden)
 	ErrUnexpectedEOF                    = NewError("ERR_UNEXPECTED_EOF", "server expected to receive more bytes", http.StatusBadRequest)
+	ErrUploadAlreadyCompleted           = NewError("ERR_UPLOAD_COMPLETED", "upload is already completed", http.StatusBadRequest)
 
 	// These two responses are 500 for backwards compatability. Clients might receive a timeout response
 	// when the upload got interrupted. Most clients will not retry 4XX but only 5XX, so we responsd with 500 here.
@@ -81,8 +104,19 @@ type UnroutedHandler struct {
 	isBasePathAbs bool
 	basePath      string
 	logger        *slog.Logger
+	tracer        trace.Tracer
 	extensions    string
 
+	// bandwidthLimiter is shared by all requests to enforce Config.MaxBandwidth.
+	// It is nil if no global limit is configured.
+	bandwidthLimiter *rate.Limiter
+	// concatWaiters tracks final uploads waiting for their partial uploads to finish.
+	// It is nil if the concatenation-unfinished extension is not enabled.
+	concatWaiters *concatWaiters
+	// concurrencyLimiter enforces the limits for concurrent uploads. It is nil if
+	// no limit is configured.
+	concurrencyLimiter *concurrencyLimiter
+
 	// CompleteUploads is used to send notifications whenever an upload is
 	// completed by a user. The HookEvent will contain information about this
 	// upload after it is completed. Sending to this channel will only
@@ -111,6 +145,12 @@ type UnroutedHandler struct {
 	// this channel will only happen if the NotifyCreatedUploads field is set to
 	// true in the Config structure.
 	CreatedUploads chan HookEvent
+	// UpdatedMetadata is used to send notifications whenever the meta data of an
+	// upload has been updated (see PutMetadata). The HookEvent will contain the
+	// upload's information including the new meta data. Sending to this channel
+	// will only happen if the NotifyUpdatedMetadata field is set to true in the
+	// Config structure.
+	UpdatedMetadata chan HookEvent
 	// Metrics provides numbers of the usage for this handler.
 	Metrics Metrics
 }
@@ -131,6 +171,9 @@ func NewUnroutedHandler(config Config) (*UnroutedHandler, error) {
 	}
 	if config.StoreComposer.UsesConcater && !config.DisableConcatenation {
 		extensions += ",concatenation"
+		if config.EnableConcatenationUnfinished {
+			extensions += ",concatenation-unfinished"
+		}
 	}
 	if config.StoreComposer.UsesLengthDeferrer {
 		extensions += ",creation-defer-length"
@@ -145,11 +188,25 @@ func NewUnroutedHandler(config Config) (*UnroutedHandler, error) {
 		TerminatedUploads: make(chan HookEvent),
 		UploadProgress:    make(chan HookEvent),
 		CreatedUploads:    make(chan HookEvent),
+		UpdatedMetadata:   make(chan HookEvent),
 		logger:            config.Logger,
+		tracer:            config.TracerProvider.Tracer(tracerName),
 		extensions:        extensions,
 		Metrics:           newMetrics(),
 	}
 
+	if config.StoreComposer.UsesConcater && !config.DisableConcatenation && config.EnableConcatenationUnfinished {
+		handler.concatWaiters = newConcatWaiters()
+	}
+
+	if config.MaxBandwidth > 0 {
+		handler.bandwidthLimiter = newBandwidthLimiter(config.MaxBandwidth)
+	}
+
+	if config.MaxConcurrentUploads > 0 || config.MaxConcurrentUploadsPerClient > 0 || config.MaxConcurrentUploadsPerKey > 0 {
+		handler.concurrencyLimiter = newConcurrencyLimiter(config)
+	}
+
 	return handler, nil
 }
 
@@ -167,6 +224,11 @@ func (handler *UnroutedHandler) SupportedExtensions() string {
 // this middleware.
 func (handler *UnroutedHandler) Middleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Start the span for this request. It is carried in the request's context and
+		// therefore also in our own context, which is constructed on top of it.
+		r, span := handler.startRequestSpan(r)
+		defer span.End()
+
 		// Construct our own context and make it available in the request. Successive logic
 		// should use handler.getContext to retrieve it
 		c := handler.newContext(w, r)
@@ -189,6 +251,7 @@ func (handler *UnroutedHandler) Middleware(h http.Handler) http.Handler {
 		// DELETE requests, e.g. Flash in a browser and parts of Java.
 		if newMethod := r.Header.Get("X-HTTP-Method-Override"); r.Method == "POST" && newMethod != "" {
 			r.Method = newMethod
+			span.SetName(newMethod)
 		}
 
 		c.log.InfoContext(c, "RequestIncoming")
@@ -237,16 +300,15 @@ func (handler *UnroutedHandler) Middleware(h http.Handler) http.Handler {
 		// Set appropriated headers in case of OPTIONS method allowing protocol
 		// discovery and end with an 204 No Content
 		if r.Method == "OPTIONS" {
-			ietfDraftLimits := "min-size=0"
-
 			if handler.config.MaxSize > 0 {
-				maxSizeStr := strconv.FormatInt(handler.config.MaxSize, 10)
-				header.Set("Tus-Max-Size", maxSizeStr)
-				ietfDraftLimits += ",max-size=" + maxSizeStr
+				header.Set("Tus-Max-Size", strconv.FormatInt(handler.config.MaxSize, 10))
 			}
 
+			// Clients using the IETF draft discover the server's limits using the
+			// Upload-Limit header in the response to an OPTIONS request.
 			if handler.usesIETFDraft(r) {
-				header.Set("Upload-Limit", ietfDraftLimits)
+				header.Set("Upload-Draft-Interop-Version", string(getIETFDraftInteropVersion(r)))
+				header.Set("Upload-Limit", handler.getIETFDraftUploadLimits(r, FileInfo{SizeIsDeferred: true}))
 			}
 
 			header.Set("Tus-Version", "1.0.0")
@@ -288,6 +350,10 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 
 	c := handler.getContext(w, r)
 
+	// If this request finishes a partial upload, complete the final uploads waiting
+	// for it. This must happen after the partial upload's lock has been released.
+	defer handler.finalizeWaitingConcatenations(c)
+
 	// Check for presence of application/offset+octet-stream. If another content
 	// type is defined, it will be ignored and treated as none was set because
 	// some HTTP clients may enforce a default value for this header.
@@ -318,6 +384,10 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 	var size int64
 	var sizeIsDeferred bool
 	var partialUploads []Upload
+	// offset is the amount of data received by the partial uploads of a final upload.
+	// It is less than size if the final upload is created using the concatenation-unfinished
+	// extension before all partial uploads are finished.
+	var offset int64
 	if isFinal {
 		// A final upload must not contain a chunk within the creation request
 		if containsChunk {
@@ -325,7 +395,7 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 			return
 		}
 
-		partialUploads, size, err = handler.sizeOfUploads(c, partialUploadIDs)
+		partialUploads, size, offset, err = handler.sizeOfUploads(c, partialUploadIDs, handler.concatWaiters != nil)
 		if err != nil {
 			handler.sendError(c, err)
 			return
@@ -358,13 +428,21 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 		PartialUploads: partialUploadIDs,
 	}
 
+	tokenSubject, err := handler.applyUploadToken(c, &info)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
 	resp := HTTPResponse{
 		StatusCode: http.StatusCreated,
 		Header:     HTTPHeader{},
 	}
 
+	var changes FileInfoChanges
 	if handler.config.PreUploadCreateCallback != nil {
-		resp2, changes, err := handler.config.PreUploadCreateCallback(newHookEvent(c, info))
+		var resp2 HTTPResponse
+		resp2, changes, err = handler.config.PreUploadCreateCallback(newHookEvent(c, info))
 		if err != nil {
 			handler.sendError(c, err)
 			return
@@ -383,6 +461,11 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 
 		if changes.MetaData != nil {
 			info.MetaData = changes.MetaData
+
+			// The upload must remain bound to the subject of the upload token.
+			if tokenSubject != "" {
+				info.MetaData[UploadTokenSubjectMetaDataKey] = tokenSubject
+			}
 		}
 
 		if changes.Storage != nil {
@@ -390,14 +473,30 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 		}
 	}
 
+	quota, err := handler.reserveUploadQuota(c, &info, changes)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
 	upload, err := handler.composer.Core.NewUpload(c, info)
 	if err != nil {
+		if quota != nil {
+			handler.releaseQuota(c, quota.ID)
+		}
 		handler.sendError(c, err)
 		return
 	}
 
-	info, err = upload.GetInfo(c)
+	info, err = handler.getInfo(c, upload)
 	if err != nil {
+		handler.abortUploadQuota(c, quota, upload)
+		handler.sendError(c, err)
+		return
+	}
+
+	if err := handler.moveUploadQuota(c, quota, info); err != nil {
+		handler.abortUploadQuota(c, quota, upload)
 		handler.sendError(c, err)
 		return
 	}
@@ -411,13 +510,14 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 
 	handler.Metrics.incUploadsCreated()
 	c.log = c.log.With("id", id)
+	setSpanUploadID(c, id)
 	c.log.InfoContext(c, "UploadCreated", "size", size, "url", url)
 
 	if handler.config.NotifyCreatedUploads {
 		handler.CreatedUploads <- newHookEvent(c, info)
 	}
 
-	if isFinal {
+	if isFinal && offset == size {
 		concatableUpload := handler.composer.Concater.AsConcatableUpload(upload)
 		if err := concatableUpload.ConcatUploads(c, partialUploads); err != nil {
 			handler.sendError(c, err)
@@ -425,11 +525,38 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 		}
 		info.Offset = size
 
+		info, err = handler.inspectFinishedUpload(c, upload, info)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
 		resp, err = handler.emitFinishEvents(c, resp, info)
 		if err != nil {
 			handler.sendError(c, err)
 			return
 		}
+	} else if isFinal {
+		// Some partial uploads are still in progress, so the concatenation is completed
+		// once the last of them finishes (concatenation-unfinished extension).
+		if handler.composer.UsesLocker {
+			lock, err := handler.lockConcatUpload(c, id)
+			if err != nil {
+				handler.sendError(c, err)
+				return
+			}
+
+			defer lock.Unlock()
+		}
+
+		handler.concatWaiters.add(id, partialUploadIDs)
+
+		// A partial upload might have finished since we checked their offsets, before
+		// the final upload was registered. Check again to not miss its completion.
+		if _, err := handler.completeConcatenation(c, upload, info); err != nil {
+			handler.sendError(c, err)
+			return
+		}
 	}
 
 	if containsChunk {
@@ -443,7 +570,7 @@ func (handler *UnroutedHandler) PostFile(w http.ResponseWriter, r *http.Request)
 			defer lock.Unlock()
 		}
 
-		resp, err = handler.writeChunk(c, resp, upload, info)
+		resp, err = handler.writeChunk(c, resp, upload, info, ReceiveChanges{BandwidthLimit: changes.BandwidthLimit})
 		if err != nil {
 			handler.sendError(c, err)
 			return
@@ -519,14 +646,22 @@ func (handler *UnroutedHandler) PostFileV2(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
+	tokenSubject, err := handler.applyUploadToken(c, &info)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
 	resp := HTTPResponse{
 		StatusCode: http.StatusCreated,
 		Header:     HTTPHeader{},
 	}
 
 	// 1. Create upload resource
+	var changes FileInfoChanges
 	if handler.config.PreUploadCreateCallback != nil {
-		resp2, changes, err := handler.config.PreUploadCreateCallback(newHookEvent(c, info))
+		var resp2 HTTPResponse
+		resp2, changes, err = handler.config.PreUploadCreateCallback(newHookEvent(c, info))
 		if err != nil {
 			handler.sendError(c, err)
 			return
@@ -545,6 +680,11 @@ func (handler *UnroutedHandler) PostFileV2(w http.ResponseWriter, r *http.Reques
 
 		if changes.MetaData != nil {
 			info.MetaData = changes.MetaData
+
+			// The upload must remain bound to the subject of the upload token.
+			if tokenSubject != "" {
+				info.MetaData[UploadTokenSubjectMetaDataKey] = tokenSubject
+			}
 		}
 
 		if changes.Storage != nil {
@@ -552,32 +692,50 @@ func (handler *UnroutedHandler) PostFileV2(w http.ResponseWriter, r *http.Reques
 		}
 	}
 
+	quota, err := handler.reserveUploadQuota(c, &info, changes)
+	if err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
 	upload, err := handler.composer.Core.NewUpload(c, info)
 	if err != nil {
+		if quota != nil {
+			handler.releaseQuota(c, quota.ID)
+		}
 		handler.sendError(c, err)
 		return
 	}
 
-	info, err = upload.GetInfo(c)
+	info, err = handler.getInfo(c, upload)
 	if err != nil {
+		handler.abortUploadQuota(c, quota, upload)
+		handler.sendError(c, err)
+		return
+	}
+
+	if err := handler.moveUploadQuota(c, quota, info); err != nil {
+		handler.abortUploadQuota(c, quota, upload)
 		handler.sendError(c, err)
 		return
 	}
 
 	id := info.ID
 	url := handler.absFileURL(r, id)
-	limits := handler.getIETFDraftUploadLimits(info)
+	limits := handler.getIETFDraftUploadLimits(r, info)
 	resp.Header["Location"] = url
 	resp.Header["Upload-Limit"] = limits
 
-	// Send 104 response
-	w.Header().Set("Location", url)
-	w.Header().Set("Upload-Draft-Interop-Version", string(currentUploadDraftInteropVersion))
-	w.Header().Set("Upload-Limit", limits)
-	w.WriteHeader(104)
+	// Send 104 response, so the client learns about the upload URL before the data is transferred.
+	handler.sendUploadResumptionSupported(c, HTTPHeader{
+		"Location":                     url,
+		"Upload-Draft-Interop-Version": string(currentUploadDraftInteropVersion),
+		"Upload-Limit":                 limits,
+	})
 
 	handler.Metrics.incUploadsCreated()
 	c.log = c.log.With("id", id)
+	setSpanUploadID(c, id)
 	c.log.InfoContext(c, "UploadCreated", "size", info.Size, "url", url)
 
 	if handler.config.NotifyCreatedUploads {
@@ -596,7 +754,7 @@ func (handler *UnroutedHandler) PostFileV2(w http.ResponseWriter, r *http.Reques
 	}
 
 	// 3. Write chunk
-	resp, err = handler.writeChunk(c, resp, upload, info)
+	resp, err = handler.writeChunk(c, resp, upload, info, ReceiveChanges{BandwidthLimit: changes.BandwidthLimit})
 	if err != nil {
 		handler.sendError(c, err)
 		return
@@ -604,7 +762,7 @@ func (handler *UnroutedHandler) PostFileV2(w http.ResponseWriter, r *http.Reques
 
 	// 4. Finish upload, if necessary
 	if willCompleteUpload && info.SizeIsDeferred {
-		info, err = upload.GetInfo(c)
+		info, err = handler.getInfo(c, upload)
 		if err != nil {
 			handler.sendError(c, err)
 			return
@@ -642,6 +800,7 @@ func (handler *UnroutedHandler) HeadFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	c.log = c.log.With("id", id)
+	setSpanUploadID(c, id)
 
 	if handler.composer.UsesLocker {
 		lock, err := handler.lockUpload(c, id)
@@ -659,12 +818,27 @@ func (handler *UnroutedHandler) HeadFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	info, err := upload.GetInfo(c)
+	info, err := handler.getInfo(c, upload)
 	if err != nil {
 		handler.sendError(c, err)
 		return
 	}
 
+	if err := handler.checkUploadTokenSubject(c, info); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	// A final upload created using the concatenation-unfinished extension reports the
+	// progress of its partial uploads.
+	if info.IsFinal && handler.concatWaiters != nil {
+		info, err = handler.concatenationProgress(c, info)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+	}
+
 	resp := HTTPResponse{
 		Header: HTTPHeader{
 			"Cache-Control": "no-store",
@@ -712,7 +886,7 @@ func (handler *UnroutedHandler) HeadFile(w http.ResponseWriter, r *http.Request)
 			resp.Header["Upload-Length"] = strconv.FormatInt(info.Size, 10)
 		}
 
-		resp.Header["Upload-Limit"] = handler.getIETFDraftUploadLimits(info)
+		resp.Header["Upload-Limit"] = handler.getIETFDraftUploadLimits(r, info)
 
 		// Draft -01 and -02 require a 204 No Content response. Version -03 allows 200 OK as well,
 		// but we stick to 204 to not make the logic less complex.
@@ -727,6 +901,10 @@ func (handler *UnroutedHandler) HeadFile(w http.ResponseWriter, r *http.Request)
 func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request) {
 	c := handler.getContext(w, r)
 
+	// If this request finishes a partial upload, complete the final uploads waiting
+	// for it. This must happen after the partial upload's lock has been released.
+	defer handler.finalizeWaitingConcatenations(c)
+
 	isTusV1 := !handler.usesIETFDraft(r)
 
 	// Check for presence of application/offset+octet-stream (tus v1) or application/partial-upload (IETF draft since -04)
@@ -756,6 +934,7 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 		return
 	}
 	c.log = c.log.With("id", id)
+	setSpanUploadID(c, id)
 
 	if handler.composer.UsesLocker {
 		lock, err := handler.lockUpload(c, id)
@@ -773,12 +952,59 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	info, err := upload.GetInfo(c)
+	info, err := handler.getInfo(c, upload)
 	if err != nil {
 		handler.sendError(c, err)
 		return
 	}
 
+	if err := handler.checkUploadTokenSubject(c, info); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	// If a finished upload could not be scanned for malware before, the scan is repeated
+	// when the client retries its request. This also applies to final uploads, which
+	// cannot be modified otherwise.
+	if offset == info.Offset && handler.awaitsVirusScan(info) {
+		resp := HTTPResponse{
+			StatusCode: http.StatusNoContent,
+			Header: HTTPHeader{
+				"Upload-Offset": strconv.FormatInt(offset, 10),
+			},
+		}
+
+		resp, err := handler.completeUpload(c, resp, upload, info)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
+		handler.sendResp(c, resp)
+		return
+	}
+
+	// If the partial uploads of a final upload created using the concatenation-unfinished
+	// extension are all finished, but the concatenation has not been completed (e.g. because
+	// tusd was restarted in between), it is completed when the client retries its request.
+	if info.IsFinal && handler.concatWaiters != nil && info.Offset != info.Size {
+		info, err = handler.completeConcatenation(c, upload, info)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
+		if offset == info.Offset && info.Offset == info.Size {
+			handler.sendResp(c, HTTPResponse{
+				StatusCode: http.StatusNoContent,
+				Header: HTTPHeader{
+					"Upload-Offset": strconv.FormatInt(offset, 10),
+				},
+			})
+			return
+		}
+	}
+
 	// Modifying a final upload is not allowed
 	if info.IsFinal {
 		handler.sendError(c, ErrModifyFinal)
@@ -786,7 +1012,10 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 	}
 
 	if offset != info.Offset {
-		handler.sendError(c, ErrMismatchOffset)
+		handler.sendError(c, newIETFDraftProblem(r, ErrMismatchOffset, problemTypeMismatchingOffset, map[string]any{
+			"expected-offset": info.Offset,
+			"provided-offset": offset,
+		}))
 		return
 	}
 
@@ -801,6 +1030,13 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 
 	// Do not proxy the call to the data store if the upload is already completed
 	if !info.SizeIsDeferred && info.Offset == info.Size {
+		// Starting with interop version 7, appending to a completed upload is an error,
+		// even if the request does not contain any data.
+		if !isTusV1 && getIETFDraftInteropVersion(r).isAtLeast(interopVersion7) {
+			handler.sendError(c, newIETFDraftProblem(r, ErrUploadAlreadyCompleted, problemTypeCompletedUpload, nil))
+			return
+		}
+
 		resp.Header["Upload-Offset"] = strconv.FormatInt(offset, 10)
 		handler.sendResp(c, resp)
 		return
@@ -821,6 +1057,11 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 			return
 		}
 
+		if err := handler.reserveLengthQuota(c, info, uploadLength); err != nil {
+			handler.sendError(c, err)
+			return
+		}
+
 		lengthDeclarableUpload := handler.composer.LengthDeferrer.AsLengthDeclarableUpload(upload)
 		if err := lengthDeclarableUpload.DeclareLength(c, uploadLength); err != nil {
 			handler.sendError(c, err)
@@ -831,7 +1072,7 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 		info.SizeIsDeferred = false
 	}
 
-	resp, err = handler.writeChunk(c, resp, upload, info)
+	resp, err = handler.writeChunk(c, resp, upload, info, ReceiveChanges{})
 	if err != nil {
 		handler.sendError(c, err)
 		return
@@ -839,7 +1080,7 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 
 	willCompleteUpload := isIETFDraftUploadComplete(r)
 	if willCompleteUpload && info.SizeIsDeferred {
-		info, err = upload.GetInfo(c)
+		info, err = handler.getInfo(c, upload)
 		if err != nil {
 			handler.sendError(c, err)
 			return
@@ -869,7 +1110,7 @@ func (handler *UnroutedHandler) PatchFile(w http.ResponseWriter, r *http.Request
 // writeChunk reads the body from the requests r and appends it to the upload
 // with the corresponding id. Afterwards, it will set the necessary response
 // headers but will not send the response.
-func (handler *UnroutedHandler) writeChunk(c *httpContext, resp HTTPResponse, upload Upload, info FileInfo) (HTTPResponse, error) {
+func (handler *UnroutedHandler) writeChunk(c *httpContext, resp HTTPResponse, upload Upload, info FileInfo, changes ReceiveChanges) (HTTPResponse, error) {
 	// Get Content-Length if possible
 	r := c.req
 	length := r.ContentLength
@@ -897,10 +1138,41 @@ func (handler *UnroutedHandler) writeChunk(c *httpContext, resp HTTPResponse, up
 		maxSize = length
 	}
 
+	// The changes from the pre-create callback can be overridden by the pre-receive callback.
+	if handler.config.PreUploadReceiveCallback != nil {
+		resp2, receiveChanges, err := handler.config.PreUploadReceiveCallback(newHookEvent(c, info))
+		if err != nil {
+			return resp, err
+		}
+		resp = resp.MergeWith(resp2)
+
+		if receiveChanges.BandwidthLimit > 0 {
+			changes.BandwidthLimit = receiveChanges.BandwidthLimit
+		}
+		if receiveChanges.ConcurrencyKey != "" {
+			changes.ConcurrencyKey = receiveChanges.ConcurrencyKey
+		}
+	}
+
+	releaseUploadSlot, err := handler.acquireUploadSlot(c, changes.ConcurrencyKey)
+	if err != nil {
+		return resp, err
+	}
+	defer releaseUploadSlot()
+
+	uploadBandwidth := handler.config.MaxUploadBandwidth
+	if changes.BandwidthLimit > 0 {
+		uploadBandwidth = changes.BandwidthLimit
+	}
+
+	quota, maxSize, err := handler.reserveChunkQuota(c, info, offset, maxSize)
+	if err != nil {
+		return resp, err
+	}
+
 	c.log.InfoContext(c, "ChunkWriteStart", "maxSize", maxSize, "offset", offset)
 
 	var bytesWritten int64
-	var err error
 	// Prevent a nil pointer dereference when accessing the body which may not be
 	// available in the case of a malicious request.
 	if r.Body != nil {
@@ -922,6 +1194,23 @@ func (handler *UnroutedHandler) writeChunk(c *httpContext, resp HTTPResponse, up
 			}
 		}
 
+		if limiters := handler.bandwidthLimiters(uploadBandwidth); len(limiters) > 0 {
+			c.body.throttle(limiters, handler.Metrics)
+			handler.Metrics.incUploadsThrottled()
+			defer handler.Metrics.decUploadsThrottled()
+		}
+
+		digest := handler.startDigest(c, info)
+		if digest != nil {
+			c.body.hash(digest)
+		}
+
+		if err := handler.sniffBody(c, upload, &info); err != nil {
+			handler.updateChunkQuota(c, quota, info, offset)
+			handler.rejectContentType(c, upload, info)
+			return resp, err
+		}
+
 		// We use a callback to allow the hook system to cancel an upload. The callback
 		// cancels the request context causing the request body to be closed with the
 		// provided error.
@@ -931,11 +1220,18 @@ func (handler *UnroutedHandler) writeChunk(c *httpContext, resp HTTPResponse, up
 			c.cancel(cause)
 		}
 
-		if handler.config.NotifyUploadProgress {
+		if handler.config.NotifyUploadProgress || handler.composer.UsesEventBus {
 			handler.sendProgressMessages(c, info)
 		}
 
-		bytesWritten, err = upload.WriteChunk(c, offset, c.body)
+		handler.Metrics.incUploadsActive()
+		ctx, span := handler.startSpan(c, "WriteChunk", attribute.Int64("tus.upload.offset", offset))
+		bytesWritten, err = upload.WriteChunk(ctx, offset, c.body)
+		span.SetAttributes(attribute.Int64("tus.upload.bytes_written", bytesWritten))
+		endSpan(span, err)
+		handler.Metrics.decUploadsActive()
+
+		handler.saveDigest(c, upload, &info, digest, offset, bytesWritten)
 
 		// If we encountered an error while reading the body from the HTTP request, log it, but only include
 		// it in the response, if the store did not also return an error.
@@ -949,6 +1245,11 @@ func (handler *UnroutedHandler) writeChunk(c *httpContext, resp HTTPResponse, up
 
 		// Terminate the upload if it was stopped, as indicated by the ErrUploadStoppedByServer error.
 		terminateUpload := errors.Is(bodyErr, ErrUploadStoppedByServer)
+		if terminateUpload {
+			stoppedInfo := info
+			stoppedInfo.Offset = offset + bytesWritten
+			handler.publishEvent(c, UploadEventStop, stoppedInfo)
+		}
 		if terminateUpload && handler.composer.UsesTerminater {
 			if terminateErr := handler.terminateUpload(c, upload, info); terminateErr != nil {
 				// We only log this error and not show it to the user since this
@@ -963,6 +1264,7 @@ func (handler *UnroutedHandler) writeChunk(c *httpContext, resp HTTPResponse, up
 	// Send new offset to client
 	newOffset := offset + bytesWritten
 	resp.Header["Upload-Offset"] = strconv.FormatInt(newOffset, 10)
+	handler.updateChunkQuota(c, quota, info, newOffset)
 	handler.Metrics.incBytesReceived(uint64(bytesWritten))
 	info.Offset = newOffset
 
@@ -984,20 +1286,73 @@ func (handler *UnroutedHandler) finishUploadIfComplete(c *httpContext, resp HTTP
 	if !info.SizeIsDeferred && info.Offset == info.Size {
 		var err error
 		// ... allow the data storage to finish and cleanup the upload
-		if err = upload.FinishUpload(c); err != nil {
-			return resp, err
-		}
-
-		// ... and call pre-finish callback and send post-finish notification.
-		resp, err = handler.emitFinishEvents(c, resp, info)
+		ctx, span := handler.startSpan(c, "FinishUpload")
+		err = upload.FinishUpload(ctx)
+		endSpan(span, err)
 		if err != nil {
 			return resp, err
 		}
+
+		// ... and complete the upload.
+		return handler.completeUpload(c, resp, upload, info)
 	}
 
 	return resp, nil
 }
 
+// completeUpload checks the data of a finished upload, computes its digests and emits the
+// finish events. It is called again if the client retries its request after the upload
+// could not be scanned for malware (see awaitsVirusScan).
+func (handler *UnroutedHandler) completeUpload(c *httpContext, resp HTTPResponse, upload Upload, info FileInfo) (HTTPResponse, error) {
+	// Check the upload's data and compute its digests ...
+	info, err := handler.inspectFinishedUpload(c, upload, info)
+	if err != nil {
+		return resp, err
+	}
+
+	// ... remember to complete final uploads waiting for this partial upload ...
+	if info.IsPartial {
+		c.finishedPartialUpload = info.ID
+	}
+
+	// ... and call pre-finish callback and send post-finish notification.
+	return handler.emitFinishEvents(c, resp, info)
+}
+
+// inspectFinishedUpload checks the content type of a finished upload, scans it for
+// malware and computes its digests. If the upload is rejected by one of the checks, it
+// is terminated and an error is returned, so that the finish events are not emitted.
+func (handler *UnroutedHandler) inspectFinishedUpload(c *httpContext, upload Upload, info FileInfo) (FileInfo, error) {
+	if err := handler.finishContentType(c, upload, &info); err != nil {
+		handler.rejectContentType(c, upload, info)
+		return info, err
+	}
+
+	if err := handler.scanUpload(c, upload, &info); err != nil {
+		if handlerErr, ok := err.(Error); ok && handlerErr.ErrorCode == ErrUploadInfected.ErrorCode {
+			handler.discardUpload(c, upload, info)
+		}
+		return info, err
+	}
+
+	info.Digests = handler.finishDigest(c, upload, &info)
+	return info, nil
+}
+
+// discardUpload terminates an upload, which has been rejected by the server, if the
+// data store supports it.
+func (handler *UnroutedHandler) discardUpload(c *httpContext, upload Upload, info FileInfo) {
+	if !handler.composer.UsesTerminater {
+		return
+	}
+
+	if err := handler.terminateUpload(c, upload, info); err != nil {
+		// We only log this error and not show it to the user since this
+		// termination error is not relevant to the uploading client
+		c.log.ErrorContext(c, "UploadRejectTerminateError", "error", err)
+	}
+}
+
 // emitFinishEvents calls the PreFinishResponseCallback function and sends
 // the necessary message on the CompleteUpload channel.
 func (handler *UnroutedHandler) emitFinishEvents(c *httpContext, resp HTTPResponse, info FileInfo) (HTTPResponse, error) {
@@ -1011,6 +1366,7 @@ func (handler *UnroutedHandler) emitFinishEvents(c *httpContext, resp HTTPRespon
 
 	c.log.InfoContext(c, "UploadFinished", "size", info.Size)
 	handler.Metrics.incUploadsFinished()
+	handler.publishEvent(c, UploadEventFinish, info)
 
 	if handler.config.NotifyCompleteUploads {
 		handler.CompleteUploads <- newHookEvent(c, info)
@@ -1030,8 +1386,22 @@ func (handler *UnroutedHandler) GetFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	c.log = c.log.With("id", id)
+	setSpanUploadID(c, id)
 
-	if handler.composer.UsesLocker {
+	var signedDisposition string
+	if len(handler.config.DownloadSigningKey) > 0 {
+		signedDisposition, err = handler.verifyDownloadSignature(c, id)
+		if err != nil {
+			handler.sendError(c, err)
+			return
+		}
+	}
+
+	// If the data store allows reading uploads while they are written to, GET requests
+	// do not acquire the upload's lock. Otherwise, they would interrupt an ongoing PATCH
+	// request, preventing clients from reading an upload while it is still being received.
+	concurrentReads := handler.composer.UsesConcurrentReader && handler.composer.ConcurrentReader.SupportsConcurrentReads()
+	if handler.composer.UsesLocker && !concurrentReads {
 		lock, err := handler.lockUpload(c, id)
 		if err != nil {
 			handler.sendError(c, err)
@@ -1047,14 +1417,22 @@ func (handler *UnroutedHandler) GetFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	info, err := upload.GetInfo(c)
+	info, err := handler.getInfo(c, upload)
 	if err != nil {
 		handler.sendError(c, err)
 		return
 	}
 
-	// Fall back to the existing GetReader implementation if ContentServerDataStore is not implemented
+	if err := handler.checkVirusScan(info); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
+	info.DetectedContentType = handler.uploadContentType(c, upload, info)
 	contentType, contentDisposition := filterContentType(info)
+	if signedDisposition != "" {
+		contentDisposition = signedDisposition
+	}
 	resp := HTTPResponse{
 		StatusCode: http.StatusOK,
 		Header: HTTPHeader{
@@ -1066,14 +1444,24 @@ func (handler *UnroutedHandler) GetFile(w http.ResponseWriter, r *http.Request)
 	}
 
 	// If the data store implements ContentServerDataStore, use delegate the handling
-	// of GET requests to the data store.
-	// Otherwise, we will use the existing GetReader implementation.
-	if handler.composer.UsesContentServer {
+	// of GET requests for finished uploads to the data store.
+	// Otherwise, we serve the content ourselves using GetReader or RangeReaderDataStore.
+	// For unfinished uploads, the data received so far is served, i.e. up to the
+	// current offset, so that consumers can start processing it early.
+	isFinished := !info.SizeIsDeferred && info.Offset == info.Size
+	if isFinished {
+		setDigestHeaders(resp.Header, info.savedDigests())
+	}
+
+	if handler.composer.UsesContentServer && isFinished {
 		servableUpload := handler.composer.ContentServer.AsServableUpload(upload)
 
-		// Pass file type and name to the implementation, but it may override them.
-		w.Header().Set("Content-Type", resp.Header["Content-Type"])
-		w.Header().Set("Content-Disposition", resp.Header["Content-Disposition"])
+		// Pass file type, name and digests to the implementation, but it may override them.
+		for key, value := range resp.Header {
+			if key != "Content-Length" {
+				w.Header().Set(key, value)
+			}
+		}
 
 		// Use loggingResponseWriter to get the ResponseOutgoing log entry that
 		// normally handler.sendResp would produce.
@@ -1093,28 +1481,9 @@ func (handler *UnroutedHandler) GetFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	if handler.composer.UsesContentServer {
-		servableUpload := handler.composer.ContentServer.AsServableUpload(upload)
-		err = servableUpload.ServeContent(c, w, r)
-		if err != nil {
-			handler.sendError(c, err)
-		}
-		return
-	}
-
-	src, err := upload.GetReader(c)
-	if err != nil {
-		handler.sendError(c, err)
-		return
-	}
-
-	handler.sendResp(c, resp)
-	if _, err := io.Copy(w, src); err != nil {
+	if err := handler.serveUploadContent(c, resp, upload, info); err != nil {
 		handler.sendError(c, err)
-		return
 	}
-
-	src.Close()
 }
 
 // mimeInlineBrowserWhitelist is a map containing MIME types which should be
@@ -1155,6 +1524,10 @@ var mimeInlineBrowserWhitelist = map[string]struct{}{
 // See https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Content-Disposition
 func filterContentType(info FileInfo) (contentType string, contentDisposition string) {
 	filetype := info.MetaData["filetype"]
+	// Prefer the type detected from the upload's data, since the meta data is supplied by the client.
+	if info.DetectedContentType != "" {
+		filetype = info.DetectedContentType
+	}
 
 	if ft, _, err := mime.ParseMediaType(filetype); err == nil {
 		// If the filetype from metadata is well-formed, we forward use this for the Content-Type header.
@@ -1196,6 +1569,7 @@ func (handler *UnroutedHandler) DelFile(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	c.log = c.log.With("id", id)
+	setSpanUploadID(c, id)
 
 	if handler.composer.UsesLocker {
 		lock, err := handler.lockUpload(c, id)
@@ -1214,14 +1588,19 @@ func (handler *UnroutedHandler) DelFile(w http.ResponseWriter, r *http.Request)
 	}
 
 	var info FileInfo
-	if handler.config.NotifyTerminatedUploads || handler.config.PreUploadTerminateCallback != nil {
-		info, err = upload.GetInfo(c)
+	if handler.config.NotifyTerminatedUploads || handler.config.PreUploadTerminateCallback != nil || handler.composer.UsesEventBus || handler.composer.UsesQuotaStore || len(handler.config.UploadTokenKey) > 0 {
+		info, err = handler.getInfo(c, upload)
 		if err != nil {
 			handler.sendError(c, err)
 			return
 		}
 	}
 
+	if err := handler.checkUploadTokenSubject(c, info); err != nil {
+		handler.sendError(c, err)
+		return
+	}
+
 	resp := HTTPResponse{
 		StatusCode: http.StatusNoContent,
 	}
@@ -1248,7 +1627,7 @@ func (handler *UnroutedHandler) DelFile(w http.ResponseWriter, r *http.Request)
 // send the corresponding upload info on the TerminatedUploads channnel
 // and updates the statistics.
 // Note the the info argument is only needed if the terminated uploads
-// notifications are enabled.
+// notifications or the event bus are enabled.
 func (handler *UnroutedHandler) terminateUpload(c *httpContext, upload Upload, info FileInfo) error {
 	terminatableUpload := handler.composer.Terminater.AsTerminatableUpload(upload)
 
@@ -1263,6 +1642,17 @@ func (handler *UnroutedHandler) terminateUpload(c *httpContext, upload Upload, i
 
 	c.log.InfoContext(c, "UploadTerminated")
 	handler.Metrics.incUploadsTerminated()
+	handler.releaseQuota(c, info.ID)
+	handler.publishEvent(c, UploadEventTerminate, info)
+
+	if handler.concatWaiters != nil {
+		if info.IsFinal {
+			handler.concatWaiters.remove(info.ID)
+		}
+		if info.IsPartial {
+			handler.concatWaiters.removePartial(info.ID)
+		}
+	}
 
 	return nil
 }
@@ -1292,6 +1682,7 @@ func (handler *UnroutedHandler) sendError(c *httpContext, err error) {
 // sendResp writes the header to w with the specified status code.
 func (handler *UnroutedHandler) sendResp(c *httpContext, resp HTTPResponse) {
 	resp.writeTo(c.res)
+	setSpanStatus(c, resp.StatusCode)
 
 	c.log.InfoContext(c, "ResponseOutgoing", "status", resp.StatusCode, "body", resp.Body)
 }
@@ -1312,7 +1703,7 @@ func (handler *UnroutedHandler) absFileURL(r *http.Request, id string) string {
 }
 
 // sendProgressMessage will send a notification over the UploadProgress channel
-// indicating how much data has been transfered to the server.
+// and the event bus indicating how much data has been transfered to the server.
 // It will stop sending these instances once the provided context is done.
 func (handler *UnroutedHandler) sendProgressMessages(c *httpContext, info FileInfo) {
 	hook := newHookEvent(c, info)
@@ -1323,7 +1714,10 @@ func (handler *UnroutedHandler) sendProgressMessages(c *httpContext, info FileIn
 	emitProgress := func() {
 		hook.Upload.Offset = originalOffset + c.body.bytesRead()
 		if hook.Upload.Offset != previousOffset {
-			handler.UploadProgress <- hook
+			if handler.config.NotifyUploadProgress {
+				handler.UploadProgress <- hook
+			}
+			handler.publishEvent(c, UploadEventProgress, hook.Upload)
 			previousOffset = hook.Upload.Offset
 		}
 	}
@@ -1389,27 +1783,30 @@ func getHostAndProtocol(r *http.Request, allowForwarded bool) (host, proto strin
 
 // The get sum of all sizes for a list of upload ids while checking whether
 // all of these uploads are finished yet. This is used to calculate the size
-// of a final resource.
-func (handler *UnroutedHandler) sizeOfUploads(ctx context.Context, ids []string) (partialUploads []Upload, size int64, err error) {
+// of a final resource. If allowUnfinished is set, uploads which are still in
+// progress are accepted as long as their size is known, and the returned offset
+// is the sum of their offsets. Otherwise, offset always equals size.
+func (handler *UnroutedHandler) sizeOfUploads(ctx context.Context, ids []string, allowUnfinished bool) (partialUploads []Upload, size int64, offset int64, err error) {
 	partialUploads = make([]Upload, len(ids))
 
 	for i, id := range ids {
 		upload, err := handler.composer.Core.GetUpload(ctx, id)
 		if err != nil {
-			return nil, 0, err
+			return nil, 0, 0, err
 		}
 
-		info, err := upload.GetInfo(ctx)
+		info, err := handler.getInfo(ctx, upload)
 		if err != nil {
-			return nil, 0, err
+			return nil, 0, 0, err
 		}
 
-		if info.SizeIsDeferred || info.Offset != info.Size {
+		if info.SizeIsDeferred || (!allowUnfinished && info.Offset != info.Size) {
 			err = ErrUploadNotFinished
-			return nil, 0, err
+			return nil, 0, 0, err
 		}
 
 		size += info.Size
+		offset += info.Offset
 		partialUploads[i] = upload
 	}
 
@@ -1443,13 +1840,18 @@ func (handler *UnroutedHandler) validateNewUploadLengthHeaders(uploadLengthHeade
 
 // lockUpload creates a new lock for the given upload ID and attempts to lock it.
 // The created lock is returned if it was aquired successfully.
-func (handler *UnroutedHandler) lockUpload(c *httpContext, id string) (Lock, error) {
-	lock, err := handler.composer.Locker.NewLock(id)
+func (handler *UnroutedHandler) lockUpload(c *httpContext, id string) (lock Lock, err error) {
+	spanCtx, span := handler.startSpan(c, "AcquireLock")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	lock, err = handler.composer.Locker.NewLock(id)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, cancelContext := context.WithTimeout(c, handler.config.AcquireLockTimeout)
+	ctx, cancelContext := context.WithTimeout(spanCtx, handler.config.AcquireLockTimeout)
 	defer cancelContext()
 
 	// No need to wrap this in a sync.OnceFunc because c.cancel will be a noop after the first call.
@@ -1474,22 +1876,69 @@ func (handler UnroutedHandler) usesIETFDraft(r *http.Request) bool {
 
 // getIETFDraftUploadLimits returns the Upload-Limit header for a given upload
 // according to the set resumable upload draft version from IETF.
-func (handler UnroutedHandler) getIETFDraftUploadLimits(info FileInfo) string {
+func (handler UnroutedHandler) getIETFDraftUploadLimits(r *http.Request, info FileInfo) string {
 	limits := "min-size=0"
 	if handler.config.MaxSize > 0 {
 		limits += ",max-size=" + strconv.FormatInt(handler.config.MaxSize, 10)
-	} else if !info.SizeIsDeferred {
+	} else if !info.SizeIsDeferred && !getIETFDraftInteropVersion(r).isAtLeast(interopVersion7) {
+		// Before interop version 7, the upload's length was announced as its maximum size.
+		// Since then, the limits only describe the server's constraints, while the upload's
+		// length is sent in the Upload-Length header.
 		limits += ",max-size=" + strconv.FormatInt(info.Size, 10)
 	}
 
 	return limits
 }
 
+// sendUploadResumptionSupported sends the 104 (Upload Resumption Supported) informational
+// response with the given headers. Interim responses must not be sent to HTTP/1.0 clients,
+// so nothing is sent to them.
+func (handler UnroutedHandler) sendUploadResumptionSupported(c *httpContext, header HTTPHeader) {
+	if !c.req.ProtoAtLeast(1, 1) {
+		return
+	}
+
+	h := c.res.Header()
+	for key, value := range header {
+		h.Set(key, value)
+	}
+
+	c.res.WriteHeader(104)
+}
+
+// newIETFDraftProblem converts err into a problem details response (RFC 9457) with the given
+// problem type and additional members, if the request uses interop version 7 or later. For
+// other requests, err is returned unchanged.
+func newIETFDraftProblem(r *http.Request, err Error, problemType string, members map[string]any) error {
+	if !getIETFDraftInteropVersion(r).isAtLeast(interopVersion7) {
+		return err
+	}
+
+	problem := map[string]any{
+		"type":  problemType,
+		"title": err.Message,
+	}
+	maps.Copy(problem, members)
+
+	body, jsonErr := json.Marshal(problem)
+	if jsonErr != nil {
+		return err
+	}
+
+	err.HTTPResponse = err.HTTPResponse.MergeWith(HTTPResponse{
+		Body: string(body),
+		Header: HTTPHeader{
+			"Content-Type": "application/problem+json",
+		},
+	})
+	return err
+}
+
 // getIETFDraftInteropVersion returns the resumable upload draft interop version from the headers.
 func getIETFDraftInteropVersion(r *http.Request) draftVersion {
 	version := draftVersion(r.Header.Get("Upload-Draft-Interop-Version"))
 	switch version {
-	case interopVersion3, interopVersion4, interopVersion5, interopVersion6:
+	case interopVersion3, interopVersion4, interopVersion5, interopVersion6, interopVersion7, interopVersion8:
 		return version
 	default:
 		return ""
@@ -1501,7 +1950,7 @@ func getIETFDraftInteropVersion(r *http.Request) draftVersion {
 func isIETFDraftUploadComplete(r *http.Request) bool {
 	currentUploadDraftInteropVersion := getIETFDraftInteropVersion(r)
 	switch currentUploadDraftInteropVersion {
-	case interopVersion4, interopVersion5, interopVersion6:
+	case interopVersion4, interopVersion5, interopVersion6, interopVersion7, interopVersion8:
 		return r.Header.Get("Upload-Complete") == "?1"
 	case interopVersion3:
 		return r.Header.Get("Upload-Incomplete") == "?0"
@@ -1522,7 +1971,7 @@ func setIETFDraftUploadComplete(r *http.Request, resp HTTPResponse, isComplete b
 		} else {
 			resp.Header["Upload-Incomplete"] = "?1"
 		}
-	case interopVersion4, interopVersion5, interopVersion6:
+	case interopVersion4, interopVersion5, interopVersion6, interopVersion7, interopVersion8:
 		if isComplete {
 			resp.Header["Upload-Complete"] = "?1"
 		} else {
@@ -1559,7 +2008,7 @@ func getIETFDraftUploadLength(r *http.Request) (length int64, lengthIsDeferred b
 
 	// If both lengths are set, they must match
 	if hasLengthFromContentLength && hasLengthFromUploadLength && lengthFromUploadLength != lengthFromContentLength {
-		return 0, false, ErrInvalidUploadLength
+		return 0, false, newIETFDraftProblem(r, ErrInvalidUploadLength, problemTypeInconsistentUploadLength, nil)
 	}
 
 	// Return whichever length is set
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -105,3 +106,44 @@ func TestFilterContentType(t *testing.T) {
 		})
 	}
 }
+
+func TestGetClientAddress(t *testing.T) {
+	a := assert.New(t)
+
+	r := httptest.NewRequest("PATCH", "/files/foo", nil)
+	r.RemoteAddr = "10.0.0.1:5678"
+	r.Header.Set("X-Forwarded-For", "192.0.2.1, 10.0.0.2")
+	a.Equal("10.0.0.1", getClientAddress(r, false))
+	a.Equal("192.0.2.1", getClientAddress(r, true))
+
+	r.Header.Del("X-Forwarded-For")
+	r.Header.Set("Forwarded", `for="[2001:db8::1]:4711";proto=https`)
+	a.Equal("2001:db8::1", getClientAddress(r, true))
+
+	r.Header.Set("Forwarded", "for=192.0.2.60;proto=http, for=10.0.0.2")
+	a.Equal("192.0.2.60", getClientAddress(r, true))
+}
+
+func TestConcurrencyLimiter(t *testing.T) {
+	a := assert.New(t)
+
+	limiter := newConcurrencyLimiter(Config{
+		MaxConcurrentUploads:          3,
+		MaxConcurrentUploadsPerClient: 2,
+		MaxConcurrentUploadsPerKey:    1,
+	})
+
+	a.True(limiter.acquire("client-a", "key-a"))
+	a.False(limiter.acquire("client-b", "key-a"))
+	a.True(limiter.acquire("client-a", ""))
+	a.False(limiter.acquire("client-a", ""))
+	a.True(limiter.acquire("client-b", "key-b"))
+	a.False(limiter.acquire("client-c", ""))
+
+	limiter.release("client-a", "key-a")
+	a.True(limiter.acquire("client-c", "key-a"))
+	a.Equal(1, limiter.clients["client-a"])
+
+	limiter.release("client-a", "")
+	a.NotContains(limiter.clients, "client-a")
+}
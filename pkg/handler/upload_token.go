@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tus/tusd/v2/internal/uid"
+)
+
+var (
+	ErrUploadTokenInvalid         = NewError("ERR_UPLOAD_TOKEN_INVALID", "upload token is missing or invalid", http.StatusUnauthorized)
+	ErrUploadTokenExpired         = NewError("ERR_UPLOAD_TOKEN_EXPIRED", "upload token has expired", http.StatusUnauthorized)
+	ErrUploadTokenSubjectMismatch = NewError("ERR_UPLOAD_TOKEN_SUBJECT_MISMATCH", "upload does not belong to the subject of the upload token", http.StatusForbidden)
+	ErrUploadTokenRequiresLength  = NewError("ERR_UPLOAD_TOKEN_REQUIRES_LENGTH", "upload token requires the upload length to be known", http.StatusBadRequest)
+	ErrUploadTokenUsed            = NewError("ERR_UPLOAD_TOKEN_USED", "upload token has already been used to create an upload", http.StatusConflict)
+)
+
+// UploadTokenSubjectMetaDataKey is the meta data key under which the subject of the
+// upload token used for creating the upload is saved.
+const UploadTokenSubjectMetaDataKey = "tokensubject"
+
+// UploadToken describes what a client is allowed to upload. Tokens are created by
+// the application using SignUploadToken and are passed by the client in the
+// Upload-Token header or the token query parameter, if Config.UploadTokenKey is set.
+type UploadToken struct {
+	// Subject identifies the party the token has been issued to, e.g. a user ID. It
+	// is saved in the upload's meta data and all further requests for the upload must
+	// carry a token with the same subject.
+	Subject string `json:"sub"`
+	// ExpiresAt is the Unix time in seconds after which the token is no longer accepted.
+	ExpiresAt int64 `json:"exp"`
+	// If MaxSize is larger than zero, it is the maximum size of the upload in bytes.
+	// Uploads with a deferred length are then rejected.
+	MaxSize int64 `json:"maxSize,omitempty"`
+	// MetaData contains meta data entries that are set for the upload, overwriting
+	// the values provided by the client.
+	MetaData MetaData `json:"metaData,omitempty"`
+	// If AllowedMetaDataKeys is not empty, only meta data entries with these keys
+	// are kept from the values provided by the client.
+	AllowedMetaDataKeys []string `json:"allowedMetaDataKeys,omitempty"`
+	// If ID is not empty, it is used as the upload's ID. Such a token can only be
+	// used to create a single upload, i.e. while an upload with this ID exists,
+	// further creation requests are rejected.
+	ID string `json:"id,omitempty"`
+	// If IDPrefix is not empty, the upload's ID is generated and prefixed with it,
+	// e.g. to place uploads in a directory or under a storage prefix.
+	IDPrefix string `json:"idPrefix,omitempty"`
+}
+
+// SignUploadToken encodes the token and signs it using the key, so that it is
+// accepted by a handler configured with the same key in Config.UploadTokenKey.
+// The result consists of the base64url-encoded JSON representation of the token
+// and its base64url-encoded HMAC-SHA256, separated by a dot.
+func SignUploadToken(key []byte, token UploadToken) (string, error) {
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + uploadTokenSignature(key, encoded), nil
+}
+
+func uploadTokenSignature(key []byte, encodedPayload string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(encodedPayload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// requestUploadToken verifies and decodes the upload token included in the request.
+func (handler *UnroutedHandler) requestUploadToken(c *httpContext) (UploadToken, error) {
+	var token UploadToken
+
+	value := c.req.Header.Get("Upload-Token")
+	if value == "" {
+		value = c.req.URL.Query().Get("token")
+	}
+
+	encoded, signature, ok := strings.Cut(value, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(uploadTokenSignature(handler.config.UploadTokenKey, encoded))) {
+		c.log.WarnContext(c, "UploadTokenInvalid")
+		return token, ErrUploadTokenInvalid
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return token, ErrUploadTokenInvalid
+	}
+
+	if err := json.Unmarshal(payload, &token); err != nil || token.Subject == "" {
+		return token, ErrUploadTokenInvalid
+	}
+
+	if time.Now().Unix() > token.ExpiresAt {
+		return token, ErrUploadTokenExpired
+	}
+
+	return token, nil
+}
+
+// applyUploadToken validates the new upload against the constraints of the request's
+// upload token and applies them to the upload's info. It returns the token's subject,
+// which must be kept in the meta data. If no key is configured, nothing happens.
+func (handler *UnroutedHandler) applyUploadToken(c *httpContext, info *FileInfo) (string, error) {
+	if len(handler.config.UploadTokenKey) == 0 {
+		return "", nil
+	}
+
+	token, err := handler.requestUploadToken(c)
+	if err != nil {
+		return "", err
+	}
+
+	if token.MaxSize > 0 {
+		if info.SizeIsDeferred {
+			return "", ErrUploadTokenRequiresLength
+		}
+		if info.Size > token.MaxSize {
+			return "", ErrMaxSizeExceeded
+		}
+	}
+
+	// A final upload must only consist of partial uploads of the same subject.
+	for _, id := range info.PartialUploads {
+		upload, err := handler.composer.Core.GetUpload(c, id)
+		if err != nil {
+			return "", err
+		}
+
+		partialInfo, err := handler.getInfo(c, upload)
+		if err != nil {
+			return "", err
+		}
+
+		if partialInfo.MetaData[UploadTokenSubjectMetaDataKey] != token.Subject {
+			return "", ErrUploadTokenSubjectMismatch
+		}
+	}
+
+	metaData := make(MetaData)
+	for key, value := range info.MetaData {
+		if len(token.AllowedMetaDataKeys) == 0 || slices.Contains(token.AllowedMetaDataKeys, key) {
+			metaData[key] = value
+		}
+	}
+	for key, value := range token.MetaData {
+		metaData[key] = value
+	}
+	metaData[UploadTokenSubjectMetaDataKey] = token.Subject
+	info.MetaData = metaData
+
+	if token.ID != "" {
+		if err := validateUploadId(token.ID); err != nil {
+			return "", err
+		}
+
+		// Replaying the token must not replace the existing upload and its data.
+		_, err := handler.composer.Core.GetUpload(c, token.ID)
+		if err == nil {
+			c.log.WarnContext(c, "UploadTokenUsed", "id", token.ID)
+			return "", ErrUploadTokenUsed
+		}
+		if handlerErr, ok := err.(Error); !ok || handlerErr.ErrorCode != ErrNotFound.ErrorCode {
+			return "", err
+		}
+
+		info.ID = token.ID
+	} else if token.IDPrefix != "" {
+		info.ID = token.IDPrefix + uid.Uid()
+	}
+
+	if err := validateUploadId(info.ID); err != nil {
+		return "", err
+	}
+
+	c.log = c.log.With("tokenSubject", token.Subject)
+	return token.Subject, nil
+}
+
+// checkUploadTokenSubject ensures that the request carries a valid upload token for
+// the same subject that created the upload. If no key is configured, nothing happens.
+func (handler *UnroutedHandler) checkUploadTokenSubject(c *httpContext, info FileInfo) error {
+	if len(handler.config.UploadTokenKey) == 0 {
+		return nil
+	}
+
+	token, err := handler.requestUploadToken(c)
+	if err != nil {
+		return err
+	}
+
+	if info.MetaData[UploadTokenSubjectMetaDataKey] != token.Subject {
+		c.log.WarnContext(c, "UploadTokenSubjectMismatch", "tokenSubject", token.Subject)
+		return ErrUploadTokenSubjectMismatch
+	}
+
+	return nil
+}
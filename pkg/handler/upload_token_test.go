@@ -0,0 +1,311 @@
+package handler_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+func TestUploadToken(t *testing.T) {
+	key := []byte("secret")
+
+	signToken := func(t *testing.T, token UploadToken) string {
+		if token.ExpiresAt == 0 {
+			token.ExpiresAt = time.Now().Add(time.Hour).Unix()
+		}
+
+		value, err := SignUploadToken(key, token)
+		assert.NoError(t, err)
+		return value
+	}
+
+	SubTest(t, "CreateWithToken", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "user-1-upload").Return(nil, ErrNotFound),
+			store.EXPECT().NewUpload(gomock.Any(), FileInfo{
+				ID:   "user-1-upload",
+				Size: 300,
+				MetaData: map[string]string{
+					"foo":          "hello",
+					"bucket":       "photos",
+					"tokensubject": "user-1",
+				},
+			}).Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "user-1-upload",
+				Size: 300,
+				MetaData: map[string]string{
+					"foo":          "hello",
+					"bucket":       "photos",
+					"tokensubject": "user-1",
+				},
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			BasePath:       "/files/",
+			UploadTokenKey: key,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":   "1.0.0",
+				"Upload-Length":   "300",
+				"Upload-Metadata": "foo aGVsbG8=, bar d29ybGQ=, bucket d29ybGQ=",
+				"Upload-Token": signToken(t, UploadToken{
+					Subject:             "user-1",
+					MaxSize:             500,
+					MetaData:            MetaData{"bucket": "photos"},
+					AllowedMetaDataKeys: []string{"foo"},
+					ID:                  "user-1-upload",
+				}),
+			},
+			Code: http.StatusCreated,
+			ResHeader: map[string]string{
+				"Location": "http://tus.io/files/user-1-upload",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "ReplayTokenWithID", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		// The upload created with the token exists already, so it must not be replaced.
+		store.EXPECT().GetUpload(gomock.Any(), "user-1-upload").Return(upload, nil)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			UploadTokenKey: key,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				"Upload-Token": signToken(t, UploadToken{
+					Subject: "user-1",
+					ID:      "user-1-upload",
+				}),
+			},
+			Code:    http.StatusConflict,
+			ResBody: "ERR_UPLOAD_TOKEN_USED: upload token has already been used to create an upload\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "CreateWithIDPrefix", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().NewUpload(gomock.Any(), gomock.Any()).DoAndReturn(func(_ any, info FileInfo) (Upload, error) {
+				assert.True(t, strings.HasPrefix(info.ID, "user-1/"))
+				return upload, nil
+			}),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:   "user-1/abc",
+				Size: 300,
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			BasePath:       "/files/",
+			UploadTokenKey: key,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			// The token can also be passed as a query parameter.
+			URL: "?token=" + signToken(t, UploadToken{
+				Subject:  "user-1",
+				IDPrefix: "user-1/",
+			}),
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+			},
+			Code: http.StatusCreated,
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "MissingToken", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			UploadTokenKey: key,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+			},
+			Code:    http.StatusUnauthorized,
+			ResBody: "ERR_UPLOAD_TOKEN_INVALID: upload token is missing or invalid\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "InvalidSignature", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			UploadTokenKey: key,
+		})
+
+		token, err := SignUploadToken([]byte("other"), UploadToken{
+			Subject:   "user-1",
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		})
+		assert.NoError(t, err)
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				"Upload-Token":  token,
+			},
+			Code:    http.StatusUnauthorized,
+			ResBody: "ERR_UPLOAD_TOKEN_INVALID: upload token is missing or invalid\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "ExpiredToken", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			UploadTokenKey: key,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				"Upload-Token": signToken(t, UploadToken{
+					Subject:   "user-1",
+					ExpiresAt: time.Now().Add(-time.Minute).Unix(),
+				}),
+			},
+			Code:    http.StatusUnauthorized,
+			ResBody: "ERR_UPLOAD_TOKEN_EXPIRED: upload token has expired\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "MaxSizeExceeded", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			UploadTokenKey: key,
+		})
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Length": "300",
+				"Upload-Token": signToken(t, UploadToken{
+					Subject: "user-1",
+					MaxSize: 200,
+				}),
+			},
+			Code:    http.StatusRequestEntityTooLarge,
+			ResBody: "ERR_MAX_SIZE_EXCEEDED: maximum size exceeded\n",
+		}).Run(handler, t)
+
+		(&httpTest{
+			Method: "POST",
+			ReqHeader: map[string]string{
+				"Tus-Resumable":       "1.0.0",
+				"Upload-Defer-Length": "1",
+				"Upload-Token": signToken(t, UploadToken{
+					Subject: "user-1",
+					MaxSize: 200,
+				}),
+			},
+			Code:    http.StatusBadRequest,
+			ResBody: "ERR_UPLOAD_TOKEN_REQUIRES_LENGTH: upload token requires the upload length to be known\n",
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "HeadSameSubject", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:       "yes",
+				Offset:   11,
+				Size:     44,
+				MetaData: map[string]string{"tokensubject": "user-1"},
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			UploadTokenKey: key,
+		})
+
+		(&httpTest{
+			Method: "HEAD",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Upload-Token":  signToken(t, UploadToken{Subject: "user-1"}),
+			},
+			Code: http.StatusOK,
+			ResHeader: map[string]string{
+				"Upload-Offset": "11",
+			},
+		}).Run(handler, t)
+	})
+
+	SubTest(t, "PatchOtherSubject", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:       "yes",
+				Offset:   5,
+				Size:     10,
+				MetaData: map[string]string{"tokensubject": "user-1"},
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:  composer,
+			UploadTokenKey: key,
+		})
+
+		(&httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": "5",
+				"Upload-Token":  signToken(t, UploadToken{Subject: "user-2"}),
+			},
+			ReqBody: strings.NewReader("hello"),
+			Code:    http.StatusForbidden,
+			ResBody: "ERR_UPLOAD_TOKEN_SUBJECT_MISMATCH: upload does not belong to the subject of the upload token\n",
+		}).Run(handler, t)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"reflect"
+	"strconv"
 	"testing"
 
 	httptestrecorder "github.com/Acconut/go-httptest-recorder"
@@ -26,6 +27,8 @@ type FullDataStore interface {
 	handler.TerminaterDataStore
 	handler.ConcaterDataStore
 	handler.LengthDeferrerDataStore
+	handler.MetadataUpdaterDataStore
+	handler.StateUpdaterDataStore
 }
 
 type FullUpload interface {
@@ -33,6 +36,8 @@ type FullUpload interface {
 	handler.TerminatableUpload
 	handler.LengthDeclarableUpload
 	handler.ConcatableUpload
+	handler.MetadataUpdatableUpload
+	handler.StateUpdatableUpload
 }
 
 type FullLocker interface {
@@ -142,7 +147,7 @@ func addIETFUploadCompleteHeader(header map[string]string, isComplete bool, inte
 		} else {
 			header["Upload-Incomplete"] = "?1"
 		}
-	case "4", "5", "6":
+	case "4", "5", "6", "7", "8":
 		if isComplete {
 			header["Upload-Complete"] = "?1"
 		} else {
@@ -156,8 +161,31 @@ func addIETFUploadCompleteHeader(header map[string]string, isComplete bool, inte
 // addIETFContentTypeHeader writes the Content-Type header depending on the interop version.
 func addIETFContentTypeHeader(header map[string]string, interopVersion string) map[string]string {
 	switch interopVersion {
-	case "6":
+	case "6", "7", "8":
 		header["Content-Type"] = "application/partial-upload"
 	}
 	return header
 }
+
+// ietfUploadLimit returns the expected Upload-Limit header for an upload of the given size
+// if no maximum size is configured. Since interop version 7, the limits do not include the
+// upload's size anymore.
+func ietfUploadLimit(size int64, interopVersion string) string {
+	switch interopVersion {
+	case "3", "4", "5", "6":
+		return "min-size=0,max-size=" + strconv.FormatInt(size, 10)
+	default:
+		return "min-size=0"
+	}
+}
+
+// ietfProblemBody returns the expected response body for an error, which is a problem
+// details object since interop version 7.
+func ietfProblemBody(body string, interopVersion string, problem string) string {
+	switch interopVersion {
+	case "3", "4", "5", "6":
+		return body
+	default:
+		return problem
+	}
+}
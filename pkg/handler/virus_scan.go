@@ -0,0 +1,134 @@
+package handler
+
+import (
+	"context"
+	"io"
+	"maps"
+	"net/http"
+)
+
+var (
+	ErrUploadInfected   = NewError("ERR_UPLOAD_INFECTED", "upload contains malware", http.StatusUnprocessableEntity)
+	ErrVirusScanFailed  = NewError("ERR_VIRUS_SCAN_FAILED", "upload could not be scanned for malware", http.StatusServiceUnavailable)
+	ErrUploadNotScanned = NewError("ERR_UPLOAD_NOT_SCANNED", "upload has not been scanned for malware", http.StatusConflict)
+)
+
+// VirusScanMetaDataKey is the meta data field, in which the result of scanning an upload
+// is recorded. Its value is "clean" or the name of the detected malware.
+const VirusScanMetaDataKey = "virusscan"
+
+// virusScanClean is the result of scanning an upload, in which no malware was found.
+const virusScanClean = "clean"
+
+// VirusScanner is the interface for scanning the data of finished uploads for malware.
+// Implementations are provided by the clamdscanner and icapscanner packages.
+type VirusScanner interface {
+	// Scan reads the data from the reader and sends it to the scanner. It must not
+	// return an error if malware is found, but report it in the result instead.
+	Scan(ctx context.Context, data io.Reader) (ScanResult, error)
+}
+
+// ScanResult describes the outcome of scanning an upload's data.
+type ScanResult struct {
+	// Infected indicates that malware was found.
+	Infected bool
+	// Signature is the name of the found malware, if the scanner reports it.
+	Signature string
+}
+
+// scanUpload scans the data of a finished upload using the configured VirusScanner and
+// saves the result with the upload. It is also recorded in the upload's meta data for the
+// hooks. Partial uploads are skipped, since their data is scanned as part of the final
+// upload. If malware is found, ErrUploadInfected is returned. If the data could not be
+// scanned or the result could not be saved, ErrVirusScanFailed is returned, so that an
+// unscanned upload is never considered complete. The scan is repeated when the client
+// retries its request (see awaitsVirusScan).
+func (handler *UnroutedHandler) scanUpload(c *httpContext, upload Upload, info *FileInfo) (err error) {
+	if handler.config.VirusScanner == nil || info.IsPartial {
+		return nil
+	}
+
+	ctx, span := handler.startSpan(c, "ScanUpload")
+	defer func() {
+		endSpan(span, err)
+	}()
+
+	src, err := upload.GetReader(ctx)
+	if err != nil {
+		c.log.ErrorContext(c, "VirusScanError", "error", err)
+		return ErrVirusScanFailed
+	}
+	defer src.Close()
+
+	result, err := handler.config.VirusScanner.Scan(ctx, io.LimitReader(src, info.Size))
+	if err != nil {
+		c.log.ErrorContext(c, "VirusScanError", "error", err)
+		return ErrVirusScanFailed
+	}
+
+	// Copy the meta data, since the map might be shared with other FileInfo structs.
+	info.MetaData = maps.Clone(info.MetaData)
+	if info.MetaData == nil {
+		info.MetaData = make(MetaData)
+	}
+
+	if !result.Infected {
+		if err := handler.updateState(c, upload, info, func(s *UploadState) { s.VirusScan = virusScanClean }); err != nil {
+			c.log.ErrorContext(c, "VirusScanError", "error", err)
+			return ErrVirusScanFailed
+		}
+
+		info.MetaData[VirusScanMetaDataKey] = virusScanClean
+		c.log.InfoContext(c, "VirusScanClean")
+		return nil
+	}
+
+	signature := result.Signature
+	if signature == "" {
+		signature = "unknown"
+	}
+	info.MetaData[VirusScanMetaDataKey] = signature
+	c.log.WarnContext(c, "UploadInfected", "signature", signature)
+
+	// The upload is terminated afterwards, but the result is also saved in case the data
+	// store cannot terminate it, so that it is never served.
+	if err := handler.updateState(c, upload, info, func(s *UploadState) { s.VirusScan = signature }); err != nil {
+		c.log.ErrorContext(c, "VirusScanError", "error", err)
+	}
+
+	return ErrUploadInfected
+}
+
+// awaitsVirusScan returns whether a finished upload has not been scanned successfully,
+// e.g. because the scanner was not available, so that the scan must be repeated.
+func (handler *UnroutedHandler) awaitsVirusScan(info FileInfo) bool {
+	return handler.config.VirusScanner != nil && !info.IsPartial && !info.SizeIsDeferred &&
+		info.Offset == info.Size && info.virusScanResult() == ""
+}
+
+// checkVirusScan returns an error if the upload's data must not be served, because it
+// has not been scanned successfully or contains malware.
+func (handler *UnroutedHandler) checkVirusScan(info FileInfo) error {
+	if handler.config.VirusScanner == nil {
+		return nil
+	}
+
+	switch info.virusScanResult() {
+	case virusScanClean:
+		return nil
+	case "":
+		return ErrUploadNotScanned
+	default:
+		return ErrUploadInfected
+	}
+}
+
+// virusScanResult returns the saved result of scanning the upload or an empty string if
+// it has not been scanned successfully.
+func (info FileInfo) virusScanResult() string {
+	if info.State == nil {
+		return ""
+	}
+
+	return info.State.VirusScan
+}
@@ -0,0 +1,263 @@
+package handler_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	. "github.com/tus/tusd/v2/pkg/handler"
+)
+
+// stringScanner reports all data containing the word EICAR as infected.
+type stringScanner struct {
+	err error
+}
+
+func (s stringScanner) Scan(ctx context.Context, data io.Reader) (ScanResult, error) {
+	if s.err != nil {
+		return ScanResult{}, s.err
+	}
+
+	b, err := io.ReadAll(data)
+	if err != nil {
+		return ScanResult{}, err
+	}
+
+	if strings.Contains(string(b), "EICAR") {
+		return ScanResult{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return ScanResult{}, nil
+}
+
+func TestVirusScan(t *testing.T) {
+	patchRequest := func(offset string, body string) *httpTest {
+		return &httpTest{
+			Method: "PATCH",
+			URL:    "yes",
+			ReqHeader: map[string]string{
+				"Tus-Resumable": "1.0.0",
+				"Content-Type":  "application/offset+octet-stream",
+				"Upload-Offset": offset,
+			},
+			ReqBody: strings.NewReader(body),
+		}
+	}
+
+	SubTest(t, "RequireStateUpdater", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		_, err := NewHandler(Config{
+			StoreComposer: composer,
+			VirusScanner:  stringScanner{},
+		})
+		assert.EqualError(t, err, "tusd: VirusScanner requires a data store implementing StateUpdaterDataStore")
+	})
+
+	SubTest(t, "Clean", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UseStateUpdater(store)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:       "yes",
+				Offset:   0,
+				Size:     5,
+				MetaData: map[string]string{"filename": "hello.txt"},
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+			upload.EXPECT().GetReader(gomock.Any()).Return(&closingStringReader{
+				Reader: strings.NewReader("hello"),
+			}, nil),
+			store.EXPECT().AsStateUpdatableUpload(upload).Return(upload),
+			upload.EXPECT().UpdateState(gomock.Any(), UploadState{VirusScan: "clean"}),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			NotifyCompleteUploads: true,
+			VirusScanner:          stringScanner{},
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.CompleteUploads = c
+
+		test := patchRequest("0", "hello")
+		test.Code = http.StatusNoContent
+		test.Run(handler, t)
+
+		event := <-c
+		assert.Equal(t, MetaData{
+			"filename":  "hello.txt",
+			"virusscan": "clean",
+		}, event.Upload.MetaData)
+	})
+
+	SubTest(t, "Infected", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UseStateUpdater(store)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   5,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("EICAR")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+			upload.EXPECT().GetReader(gomock.Any()).Return(&closingStringReader{
+				Reader: strings.NewReader("EICAR"),
+			}, nil),
+			store.EXPECT().AsStateUpdatableUpload(upload).Return(upload),
+			upload.EXPECT().UpdateState(gomock.Any(), UploadState{VirusScan: "Eicar-Test-Signature"}),
+			store.EXPECT().AsTerminatableUpload(upload).Return(upload),
+			upload.EXPECT().Terminate(gomock.Any()).Return(nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:           composer,
+			NotifyCompleteUploads:   true,
+			NotifyTerminatedUploads: true,
+			VirusScanner:            stringScanner{},
+		})
+
+		handler.CompleteUploads = make(chan HookEvent, 1)
+		terminated := make(chan HookEvent, 1)
+		handler.TerminatedUploads = terminated
+
+		test := patchRequest("0", "EICAR")
+		test.Code = http.StatusUnprocessableEntity
+		test.ResBody = "ERR_UPLOAD_INFECTED: upload contains malware\n"
+		test.Run(handler, t)
+
+		event := <-terminated
+		assert.Equal(t, "Eicar-Test-Signature", event.Upload.MetaData["virusscan"])
+		assert.Empty(t, handler.CompleteUploads)
+	})
+
+	SubTest(t, "ScanFailed", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UseStateUpdater(store)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 0,
+				Size:   5,
+			}, nil),
+			upload.EXPECT().WriteChunk(gomock.Any(), int64(0), NewReaderMatcher("hello")).Return(int64(5), nil),
+			upload.EXPECT().FinishUpload(gomock.Any()),
+			upload.EXPECT().GetReader(gomock.Any()).Return(&closingStringReader{
+				Reader: strings.NewReader("hello"),
+			}, nil),
+			// The upload is complete, but has not been scanned, so it is not served.
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   5,
+			}, nil),
+			// Once the scanner is available again, the client's retry completes the upload.
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   5,
+			}, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(&closingStringReader{
+				Reader: strings.NewReader("hello"),
+			}, nil),
+			store.EXPECT().AsStateUpdatableUpload(upload).Return(upload),
+			upload.EXPECT().UpdateState(gomock.Any(), UploadState{VirusScan: "clean"}),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer:         composer,
+			NotifyCompleteUploads: true,
+			VirusScanner:          stringScanner{err: errors.New("connection refused")},
+		})
+
+		c := make(chan HookEvent, 1)
+		handler.CompleteUploads = c
+
+		test := patchRequest("0", "hello")
+		test.Code = http.StatusServiceUnavailable
+		test.ResBody = "ERR_VIRUS_SCAN_FAILED: upload could not be scanned for malware\n"
+		test.Run(handler, t)
+		assert.Empty(t, c)
+
+		(&httpTest{
+			Method:  "GET",
+			URL:     "yes",
+			Code:    http.StatusConflict,
+			ResBody: "ERR_UPLOAD_NOT_SCANNED: upload has not been scanned for malware\n",
+		}).Run(handler, t)
+
+		handler, _ = NewHandler(Config{
+			StoreComposer:         composer,
+			NotifyCompleteUploads: true,
+			VirusScanner:          stringScanner{},
+		})
+		handler.CompleteUploads = c
+
+		test = patchRequest("5", "")
+		test.Code = http.StatusNoContent
+		test.ResHeader = map[string]string{
+			"Upload-Offset": "5",
+		}
+		test.Run(handler, t)
+
+		event := <-c
+		assert.Equal(t, "clean", event.Upload.MetaData["virusscan"])
+	})
+
+	SubTest(t, "DownloadClean", func(t *testing.T, store *MockFullDataStore, composer *StoreComposer) {
+		ctrl := gomock.NewController(t)
+		defer ctrl.Finish()
+		upload := NewMockFullUpload(ctrl)
+
+		composer.UseStateUpdater(store)
+
+		gomock.InOrder(
+			store.EXPECT().GetUpload(gomock.Any(), "yes").Return(upload, nil),
+			upload.EXPECT().GetInfo(gomock.Any()).Return(FileInfo{
+				ID:     "yes",
+				Offset: 5,
+				Size:   5,
+				State: &UploadState{
+					VirusScan: "clean",
+				},
+			}, nil),
+			upload.EXPECT().GetReader(gomock.Any()).Return(&closingStringReader{
+				Reader: strings.NewReader("hello"),
+			}, nil),
+		)
+
+		handler, _ := NewHandler(Config{
+			StoreComposer: composer,
+			VirusScanner:  stringScanner{},
+		})
+
+		(&httpTest{
+			Method:  "GET",
+			URL:     "yes",
+			Code:    http.StatusOK,
+			ResBody: "hello",
+		}).Run(handler, t)
+	})
+}
@@ -15,6 +15,8 @@ import (
 	grpc_retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
 	"github.com/tus/tusd/v2/pkg/hooks"
 	pb "github.com/tus/tusd/v2/pkg/hooks/grpc/proto"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
@@ -78,6 +80,8 @@ func (g *GrpcHook) Setup() error {
 		grpc_retry.WithMax(uint(g.MaxRetries)),
 	}
 	grpcOpts = append(grpcOpts, grpc.WithUnaryInterceptor(grpc_retry.UnaryClientInterceptor(opts...)))
+	// Propagate the trace context to the hook server.
+	grpcOpts = append(grpcOpts, grpc.WithStatsHandler(otelgrpc.NewClientHandler()))
 
 	conn, err := grpc.NewClient(g.Endpoint, grpcOpts...)
 	if err != nil {
@@ -88,7 +92,12 @@ func (g *GrpcHook) Setup() error {
 }
 
 func (g *GrpcHook) InvokeHook(hookReq hooks.HookRequest) (hookRes hooks.HookResponse, err error) {
+	// The call is not bound to the event's context, so it does not get cancelled
+	// with the request, but it continues the event's trace.
 	ctx := context.Background()
+	if hookReq.Event.Context != nil {
+		ctx = trace.ContextWithSpanContext(ctx, trace.SpanContextFromContext(hookReq.Event.Context))
+	}
 
 	for _, header := range g.ForwardHeaders {
 		value := hookReq.Event.HTTPRequest.Header.Get(header)
@@ -114,15 +123,17 @@ func marshal(hookReq hooks.HookRequest) *pb.HookRequest {
 		Type: string(hookReq.Type),
 		Event: &pb.Event{
 			Upload: &pb.FileInfo{
-				Id:             event.Upload.ID,
-				Size:           event.Upload.Size,
-				SizeIsDeferred: event.Upload.SizeIsDeferred,
-				Offset:         event.Upload.Offset,
-				MetaData:       event.Upload.MetaData,
-				IsPartial:      event.Upload.IsPartial,
-				IsFinal:        event.Upload.IsFinal,
-				PartialUploads: event.Upload.PartialUploads,
-				Storage:        event.Upload.Storage,
+				Id:                  event.Upload.ID,
+				Size:                event.Upload.Size,
+				SizeIsDeferred:      event.Upload.SizeIsDeferred,
+				Offset:              event.Upload.Offset,
+				MetaData:            event.Upload.MetaData,
+				IsPartial:           event.Upload.IsPartial,
+				IsFinal:             event.Upload.IsFinal,
+				PartialUploads:      event.Upload.PartialUploads,
+				Storage:             event.Upload.Storage,
+				Digests:             event.Upload.Digests,
+				DetectedContentType: event.Upload.DetectedContentType,
 			},
 			HttpRequest: &pb.HTTPRequest{
 				Method:     event.HTTPRequest.Method,
@@ -147,6 +158,8 @@ func getHeader(httpHeader http.Header) (hookHeader map[string]string) {
 func unmarshal(res *pb.HookResponse) (hookRes hooks.HookResponse) {
 	hookRes.RejectUpload = res.RejectUpload
 	hookRes.StopUpload = res.StopUpload
+	hookRes.RejectReceive = res.RejectReceive
+	hookRes.RejectMetadataUpdate = res.RejectMetadataUpdate
 
 	httpRes := res.HttpResponse
 	if httpRes != nil {
@@ -160,6 +173,15 @@ func unmarshal(res *pb.HookResponse) (hookRes hooks.HookResponse) {
 		hookRes.ChangeFileInfo.ID = changes.Id
 		hookRes.ChangeFileInfo.MetaData = changes.MetaData
 		hookRes.ChangeFileInfo.Storage = changes.Storage
+		hookRes.ChangeFileInfo.BandwidthLimit = changes.BandwidthLimit
+		hookRes.ChangeFileInfo.QuotaKey = changes.QuotaKey
+		hookRes.ChangeFileInfo.QuotaLimit = changes.QuotaLimit
+	}
+
+	receiveChanges := res.ChangeReceive
+	if receiveChanges != nil {
+		hookRes.ChangeReceive.BandwidthLimit = receiveChanges.BandwidthLimit
+		hookRes.ChangeReceive.ConcurrencyKey = receiveChanges.ConcurrencyKey
 	}
 
 	return hookRes
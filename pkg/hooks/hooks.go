@@ -18,11 +18,16 @@
 package hooks
 
 import (
+	"context"
 	"fmt"
 	"slices"
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tus/tusd/v2/pkg/handler"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/exp/slog"
 )
 
@@ -52,7 +57,7 @@ type HookRequest struct {
 // HookResponse is the response after a hook is executed.
 type HookResponse struct {
 	// HTTPResponse's fields can be filled to modify the HTTP response.
-	// This is only possible for pre-create, pre-finish and post-receive hooks.
+	// This is only possible for pre-create, pre-finish, pre-receive and post-receive hooks.
 	// For other hooks this value is ignored.
 	// If multiple hooks modify the HTTP response, a later hook may overwrite the
 	// modified values from a previous hook (e.g. if multiple post-receive hooks
@@ -78,9 +83,28 @@ type HookResponse struct {
 	// it has been created. See the handler.FileInfoChanges type for more details.
 	// Changes are applied on a per-property basis, meaning that specifying just
 	// one property leaves all others unchanged.
-	// This value is only respected for pre-create hooks.
+	// This value is only respected for pre-create hooks. The pre-update-metadata hook
+	// only respects ChangeFileInfo.MetaData.
 	ChangeFileInfo handler.FileInfoChanges
 
+	// RejectReceive will cause the request to be rejected before any upload data
+	// is received. This value is only respected for pre-receive hooks. For other hooks,
+	// it is ignored. Use the HTTPResponse field to send details about the rejection
+	// to the client.
+	RejectReceive bool
+
+	// ChangeReceive can be set to adjust how the upload data is received during the
+	// current request, for example to limit its bandwidth. See the handler.ReceiveChanges
+	// type for more details.
+	// This value is only respected for pre-receive hooks.
+	ChangeReceive handler.ReceiveChanges
+
+	// RejectMetadataUpdate will cause the update of the upload's meta data to be rejected.
+	// This value is only respected for pre-update-metadata hooks. For other hooks,
+	// it is ignored. Use the HTTPResponse field to send details about the rejection
+	// to the client.
+	RejectMetadataUpdate bool
+
 	// StopUpload will cause the upload to be stopped during a PATCH request.
 	// This value is only respected for post-receive hooks. For other hooks,
 	// it is ignored. Use the HTTPResponse field to send details about the stop
@@ -98,10 +122,14 @@ const (
 	HookPreCreate     HookType = "pre-create"
 	HookPreFinish     HookType = "pre-finish"
 	HookPreTerminate  HookType = "pre-terminate"
+	HookPreReceive    HookType = "pre-receive"
+
+	HookPreUpdateMetadata  HookType = "pre-update-metadata"
+	HookPostUpdateMetadata HookType = "post-update-metadata"
 )
 
 // AvailableHooks is a slice of all hooks that are implemented by tusd.
-var AvailableHooks []HookType = []HookType{HookPreCreate, HookPostCreate, HookPostReceive, HookPreTerminate, HookPostTerminate, HookPostFinish, HookPreFinish}
+var AvailableHooks []HookType = []HookType{HookPreCreate, HookPostCreate, HookPostReceive, HookPreTerminate, HookPostTerminate, HookPostFinish, HookPreFinish, HookPreReceive, HookPreUpdateMetadata, HookPostUpdateMetadata}
 
 func preCreateCallback(event handler.HookEvent, hookHandler HookHandler) (handler.HTTPResponse, handler.FileInfoChanges, error) {
 	ok, hookRes, err := invokeHookSync(HookPreCreate, event, hookHandler)
@@ -155,6 +183,50 @@ func preTerminateCallback(event handler.HookEvent, hookHandler HookHandler) (han
 	return httpRes, nil
 }
 
+func preReceiveCallback(event handler.HookEvent, hookHandler HookHandler) (handler.HTTPResponse, handler.ReceiveChanges, error) {
+	ok, hookRes, err := invokeHookSync(HookPreReceive, event, hookHandler)
+	if !ok || err != nil {
+		return handler.HTTPResponse{}, handler.ReceiveChanges{}, err
+	}
+
+	httpRes := hookRes.HTTPResponse
+
+	// If the hook response includes the instruction to reject the request, reuse the error code
+	// and message from ErrUploadReceiveRejected, but also include custom HTTP response values.
+	if hookRes.RejectReceive {
+		err := handler.ErrUploadReceiveRejected
+		err.HTTPResponse = err.HTTPResponse.MergeWith(httpRes)
+
+		return handler.HTTPResponse{}, handler.ReceiveChanges{}, err
+	}
+
+	return httpRes, hookRes.ChangeReceive, nil
+}
+
+func preUpdateMetadataCallback(event handler.HookEvent, hookHandler HookHandler) (handler.HTTPResponse, handler.FileInfoChanges, error) {
+	ok, hookRes, err := invokeHookSync(HookPreUpdateMetadata, event, hookHandler)
+	if !ok || err != nil {
+		return handler.HTTPResponse{}, handler.FileInfoChanges{}, err
+	}
+
+	httpRes := hookRes.HTTPResponse
+
+	// If the hook response includes the instruction to reject the update, reuse the error code
+	// and message from ErrMetadataUpdateRejected, but also include custom HTTP response values.
+	if hookRes.RejectMetadataUpdate {
+		err := handler.ErrMetadataUpdateRejected
+		err.HTTPResponse = err.HTTPResponse.MergeWith(httpRes)
+
+		return handler.HTTPResponse{}, handler.FileInfoChanges{}, err
+	}
+
+	// Only the meta data can be changed by this hook.
+	changes := handler.FileInfoChanges{
+		MetaData: hookRes.ChangeFileInfo.MetaData,
+	}
+	return httpRes, changes, nil
+}
+
 func postReceiveCallback(event handler.HookEvent, hookHandler HookHandler) {
 	ok, hookRes, _ := invokeHookSync(HookPostReceive, event, hookHandler)
 	// invokeHookSync already logs the error, if any occurs. So by checking `ok`, we can ensure
@@ -170,6 +242,9 @@ func postReceiveCallback(event handler.HookEvent, hookHandler HookHandler) {
 	}
 }
 
+// tracer creates the spans for hook invocations using the global OpenTelemetry tracer provider.
+var tracer = otel.Tracer("github.com/tus/tusd/v2/pkg/hooks")
+
 var MetricsHookErrorsTotal = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
 		Name: "tusd_hook_errors_total",
@@ -194,6 +269,9 @@ func SetupHookMetrics() {
 	MetricsHookErrorsTotal.WithLabelValues(string(HookPreCreate)).Add(0)
 	MetricsHookErrorsTotal.WithLabelValues(string(HookPreFinish)).Add(0)
 	MetricsHookErrorsTotal.WithLabelValues(string(HookPreTerminate)).Add(0)
+	MetricsHookErrorsTotal.WithLabelValues(string(HookPreReceive)).Add(0)
+	MetricsHookErrorsTotal.WithLabelValues(string(HookPreUpdateMetadata)).Add(0)
+	MetricsHookErrorsTotal.WithLabelValues(string(HookPostUpdateMetadata)).Add(0)
 	MetricsHookInvocationsTotal.WithLabelValues(string(HookPostFinish)).Add(0)
 	MetricsHookInvocationsTotal.WithLabelValues(string(HookPostTerminate)).Add(0)
 	MetricsHookInvocationsTotal.WithLabelValues(string(HookPostReceive)).Add(0)
@@ -201,6 +279,9 @@ func SetupHookMetrics() {
 	MetricsHookInvocationsTotal.WithLabelValues(string(HookPreCreate)).Add(0)
 	MetricsHookInvocationsTotal.WithLabelValues(string(HookPreFinish)).Add(0)
 	MetricsHookInvocationsTotal.WithLabelValues(string(HookPreTerminate)).Add(0)
+	MetricsHookInvocationsTotal.WithLabelValues(string(HookPreReceive)).Add(0)
+	MetricsHookInvocationsTotal.WithLabelValues(string(HookPreUpdateMetadata)).Add(0)
+	MetricsHookInvocationsTotal.WithLabelValues(string(HookPostUpdateMetadata)).Add(0)
 }
 
 func invokeHookAsync(typ HookType, event handler.HookEvent, hookHandler HookHandler) {
@@ -223,6 +304,21 @@ func invokeHookSync(typ HookType, event handler.HookEvent, hookHandler HookHandl
 
 	slog.Debug("HookInvocationStart", "type", typ, "id", id)
 
+	// The span is made available to the hook handler through the event's context, so
+	// that it can propagate the trace context to the hook endpoint.
+	ctx := event.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, span := tracer.Start(ctx, "hook "+string(typ), trace.WithAttributes(
+		attribute.String("tus.hook.type", string(typ)),
+		attribute.String("tus.upload.id", id),
+	))
+	defer span.End()
+	if event.Context != nil {
+		event.Context = ctx
+	}
+
 	res, err = hookHandler.InvokeHook(HookRequest{
 		Type:  typ,
 		Event: event,
@@ -232,6 +328,8 @@ func invokeHookSync(typ HookType, event handler.HookEvent, hookHandler HookHandl
 		// return a hook response.
 		slog.Error("HookInvocationError", "type", typ, "id", id, "error", err.Error())
 		MetricsHookErrorsTotal.WithLabelValues(string(typ)).Add(1)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return false, HookResponse{}, err
 	}
 
@@ -252,7 +350,7 @@ func invokeHookSync(typ HookType, event handler.HookEvent, hookHandler HookHandl
 //	unroutedHandler := routedHandler.UnroutedHandler
 //
 // Note: NewHandlerWithHooks sets up a goroutine to consume the notfication channels (CompleteUploads, TerminatedUploads,
-// CreatedUploads, UploadProgress) on the created handler. These channels must not be consumed by the caller or otherwise
+// CreatedUploads, UploadProgress, UpdatedMetadata) on the created handler. These channels must not be consumed by the caller or otherwise
 // events might not be passed to the hook handler.
 func NewHandlerWithHooks(config *handler.Config, hookHandler HookHandler, enabledHooks []HookType) (*handler.Handler, error) {
 	if err := hookHandler.Setup(); err != nil {
@@ -264,6 +362,7 @@ func NewHandlerWithHooks(config *handler.Config, hookHandler HookHandler, enable
 	config.NotifyTerminatedUploads = slices.Contains(enabledHooks, HookPostTerminate)
 	config.NotifyUploadProgress = slices.Contains(enabledHooks, HookPostReceive)
 	config.NotifyCreatedUploads = slices.Contains(enabledHooks, HookPostCreate)
+	config.NotifyUpdatedMetadata = slices.Contains(enabledHooks, HookPostUpdateMetadata)
 
 	// Install callbacks for pre-* hooks
 	if slices.Contains(enabledHooks, HookPreCreate) {
@@ -283,6 +382,18 @@ func NewHandlerWithHooks(config *handler.Config, hookHandler HookHandler, enable
 		}
 	}
 
+	if slices.Contains(enabledHooks, HookPreReceive) {
+		config.PreUploadReceiveCallback = func(event handler.HookEvent) (handler.HTTPResponse, handler.ReceiveChanges, error) {
+			return preReceiveCallback(event, hookHandler)
+		}
+	}
+
+	if slices.Contains(enabledHooks, HookPreUpdateMetadata) {
+		config.PreUpdateMetadataCallback = func(event handler.HookEvent) (handler.HTTPResponse, handler.FileInfoChanges, error) {
+			return preUpdateMetadataCallback(event, hookHandler)
+		}
+	}
+
 	// Create handler
 	handler, err := handler.NewHandler(*config)
 	if err != nil {
@@ -299,6 +410,8 @@ func NewHandlerWithHooks(config *handler.Config, hookHandler HookHandler, enable
 				invokeHookAsync(HookPostTerminate, event, hookHandler)
 			case event := <-handler.CreatedUploads:
 				invokeHookAsync(HookPostCreate, event, hookHandler)
+			case event := <-handler.UpdatedMetadata:
+				invokeHookAsync(HookPostUpdateMetadata, event, hookHandler)
 			case event := <-handler.UploadProgress:
 				go postReceiveCallback(event, hookHandler)
 			}
@@ -62,6 +62,10 @@ func TestNewHandlerWithHooks(t *testing.T) {
 		},
 	}
 
+	receiveChange := handler.ReceiveChanges{
+		BandwidthLimit: 1024,
+	}
+
 	error := errors.New("oh no")
 
 	gomock.InOrder(
@@ -104,6 +108,20 @@ func TestNewHandlerWithHooks(t *testing.T) {
 			HTTPResponse:      response,
 			RejectTermination: true,
 		}, nil),
+		hookHandler.EXPECT().InvokeHook(HookRequest{
+			Type:  HookPreReceive,
+			Event: event,
+		}).Return(HookResponse{
+			HTTPResponse:  response,
+			ChangeReceive: receiveChange,
+		}, nil),
+		hookHandler.EXPECT().InvokeHook(HookRequest{
+			Type:  HookPreReceive,
+			Event: event,
+		}).Return(HookResponse{
+			HTTPResponse:  response,
+			RejectReceive: true,
+		}, nil),
 	)
 
 	// The hooks are executed asynchronously, so we don't know their execution order.
@@ -127,7 +145,7 @@ func TestNewHandlerWithHooks(t *testing.T) {
 		Event: event,
 	})
 
-	uploadHandler, err := NewHandlerWithHooks(&config, hookHandler, []HookType{HookPreCreate, HookPostCreate, HookPostReceive, HookPostTerminate, HookPostFinish, HookPreFinish, HookPreTerminate})
+	uploadHandler, err := NewHandlerWithHooks(&config, hookHandler, []HookType{HookPreCreate, HookPostCreate, HookPostReceive, HookPostTerminate, HookPostFinish, HookPreFinish, HookPreTerminate, HookPreReceive})
 	a.NoError(err)
 
 	// Successful pre-create hook
@@ -184,6 +202,29 @@ func TestNewHandlerWithHooks(t *testing.T) {
 	}, err)
 	a.Equal(handler.HTTPResponse{}, resp_got)
 
+	// Successful pre-receive hook
+	resp_got, receive_change_got, err := config.PreUploadReceiveCallback(event)
+	a.NoError(err)
+	a.Equal(response, resp_got)
+	a.Equal(receiveChange, receive_change_got)
+
+	// Pre-receive hook with rejection
+	resp_got, receive_change_got, err = config.PreUploadReceiveCallback(event)
+	a.Equal(handler.Error{
+		ErrorCode: handler.ErrUploadReceiveRejected.ErrorCode,
+		Message:   handler.ErrUploadReceiveRejected.Message,
+		HTTPResponse: handler.HTTPResponse{
+			StatusCode: 200,
+			Body:       "foobar",
+			Header: handler.HTTPHeader{
+				"X-Hello":      "here",
+				"Content-Type": "text/plain; charset=utf-8",
+			},
+		},
+	}, err)
+	a.Equal(handler.HTTPResponse{}, resp_got)
+	a.Equal(handler.ReceiveChanges{}, receive_change_got)
+
 	// Successful post-* hooks
 	uploadHandler.CreatedUploads <- event
 	uploadHandler.UploadProgress <- event
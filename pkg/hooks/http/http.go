@@ -18,6 +18,7 @@ import (
 
 	"github.com/sethgrid/pester"
 	"github.com/tus/tusd/v2/pkg/hooks"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 )
 
 type HttpHook struct {
@@ -58,7 +59,9 @@ func (h *HttpHook) Setup() error {
 			InsecureSkipVerify: true,
 		}
 	}
-	client.Transport = t
+	// The OpenTelemetry transport creates a span for each request and propagates the
+	// trace context to the hook endpoint.
+	client.Transport = otelhttp.NewTransport(t)
 
 	h.client = client
 
@@ -0,0 +1,159 @@
+// Package icapscanner scans uploads for malware using an ICAP server (RFC 3507).
+//
+// The upload's data is sent to the ICAP service as the body of an HTTP response in a
+// RESPMOD request, which is supported by most antivirus products offering an ICAP
+// interface, for example c-icap with squidclamav. If the service leaves the response
+// unmodified (204 No Content), the upload is considered clean. If the service modifies
+// the response, the upload is considered infected:
+//
+//	scanner, err := icapscanner.New("icap://localhost:1344/avscan")
+//	config := handler.Config{
+//		StoreComposer: composer,
+//		VirusScanner:  scanner,
+//	}
+package icapscanner
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http/httputil"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+const defaultPort = "1344"
+
+// encapsulatedHeader is the HTTP response header, which encapsulates the upload's data.
+const encapsulatedHeader = "HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\nTransfer-Encoding: chunked\r\n\r\n"
+
+// ICAPScanner sends uploads to an ICAP service for scanning.
+type ICAPScanner struct {
+	// URL of the ICAP service, for example icap://localhost:1344/avscan.
+	URL *url.URL
+}
+
+// New creates a new scanner for the ICAP service at the given URL.
+func New(serviceURL string) (ICAPScanner, error) {
+	u, err := url.Parse(serviceURL)
+	if err != nil {
+		return ICAPScanner{}, err
+	}
+	if u.Scheme != "icap" {
+		return ICAPScanner{}, fmt.Errorf("icapscanner: unsupported scheme %q in service URL", u.Scheme)
+	}
+
+	return ICAPScanner{
+		URL: u,
+	}, nil
+}
+
+func (scanner ICAPScanner) Scan(ctx context.Context, data io.Reader) (handler.ScanResult, error) {
+	address := scanner.URL.Host
+	if scanner.URL.Port() == "" {
+		address = net.JoinHostPort(scanner.URL.Hostname(), defaultPort)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return handler.ScanResult{}, err
+	}
+	defer conn.Close()
+
+	// Interrupt blocking reads and writes once the context is cancelled.
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	defer stop()
+
+	if err := scanner.sendRequest(conn, data); err != nil {
+		return handler.ScanResult{}, err
+	}
+
+	return readResponse(conn)
+}
+
+// sendRequest sends the RESPMOD request including the encapsulated HTTP response, whose
+// body contains the upload's data using the chunked transfer encoding.
+func (scanner ICAPScanner) sendRequest(conn net.Conn, data io.Reader) error {
+	writer := bufio.NewWriter(conn)
+
+	fmt.Fprintf(writer, "RESPMOD %s ICAP/1.0\r\n", scanner.URL.String())
+	fmt.Fprintf(writer, "Host: %s\r\n", scanner.URL.Host)
+	fmt.Fprintf(writer, "Allow: 204\r\n")
+	fmt.Fprintf(writer, "Encapsulated: res-hdr=0, res-body=%d\r\n", len(encapsulatedHeader))
+	fmt.Fprintf(writer, "\r\n")
+	writer.WriteString(encapsulatedHeader)
+
+	body := httputil.NewChunkedWriter(writer)
+	if _, err := io.Copy(body, data); err != nil {
+		return err
+	}
+	if err := body.Close(); err != nil {
+		return err
+	}
+	// The chunked writer does not write the empty line after the last chunk.
+	writer.WriteString("\r\n")
+
+	return writer.Flush()
+}
+
+// readResponse interprets the ICAP response. 204 means that the service did not modify
+// the data and therefore did not find malware, while 200 indicates that the service
+// replaced the data, for example with an error page, because malware was found.
+func readResponse(conn net.Conn) (handler.ScanResult, error) {
+	reader := textproto.NewReader(bufio.NewReader(conn))
+
+	statusLine, err := reader.ReadLine()
+	if err != nil {
+		return handler.ScanResult{}, err
+	}
+
+	protocol, status, _ := strings.Cut(statusLine, " ")
+	code, _, _ := strings.Cut(status, " ")
+	if !strings.HasPrefix(protocol, "ICAP/") {
+		return handler.ScanResult{}, fmt.Errorf("icapscanner: invalid response: %s", statusLine)
+	}
+
+	header, err := reader.ReadMIMEHeader()
+	if err != nil {
+		return handler.ScanResult{}, err
+	}
+
+	switch statusCode, _ := strconv.Atoi(code); statusCode {
+	case 204:
+		return handler.ScanResult{}, nil
+	case 200:
+		return handler.ScanResult{
+			Infected:  true,
+			Signature: signature(header),
+		}, nil
+	default:
+		return handler.ScanResult{}, fmt.Errorf("icapscanner: scan failed: %s", statusLine)
+	}
+}
+
+// signature extracts the name of the found malware from the ICAP response headers.
+// Unfortunately, the services use different headers for reporting it.
+func signature(header textproto.MIMEHeader) string {
+	// X-Infection-Found: Type=0; Resolution=2; Threat=Eicar-Test-Signature;
+	for _, field := range strings.Split(header.Get("X-Infection-Found"), ";") {
+		if threat, ok := strings.CutPrefix(strings.TrimSpace(field), "Threat="); ok {
+			return threat
+		}
+	}
+
+	if virusID := header.Get("X-Virus-Id"); virusID != "" {
+		return virusID
+	}
+
+	return ""
+}
@@ -0,0 +1,98 @@
+package icapscanner
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http/httputil"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+var _ handler.VirusScanner = ICAPScanner{}
+
+// fakeICAP implements a RESPMOD service, which reports all bodies containing the
+// word EICAR as infected.
+func fakeICAP(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				reader := textproto.NewReader(bufio.NewReader(conn))
+
+				requestLine, err := reader.ReadLine()
+				if err != nil || !strings.HasPrefix(requestLine, "RESPMOD icap://") {
+					io.WriteString(conn, "ICAP/1.0 400 Bad Request\r\n\r\n")
+					return
+				}
+				if _, err := reader.ReadMIMEHeader(); err != nil {
+					return
+				}
+				// Skip the encapsulated HTTP response header.
+				for {
+					line, err := reader.ReadLine()
+					if err != nil {
+						return
+					}
+					if line == "" {
+						break
+					}
+				}
+
+				body, err := io.ReadAll(httputil.NewChunkedReader(reader.R))
+				if err != nil {
+					io.WriteString(conn, "ICAP/1.0 500 Server Error\r\n\r\n")
+					return
+				}
+
+				if strings.Contains(string(body), "EICAR") {
+					io.WriteString(conn, "ICAP/1.0 200 OK\r\nX-Infection-Found: Type=0; Resolution=2; Threat=Eicar-Test-Signature;\r\nEncapsulated: null-body=0\r\n\r\n")
+				} else {
+					io.WriteString(conn, "ICAP/1.0 204 No Content\r\n\r\n")
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestScan(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	scanner, err := New("icap://" + fakeICAP(t) + "/avscan")
+	a.NoError(err)
+
+	result, err := scanner.Scan(ctx, strings.NewReader("hello world"))
+	a.NoError(err)
+	a.Equal(handler.ScanResult{}, result)
+
+	result, err = scanner.Scan(ctx, strings.NewReader("hello EICAR world"))
+	a.NoError(err)
+	a.Equal(handler.ScanResult{
+		Infected:  true,
+		Signature: "Eicar-Test-Signature",
+	}, result)
+}
+
+func TestNewInvalidScheme(t *testing.T) {
+	_, err := New("http://localhost/avscan")
+	assert.Error(t, err)
+}
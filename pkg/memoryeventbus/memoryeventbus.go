@@ -0,0 +1,129 @@
+// Package memoryeventbus provides an in-memory event bus for upload events.
+//
+// The handler publishes events about the progress, completion, termination and
+// stopping of uploads on an event bus. Requests to the event stream endpoint
+// (see handler.UnroutedHandler.GetEvents) subscribe to these events and forward
+// them to the client.
+//
+// MemoryEventBus delivers events using memory and therefore only works if the
+// events are published and consumed in the same process. If multiple tusd
+// instances serve the same uploads, an event bus based on an external message
+// broker must be used instead.
+//
+// Publishing never waits for subscribers. Each subscriber has a bounded buffer of
+// events. If a subscriber does not consume its events fast enough, progress events
+// are dropped since the next progress event supersedes them anyways. Part of the
+// buffer is reserved for all other events. If it is full nonetheless, the
+// subscription is ended by closing its channel, so that the subscriber can notice
+// that it missed events.
+package memoryeventbus
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+const (
+	// subscriberBufferSize is the number of events that can be queued for a single
+	// subscriber before its subscription is ended.
+	subscriberBufferSize = 16
+	// progressBufferSize is the number of events that can be queued for a single
+	// subscriber before progress events are dropped.
+	progressBufferSize = subscriberBufferSize - 4
+)
+
+// MemoryEventBus distributes upload events between publishers and subscribers
+// in the same process.
+type MemoryEventBus struct {
+	subscribers map[string]map[*subscriber]struct{}
+	mutex       sync.RWMutex
+}
+
+type subscriber struct {
+	events chan handler.UploadEvent
+	// cancel ends the subscription.
+	cancel context.CancelFunc
+}
+
+// New creates a new in-memory event bus.
+func New() *MemoryEventBus {
+	return &MemoryEventBus{
+		subscribers: make(map[string]map[*subscriber]struct{}),
+	}
+}
+
+// UseIn adds this event bus to the passed composer.
+func (bus *MemoryEventBus) UseIn(composer *handler.StoreComposer) {
+	composer.UseEventBus(bus)
+}
+
+// Publish delivers the event to all subscribers of the event's upload without
+// waiting for them.
+func (bus *MemoryEventBus) Publish(ctx context.Context, event handler.UploadEvent) error {
+	bus.mutex.RLock()
+	defer bus.mutex.RUnlock()
+
+	for sub := range bus.subscribers[event.Upload.ID] {
+		if event.Type == handler.UploadEventProgress {
+			if len(sub.events) < progressBufferSize {
+				select {
+				case sub.events <- event:
+				default:
+				}
+			}
+			// Otherwise, the subscriber is lagging behind, so we drop this progress event.
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			// The subscriber cannot receive this event, so we end its subscription
+			// instead of silently dropping the event.
+			sub.cancel()
+		}
+	}
+
+	return nil
+}
+
+// Subscribe returns a channel receiving all events for the given upload until
+// the context is cancelled.
+// If the subscriber does not consume the events fast enough, the channel is closed
+// early.
+func (bus *MemoryEventBus) Subscribe(ctx context.Context, id string) (<-chan handler.UploadEvent, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	sub := &subscriber{
+		events: make(chan handler.UploadEvent, subscriberBufferSize),
+		cancel: cancel,
+	}
+
+	bus.mutex.Lock()
+	subs, ok := bus.subscribers[id]
+	if !ok {
+		subs = make(map[*subscriber]struct{})
+		bus.subscribers[id] = subs
+	}
+	subs[sub] = struct{}{}
+	bus.mutex.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		// Publish never blocks while holding the lock, so acquiring it cannot block
+		// forever. Once the subscriber is removed, it is safe to close its channel.
+		bus.mutex.Lock()
+		subs := bus.subscribers[id]
+		delete(subs, sub)
+		if len(subs) == 0 {
+			delete(bus.subscribers, id)
+		}
+		bus.mutex.Unlock()
+
+		close(sub.events)
+	}()
+
+	return sub.events, nil
+}
@@ -0,0 +1,139 @@
+package memoryeventbus
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+var _ handler.EventBus = &MemoryEventBus{}
+
+func TestMemoryEventBus_PublishAndSubscribe(t *testing.T) {
+	a := assert.New(t)
+
+	bus := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := bus.Subscribe(ctx, "one")
+	a.NoError(err)
+
+	otherEvents, err := bus.Subscribe(ctx, "two")
+	a.NoError(err)
+
+	a.NoError(bus.Publish(context.Background(), handler.UploadEvent{
+		Type:   handler.UploadEventProgress,
+		Upload: handler.FileInfo{ID: "one", Offset: 5},
+	}))
+	a.NoError(bus.Publish(context.Background(), handler.UploadEvent{
+		Type:   handler.UploadEventFinish,
+		Upload: handler.FileInfo{ID: "one", Offset: 10},
+	}))
+
+	event := <-events
+	a.Equal(handler.UploadEventProgress, event.Type)
+	a.EqualValues(5, event.Upload.Offset)
+
+	event = <-events
+	a.Equal(handler.UploadEventFinish, event.Type)
+	a.EqualValues(10, event.Upload.Offset)
+
+	select {
+	case event := <-otherEvents:
+		t.Fatalf("unexpected event for other upload: %v", event)
+	default:
+	}
+}
+
+func TestMemoryEventBus_Unsubscribe(t *testing.T) {
+	a := assert.New(t)
+
+	bus := New()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	events, err := bus.Subscribe(ctx, "one")
+	a.NoError(err)
+
+	cancel()
+
+	select {
+	case _, ok := <-events:
+		a.False(ok)
+	case <-time.After(time.Second):
+		t.Fatal("channel was not closed after context cancellation")
+	}
+
+	// Publishing after the subscriber is gone must not block.
+	a.NoError(bus.Publish(context.Background(), handler.UploadEvent{
+		Type:   handler.UploadEventTerminate,
+		Upload: handler.FileInfo{ID: "one"},
+	}))
+}
+
+func TestMemoryEventBus_DropProgress(t *testing.T) {
+	a := assert.New(t)
+
+	bus := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := bus.Subscribe(ctx, "one")
+	a.NoError(err)
+
+	// Progress events exceeding the buffer are dropped instead of blocking.
+	for i := range subscriberBufferSize * 2 {
+		a.NoError(bus.Publish(context.Background(), handler.UploadEvent{
+			Type:   handler.UploadEventProgress,
+			Upload: handler.FileInfo{ID: "one", Offset: int64(i)},
+		}))
+	}
+
+	// Other events still fit into the buffer.
+	a.NoError(bus.Publish(context.Background(), handler.UploadEvent{
+		Type:   handler.UploadEventFinish,
+		Upload: handler.FileInfo{ID: "one"},
+	}))
+
+	for range progressBufferSize {
+		event := <-events
+		a.Equal(handler.UploadEventProgress, event.Type)
+	}
+
+	event := <-events
+	a.Equal(handler.UploadEventFinish, event.Type)
+}
+
+func TestMemoryEventBus_EndLaggingSubscription(t *testing.T) {
+	a := assert.New(t)
+
+	bus := New()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := bus.Subscribe(ctx, "one")
+	a.NoError(err)
+
+	// Publishing does not wait for the subscriber, even if its buffer is full.
+	for range subscriberBufferSize + 1 {
+		a.NoError(bus.Publish(context.Background(), handler.UploadEvent{
+			Type:   handler.UploadEventStop,
+			Upload: handler.FileInfo{ID: "one"},
+		}))
+	}
+
+	// The subscription is ended after the buffered events.
+	for range subscriberBufferSize {
+		event := <-events
+		a.Equal(handler.UploadEventStop, event.Type)
+	}
+
+	select {
+	case _, ok := <-events:
+		a.False(ok)
+	case <-time.After(time.Second):
+		t.Fatal("channel was not closed for lagging subscriber")
+	}
+}
@@ -0,0 +1,78 @@
+// Package memoryquotastore provides an in-memory quota store.
+//
+// MemoryQuotaStore keeps the quota reservations in memory. Therefore, they are
+// lost if the program exits and cannot be shared between multiple tusd instances.
+// It is mostly suited for single instances and testing purposes:
+//
+//	composer := handler.NewStoreComposer()
+//	memoryquotastore.New().UseIn(composer)
+//	config := handler.Config{
+//		StoreComposer:    composer,
+//		QuotaMetaDataKey: "tenant",
+//		QuotaLimit:       10 * 1024 * 1024 * 1024,
+//	}
+package memoryquotastore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tus/tusd/v2/internal/quotamap"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// MemoryQuotaStore keeps quota reservations in memory.
+type MemoryQuotaStore struct {
+	reservations quotamap.Map
+	mutex        sync.RWMutex
+}
+
+// New creates a new in-memory quota store.
+func New() *MemoryQuotaStore {
+	return &MemoryQuotaStore{
+		reservations: make(quotamap.Map),
+	}
+}
+
+// UseIn adds this quota store to the passed composer.
+func (store *MemoryQuotaStore) UseIn(composer *handler.StoreComposer) {
+	composer.UseQuotaStore(store)
+}
+
+func (store *MemoryQuotaStore) Reserve(ctx context.Context, key string, id string, size int64, limit int64) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.reservations.Reserve(key, id, size, limit)
+}
+
+func (store *MemoryQuotaStore) Use(ctx context.Context, id string, used int64) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.reservations.Use(id, used)
+	return nil
+}
+
+func (store *MemoryQuotaStore) Release(ctx context.Context, id string) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.reservations, id)
+	return nil
+}
+
+func (store *MemoryQuotaStore) GetReservation(ctx context.Context, id string) (handler.QuotaReservation, bool, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	reservation, ok := store.reservations[id]
+	return reservation, ok, nil
+}
+
+func (store *MemoryQuotaStore) GetUsage(ctx context.Context, key string) (handler.QuotaUsage, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+
+	return store.reservations.Usage(key), nil
+}
@@ -0,0 +1,59 @@
+package memoryquotastore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+var _ handler.QuotaStore = &MemoryQuotaStore{}
+
+func TestMemoryQuotaStore(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	store := New()
+
+	a.NoError(store.Reserve(ctx, "tenant", "one", 60, 100))
+	a.NoError(store.Reserve(ctx, "tenant", "two", 40, 100))
+	a.NoError(store.Reserve(ctx, "other", "three", 80, 100))
+
+	// The quota is exhausted, so a reservation for a new upload fails ...
+	a.Equal(handler.ErrQuotaExceeded, store.Reserve(ctx, "tenant", "four", 1, 100))
+	// ... but an existing upload may shrink its reservation.
+	a.NoError(store.Reserve(ctx, "tenant", "two", 30, 100))
+	a.Equal(handler.ErrQuotaExceeded, store.Reserve(ctx, "tenant", "two", 50, 100))
+
+	a.NoError(store.Use(ctx, "one", 20))
+	a.NoError(store.Use(ctx, "unknown", 20))
+
+	reservation, ok, err := store.GetReservation(ctx, "one")
+	a.NoError(err)
+	a.True(ok)
+	a.Equal(handler.QuotaReservation{
+		Key:   "tenant",
+		ID:    "one",
+		Size:  60,
+		Used:  20,
+		Limit: 100,
+	}, reservation)
+
+	usage, err := store.GetUsage(ctx, "tenant")
+	a.NoError(err)
+	a.Equal(handler.QuotaUsage{Reserved: 90, Used: 20}, usage)
+
+	a.NoError(store.Release(ctx, "one"))
+	_, ok, err = store.GetReservation(ctx, "one")
+	a.NoError(err)
+	a.False(ok)
+
+	a.NoError(store.Reserve(ctx, "tenant", "four", 70, 100))
+
+	// Without a limit, reservations are only tracked.
+	a.NoError(store.Reserve(ctx, "tenant", "five", 1000, 0))
+	usage, err = store.GetUsage(ctx, "tenant")
+	a.NoError(err)
+	a.Equal(handler.QuotaUsage{Reserved: 1100, Used: 0}, usage)
+}
@@ -0,0 +1,355 @@
+// Package memorystore provides a storage backend keeping uploads in memory.
+//
+// MemoryStore is a storage backend used as a handler.DataStore in handler.NewHandler.
+// The uploads' data and information are only kept as long as this object is kept in
+// reference and are lost if the program exits. It is mostly suited for tests and
+// ephemeral deployments, such as local development servers, which should not touch
+// the file system:
+//
+//	store := memorystore.New()
+//	store.MaxMemory = 100 * 1024 * 1024
+//	composer := handler.NewStoreComposer()
+//	store.UseIn(composer)
+//	memorylocker.New().UseIn(composer)
+//
+// For testing how clients and the handler deal with failing or slow storage,
+// faults can be injected using the FailAfterBytes and WriteDelay fields.
+package memorystore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tus/tusd/v2/internal/storageinfo"
+	"github.com/tus/tusd/v2/internal/uid"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+var (
+	// ErrMemoryLimitExceeded is returned if the store does not have enough memory
+	// left for the upload's data.
+	ErrMemoryLimitExceeded = handler.NewError("ERR_MEMORY_LIMIT_EXCEEDED", "memory store has no capacity left for upload", http.StatusInsufficientStorage)
+	// ErrInjectedFailure is returned from WriteChunk if a failure is injected using
+	// FailAfterBytes.
+	ErrInjectedFailure = errors.New("memorystore: injected write failure")
+)
+
+// See the handler.DataStore interface for documentation about the different
+// methods.
+type MemoryStore struct {
+	// MaxMemory is the maximum number of bytes of upload data that are kept in memory
+	// across all uploads. If zero, the memory is not limited.
+	MaxMemory int64
+
+	// If FailAfterBytes is larger than zero, WriteChunk stores at most this number
+	// of bytes per call and then fails with ErrInjectedFailure, simulating an
+	// interrupted request. The bytes stored before the failure are kept.
+	FailAfterBytes int64
+
+	// WriteDelay is the duration WriteChunk waits before storing the data,
+	// simulating slow storage. The wait is aborted if the context is cancelled.
+	WriteDelay time.Duration
+
+	mutex   sync.Mutex
+	uploads map[string]*memoryUpload
+	used    int64
+}
+
+type memoryUpload struct {
+	store   *MemoryStore
+	info    handler.FileInfo
+	data    []byte
+	modTime time.Time
+}
+
+// New creates a new in-memory storage backend without a memory limit.
+func New() *MemoryStore {
+	return &MemoryStore{
+		uploads: make(map[string]*memoryUpload),
+	}
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// all possible extension to it.
+func (store *MemoryStore) UseIn(composer *handler.StoreComposer) {
+	composer.UseCore(store)
+	composer.UseTerminater(store)
+	composer.UseConcater(store)
+	composer.UseLengthDeferrer(store)
+	composer.UseContentServer(store)
+	composer.UseMetadataUpdater(store)
+	composer.UseStateUpdater(store)
+	composer.UseConcurrentReader(store)
+}
+
+// Used returns the number of bytes of upload data currently kept in memory.
+func (store *MemoryStore) Used() int64 {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.used
+}
+
+func (store *MemoryStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	if info.ID == "" {
+		info.ID = uid.Uid()
+	}
+
+	info.Storage = storageinfo.Clone(info.Storage)
+	info.Storage["Type"] = "memorystore"
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	// An existing upload with the same ID is replaced.
+	if existing, ok := store.uploads[info.ID]; ok {
+		store.used -= int64(len(existing.data))
+		delete(store.uploads, info.ID)
+	}
+
+	if !info.SizeIsDeferred && !store.hasCapacity(info.Size) {
+		return nil, ErrMemoryLimitExceeded
+	}
+
+	upload := &memoryUpload{
+		store:   store,
+		info:    info,
+		modTime: time.Now(),
+	}
+	store.uploads[info.ID] = upload
+
+	return upload, nil
+}
+
+func (store *MemoryStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	upload, ok := store.uploads[id]
+	if !ok {
+		return nil, handler.ErrNotFound
+	}
+
+	return upload, nil
+}
+
+func (store *MemoryStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
+	return upload.(*memoryUpload)
+}
+
+func (store *MemoryStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
+	return upload.(*memoryUpload)
+}
+
+func (store *MemoryStore) AsConcatableUpload(upload handler.Upload) handler.ConcatableUpload {
+	return upload.(*memoryUpload)
+}
+
+func (store *MemoryStore) AsServableUpload(upload handler.Upload) handler.ServableUpload {
+	return upload.(*memoryUpload)
+}
+
+func (store *MemoryStore) AsMetadataUpdatableUpload(upload handler.Upload) handler.MetadataUpdatableUpload {
+	return upload.(*memoryUpload)
+}
+
+func (store *MemoryStore) AsStateUpdatableUpload(upload handler.Upload) handler.StateUpdatableUpload {
+	return upload.(*memoryUpload)
+}
+
+// SupportsConcurrentReads returns true, since GetReader only provides a snapshot of the
+// data received so far.
+func (store *MemoryStore) SupportsConcurrentReads() bool {
+	return true
+}
+
+// remaining returns the number of bytes that can still be stored, if MaxMemory is set.
+// It is negative if MaxMemory has been lowered below the memory in use.
+func (store *MemoryStore) remaining() int64 {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.MaxMemory - store.used
+}
+
+// hasCapacity returns whether n more bytes can be stored. The caller must hold the mutex.
+func (store *MemoryStore) hasCapacity(n int64) bool {
+	return store.MaxMemory <= 0 || store.used+n <= store.MaxMemory
+}
+
+func (upload *memoryUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	store := upload.store
+
+	if store.WriteDelay > 0 {
+		select {
+		case <-time.After(store.WriteDelay):
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	// Read the data before acquiring the mutex, so other uploads are not blocked
+	// while the request body is received. If the memory is limited, at most one
+	// byte more than fits into the remaining memory is read, which is enough to
+	// detect that the limit is exceeded.
+	limit := int64(-1)
+	if store.MaxMemory > 0 {
+		limit = max(store.remaining(), 0) + 1
+	}
+
+	var buf []byte
+	var readErr error
+	injectFailure := false
+	if store.FailAfterBytes > 0 && (limit < 0 || store.FailAfterBytes < limit) {
+		buf, readErr = io.ReadAll(io.LimitReader(src, store.FailAfterBytes))
+		if readErr == nil && int64(len(buf)) == store.FailAfterBytes {
+			// Only fail if the request body contains more data.
+			_, err := io.ReadFull(src, make([]byte, 1))
+			injectFailure = err != io.EOF
+		}
+	} else if limit >= 0 {
+		buf, readErr = io.ReadAll(io.LimitReader(src, limit))
+	} else {
+		buf, readErr = io.ReadAll(src)
+	}
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.uploads[upload.info.ID] != upload {
+		return 0, handler.ErrNotFound
+	}
+
+	var err error
+	if !store.hasCapacity(int64(len(buf))) {
+		// Keep as much data as fits into the remaining memory. MaxMemory might have
+		// been lowered below the memory in use, so nothing fits anymore.
+		buf = buf[:max(store.MaxMemory-store.used, 0)]
+		err = ErrMemoryLimitExceeded
+	}
+
+	upload.data = append(upload.data, buf...)
+	upload.info.Offset += int64(len(buf))
+	upload.modTime = time.Now()
+	store.used += int64(len(buf))
+
+	if err != nil {
+		return int64(len(buf)), err
+	}
+	if readErr != nil {
+		return int64(len(buf)), readErr
+	}
+
+	if injectFailure {
+		return int64(len(buf)), ErrInjectedFailure
+	}
+
+	return int64(len(buf)), nil
+}
+
+func (upload *memoryUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
+	upload.store.mutex.Lock()
+	defer upload.store.mutex.Unlock()
+
+	info := upload.info
+	info.MetaData = maps.Clone(info.MetaData)
+	info.Storage = maps.Clone(info.Storage)
+	return info, nil
+}
+
+func (upload *memoryUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(upload.snapshot())), nil
+}
+
+// snapshot returns the data received so far. Data is only ever appended, so the
+// returned slice is not modified by later writes.
+func (upload *memoryUpload) snapshot() []byte {
+	upload.store.mutex.Lock()
+	defer upload.store.mutex.Unlock()
+
+	return upload.data[:len(upload.data):len(upload.data)]
+}
+
+func (upload *memoryUpload) FinishUpload(ctx context.Context) error {
+	return nil
+}
+
+func (upload *memoryUpload) Terminate(ctx context.Context) error {
+	store := upload.store
+
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if store.uploads[upload.info.ID] != upload {
+		return handler.ErrNotFound
+	}
+
+	delete(store.uploads, upload.info.ID)
+	store.used -= int64(len(upload.data))
+	upload.data = nil
+
+	return nil
+}
+
+func (upload *memoryUpload) DeclareLength(ctx context.Context, length int64) error {
+	upload.store.mutex.Lock()
+	defer upload.store.mutex.Unlock()
+
+	upload.info.Size = length
+	upload.info.SizeIsDeferred = false
+	return nil
+}
+
+func (upload *memoryUpload) ConcatUploads(ctx context.Context, partialUploads []handler.Upload) error {
+	// Take snapshots first, since the mutex is also acquired for each partial upload.
+	var data []byte
+	for _, partialUpload := range partialUploads {
+		data = append(data, partialUpload.(*memoryUpload).snapshot()...)
+	}
+
+	store := upload.store
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	if !store.hasCapacity(int64(len(data))) {
+		return ErrMemoryLimitExceeded
+	}
+
+	upload.data = append(upload.data, data...)
+	upload.info.Offset += int64(len(data))
+	upload.modTime = time.Now()
+	store.used += int64(len(data))
+
+	return nil
+}
+
+func (upload *memoryUpload) UpdateMetaData(ctx context.Context, metaData handler.MetaData) error {
+	upload.store.mutex.Lock()
+	defer upload.store.mutex.Unlock()
+
+	upload.info.MetaData = maps.Clone(metaData)
+	return nil
+}
+
+func (upload *memoryUpload) UpdateState(ctx context.Context, state handler.UploadState) error {
+	upload.store.mutex.Lock()
+	defer upload.store.mutex.Unlock()
+
+	upload.info.State = &state
+	return nil
+}
+
+func (upload *memoryUpload) ServeContent(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	upload.store.mutex.Lock()
+	modTime := upload.modTime
+	upload.store.mutex.Unlock()
+
+	http.ServeContent(w, r, "", modTime, bytes.NewReader(upload.snapshot()))
+	return nil
+}
@@ -0,0 +1,269 @@
+package memorystore
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Test interface implementations
+var _ handler.DataStore = &MemoryStore{}
+var _ handler.TerminaterDataStore = &MemoryStore{}
+var _ handler.ConcaterDataStore = &MemoryStore{}
+var _ handler.LengthDeferrerDataStore = &MemoryStore{}
+var _ handler.ContentServerDataStore = &MemoryStore{}
+var _ handler.MetadataUpdaterDataStore = &MemoryStore{}
+var _ handler.StateUpdaterDataStore = &MemoryStore{}
+var _ handler.ConcurrentReaderDataStore = &MemoryStore{}
+
+func TestMemoryStore(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store := New()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size: 42,
+		MetaData: map[string]string{
+			"hello": "world",
+		},
+	})
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(42, info.Size)
+	a.EqualValues(0, info.Offset)
+	a.Equal(handler.MetaData{"hello": "world"}, info.MetaData)
+	a.Equal(map[string]string{"Type": "memorystore"}, info.Storage)
+
+	n, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.NoError(err)
+	a.EqualValues(11, n)
+	a.EqualValues(11, store.Used())
+
+	// The upload can be fetched again using its ID.
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(11, info.Offset)
+
+	reader, err := upload.GetReader(ctx)
+	a.NoError(err)
+	content, err := io.ReadAll(reader)
+	a.NoError(err)
+	a.Equal("hello world", string(content))
+
+	err = store.AsMetadataUpdatableUpload(upload).UpdateMetaData(ctx, handler.MetaData{"foo": "bar"})
+	a.NoError(err)
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal(handler.MetaData{"foo": "bar"}, info.MetaData)
+
+	err = store.AsTerminatableUpload(upload).Terminate(ctx)
+	a.NoError(err)
+	a.EqualValues(0, store.Used())
+
+	_, err = store.GetUpload(ctx, info.ID)
+	a.Equal(handler.ErrNotFound, err)
+}
+
+func TestDeclareLength(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store := New()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		SizeIsDeferred: true,
+	})
+	a.NoError(err)
+
+	err = store.AsLengthDeclarableUpload(upload).DeclareLength(ctx, 100)
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(100, info.Size)
+	a.False(info.SizeIsDeferred)
+}
+
+func TestConcatUploads(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store := New()
+
+	var partialUploads []handler.Upload
+	for _, content := range []string{"abc", "def", "ghi"} {
+		upload, err := store.NewUpload(ctx, handler.FileInfo{
+			Size:      3,
+			IsPartial: true,
+		})
+		a.NoError(err)
+
+		_, err = upload.WriteChunk(ctx, 0, strings.NewReader(content))
+		a.NoError(err)
+
+		partialUploads = append(partialUploads, upload)
+	}
+
+	finalUpload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size:    9,
+		IsFinal: true,
+	})
+	a.NoError(err)
+
+	err = store.AsConcatableUpload(finalUpload).ConcatUploads(ctx, partialUploads)
+	a.NoError(err)
+
+	info, err := finalUpload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(9, info.Offset)
+
+	reader, err := finalUpload.GetReader(ctx)
+	a.NoError(err)
+	content, err := io.ReadAll(reader)
+	a.NoError(err)
+	a.Equal("abcdefghi", string(content))
+	a.EqualValues(18, store.Used())
+}
+
+func TestMaxMemory(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store := New()
+	store.MaxMemory = 10
+
+	_, err := store.NewUpload(ctx, handler.FileInfo{
+		Size: 11,
+	})
+	a.Equal(ErrMemoryLimitExceeded, err)
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		SizeIsDeferred: true,
+	})
+	a.NoError(err)
+
+	// Only the data fitting into the remaining memory is kept and the rest of
+	// the request body is not read.
+	src := strings.NewReader("hello world, hello world")
+	n, err := upload.WriteChunk(ctx, 0, src)
+	a.Equal(ErrMemoryLimitExceeded, err)
+	a.EqualValues(10, n)
+	a.EqualValues(10, store.Used())
+	a.Equal(13, src.Len())
+
+	// Lowering the limit below the memory in use rejects further data.
+	store.MaxMemory = 5
+	n, err = upload.WriteChunk(ctx, 10, strings.NewReader("hello"))
+	a.Equal(ErrMemoryLimitExceeded, err)
+	a.EqualValues(0, n)
+	a.EqualValues(10, store.Used())
+	store.MaxMemory = 10
+
+	// Memory is released once the upload is terminated.
+	err = store.AsTerminatableUpload(upload).Terminate(ctx)
+	a.NoError(err)
+
+	_, err = store.NewUpload(ctx, handler.FileInfo{
+		Size: 10,
+	})
+	a.NoError(err)
+}
+
+func TestFailAfterBytes(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store := New()
+	store.FailAfterBytes = 5
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size: 11,
+	})
+	a.NoError(err)
+
+	n, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.Equal(ErrInjectedFailure, err)
+	a.EqualValues(5, n)
+
+	// Requests not exceeding the limit succeed.
+	n, err = upload.WriteChunk(ctx, 5, strings.NewReader(" worl"))
+	a.NoError(err)
+	a.EqualValues(5, n)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(10, info.Offset)
+}
+
+func TestWriteDelay(t *testing.T) {
+	a := assert.New(t)
+	store := New()
+	store.WriteDelay = time.Minute
+
+	upload, err := store.NewUpload(context.Background(), handler.FileInfo{
+		Size: 11,
+	})
+	a.NoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	n, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.ErrorIs(err, context.DeadlineExceeded)
+	a.EqualValues(0, n)
+}
+
+func TestHandler(t *testing.T) {
+	a := assert.New(t)
+
+	composer := handler.NewStoreComposer()
+	New().UseIn(composer)
+
+	tusHandler, err := handler.NewHandler(handler.Config{
+		BasePath:      "/files/",
+		StoreComposer: composer,
+	})
+	a.NoError(err)
+
+	server := httptest.NewServer(http.StripPrefix("/files/", tusHandler))
+	defer server.Close()
+
+	req, _ := http.NewRequest("POST", server.URL+"/files/", strings.NewReader("hello"))
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Upload-Length", "11")
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	res, err := http.DefaultClient.Do(req)
+	a.NoError(err)
+	res.Body.Close()
+	a.Equal(http.StatusCreated, res.StatusCode)
+	a.Equal("5", res.Header.Get("Upload-Offset"))
+
+	location := res.Header.Get("Location")
+
+	req, _ = http.NewRequest("PATCH", location, strings.NewReader(" world"))
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Upload-Offset", "5")
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	res, err = http.DefaultClient.Do(req)
+	a.NoError(err)
+	res.Body.Close()
+	a.Equal(http.StatusNoContent, res.StatusCode)
+
+	req, _ = http.NewRequest("GET", location, nil)
+	req.Header.Set("Range", "bytes=6-")
+	res, err = http.DefaultClient.Do(req)
+	a.NoError(err)
+	content, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	a.NoError(err)
+	a.Equal(http.StatusPartialContent, res.StatusCode)
+	a.Equal("world", string(content))
+}
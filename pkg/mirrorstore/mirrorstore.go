@@ -0,0 +1,626 @@
+// Package mirrorstore provides a wrapper, which replicates uploads from a primary to a
+// secondary storage backend.
+//
+// MirrorStore combines two data stores, which have been set up in separate composers. All
+// writes go to the primary data store. Once an upload is finished, its data is copied to the
+// secondary data store, either synchronously before the request completes or asynchronously
+// in the background:
+//
+//	primary := handler.NewStoreComposer()
+//	filestore.New("/mnt/nvme/uploads").UseIn(primary)
+//
+//	secondary := handler.NewStoreComposer()
+//	s3store.New("backup-bucket", s3Client).UseIn(secondary)
+//
+//	store := mirrorstore.New(primary, secondary)
+//	store.Async = true
+//	store.RegisterMetrics(prometheus.DefaultRegisterer)
+//
+//	composer := handler.NewStoreComposer()
+//	store.UseIn(composer)
+//	filelocker.New("/mnt/nvme/uploads").UseIn(composer)
+//
+// When an upload is created, an empty upload is created in the secondary data store as
+// well and its ID is used for the upload in the primary data store. If an upload cannot be
+// read from the primary data store anymore, finished uploads are served from the secondary
+// data store instead. Uploads served from the secondary data store cannot be modified.
+// Falling back only works if the primary data store uses the upload ID passed to
+// NewUpload, which all data stores in tusd except s3store do.
+//
+// If a synchronous replication fails, FinishUpload returns an error. Since the handler
+// does not call FinishUpload again for an upload, which has received all data, a marker is
+// saved in the primary upload's FileInfo.State until the replication has succeeded and the
+// replication is retried when the upload is fetched the next time, e.g. when the client
+// retries its last PATCH request. Until then, fetching the upload fails. This requires the
+// primary data store to implement handler.StateUpdaterDataStore.
+//
+// Failed asynchronous replications are logged and counted, but not retried. Replications,
+// which are still pending when the process exits, are lost. Use Wait to let them complete.
+package mirrorstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/tus/tusd/v2/internal/storageinfo"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"golang.org/x/exp/slog"
+)
+
+// StorageKeySecondaryID is the key of the upload's ID in the secondary data store in
+// handler.FileInfo.Storage.
+const StorageKeySecondaryID = "MirrorSecondaryID"
+
+// StateKeyReplicationPending is the key in handler.UploadState.Storage, which marks an
+// upload whose synchronous replication has not succeeded yet.
+const StateKeyReplicationPending = "MirrorReplicationPending"
+
+// ErrPrimaryUnavailable is returned when modifying an upload, which is only available from
+// the secondary data store.
+var ErrPrimaryUnavailable = handler.NewError("ERR_PRIMARY_STORAGE_UNAVAILABLE", "upload is only available from secondary storage and cannot be modified", http.StatusServiceUnavailable)
+
+// See the handler.DataStore interface for documentation about the different
+// methods.
+type MirrorStore struct {
+	// If Async is true, finished uploads are replicated to the secondary data store in the
+	// background. Otherwise, FinishUpload only returns once the replication is complete and
+	// fails if the replication fails.
+	Async bool
+	// Logger is used for reporting failed asynchronous replications. Defaults to slog.Default().
+	Logger *slog.Logger
+
+	primary   *handler.StoreComposer
+	secondary *handler.StoreComposer
+	pending   sync.WaitGroup
+
+	// replicationLagMetric holds the prometheus instance for storing the time between
+	// finishing an upload and completing its replication.
+	replicationLagMetric prometheus.Histogram
+	// pendingReplicationsMetric holds the prometheus instance for storing the number of
+	// replications in progress.
+	pendingReplicationsMetric prometheus.Gauge
+	// replicationFailuresMetric holds the prometheus instance for counting failed replications.
+	replicationFailuresMetric prometheus.Counter
+}
+
+// New creates a new store, which writes to the data store configured in the primary
+// composer and replicates finished uploads to the data store in the secondary composer.
+func New(primary *handler.StoreComposer, secondary *handler.StoreComposer) *MirrorStore {
+	return &MirrorStore{
+		Logger:    slog.Default(),
+		primary:   primary,
+		secondary: secondary,
+		replicationLagMetric: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "tusd_mirror_replication_lag_seconds",
+			Help:    "Time between finishing an upload and completing its replication to the secondary storage in seconds",
+			Buckets: prometheus.ExponentialBuckets(0.01, 4, 10),
+		}),
+		pendingReplicationsMetric: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: "tusd_mirror_replications_pending",
+			Help: "Number of uploads, whose replication to the secondary storage is in progress",
+		}),
+		replicationFailuresMetric: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "tusd_mirror_replication_failures_total",
+			Help: "Total number of failed replications to the secondary storage",
+		}),
+	}
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// all extensions, which are supported by the wrapped data stores.
+func (store *MirrorStore) UseIn(composer *handler.StoreComposer) {
+	composer.UseCore(store)
+	if store.primary.UsesTerminater {
+		composer.UseTerminater(store)
+	}
+	if store.primary.UsesConcater {
+		composer.UseConcater(store)
+	}
+	if store.primary.UsesLengthDeferrer && store.secondary.UsesLengthDeferrer {
+		composer.UseLengthDeferrer(store)
+	}
+	if store.primary.UsesContentServer && store.secondary.UsesContentServer {
+		composer.UseContentServer(store)
+	}
+	if store.primary.UsesMetadataUpdater {
+		composer.UseMetadataUpdater(store)
+	}
+	if store.primary.UsesStateUpdater {
+		composer.UseStateUpdater(store)
+	}
+}
+
+func (store *MirrorStore) RegisterMetrics(registry prometheus.Registerer) {
+	registry.MustRegister(store.replicationLagMetric)
+	registry.MustRegister(store.pendingReplicationsMetric)
+	registry.MustRegister(store.replicationFailuresMetric)
+}
+
+// Wait blocks until all pending asynchronous replications have completed.
+func (store *MirrorStore) Wait() {
+	store.pending.Wait()
+}
+
+func (store *MirrorStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	// The storage information is meant for the primary data store, e.g. if it has been
+	// changed by the pre-create hook.
+	secondaryInfo := info
+	secondaryInfo.Storage = nil
+
+	secondary, err := store.secondary.Core.NewUpload(ctx, secondaryInfo)
+	if err != nil {
+		return nil, fmt.Errorf("mirrorstore: unable to create upload in secondary store: %w", err)
+	}
+
+	secondaryInfo, err = secondary.GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	info.ID = secondaryInfo.ID
+	info.Storage = storageinfo.Clone(info.Storage)
+	info.Storage[StorageKeySecondaryID] = secondaryInfo.ID
+
+	primary, err := store.primary.Core.NewUpload(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mirrorUpload{
+		store:     store,
+		id:        secondaryInfo.ID,
+		primary:   primary,
+		secondary: secondary,
+	}, nil
+}
+
+func (store *MirrorStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	upload := &mirrorUpload{
+		store: store,
+		id:    id,
+	}
+
+	primary, err := store.primary.Core.GetUpload(ctx, id)
+	if err != nil {
+		if fallbackErr := upload.fallback(ctx); fallbackErr != nil {
+			return nil, err
+		}
+		return upload, nil
+	}
+
+	upload.primary = primary
+	if err := upload.retryReplication(ctx); err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+func (store *MirrorStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
+	return upload.(*mirrorUpload)
+}
+
+func (store *MirrorStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
+	return upload.(*mirrorUpload)
+}
+
+func (store *MirrorStore) AsConcatableUpload(upload handler.Upload) handler.ConcatableUpload {
+	return upload.(*mirrorUpload)
+}
+
+func (store *MirrorStore) AsServableUpload(upload handler.Upload) handler.ServableUpload {
+	return upload.(*mirrorUpload)
+}
+
+func (store *MirrorStore) AsMetadataUpdatableUpload(upload handler.Upload) handler.MetadataUpdatableUpload {
+	return upload.(*mirrorUpload)
+}
+
+func (store *MirrorStore) AsStateUpdatableUpload(upload handler.Upload) handler.StateUpdatableUpload {
+	return upload.(*mirrorUpload)
+}
+
+// finish replicates the upload after it has been finished in the primary data store.
+func (store *MirrorStore) finish(ctx context.Context, primary handler.Upload) error {
+	finishedAt := time.Now()
+
+	if !store.Async {
+		if err := store.setReplicationPending(ctx, primary, true); err != nil {
+			return err
+		}
+		if err := store.replicate(ctx, primary, finishedAt); err != nil {
+			return err
+		}
+		return store.setReplicationPending(ctx, primary, false)
+	}
+
+	store.pending.Add(1)
+	go func() {
+		defer store.pending.Done()
+
+		// The replication must not be cancelled once the request is completed.
+		if err := store.replicate(context.WithoutCancel(ctx), primary, finishedAt); err != nil {
+			store.Logger.Error("MirrorReplicationError", "error", err)
+		}
+	}()
+
+	return nil
+}
+
+// setReplicationPending saves or removes the marker for a pending replication in the
+// primary upload's state.
+func (store *MirrorStore) setReplicationPending(ctx context.Context, primary handler.Upload, pending bool) error {
+	if !store.primary.UsesStateUpdater {
+		return nil
+	}
+
+	info, err := primary.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+	if replicationPending(info) == pending {
+		return nil
+	}
+
+	var state handler.UploadState
+	if info.State != nil {
+		state = *info.State
+	}
+	if pending {
+		state.Storage = storageinfo.Clone(state.Storage)
+		state.Storage[StateKeyReplicationPending] = "true"
+	} else {
+		state = withoutReplicationMarker(state)
+	}
+
+	return store.primary.StateUpdater.AsStateUpdatableUpload(primary).UpdateState(ctx, state)
+}
+
+// replicate copies the upload's data from the primary to the secondary data store. If
+// the secondary upload already contains some data, e.g. from a previous attempt, only the
+// remaining data is copied.
+func (store *MirrorStore) replicate(ctx context.Context, primary handler.Upload, finishedAt time.Time) (err error) {
+	store.pendingReplicationsMetric.Inc()
+	defer func() {
+		store.pendingReplicationsMetric.Dec()
+		if err != nil {
+			store.replicationFailuresMetric.Inc()
+		} else {
+			store.replicationLagMetric.Observe(time.Since(finishedAt).Seconds())
+		}
+	}()
+
+	info, err := primary.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	secondaryID, ok := info.Storage[StorageKeySecondaryID]
+	if !ok {
+		return fmt.Errorf("mirrorstore: upload %s has no secondary upload", info.ID)
+	}
+
+	secondary, err := store.secondary.Core.GetUpload(ctx, secondaryID)
+	if err != nil {
+		return err
+	}
+
+	secondaryInfo, err := secondary.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	if secondaryInfo.SizeIsDeferred {
+		if !store.secondary.UsesLengthDeferrer {
+			return fmt.Errorf("mirrorstore: secondary store cannot declare length of upload %s", info.ID)
+		}
+
+		if err := store.secondary.LengthDeferrer.AsLengthDeclarableUpload(secondary).DeclareLength(ctx, info.Size); err != nil {
+			return err
+		}
+	}
+
+	if secondaryInfo.Offset < info.Offset {
+		reader, err := primary.GetReader(ctx)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		if _, err := io.CopyN(io.Discard, reader, secondaryInfo.Offset); err != nil {
+			return err
+		}
+
+		remaining := info.Offset - secondaryInfo.Offset
+		n, err := secondary.WriteChunk(ctx, secondaryInfo.Offset, io.LimitReader(reader, remaining))
+		if err != nil {
+			return err
+		}
+		if n != remaining {
+			return fmt.Errorf("mirrorstore: only %d of %d bytes of upload %s replicated", n, remaining, info.ID)
+		}
+	}
+
+	if info.State != nil && store.secondary.UsesStateUpdater {
+		if err := store.secondary.StateUpdater.AsStateUpdatableUpload(secondary).UpdateState(ctx, withoutReplicationMarker(*info.State)); err != nil {
+			return err
+		}
+	}
+
+	return secondary.FinishUpload(ctx)
+}
+
+type mirrorUpload struct {
+	store *MirrorStore
+	id    string
+
+	// primary is nil if the upload is served from the secondary data store.
+	primary handler.Upload
+	// secondary is only set when the upload is served from the secondary data store or
+	// has just been created.
+	secondary handler.Upload
+}
+
+// retryReplication replicates the upload, if its synchronous replication failed before.
+func (upload *mirrorUpload) retryReplication(ctx context.Context) error {
+	store := upload.store
+	if !store.primary.UsesStateUpdater {
+		return nil
+	}
+
+	// Errors are returned once the caller requests the information, which falls back
+	// to the secondary data store if possible.
+	info, err := upload.primary.GetInfo(ctx)
+	if err != nil || !replicationPending(info) {
+		return nil
+	}
+
+	if err := store.replicate(ctx, upload.primary, time.Now()); err != nil {
+		return err
+	}
+	return store.setReplicationPending(ctx, upload.primary, false)
+}
+
+// fallback switches to the upload in the secondary data store. This is only possible
+// if the upload has been fully replicated.
+func (upload *mirrorUpload) fallback(ctx context.Context) error {
+	secondary, err := upload.store.secondary.Core.GetUpload(ctx, upload.id)
+	if err != nil {
+		return err
+	}
+
+	info, err := secondary.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	if info.SizeIsDeferred || info.Offset != info.Size {
+		return errors.New("mirrorstore: upload is not replicated yet")
+	}
+
+	upload.primary = nil
+	upload.secondary = secondary
+	return nil
+}
+
+func (upload *mirrorUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	if upload.primary == nil {
+		return 0, ErrPrimaryUnavailable
+	}
+
+	return upload.primary.WriteChunk(ctx, offset, src)
+}
+
+func (upload *mirrorUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
+	if upload.primary != nil {
+		info, err := upload.primary.GetInfo(ctx)
+		if err == nil && info.State != nil {
+			state := withoutReplicationMarker(*info.State)
+			info.State = &state
+		}
+		if err == nil || upload.fallback(ctx) != nil {
+			return info, err
+		}
+	}
+
+	info, err := upload.secondary.GetInfo(ctx)
+	info.ID = upload.id
+	return info, err
+}
+
+func (upload *mirrorUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	if upload.primary != nil {
+		reader, err := upload.primary.GetReader(ctx)
+		if err == nil || upload.fallback(ctx) != nil {
+			return reader, err
+		}
+	}
+
+	return upload.secondary.GetReader(ctx)
+}
+
+func (upload *mirrorUpload) FinishUpload(ctx context.Context) error {
+	if upload.primary == nil {
+		return ErrPrimaryUnavailable
+	}
+
+	if err := upload.primary.FinishUpload(ctx); err != nil {
+		return err
+	}
+
+	return upload.store.finish(ctx, upload.primary)
+}
+
+func (upload *mirrorUpload) Terminate(ctx context.Context) error {
+	store := upload.store
+
+	secondaryID := upload.id
+	if upload.primary != nil {
+		info, err := upload.primary.GetInfo(ctx)
+		if err != nil {
+			return err
+		}
+		if id, ok := info.Storage[StorageKeySecondaryID]; ok {
+			secondaryID = id
+		}
+
+		if err := store.primary.Terminater.AsTerminatableUpload(upload.primary).Terminate(ctx); err != nil {
+			return err
+		}
+	}
+
+	if !store.secondary.UsesTerminater {
+		return nil
+	}
+
+	secondary, err := store.secondary.Core.GetUpload(ctx, secondaryID)
+	if err == nil {
+		err = store.secondary.Terminater.AsTerminatableUpload(secondary).Terminate(ctx)
+	}
+	if err != nil && !isNotFound(err) {
+		return fmt.Errorf("mirrorstore: unable to terminate upload in secondary store: %w", err)
+	}
+
+	return nil
+}
+
+func (upload *mirrorUpload) DeclareLength(ctx context.Context, length int64) error {
+	if upload.primary == nil {
+		return ErrPrimaryUnavailable
+	}
+
+	return upload.store.primary.LengthDeferrer.AsLengthDeclarableUpload(upload.primary).DeclareLength(ctx, length)
+}
+
+func (upload *mirrorUpload) ConcatUploads(ctx context.Context, partialUploads []handler.Upload) error {
+	if upload.primary == nil {
+		return ErrPrimaryUnavailable
+	}
+
+	primaryUploads := make([]handler.Upload, len(partialUploads))
+	for i, partialUpload := range partialUploads {
+		primaryUploads[i] = partialUpload.(*mirrorUpload).primary
+		if primaryUploads[i] == nil {
+			return ErrPrimaryUnavailable
+		}
+	}
+
+	if err := upload.store.primary.Concater.AsConcatableUpload(upload.primary).ConcatUploads(ctx, primaryUploads); err != nil {
+		return err
+	}
+
+	// The handler does not finish concatenated uploads, so they are replicated here.
+	return upload.store.finish(ctx, upload.primary)
+}
+
+func (upload *mirrorUpload) ServeContent(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if upload.primary != nil {
+		return upload.store.primary.ContentServer.AsServableUpload(upload.primary).ServeContent(ctx, w, r)
+	}
+
+	return upload.store.secondary.ContentServer.AsServableUpload(upload.secondary).ServeContent(ctx, w, r)
+}
+
+func (upload *mirrorUpload) UpdateMetaData(ctx context.Context, metaData handler.MetaData) error {
+	if upload.primary == nil {
+		return ErrPrimaryUnavailable
+	}
+
+	store := upload.store
+	if err := store.primary.MetadataUpdater.AsMetadataUpdatableUpload(upload.primary).UpdateMetaData(ctx, metaData); err != nil {
+		return err
+	}
+
+	if !store.secondary.UsesMetadataUpdater {
+		return nil
+	}
+
+	info, err := upload.primary.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	secondary, err := store.secondary.Core.GetUpload(ctx, info.Storage[StorageKeySecondaryID])
+	if err == nil {
+		err = store.secondary.MetadataUpdater.AsMetadataUpdatableUpload(secondary).UpdateMetaData(ctx, metaData)
+	}
+	if err != nil {
+		return fmt.Errorf("mirrorstore: unable to update meta data in secondary store: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateState saves the state in the primary data store. Once the upload is finished,
+// the state is also saved in the secondary data store, so that it is available when the
+// upload is served from there.
+func (upload *mirrorUpload) UpdateState(ctx context.Context, state handler.UploadState) error {
+	if upload.primary == nil {
+		return ErrPrimaryUnavailable
+	}
+
+	store := upload.store
+	info, err := upload.primary.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	// The marker for a pending replication is hidden from the caller and must be preserved.
+	primaryState := withoutReplicationMarker(state)
+	if replicationPending(info) {
+		primaryState.Storage = storageinfo.Clone(primaryState.Storage)
+		primaryState.Storage[StateKeyReplicationPending] = "true"
+	}
+	if err := store.primary.StateUpdater.AsStateUpdatableUpload(upload.primary).UpdateState(ctx, primaryState); err != nil {
+		return err
+	}
+
+	if !store.secondary.UsesStateUpdater {
+		return nil
+	}
+
+	if info.SizeIsDeferred || info.Offset < info.Size {
+		return nil
+	}
+
+	secondary, err := store.secondary.Core.GetUpload(ctx, info.Storage[StorageKeySecondaryID])
+	if err == nil {
+		err = store.secondary.StateUpdater.AsStateUpdatableUpload(secondary).UpdateState(ctx, withoutReplicationMarker(state))
+	}
+	if err != nil {
+		return fmt.Errorf("mirrorstore: unable to update state in secondary store: %w", err)
+	}
+
+	return nil
+}
+
+// replicationPending returns whether the upload's synchronous replication has not
+// succeeded yet.
+func replicationPending(info handler.FileInfo) bool {
+	return info.State != nil && info.State.Storage[StateKeyReplicationPending] != ""
+}
+
+// withoutReplicationMarker returns the state without the marker for a pending replication.
+func withoutReplicationMarker(state handler.UploadState) handler.UploadState {
+	if _, ok := state.Storage[StateKeyReplicationPending]; !ok {
+		return state
+	}
+
+	state.Storage = maps.Clone(state.Storage)
+	delete(state.Storage, StateKeyReplicationPending)
+	if len(state.Storage) == 0 {
+		state.Storage = nil
+	}
+	return state
+}
+
+func isNotFound(err error) bool {
+	var tusErr handler.Error
+	return errors.As(err, &tusErr) && tusErr.ErrorCode == handler.ErrNotFound.ErrorCode
+}
@@ -0,0 +1,262 @@
+package mirrorstore
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/memorystore"
+)
+
+// Test interface implementations
+var _ handler.DataStore = &MirrorStore{}
+var _ handler.TerminaterDataStore = &MirrorStore{}
+var _ handler.ConcaterDataStore = &MirrorStore{}
+var _ handler.LengthDeferrerDataStore = &MirrorStore{}
+var _ handler.ContentServerDataStore = &MirrorStore{}
+var _ handler.MetadataUpdaterDataStore = &MirrorStore{}
+var _ handler.StateUpdaterDataStore = &MirrorStore{}
+
+func newStore() (*MirrorStore, *memorystore.MemoryStore, *memorystore.MemoryStore) {
+	primaryStore := memorystore.New()
+	primary := handler.NewStoreComposer()
+	primaryStore.UseIn(primary)
+
+	secondaryStore := memorystore.New()
+	secondary := handler.NewStoreComposer()
+	secondaryStore.UseIn(secondary)
+
+	return New(primary, secondary), primaryStore, secondaryStore
+}
+
+func readUpload(t *testing.T, upload handler.Upload) string {
+	reader, err := upload.GetReader(context.Background())
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func writeUpload(t *testing.T, store handler.DataStore, info handler.FileInfo, content string) handler.Upload {
+	ctx := context.Background()
+
+	upload, err := store.NewUpload(ctx, info)
+	assert.NoError(t, err)
+
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader(content))
+	assert.NoError(t, err)
+
+	assert.NoError(t, upload.FinishUpload(ctx))
+	return upload
+}
+
+func TestSyncReplication(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, primaryStore, secondaryStore := newStore()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		ID:       "abc",
+		Size:     11,
+		MetaData: handler.MetaData{"foo": "bar"},
+	})
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal("abc", info.ID)
+	a.Equal("abc", info.Storage[StorageKeySecondaryID])
+
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.NoError(err)
+
+	// Data is only written to the primary store until the upload is finished.
+	a.EqualValues(11, primaryStore.Used())
+	a.EqualValues(0, secondaryStore.Used())
+
+	a.NoError(upload.FinishUpload(ctx))
+	a.EqualValues(11, secondaryStore.Used())
+
+	secondary, err := secondaryStore.GetUpload(ctx, "abc")
+	a.NoError(err)
+	a.Equal("hello world", readUpload(t, secondary))
+
+	secondaryInfo, err := secondary.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal(handler.MetaData{"foo": "bar"}, secondaryInfo.MetaData)
+
+	a.Equal(1, testutil.CollectAndCount(store.replicationLagMetric))
+	a.Equal(float64(0), testutil.ToFloat64(store.replicationFailuresMetric))
+
+	// Meta data updates are applied to both stores.
+	err = store.AsMetadataUpdatableUpload(upload).UpdateMetaData(ctx, handler.MetaData{"foo": "baz"})
+	a.NoError(err)
+	secondaryInfo, err = secondary.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal(handler.MetaData{"foo": "baz"}, secondaryInfo.MetaData)
+
+	// Termination removes the upload from both stores.
+	err = store.AsTerminatableUpload(upload).Terminate(ctx)
+	a.NoError(err)
+	a.EqualValues(0, primaryStore.Used())
+	a.EqualValues(0, secondaryStore.Used())
+
+	_, err = store.GetUpload(ctx, "abc")
+	a.Equal(handler.ErrNotFound, err)
+}
+
+func TestAsyncReplication(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _, secondaryStore := newStore()
+	store.Async = true
+
+	writeUpload(t, store, handler.FileInfo{ID: "abc", Size: 11}, "hello world")
+	store.Wait()
+
+	secondary, err := secondaryStore.GetUpload(ctx, "abc")
+	a.NoError(err)
+	a.Equal("hello world", readUpload(t, secondary))
+	a.Equal(float64(0), testutil.ToFloat64(store.pendingReplicationsMetric))
+}
+
+func TestFailedReplication(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, primaryStore, secondaryStore := newStore()
+	secondaryStore.FailAfterBytes = 5
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{ID: "abc", Size: 11})
+	a.NoError(err)
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.NoError(err)
+
+	a.Equal(memorystore.ErrInjectedFailure, upload.FinishUpload(ctx))
+	a.Equal(float64(1), testutil.ToFloat64(store.replicationFailuresMetric))
+
+	// Updating the state preserves the marker for the pending replication.
+	a.NoError(store.AsStateUpdatableUpload(upload).UpdateState(ctx, handler.UploadState{ContentType: "text/plain"}))
+	primary, err := primaryStore.GetUpload(ctx, "abc")
+	a.NoError(err)
+	primaryInfo, err := primary.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal("true", primaryInfo.State.Storage[StateKeyReplicationPending])
+
+	// The replication is retried when the upload is fetched again, since the handler
+	// does not finish it again.
+	_, err = store.GetUpload(ctx, "abc")
+	a.Equal(memorystore.ErrInjectedFailure, err)
+	a.Equal(float64(2), testutil.ToFloat64(store.replicationFailuresMetric))
+
+	// A repeated replication continues with the remaining data.
+	secondaryStore.FailAfterBytes = 0
+	upload, err = store.GetUpload(ctx, "abc")
+	a.NoError(err)
+
+	secondary, err := secondaryStore.GetUpload(ctx, "abc")
+	a.NoError(err)
+	a.Equal("hello world", readUpload(t, secondary))
+
+	// The marker for the pending replication is removed and not exposed.
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Empty(info.State.Storage)
+
+	primaryInfo, err = primary.GetInfo(ctx)
+	a.NoError(err)
+	a.Empty(primaryInfo.State.Storage)
+	a.Equal("text/plain", primaryInfo.State.ContentType)
+
+	// Once replicated, fetching the upload does not replicate it again.
+	_, err = store.GetUpload(ctx, "abc")
+	a.NoError(err)
+	a.Equal(float64(2), testutil.ToFloat64(store.replicationFailuresMetric))
+}
+
+func TestFallback(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, primaryStore, _ := newStore()
+
+	writeUpload(t, store, handler.FileInfo{ID: "finished", Size: 11}, "hello world")
+
+	unfinished, err := store.NewUpload(ctx, handler.FileInfo{ID: "unfinished", Size: 11})
+	a.NoError(err)
+	_, err = unfinished.WriteChunk(ctx, 0, strings.NewReader("hello"))
+	a.NoError(err)
+
+	// Simulate losing the uploads in the primary store.
+	for _, id := range []string{"finished", "unfinished"} {
+		primary, err := primaryStore.GetUpload(ctx, id)
+		a.NoError(err)
+		a.NoError(primaryStore.AsTerminatableUpload(primary).Terminate(ctx))
+	}
+
+	upload, err := store.GetUpload(ctx, "finished")
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal("finished", info.ID)
+	a.EqualValues(11, info.Offset)
+	a.Equal("hello world", readUpload(t, upload))
+
+	// Uploads from the secondary store cannot be modified.
+	_, err = upload.WriteChunk(ctx, 11, strings.NewReader("!"))
+	a.Equal(ErrPrimaryUnavailable, err)
+
+	// Unfinished uploads have not been replicated yet.
+	_, err = store.GetUpload(ctx, "unfinished")
+	a.Equal(handler.ErrNotFound, err)
+}
+
+func TestConcatUploads(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _, secondaryStore := newStore()
+
+	partialUploads := []handler.Upload{
+		writeUpload(t, store, handler.FileInfo{Size: 5, IsPartial: true}, "hello"),
+		writeUpload(t, store, handler.FileInfo{Size: 6, IsPartial: true}, " world"),
+	}
+
+	finalUpload, err := store.NewUpload(ctx, handler.FileInfo{ID: "final", Size: 11, IsFinal: true})
+	a.NoError(err)
+
+	err = store.AsConcatableUpload(finalUpload).ConcatUploads(ctx, partialUploads)
+	a.NoError(err)
+	a.Equal("hello world", readUpload(t, finalUpload))
+
+	secondary, err := secondaryStore.GetUpload(ctx, "final")
+	a.NoError(err)
+	a.Equal("hello world", readUpload(t, secondary))
+}
+
+func TestDeclareLength(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _, secondaryStore := newStore()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{ID: "abc", SizeIsDeferred: true})
+	a.NoError(err)
+
+	a.NoError(store.AsLengthDeclarableUpload(upload).DeclareLength(ctx, 11))
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.NoError(err)
+	a.NoError(upload.FinishUpload(ctx))
+
+	secondary, err := secondaryStore.GetUpload(ctx, "abc")
+	a.NoError(err)
+
+	info, err := secondary.GetInfo(ctx)
+	a.NoError(err)
+	a.False(info.SizeIsDeferred)
+	a.EqualValues(11, info.Size)
+	a.Equal("hello world", readUpload(t, secondary))
+}
@@ -11,6 +11,7 @@ package prometheuscollector
 import (
 	"strconv"
 	"sync/atomic"
+	"time"
 
 	"github.com/tus/tusd/v2/pkg/handler"
 
@@ -42,6 +43,18 @@ var (
 		"tusd_uploads_terminated",
 		"Number of terminated uploads.",
 		nil, nil)
+	uploadsActiveDesc = prometheus.NewDesc(
+		"tusd_uploads_active",
+		"Number of requests currently receiving upload data.",
+		nil, nil)
+	uploadsThrottledDesc = prometheus.NewDesc(
+		"tusd_uploads_throttled",
+		"Number of requests currently receiving data subject to a bandwidth limit.",
+		nil, nil)
+	throttleDelayDesc = prometheus.NewDesc(
+		"tusd_throttle_delay_seconds",
+		"Total time that receiving data has been delayed due to bandwidth limits.",
+		nil, nil)
 )
 
 type Collector struct {
@@ -62,6 +75,9 @@ func (Collector) Describe(descs chan<- *prometheus.Desc) {
 	descs <- uploadsCreatedDesc
 	descs <- uploadsFinishedDesc
 	descs <- uploadsTerminatedDesc
+	descs <- uploadsActiveDesc
+	descs <- uploadsThrottledDesc
+	descs <- throttleDelayDesc
 }
 
 func (c Collector) Collect(metrics chan<- prometheus.Metric) {
@@ -107,4 +123,22 @@ func (c Collector) Collect(metrics chan<- prometheus.Metric) {
 		prometheus.CounterValue,
 		float64(atomic.LoadUint64(c.metrics.UploadsTerminated)),
 	)
+
+	metrics <- prometheus.MustNewConstMetric(
+		uploadsActiveDesc,
+		prometheus.GaugeValue,
+		float64(atomic.LoadInt64(c.metrics.UploadsActive)),
+	)
+
+	metrics <- prometheus.MustNewConstMetric(
+		uploadsThrottledDesc,
+		prometheus.GaugeValue,
+		float64(atomic.LoadInt64(c.metrics.UploadsThrottled)),
+	)
+
+	metrics <- prometheus.MustNewConstMetric(
+		throttleDelayDesc,
+		prometheus.CounterValue,
+		time.Duration(atomic.LoadUint64(c.metrics.ThrottleDelay)).Seconds(),
+	)
 }
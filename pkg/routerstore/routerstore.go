@@ -0,0 +1,324 @@
+// Package routerstore provides a data store, which routes every upload to one of
+// several named storage backends.
+//
+// Each storage backend is set up in its own composer. When an upload is created, the
+// backend is selected using the Store entry in FileInfo.Storage, which can be set by the
+// pre-create hook using ChangeFileInfo.Storage, or using the value of the meta data entry
+// named by MetaDataKey. The backend's name is encoded into the upload ID as a prefix
+// separated by a colon (e.g. photos:abc123), so that GetUpload can route requests without
+// any lookups:
+//
+//	photos := handler.NewStoreComposer()
+//	s3store.New("photos-bucket", s3Client).UseIn(photos)
+//
+//	documents := handler.NewStoreComposer()
+//	gcsstore.New("documents-bucket", gcsService).UseIn(documents)
+//
+//	store := routerstore.New(map[string]*handler.StoreComposer{
+//		"photos":    photos,
+//		"documents": documents,
+//	})
+//	store.DefaultStore = "documents"
+//
+//	composer := handler.NewStoreComposer()
+//	store.UseIn(composer)
+//	memorylocker.New().UseIn(composer)
+//
+// Extensions, which are announced to clients (termination, creation-defer-length) or
+// change the handler's behavior (content server, meta data updates), are only enabled if
+// all backends support them. Concatenation is always enabled: if the partial uploads are
+// stored in another backend or the backend does not support concatenation, their data is
+// copied into the final upload. Reading ranges is enabled if any backend supports it and
+// emulated for the other backends.
+package routerstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tus/tusd/v2/internal/storageinfo"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// StorageKeyStore is the key of the selected backend's name in handler.FileInfo.Storage.
+const StorageKeyStore = "Store"
+
+// separator separates the backend's name from the backend's upload ID.
+const separator = ":"
+
+// ErrUnknownStore is returned if no backend or an unknown backend is selected for a new upload.
+var ErrUnknownStore = handler.NewError("ERR_UNKNOWN_STORE", "no valid storage backend selected for upload", http.StatusBadRequest)
+
+// See the handler.DataStore interface for documentation about the different
+// methods.
+type RouterStore struct {
+	// MetaDataKey is the key of the meta data entry, whose value selects the backend for
+	// a new upload. If empty, the meta data is not considered. Since clients control the
+	// meta data, they can choose among all backends.
+	MetaDataKey string
+	// DefaultStore is the name of the backend, which is used if no backend is selected.
+	// If empty, such uploads are rejected with ErrUnknownStore.
+	DefaultStore string
+
+	stores map[string]*handler.StoreComposer
+}
+
+// New creates a new store routing uploads to the passed backends, which are identified by
+// their names. The names must not be empty or contain a colon.
+func New(stores map[string]*handler.StoreComposer) *RouterStore {
+	for name := range stores {
+		if name == "" || strings.Contains(name, separator) {
+			panic(fmt.Sprintf("routerstore: invalid store name %q", name))
+		}
+	}
+
+	return &RouterStore{
+		stores: stores,
+	}
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// the extensions, which are supported by the backends.
+func (store *RouterStore) UseIn(composer *handler.StoreComposer) {
+	all := func(uses func(*handler.StoreComposer) bool) bool {
+		for _, inner := range store.stores {
+			if !uses(inner) {
+				return false
+			}
+		}
+		return len(store.stores) > 0
+	}
+
+	composer.UseCore(store)
+	composer.UseConcater(store)
+	if all(func(c *handler.StoreComposer) bool { return c.UsesTerminater }) {
+		composer.UseTerminater(store)
+	}
+	if all(func(c *handler.StoreComposer) bool { return c.UsesLengthDeferrer }) {
+		composer.UseLengthDeferrer(store)
+	}
+	if all(func(c *handler.StoreComposer) bool { return c.UsesContentServer }) {
+		composer.UseContentServer(store)
+	}
+	if all(func(c *handler.StoreComposer) bool { return c.UsesMetadataUpdater }) {
+		composer.UseMetadataUpdater(store)
+	}
+	if all(func(c *handler.StoreComposer) bool { return c.UsesStateUpdater }) {
+		composer.UseStateUpdater(store)
+	}
+	if !all(func(c *handler.StoreComposer) bool { return !c.UsesRangeReader }) {
+		composer.UseRangeReader(store)
+	}
+}
+
+// selectStore returns the name of the backend for a new upload.
+func (store *RouterStore) selectStore(info handler.FileInfo) string {
+	if name := info.Storage[StorageKeyStore]; name != "" {
+		return name
+	}
+
+	if store.MetaDataKey != "" {
+		if name := info.MetaData[store.MetaDataKey]; name != "" {
+			return name
+		}
+	}
+
+	return store.DefaultStore
+}
+
+func (store *RouterStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	name := store.selectStore(info)
+	inner, ok := store.stores[name]
+	if !ok {
+		return nil, ErrUnknownStore
+	}
+
+	// The remaining storage information is meant for the selected backend.
+	if info.Storage != nil {
+		info.Storage = maps.Clone(info.Storage)
+		delete(info.Storage, StorageKeyStore)
+	}
+
+	upload, err := inner.Core.NewUpload(ctx, info)
+	if err != nil {
+		return nil, err
+	}
+
+	return &routerUpload{
+		name:   name,
+		inner:  inner,
+		upload: upload,
+	}, nil
+}
+
+func (store *RouterStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	name, innerID, ok := strings.Cut(id, separator)
+	if !ok {
+		return nil, handler.ErrNotFound
+	}
+
+	inner, ok := store.stores[name]
+	if !ok {
+		return nil, handler.ErrNotFound
+	}
+
+	upload, err := inner.Core.GetUpload(ctx, innerID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &routerUpload{
+		name:   name,
+		inner:  inner,
+		upload: upload,
+	}, nil
+}
+
+func (store *RouterStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
+	return upload.(*routerUpload)
+}
+
+func (store *RouterStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
+	return upload.(*routerUpload)
+}
+
+func (store *RouterStore) AsConcatableUpload(upload handler.Upload) handler.ConcatableUpload {
+	return upload.(*routerUpload)
+}
+
+func (store *RouterStore) AsServableUpload(upload handler.Upload) handler.ServableUpload {
+	return upload.(*routerUpload)
+}
+
+func (store *RouterStore) AsRangeReadableUpload(upload handler.Upload) handler.RangeReadableUpload {
+	return upload.(*routerUpload)
+}
+
+func (store *RouterStore) AsMetadataUpdatableUpload(upload handler.Upload) handler.MetadataUpdatableUpload {
+	return upload.(*routerUpload)
+}
+
+func (store *RouterStore) AsStateUpdatableUpload(upload handler.Upload) handler.StateUpdatableUpload {
+	return upload.(*routerUpload)
+}
+
+type routerUpload struct {
+	// name is the name of the backend, which stores the upload.
+	name   string
+	inner  *handler.StoreComposer
+	upload handler.Upload
+}
+
+func (upload *routerUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	return upload.upload.WriteChunk(ctx, offset, src)
+}
+
+func (upload *routerUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
+	info, err := upload.upload.GetInfo(ctx)
+	if err != nil {
+		return info, err
+	}
+
+	info.ID = upload.name + separator + info.ID
+	info.Storage = storageinfo.Clone(info.Storage)
+	info.Storage[StorageKeyStore] = upload.name
+	return info, nil
+}
+
+func (upload *routerUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	return upload.upload.GetReader(ctx)
+}
+
+func (upload *routerUpload) FinishUpload(ctx context.Context) error {
+	return upload.upload.FinishUpload(ctx)
+}
+
+func (upload *routerUpload) Terminate(ctx context.Context) error {
+	return upload.inner.Terminater.AsTerminatableUpload(upload.upload).Terminate(ctx)
+}
+
+func (upload *routerUpload) DeclareLength(ctx context.Context, length int64) error {
+	return upload.inner.LengthDeferrer.AsLengthDeclarableUpload(upload.upload).DeclareLength(ctx, length)
+}
+
+// ConcatUploads uses the backend's concatenation if all partial uploads are stored in
+// the same backend as the final upload. Otherwise, the partial uploads' data is copied.
+func (upload *routerUpload) ConcatUploads(ctx context.Context, partialUploads []handler.Upload) error {
+	innerUploads := make([]handler.Upload, 0, len(partialUploads))
+	for _, partialUpload := range partialUploads {
+		if partial := partialUpload.(*routerUpload); partial.name == upload.name {
+			innerUploads = append(innerUploads, partial.upload)
+		}
+	}
+
+	if upload.inner.UsesConcater && len(innerUploads) == len(partialUploads) {
+		return upload.inner.Concater.AsConcatableUpload(upload.upload).ConcatUploads(ctx, innerUploads)
+	}
+
+	readers := make([]io.Reader, 0, len(partialUploads))
+	for _, partialUpload := range partialUploads {
+		reader, err := partialUpload.GetReader(ctx)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		readers = append(readers, reader)
+	}
+
+	if _, err := upload.upload.WriteChunk(ctx, 0, io.MultiReader(readers...)); err != nil {
+		return err
+	}
+
+	// The handler does not finish concatenated uploads, so the backend must be
+	// informed here that all data has been written.
+	return upload.upload.FinishUpload(ctx)
+}
+
+func (upload *routerUpload) ServeContent(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return upload.inner.ContentServer.AsServableUpload(upload.upload).ServeContent(ctx, w, r)
+}
+
+func (upload *routerUpload) UpdateMetaData(ctx context.Context, metaData handler.MetaData) error {
+	return upload.inner.MetadataUpdater.AsMetadataUpdatableUpload(upload.upload).UpdateMetaData(ctx, metaData)
+}
+
+func (upload *routerUpload) UpdateState(ctx context.Context, state handler.UploadState) error {
+	return upload.inner.StateUpdater.AsStateUpdatableUpload(upload.upload).UpdateState(ctx, state)
+}
+
+// GetRangeReader uses the backend's range reader, if it supports one. Otherwise, the
+// data preceding the range is skipped.
+func (upload *routerUpload) GetRangeReader(ctx context.Context, offset int64, length int64) (io.ReadCloser, error) {
+	if upload.inner.UsesRangeReader {
+		return upload.inner.RangeReader.AsRangeReadableUpload(upload.upload).GetRangeReader(ctx, offset, length)
+	}
+
+	reader, err := upload.upload.GetReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.CopyN(io.Discard, reader, offset); err != nil {
+		reader.Close()
+		return nil, err
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(reader, length), reader}, nil
+}
+
+func (upload *routerUpload) ModTime(ctx context.Context) (time.Time, error) {
+	if upload.inner.UsesRangeReader {
+		return upload.inner.RangeReader.AsRangeReadableUpload(upload.upload).ModTime(ctx)
+	}
+
+	return time.Time{}, nil
+}
@@ -0,0 +1,209 @@
+package routerstore
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/encryptedstore"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/memorystore"
+)
+
+// Test interface implementations
+var _ handler.DataStore = &RouterStore{}
+var _ handler.TerminaterDataStore = &RouterStore{}
+var _ handler.ConcaterDataStore = &RouterStore{}
+var _ handler.LengthDeferrerDataStore = &RouterStore{}
+var _ handler.ContentServerDataStore = &RouterStore{}
+var _ handler.RangeReaderDataStore = &RouterStore{}
+var _ handler.MetadataUpdaterDataStore = &RouterStore{}
+var _ handler.StateUpdaterDataStore = &RouterStore{}
+
+func newStore() (*RouterStore, *memorystore.MemoryStore, *memorystore.MemoryStore) {
+	aStore := memorystore.New()
+	a := handler.NewStoreComposer()
+	aStore.UseIn(a)
+
+	bStore := memorystore.New()
+	b := handler.NewStoreComposer()
+	bStore.UseIn(b)
+
+	return New(map[string]*handler.StoreComposer{"a": a, "b": b}), aStore, bStore
+}
+
+func readUpload(t *testing.T, upload handler.Upload) string {
+	reader, err := upload.GetReader(context.Background())
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func writeUpload(t *testing.T, store handler.DataStore, info handler.FileInfo, content string) handler.Upload {
+	ctx := context.Background()
+
+	upload, err := store.NewUpload(ctx, info)
+	assert.NoError(t, err)
+
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader(content))
+	assert.NoError(t, err)
+
+	assert.NoError(t, upload.FinishUpload(ctx))
+	return upload
+}
+
+func TestRouting(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, aStore, bStore := newStore()
+	store.MetaDataKey = "store"
+	store.DefaultStore = "a"
+
+	// The default store is used if no store is selected.
+	writeUpload(t, store, handler.FileInfo{ID: "one", Size: 3}, "one")
+	a.EqualValues(3, aStore.Used())
+
+	// The meta data selects the store.
+	writeUpload(t, store, handler.FileInfo{ID: "two", Size: 3, MetaData: handler.MetaData{"store": "b"}}, "two")
+	a.EqualValues(3, bStore.Used())
+
+	// The storage information from the pre-create hook takes precedence.
+	upload := writeUpload(t, store, handler.FileInfo{
+		ID:       "three",
+		Size:     5,
+		MetaData: handler.MetaData{"store": "a"},
+		Storage:  map[string]string{StorageKeyStore: "b"},
+	}, "three")
+	a.EqualValues(8, bStore.Used())
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal("b:three", info.ID)
+	a.Equal("b", info.Storage[StorageKeyStore])
+
+	// The routing information is not passed to the backend.
+	inner, err := bStore.GetUpload(ctx, "three")
+	a.NoError(err)
+	innerInfo, err := inner.GetInfo(ctx)
+	a.NoError(err)
+	a.NotContains(innerInfo.Storage, StorageKeyStore)
+
+	// Uploads are found using the store's name in the ID.
+	upload, err = store.GetUpload(ctx, "b:two")
+	a.NoError(err)
+	a.Equal("two", readUpload(t, upload))
+
+	for _, id := range []string{"two", "a:two", "c:two"} {
+		_, err = store.GetUpload(ctx, id)
+		a.Equal(handler.ErrNotFound, err)
+	}
+
+	_, err = store.NewUpload(ctx, handler.FileInfo{Storage: map[string]string{StorageKeyStore: "c"}})
+	a.Equal(ErrUnknownStore, err)
+
+	err = store.AsTerminatableUpload(upload).Terminate(ctx)
+	a.NoError(err)
+	_, err = store.GetUpload(ctx, "b:two")
+	a.Equal(handler.ErrNotFound, err)
+}
+
+func TestUnknownStore(t *testing.T) {
+	store, _, _ := newStore()
+
+	_, err := store.NewUpload(context.Background(), handler.FileInfo{Size: 3})
+	assert.Equal(t, ErrUnknownStore, err)
+}
+
+func TestInvalidStoreName(t *testing.T) {
+	assert.Panics(t, func() {
+		New(map[string]*handler.StoreComposer{"a:b": handler.NewStoreComposer()})
+	})
+}
+
+func TestCapabilities(t *testing.T) {
+	a := assert.New(t)
+
+	full := handler.NewStoreComposer()
+	memorystore.New().UseIn(full)
+
+	// A backend only supporting the core, concatenation and range reads.
+	inner := handler.NewStoreComposer()
+	inner.UseCore(memorystore.New())
+	keys := encryptedstore.NewKeyRing()
+	a.NoError(keys.AddKey("key", make([]byte, 32)))
+	limited := handler.NewStoreComposer()
+	encryptedstore.New(inner, keys).UseIn(limited)
+
+	composer := handler.NewStoreComposer()
+	New(map[string]*handler.StoreComposer{"full": full, "limited": limited}).UseIn(composer)
+
+	a.True(composer.UsesConcater)
+	a.True(composer.UsesRangeReader)
+	a.False(composer.UsesTerminater)
+	a.False(composer.UsesLengthDeferrer)
+	a.False(composer.UsesContentServer)
+	a.False(composer.UsesMetadataUpdater)
+}
+
+func TestGetRangeReader(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	// A backend without range reader.
+	inner := handler.NewStoreComposer()
+	inner.UseCore(memorystore.New())
+
+	store := New(map[string]*handler.StoreComposer{"a": inner})
+	store.DefaultStore = "a"
+
+	upload := writeUpload(t, store, handler.FileInfo{ID: "abc", Size: 11}, "hello world")
+
+	reader, err := store.AsRangeReadableUpload(upload).GetRangeReader(ctx, 2, 5)
+	a.NoError(err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	a.NoError(err)
+	a.Equal("llo w", string(content))
+}
+
+func TestConcatUploads(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _, bStore := newStore()
+	store.DefaultStore = "a"
+
+	// Partial uploads in the same backend use its concatenation.
+	partialUploads := []handler.Upload{
+		writeUpload(t, store, handler.FileInfo{Size: 5, IsPartial: true}, "hello"),
+		writeUpload(t, store, handler.FileInfo{Size: 6, IsPartial: true}, " world"),
+	}
+
+	finalUpload, err := store.NewUpload(ctx, handler.FileInfo{ID: "final", Size: 11, IsFinal: true})
+	a.NoError(err)
+
+	err = store.AsConcatableUpload(finalUpload).ConcatUploads(ctx, partialUploads)
+	a.NoError(err)
+	a.Equal("hello world", readUpload(t, finalUpload))
+
+	// Partial uploads in another backend are copied.
+	finalUpload, err = store.NewUpload(ctx, handler.FileInfo{
+		ID:      "final",
+		Size:    11,
+		IsFinal: true,
+		Storage: map[string]string{StorageKeyStore: "b"},
+	})
+	a.NoError(err)
+
+	err = store.AsConcatableUpload(finalUpload).ConcatUploads(ctx, partialUploads)
+	a.NoError(err)
+
+	final, err := bStore.GetUpload(ctx, "final")
+	a.NoError(err)
+	a.Equal("hello world", readUpload(t, final))
+}
@@ -0,0 +1,189 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/tus/tusd/v2/internal/storageinfo"
+)
+
+// storageKeyContentHash is the key of the SHA-256 hash of a deduplicated upload's content
+// in handler.FileInfo.Storage.
+const storageKeyContentHash = "ContentHash"
+
+// maxCopyObjectSize is the maximum size of an object, which can be copied using a single
+// CopyObject request. Larger uploads are not deduplicated.
+const maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+
+// contentKey returns the key of the object containing the upload's data. For deduplicated
+// uploads, this is the content-addressed object.
+func (upload *s3Upload) contentKey(ctx context.Context) (*string, error) {
+	store := upload.store
+	if store.DeduplicationPrefix == "" {
+		return store.keyWithPrefix(upload.objectId), nil
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if hash := info.Storage[storageKeyContentHash]; hash != "" {
+		return store.contentKeyForHash(hash), nil
+	}
+
+	return store.keyWithPrefix(upload.objectId), nil
+}
+
+// deduplicate moves the content of a finished upload to the content-addressed object and
+// records a reference to it. The upload's info object then points to this object.
+func (upload *s3Upload) deduplicate(ctx context.Context) error {
+	store := upload.store
+	if store.DeduplicationPrefix == "" {
+		return nil
+	}
+
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	if info.Storage[storageKeyContentHash] != "" || info.Size > maxCopyObjectSize {
+		return nil
+	}
+
+	hash, err := upload.hashContent(ctx)
+	if err != nil {
+		return err
+	}
+	contentKey := store.contentKeyForHash(hash)
+
+	// The reference is added before looking for the content-addressed object, so that
+	// terminating another upload with the same content does not remove the object.
+	_, err = store.Service.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(store.Bucket),
+		Key:           store.referenceKey(hash, upload.objectId),
+		Body:          bytes.NewReader([]byte{}),
+		ContentLength: aws.Int64(0),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := upload.ensureContent(ctx, contentKey); err != nil {
+		return err
+	}
+
+	info.Storage = storageinfo.Clone(info.Storage)
+	info.Storage["Key"] = *contentKey
+	info.Storage[storageKeyContentHash] = hash
+	if err := upload.writeInfo(ctx, info); err != nil {
+		return err
+	}
+
+	// Terminating another upload might have removed the content-addressed object after
+	// it has been checked above, if that upload did not see the reference yet. Therefore,
+	// it is checked again before the upload's own object, which is the only remaining
+	// copy in this case, is removed.
+	if err := upload.ensureContent(ctx, contentKey); err != nil {
+		return err
+	}
+
+	// The info object points to the content-addressed object now, so the upload's
+	// own object is no longer needed.
+	_, err = store.Service.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(store.Bucket),
+		Key:    store.keyWithPrefix(upload.objectId),
+	})
+	return err
+}
+
+// ensureContent copies the upload's own object to the content-addressed object, unless
+// the latter exists already.
+func (upload *s3Upload) ensureContent(ctx context.Context, contentKey *string) error {
+	store := upload.store
+
+	_, err := store.Service.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(store.Bucket),
+		Key:    contentKey,
+	})
+	if isAwsError[*types.NoSuchKey](err) || isAwsError[*types.NotFound](err) {
+		_, err = store.Service.CopyObject(ctx, &s3.CopyObjectInput{
+			Bucket:     aws.String(store.Bucket),
+			Key:        contentKey,
+			CopySource: aws.String(store.Bucket + "/" + *store.keyWithPrefix(upload.objectId)),
+		})
+	}
+	return err
+}
+
+// hashContent returns the hex-encoded SHA-256 hash of the finished upload's object.
+func (upload *s3Upload) hashContent(ctx context.Context) (string, error) {
+	store := upload.store
+
+	res, err := store.Service.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(store.Bucket),
+		Key:    store.keyWithPrefix(upload.objectId),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, res.Body); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// releaseContent removes the upload's reference to the content-addressed object. The object
+// itself is removed, once no references are left.
+func (upload *s3Upload) releaseContent(ctx context.Context, hash string) error {
+	store := upload.store
+
+	_, err := store.Service.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(store.Bucket),
+		Key:    store.referenceKey(hash, upload.objectId),
+	})
+	if err != nil {
+		return err
+	}
+
+	res, err := store.Service.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+		Bucket:  aws.String(store.Bucket),
+		Prefix:  store.referenceKey(hash, ""),
+		MaxKeys: aws.Int32(1),
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(res.Contents) > 0 {
+		return nil
+	}
+
+	_, err = store.Service.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(store.Bucket),
+		Key:    store.contentKeyForHash(hash),
+	})
+	return err
+}
+
+// contentKeyForHash returns the key of the content-addressed object for the hash.
+func (store S3Store) contentKeyForHash(hash string) *string {
+	return store.keyWithPrefix(store.DeduplicationPrefix + hash)
+}
+
+// referenceKey returns the key of the empty object, which records that the upload
+// references the content-addressed object for the hash.
+func (store S3Store) referenceKey(hash string, objectId string) *string {
+	return store.metadataKeyWithPrefix(store.DeduplicationPrefix + hash + ".refs/" + objectId)
+}
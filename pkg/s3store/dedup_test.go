@@ -0,0 +1,334 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// helloWorldHash is the SHA-256 hash of "hello world".
+const helloWorldHash = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+
+func newDedupUpload(store *S3Store, storage map[string]string) *s3Upload {
+	return &s3Upload{
+		store:       store,
+		objectId:    "uploadId",
+		multipartId: "multipartId",
+		info: &handler.FileInfo{
+			ID:      "uploadId+multipartId",
+			Size:    11,
+			Offset:  11,
+			Storage: storage,
+		},
+		parts: []*s3Part{
+			{number: 1, size: 11, etag: "etag-1"},
+		},
+	}
+}
+
+func expectFinishUpload(s3obj *MockS3API) *gomock.Call {
+	return s3obj.EXPECT().CompleteMultipartUpload(context.Background(), &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+		MultipartUpload: &types.CompletedMultipartUpload{
+			Parts: []types.CompletedPart{
+				{
+					ETag:       aws.String("etag-1"),
+					PartNumber: aws.Int32(1),
+				},
+			},
+		},
+	}).Return(nil, nil)
+}
+
+func expectInfoObject(t *testing.T, s3obj *MockS3API) *gomock.Call {
+	infoJson, err := json.Marshal(handler.FileInfo{
+		ID:     "uploadId+multipartId",
+		Size:   11,
+		Offset: 11,
+		Storage: map[string]string{
+			"Type":                "s3store",
+			"Bucket":              "bucket",
+			"Key":                 "dedup/" + helloWorldHash,
+			storageKeyContentHash: helloWorldHash,
+		},
+	})
+	assert.NoError(t, err)
+
+	return s3obj.EXPECT().PutObject(context.Background(), &s3.PutObjectInput{
+		Bucket:        aws.String("bucket"),
+		Key:           aws.String("uploadId.info"),
+		Body:          bytes.NewReader(infoJson),
+		ContentLength: aws.Int64(int64(len(infoJson))),
+	}).Return(nil, nil)
+}
+
+func expectContentObject(s3obj *MockS3API) *gomock.Call {
+	return s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("dedup/" + helloWorldHash),
+	})
+}
+
+func TestDeduplicateNewContent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.DeduplicationPrefix = "dedup/"
+
+	upload := newDedupUpload(&store, map[string]string{"Type": "s3store", "Bucket": "bucket", "Key": "uploadId"})
+
+	gomock.InOrder(
+		expectFinishUpload(s3obj),
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(strings.NewReader("hello world")),
+		}, nil),
+		s3obj.EXPECT().PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket:        aws.String("bucket"),
+			Key:           aws.String("dedup/" + helloWorldHash + ".refs/uploadId"),
+			Body:          bytes.NewReader([]byte{}),
+			ContentLength: aws.Int64(0),
+		}).Return(nil, nil),
+		s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("dedup/" + helloWorldHash),
+		}).Return(nil, &types.NotFound{}),
+		s3obj.EXPECT().CopyObject(context.Background(), &s3.CopyObjectInput{
+			Bucket:     aws.String("bucket"),
+			Key:        aws.String("dedup/" + helloWorldHash),
+			CopySource: aws.String("bucket/uploadId"),
+		}).Return(nil, nil),
+		expectInfoObject(t, s3obj),
+		expectContentObject(s3obj).Return(&s3.HeadObjectOutput{}, nil),
+		s3obj.EXPECT().DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId"),
+		}).Return(nil, nil),
+	)
+
+	err := upload.FinishUpload(context.Background())
+	assert.Nil(err)
+}
+
+func TestDeduplicateExistingContent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.DeduplicationPrefix = "dedup/"
+
+	upload := newDedupUpload(&store, map[string]string{"Type": "s3store", "Bucket": "bucket", "Key": "uploadId"})
+
+	// The content-addressed object exists, so no copy is made.
+	gomock.InOrder(
+		expectFinishUpload(s3obj),
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(strings.NewReader("hello world")),
+		}, nil),
+		s3obj.EXPECT().PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket:        aws.String("bucket"),
+			Key:           aws.String("dedup/" + helloWorldHash + ".refs/uploadId"),
+			Body:          bytes.NewReader([]byte{}),
+			ContentLength: aws.Int64(0),
+		}).Return(nil, nil),
+		s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("dedup/" + helloWorldHash),
+		}).Return(&s3.HeadObjectOutput{}, nil),
+		expectInfoObject(t, s3obj),
+		expectContentObject(s3obj).Return(&s3.HeadObjectOutput{}, nil),
+		s3obj.EXPECT().DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId"),
+		}).Return(nil, nil),
+	)
+
+	err := upload.FinishUpload(context.Background())
+	assert.Nil(err)
+}
+
+func TestDeduplicateRemovedContent(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.DeduplicationPrefix = "dedup/"
+
+	upload := newDedupUpload(&store, map[string]string{"Type": "s3store", "Bucket": "bucket", "Key": "uploadId"})
+
+	// The content-addressed object is removed by terminating another upload after it
+	// has been found, so it is restored before the upload's own object is deleted.
+	gomock.InOrder(
+		expectFinishUpload(s3obj),
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(strings.NewReader("hello world")),
+		}, nil),
+		s3obj.EXPECT().PutObject(context.Background(), &s3.PutObjectInput{
+			Bucket:        aws.String("bucket"),
+			Key:           aws.String("dedup/" + helloWorldHash + ".refs/uploadId"),
+			Body:          bytes.NewReader([]byte{}),
+			ContentLength: aws.Int64(0),
+		}).Return(nil, nil),
+		expectContentObject(s3obj).Return(&s3.HeadObjectOutput{}, nil),
+		expectInfoObject(t, s3obj),
+		expectContentObject(s3obj).Return(nil, &types.NotFound{}),
+		s3obj.EXPECT().CopyObject(context.Background(), &s3.CopyObjectInput{
+			Bucket:     aws.String("bucket"),
+			Key:        aws.String("dedup/" + helloWorldHash),
+			CopySource: aws.String("bucket/uploadId"),
+		}).Return(nil, nil),
+		s3obj.EXPECT().DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId"),
+		}).Return(nil, nil),
+	)
+
+	err := upload.FinishUpload(context.Background())
+	assert.Nil(err)
+}
+
+func TestGetReaderDeduplicated(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.DeduplicationPrefix = "dedup/"
+
+	upload := newDedupUpload(&store, map[string]string{storageKeyContentHash: helloWorldHash})
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("dedup/" + helloWorldHash),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(strings.NewReader("hello world")),
+	}, nil)
+
+	reader, err := upload.GetReader(context.Background())
+	assert.Nil(err)
+
+	content, err := io.ReadAll(reader)
+	assert.Nil(err)
+	assert.Equal("hello world", string(content))
+}
+
+func expectTerminate(s3obj *MockS3API) {
+	s3obj.EXPECT().AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+	}).Return(nil, &types.NoSuchUpload{})
+
+	s3obj.EXPECT().DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+		Bucket: aws.String("bucket"),
+		Delete: &types.Delete{
+			Objects: []types.ObjectIdentifier{
+				{
+					Key: aws.String("uploadId"),
+				},
+				{
+					Key: aws.String("uploadId.part"),
+				},
+				{
+					Key: aws.String("uploadId.info"),
+				},
+			},
+			Quiet: aws.Bool(true),
+		},
+	}).Return(&s3.DeleteObjectsOutput{}, nil)
+}
+
+func TestTerminateLastReference(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.DeduplicationPrefix = "dedup/"
+
+	upload := newDedupUpload(&store, map[string]string{storageKeyContentHash: helloWorldHash})
+
+	expectTerminate(s3obj)
+	gomock.InOrder(
+		s3obj.EXPECT().DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("dedup/" + helloWorldHash + ".refs/uploadId"),
+		}).Return(nil, nil),
+		s3obj.EXPECT().ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+			Bucket:  aws.String("bucket"),
+			Prefix:  aws.String("dedup/" + helloWorldHash + ".refs/"),
+			MaxKeys: aws.Int32(1),
+		}).Return(&s3.ListObjectsV2Output{}, nil),
+		s3obj.EXPECT().DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("dedup/" + helloWorldHash),
+		}).Return(nil, nil),
+	)
+
+	err := store.AsTerminatableUpload(upload).Terminate(context.Background())
+	assert.Nil(err)
+}
+
+func TestTerminateRemainingReferences(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.DeduplicationPrefix = "dedup/"
+
+	upload := newDedupUpload(&store, map[string]string{storageKeyContentHash: helloWorldHash})
+
+	// Another upload references the content, so it is kept.
+	expectTerminate(s3obj)
+	gomock.InOrder(
+		s3obj.EXPECT().DeleteObject(context.Background(), &s3.DeleteObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("dedup/" + helloWorldHash + ".refs/uploadId"),
+		}).Return(nil, nil),
+		s3obj.EXPECT().ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+			Bucket:  aws.String("bucket"),
+			Prefix:  aws.String("dedup/" + helloWorldHash + ".refs/"),
+			MaxKeys: aws.Int32(1),
+		}).Return(&s3.ListObjectsV2Output{
+			Contents: []types.Object{
+				{Key: aws.String("dedup/" + helloWorldHash + ".refs/otherId")},
+			},
+		}, nil),
+	)
+
+	err := store.AsTerminatableUpload(upload).Terminate(context.Background())
+	assert.Nil(err)
+}
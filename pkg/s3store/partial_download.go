@@ -0,0 +1,249 @@
+package s3store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxDeleteObjects is the maximum number of objects, which can be deleted using a
+// single DeleteObjects request.
+const maxDeleteObjects = 1000
+
+// partObjectKey returns the key of the object storing a part of an unfinished upload,
+// if PartialDownloads is enabled. The part number is padded, so the objects are listed
+// in order.
+func (store S3Store) partObjectKey(objectId string, number int32) *string {
+	return store.metadataKeyWithPrefix(fmt.Sprintf("%s.parts/%05d", objectId, number))
+}
+
+// putPartObject stores a part of an unfinished upload as a separate object.
+func (store S3Store) putPartObject(ctx context.Context, objectId string, number int32, file io.ReadSeeker, size int64) error {
+	_, err := store.Service.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(store.Bucket),
+		Key:           store.partObjectKey(objectId, number),
+		Body:          file,
+		ContentLength: aws.Int64(size),
+	})
+	return err
+}
+
+// listPartObjects returns the parts of an unfinished upload, which are stored as
+// separate objects, ordered by their number.
+func (store S3Store) listPartObjects(ctx context.Context, objectId string) (parts []*s3Part, err error) {
+	prefix := *store.metadataKeyWithPrefix(objectId + ".parts/")
+
+	var continuationToken *string
+	for {
+		t := time.Now()
+		res, err := store.Service.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket:            aws.String(store.Bucket),
+			Prefix:            aws.String(prefix),
+			ContinuationToken: continuationToken,
+		})
+		store.observeRequestDuration(t, metricListParts)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, object := range res.Contents {
+			number, err := strconv.ParseInt(strings.TrimPrefix(*object.Key, prefix), 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("s3store: invalid part object %s: %w", *object.Key, err)
+			}
+
+			parts = append(parts, &s3Part{
+				number: int32(number),
+				size:   aws.ToInt64(object.Size),
+			})
+		}
+
+		if !aws.ToBool(res.IsTruncated) {
+			break
+		}
+		continuationToken = res.NextContinuationToken
+	}
+
+	slices.SortFunc(parts, func(a, b *s3Part) int {
+		return int(a.number - b.number)
+	})
+	return parts, nil
+}
+
+// copyPartObjects copies the parts, which are stored as separate objects, into the
+// multipart upload. Parts are recognized by their missing ETag, which is set once
+// they have been copied. The copied parts are returned.
+func (upload *s3Upload) copyPartObjects(ctx context.Context, parts []*s3Part) ([]*s3Part, error) {
+	store := upload.store
+
+	var copied []*s3Part
+	var eg errgroup.Group
+	for _, part := range parts {
+		if part.etag != "" {
+			continue
+		}
+		copied = append(copied, part)
+
+		eg.Go(func() error {
+			t := time.Now()
+			res, err := store.Service.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+				Bucket:     aws.String(store.Bucket),
+				Key:        store.keyWithPrefix(upload.objectId),
+				UploadId:   aws.String(upload.multipartId),
+				PartNumber: aws.Int32(part.number),
+				CopySource: aws.String(store.Bucket + "/" + *store.partObjectKey(upload.objectId, part.number)),
+			})
+			store.observeRequestDuration(t, metricUploadPart)
+			if err != nil {
+				return err
+			}
+
+			part.etag = *res.CopyPartResult.ETag
+			return nil
+		})
+	}
+
+	return copied, eg.Wait()
+}
+
+// deletePartObjects deletes the objects storing the given parts.
+func (store S3Store) deletePartObjects(ctx context.Context, objectId string, parts []*s3Part) error {
+	for batch := range slices.Chunk(parts, maxDeleteObjects) {
+		objects := make([]types.ObjectIdentifier, len(batch))
+		for i, part := range batch {
+			objects[i] = types.ObjectIdentifier{
+				Key: store.partObjectKey(objectId, part.number),
+			}
+		}
+
+		res, err := store.Service.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(store.Bucket),
+			Delete: &types.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, s3Err := range res.Errors {
+			if *s3Err.Code != "NoSuchKey" {
+				return fmt.Errorf("AWS S3 Error (%s) for object %s: %s", *s3Err.Code, *s3Err.Key, *s3Err.Message)
+			}
+		}
+	}
+
+	return nil
+}
+
+// readParts returns a reader for the data of an unfinished upload, which is stored in
+// the part objects and the incomplete part object. The reader starts at the given offset
+// and provides at most length bytes or, if length is negative, all remaining data.
+func (upload *s3Upload) readParts(ctx context.Context, offset int64, length int64) (io.ReadCloser, error) {
+	store := upload.store
+
+	_, parts, incompletePartSize, err := upload.getInternalInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	type object struct {
+		key  *string
+		size int64
+	}
+	objects := make([]object, 0, len(parts)+1)
+	for _, part := range parts {
+		objects = append(objects, object{store.partObjectKey(upload.objectId, part.number), part.size})
+	}
+	if incompletePartSize > 0 {
+		objects = append(objects, object{store.metadataKeyWithPrefix(upload.objectId + ".part"), incompletePartSize})
+	}
+
+	reader := &partsReader{
+		ctx:   ctx,
+		store: store,
+	}
+
+	// Only request the ranges of the objects, which overlap with the requested range.
+	var start int64
+	for _, obj := range objects {
+		end := start + obj.size
+		from := max(offset, start)
+		to := end
+		if length >= 0 {
+			to = min(end, offset+length)
+		}
+
+		if from < to {
+			reader.ranges = append(reader.ranges, &s3.GetObjectInput{
+				Bucket: aws.String(store.Bucket),
+				Key:    obj.key,
+				Range:  aws.String(fmt.Sprintf("bytes=%d-%d", from-start, to-start-1)),
+			})
+		}
+
+		start = end
+	}
+
+	return reader, nil
+}
+
+// partsReader reads the ranges of multiple objects one after another. Each object is
+// only requested once the previous one has been read entirely.
+type partsReader struct {
+	ctx    context.Context
+	store  *S3Store
+	ranges []*s3.GetObjectInput
+
+	current io.ReadCloser
+}
+
+func (r *partsReader) Read(p []byte) (int, error) {
+	for {
+		if r.current == nil {
+			if len(r.ranges) == 0 {
+				return 0, io.EOF
+			}
+
+			res, err := r.store.Service.GetObject(r.ctx, r.ranges[0])
+			if err != nil {
+				return 0, err
+			}
+
+			r.current = res.Body
+			r.ranges = r.ranges[1:]
+		}
+
+		n, err := r.current.Read(p)
+		if err == io.EOF {
+			err = r.current.Close()
+			r.current = nil
+			if n > 0 || err != nil {
+				return n, err
+			}
+			continue
+		}
+
+		return n, err
+	}
+}
+
+func (r *partsReader) Close() error {
+	if r.current == nil {
+		return nil
+	}
+
+	err := r.current.Close()
+	r.current = nil
+	return err
+}
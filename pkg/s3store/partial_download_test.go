@@ -0,0 +1,330 @@
+package s3store
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// expectPartialUploadInfo sets the expectations for fetching the info of an unfinished
+// upload, whose two parts with four bytes each are stored as separate objects.
+func expectPartialUploadInfo(s3obj *MockS3API, size int64, incompletePartSize int64) {
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.info"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(strings.NewReader(`{"ID":"uploadId+multipartId","Size":` + strconv.FormatInt(size, 10) + `}`)),
+	}, nil)
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+	}).Return(&s3.ListPartsOutput{}, nil)
+	s3obj.EXPECT().ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket: aws.String("bucket"),
+		Prefix: aws.String("uploadId.parts/"),
+	}).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("uploadId.parts/00002"), Size: aws.Int64(4)},
+			{Key: aws.String("uploadId.parts/00001"), Size: aws.Int64(4)},
+		},
+	}, nil)
+
+	head := s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+	})
+	if incompletePartSize > 0 {
+		head.Return(&s3.HeadObjectOutput{
+			ContentLength: aws.Int64(incompletePartSize),
+		}, nil)
+	} else {
+		head.Return(nil, &types.NotFound{})
+	}
+}
+
+func TestPartialDownloadsWriteChunk(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.MaxPartSize = 8
+	store.MinPartSize = 4
+	store.PreferredPartSize = 4
+	store.PartialDownloads = true
+
+	expectPartialUploadInfo(s3obj, 100, 0)
+
+	// The parts are stored as objects instead of being uploaded to the multipart upload
+	s3obj.EXPECT().PutObject(context.Background(), NewPutObjectInputMatcher(&s3.PutObjectInput{
+		Bucket:        aws.String("bucket"),
+		Key:           aws.String("uploadId.parts/00003"),
+		Body:          bytes.NewReader([]byte("1234")),
+		ContentLength: aws.Int64(4),
+	})).Return(nil, nil)
+	s3obj.EXPECT().PutObject(context.Background(), NewPutObjectInputMatcher(&s3.PutObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId.part"),
+		Body:   bytes.NewReader([]byte("56")),
+	})).Return(nil, nil)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	bytesRead, err := upload.WriteChunk(context.Background(), 8, bytes.NewReader([]byte("123456")))
+	assert.Nil(err)
+	assert.Equal(int64(6), bytesRead)
+
+	info, err := upload.GetInfo(context.Background())
+	assert.Nil(err)
+	assert.Equal(int64(14), info.Offset)
+}
+
+func TestPartialDownloadsGetReader(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.PartialDownloads = true
+
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+	}).Return(nil, &types.NoSuchKey{})
+	s3obj.EXPECT().ListParts(context.Background(), &s3.ListPartsInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+		MaxParts: aws.Int32(0),
+	}).Return(&s3.ListPartsOutput{}, nil)
+	expectPartialUploadInfo(s3obj, 100, 2)
+
+	// The part objects and the incomplete part are read in order
+	gomock.InOrder(
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId.parts/00001"),
+			Range:  aws.String("bytes=0-3"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(strings.NewReader("abcd")),
+		}, nil),
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId.parts/00002"),
+			Range:  aws.String("bytes=0-3"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(strings.NewReader("efgh")),
+		}, nil),
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId.part"),
+			Range:  aws.String("bytes=0-1"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(strings.NewReader("ij")),
+		}, nil),
+	)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	reader, err := upload.GetReader(context.Background())
+	assert.Nil(err)
+
+	content, err := io.ReadAll(reader)
+	assert.Nil(err)
+	assert.Equal("abcdefghij", string(content))
+	assert.Nil(reader.Close())
+}
+
+func TestPartialDownloadsGetRangeReader(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.PartialDownloads = true
+
+	s3obj.EXPECT().HeadObject(context.Background(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+	}).Return(nil, &types.NotFound{})
+	s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+		Range:  aws.String("bytes=3-8"),
+	}).Return(nil, &types.NoSuchKey{})
+	expectPartialUploadInfo(s3obj, 100, 2)
+
+	// Only the overlapping ranges of the objects are requested
+	gomock.InOrder(
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId.parts/00001"),
+			Range:  aws.String("bytes=3-3"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(strings.NewReader("d")),
+		}, nil),
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId.parts/00002"),
+			Range:  aws.String("bytes=0-3"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(strings.NewReader("efgh")),
+		}, nil),
+		s3obj.EXPECT().GetObject(context.Background(), &s3.GetObjectInput{
+			Bucket: aws.String("bucket"),
+			Key:    aws.String("uploadId.part"),
+			Range:  aws.String("bytes=0-0"),
+		}).Return(&s3.GetObjectOutput{
+			Body: io.NopCloser(strings.NewReader("i")),
+		}, nil),
+	)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	rangeUpload := store.AsRangeReadableUpload(upload)
+
+	modTime, err := rangeUpload.ModTime(context.Background())
+	assert.Nil(err)
+	assert.True(modTime.IsZero())
+
+	reader, err := rangeUpload.GetRangeReader(context.Background(), 3, 6)
+	assert.Nil(err)
+
+	content, err := io.ReadAll(reader)
+	assert.Nil(err)
+	assert.Equal("defghi", string(content))
+}
+
+func TestPartialDownloadsFinishUpload(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.PartialDownloads = true
+
+	expectPartialUploadInfo(s3obj, 8, 0)
+
+	// The part objects are copied into the multipart upload and removed afterwards
+	s3obj.EXPECT().UploadPartCopy(context.Background(), &s3.UploadPartCopyInput{
+		Bucket:     aws.String("bucket"),
+		Key:        aws.String("uploadId"),
+		UploadId:   aws.String("multipartId"),
+		PartNumber: aws.Int32(1),
+		CopySource: aws.String("bucket/uploadId.parts/00001"),
+	}).Return(&s3.UploadPartCopyOutput{
+		CopyPartResult: &types.CopyPartResult{ETag: aws.String("etag-1")},
+	}, nil)
+	s3obj.EXPECT().UploadPartCopy(context.Background(), &s3.UploadPartCopyInput{
+		Bucket:     aws.String("bucket"),
+		Key:        aws.String("uploadId"),
+		UploadId:   aws.String("multipartId"),
+		PartNumber: aws.Int32(2),
+		CopySource: aws.String("bucket/uploadId.parts/00002"),
+	}).Return(&s3.UploadPartCopyOutput{
+		CopyPartResult: &types.CopyPartResult{ETag: aws.String("etag-2")},
+	}, nil)
+	gomock.InOrder(
+		s3obj.EXPECT().CompleteMultipartUpload(context.Background(), &s3.CompleteMultipartUploadInput{
+			Bucket:   aws.String("bucket"),
+			Key:      aws.String("uploadId"),
+			UploadId: aws.String("multipartId"),
+			MultipartUpload: &types.CompletedMultipartUpload{
+				Parts: []types.CompletedPart{
+					{
+						ETag:       aws.String("etag-1"),
+						PartNumber: aws.Int32(1),
+					},
+					{
+						ETag:       aws.String("etag-2"),
+						PartNumber: aws.Int32(2),
+					},
+				},
+			},
+		}).Return(nil, nil),
+		s3obj.EXPECT().DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+			Bucket: aws.String("bucket"),
+			Delete: &types.Delete{
+				Objects: []types.ObjectIdentifier{
+					{Key: aws.String("uploadId.parts/00001")},
+					{Key: aws.String("uploadId.parts/00002")},
+				},
+				Quiet: aws.Bool(true),
+			},
+		}).Return(&s3.DeleteObjectsOutput{}, nil),
+	)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	err = upload.FinishUpload(context.Background())
+	assert.Nil(err)
+}
+
+func TestPartialDownloadsTerminate(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+	store.PartialDownloads = true
+
+	s3obj.EXPECT().AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String("bucket"),
+		Key:      aws.String("uploadId"),
+		UploadId: aws.String("multipartId"),
+	}).Return(nil, nil)
+	s3obj.EXPECT().DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+		Bucket: aws.String("bucket"),
+		Delete: &types.Delete{
+			Objects: []types.ObjectIdentifier{
+				{Key: aws.String("uploadId")},
+				{Key: aws.String("uploadId.part")},
+				{Key: aws.String("uploadId.info")},
+			},
+			Quiet: aws.Bool(true),
+		},
+	}).Return(&s3.DeleteObjectsOutput{}, nil)
+	s3obj.EXPECT().ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
+		Bucket: aws.String("bucket"),
+		Prefix: aws.String("uploadId.parts/"),
+	}).Return(&s3.ListObjectsV2Output{
+		Contents: []types.Object{
+			{Key: aws.String("uploadId.parts/00001"), Size: aws.Int64(4)},
+		},
+	}, nil)
+	s3obj.EXPECT().DeleteObjects(context.Background(), &s3.DeleteObjectsInput{
+		Bucket: aws.String("bucket"),
+		Delete: &types.Delete{
+			Objects: []types.ObjectIdentifier{
+				{Key: aws.String("uploadId.parts/00001")},
+			},
+			Quiet: aws.Bool(true),
+		},
+	}).Return(&s3.DeleteObjectsOutput{}, nil)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	err = store.AsTerminatableUpload(upload).Terminate(context.Background())
+	assert.Nil(err)
+}
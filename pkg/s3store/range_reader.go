@@ -0,0 +1,76 @@
+package s3store
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func (store S3Store) AsRangeReadableUpload(upload handler.Upload) handler.RangeReadableUpload {
+	return upload.(*s3Upload)
+}
+
+// GetRangeReader only fetches the requested range of the upload's object from S3. If the
+// upload is unfinished, the range is read from the part objects, if PartialDownloads is
+// enabled.
+func (upload *s3Upload) GetRangeReader(ctx context.Context, offset int64, length int64) (io.ReadCloser, error) {
+	// S3 cannot return an empty range.
+	if length <= 0 {
+		return io.NopCloser(strings.NewReader("")), nil
+	}
+
+	key, err := upload.contentKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := upload.store.Service.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(upload.store.Bucket),
+		Key:    key,
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)),
+	})
+	if isAwsError[*types.NoSuchKey](err) {
+		if upload.store.PartialDownloads {
+			return upload.readParts(ctx, offset, length)
+		}
+		return nil, errIncompleteUpload
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// ModTime returns the last modification time of the upload's object. The object
+// only exists once the upload is finished. Before, the time is unknown.
+func (upload *s3Upload) ModTime(ctx context.Context) (time.Time, error) {
+	key, err := upload.contentKey(ctx)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	res, err := upload.store.Service.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(upload.store.Bucket),
+		Key:    key,
+	})
+	if isAwsError[*types.NoSuchKey](err) || isAwsError[*types.NotFound](err) {
+		if upload.store.PartialDownloads {
+			return time.Time{}, nil
+		}
+		return time.Time{}, errIncompleteUpload
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return aws.ToTime(res.LastModified), nil
+}
@@ -0,0 +1,99 @@
+package s3store
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+var _ handler.RangeReaderDataStore = S3Store{}
+
+func TestS3RangeReadableUpload(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	lastModified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	s3obj.EXPECT().HeadObject(gomock.Any(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+	}).Return(&s3.HeadObjectOutput{
+		LastModified: aws.Time(lastModified),
+	}, nil)
+	s3obj.EXPECT().GetObject(gomock.Any(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+		Range:  aws.String("bytes=5-7"),
+	}).Return(&s3.GetObjectOutput{
+		Body: io.NopCloser(strings.NewReader("con")),
+	}, nil)
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	rangeUpload := store.AsRangeReadableUpload(upload)
+
+	modTime, err := rangeUpload.ModTime(context.Background())
+	assert.Nil(err)
+	assert.Equal(lastModified, modTime)
+
+	reader, err := rangeUpload.GetRangeReader(context.Background(), 5, 3)
+	assert.Nil(err)
+
+	content, err := io.ReadAll(reader)
+	assert.Nil(err)
+	assert.Equal("con", string(content))
+	assert.Nil(reader.Close())
+
+	// Empty ranges are not requested from S3
+	reader, err = rangeUpload.GetRangeReader(context.Background(), 5, 0)
+	assert.Nil(err)
+
+	content, err = io.ReadAll(reader)
+	assert.Nil(err)
+	assert.Equal("", string(content))
+}
+
+func TestS3RangeReadableUploadIncomplete(t *testing.T) {
+	mockCtrl := gomock.NewController(t)
+	defer mockCtrl.Finish()
+	assert := assert.New(t)
+
+	s3obj := NewMockS3API(mockCtrl)
+	store := New("bucket", s3obj)
+
+	s3obj.EXPECT().HeadObject(gomock.Any(), &s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+	}).Return(nil, &types.NotFound{})
+	s3obj.EXPECT().GetObject(gomock.Any(), &s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("uploadId"),
+		Range:  aws.String("bytes=0-9"),
+	}).Return(nil, &types.NoSuchKey{})
+
+	upload, err := store.GetUpload(context.Background(), "uploadId+multipartId")
+	assert.Nil(err)
+
+	rangeUpload := store.AsRangeReadableUpload(upload)
+
+	_, err = rangeUpload.ModTime(context.Background())
+	assert.Equal(errIncompleteUpload, err)
+
+	_, err = rangeUpload.GetRangeReader(context.Background(), 0, 10)
+	assert.Equal(errIncompleteUpload, err)
+}
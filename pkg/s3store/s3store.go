@@ -23,7 +23,9 @@
 //
 // First of all, a new info object is stored which contains a JSON-encoded blob
 // of general information about the upload including its size and meta data.
-// This kind of objects have the suffix ".info" in their key.
+// This kind of objects have the suffix ".info" in their key. If InfoStore is
+// set, this information is saved using the InfoStore instead and no info object
+// is created.
 //
 // In addition a new multipart upload
 // (http://docs.aws.amazon.com/AmazonS3/latest/dev/uploadobjusingmpu.html) is
@@ -40,11 +42,27 @@
 // Therefore, HEAD responses will always contain the unchanged metadata, Base64-
 // encoded, even if it contains non-ASCII characters.
 //
+// If PartialDownloads is set, the parts are not pushed to the multipart upload,
+// but stored as separate objects with the suffix ".parts/[number]", because S3
+// does not allow reading the parts of a multipart upload before it is completed.
+// This allows downloading the data of unfinished uploads. Once the upload is
+// finished, the part objects are copied into the multipart upload and removed.
+//
 // Once the upload is finished, the multipart upload is completed, resulting in
 // the entire file being stored in the bucket. The info object, containing
 // meta data is not deleted. It is recommended to copy the finished upload to
 // another bucket to avoid it being deleted by the Termination extension.
 //
+// If DeduplicationPrefix is set, the finished object is hashed using SHA-256 and
+// copied to a content-addressed object, unless an object with the same content
+// exists already. Once the content-addressed object has been confirmed to exist,
+// the upload's own object is removed and its info object points to the
+// content-addressed object. For every upload referencing it, an
+// empty object with the suffix ".refs/[id]" is stored next to it. Once the last
+// reference has been removed by terminating the uploads, the content-addressed
+// object is deleted as well. This additionally requires the s3:ListBucket
+// permission.
+//
 // If an upload is about to being terminated, the multipart upload is aborted
 // which removes all of the uploaded parts from the bucket. In addition, the
 // info object is also deleted. If the upload has been finished already, the
@@ -86,6 +104,7 @@ import (
 
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/tus/tusd/v2/internal/semaphore"
+	"github.com/tus/tusd/v2/internal/storageinfo"
 	"github.com/tus/tusd/v2/internal/uid"
 	"github.com/tus/tusd/v2/pkg/handler"
 	"golang.org/x/sync/errgroup"
@@ -163,6 +182,25 @@ type S3Store struct {
 	// CPU, so it might be desirable to disable them.
 	// Note that this property is experimental and might be removed in the future!
 	DisableContentHashes bool
+	// DeduplicationPrefix enables the deduplication of finished uploads, if not empty.
+	// Content-addressed objects are stored with the key `[ObjectPrefix][DeduplicationPrefix][hash]`,
+	// e.g. using "dedup/". The finished object is read for hashing while the request
+	// finishing the upload is processed, which causes additional traffic and delays the
+	// response for large uploads. Uploads larger than 5GiB are not deduplicated.
+	// References are counted using separate objects. The upload's own object is only
+	// removed after the content-addressed object has been confirmed to exist, so
+	// terminating another upload with the same content concurrently can only remove
+	// the shared content if its delete request is delayed until after this check.
+	DeduplicationPrefix string
+	// PartialDownloads allows downloading unfinished uploads. S3 does not allow reading
+	// the parts of a multipart upload before it has been completed. Therefore, the parts
+	// are stored as separate objects with the suffix ".parts/[number]" instead and copied
+	// into the multipart upload once the upload is finished. This requires additional
+	// requests for finishing the upload and the s3:ListBucket permission.
+	PartialDownloads bool
+	// InfoStore, if set, is used to persist the uploads' FileInfo instead of
+	// the .info objects in the bucket.
+	InfoStore handler.InfoStore
 
 	// uploadSemaphore limits the number of concurrent multipart part uploads to S3.
 	uploadSemaphore semaphore.Semaphore
@@ -206,6 +244,8 @@ type S3API interface {
 	DeleteObjects(ctx context.Context, input *s3.DeleteObjectsInput, opt ...func(*s3.Options)) (*s3.DeleteObjectsOutput, error)
 	CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, opt ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
 	UploadPartCopy(ctx context.Context, input *s3.UploadPartCopyInput, opt ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error)
+	CopyObject(ctx context.Context, input *s3.CopyObjectInput, opt ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+	ListObjectsV2(ctx context.Context, input *s3.ListObjectsV2Input, opt ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
 }
 
 // New constructs a new storage using the supplied bucket and service object.
@@ -266,6 +306,9 @@ func (store S3Store) UseIn(composer *handler.StoreComposer) {
 	composer.UseConcater(store)
 	composer.UseLengthDeferrer(store)
 	composer.UseContentServer(store)
+	composer.UseMetadataUpdater(store)
+	composer.UseStateUpdater(store)
+	composer.UseRangeReader(store)
 }
 
 func (store S3Store) RegisterMetrics(registry prometheus.Registerer) {
@@ -347,11 +390,10 @@ func (store S3Store) NewUpload(ctx context.Context, info handler.FileInfo) (hand
 	multipartId := *res.UploadId
 	info.ID = objectId + "+" + multipartId
 
-	info.Storage = map[string]string{
-		"Type":   "s3store",
-		"Bucket": store.Bucket,
-		"Key":    *store.keyWithPrefix(objectId),
-	}
+	info.Storage = storageinfo.Clone(info.Storage)
+	info.Storage["Type"] = "s3store"
+	info.Storage["Bucket"] = store.Bucket
+	info.Storage["Key"] = *store.keyWithPrefix(objectId)
 
 	upload := &s3Upload{objectId, multipartId, &store, nil, []*s3Part{}, 0}
 	err = upload.writeInfo(ctx, info)
@@ -384,11 +426,23 @@ func (store S3Store) AsConcatableUpload(upload handler.Upload) handler.Concatabl
 	return upload.(*s3Upload)
 }
 
+func (store S3Store) AsMetadataUpdatableUpload(upload handler.Upload) handler.MetadataUpdatableUpload {
+	return upload.(*s3Upload)
+}
+
+func (store S3Store) AsStateUpdatableUpload(upload handler.Upload) handler.StateUpdatableUpload {
+	return upload.(*s3Upload)
+}
+
 func (upload *s3Upload) writeInfo(ctx context.Context, info handler.FileInfo) error {
 	store := upload.store
 
 	upload.info = &info
 
+	if store.InfoStore != nil {
+		return store.InfoStore.SaveInfo(ctx, info)
+	}
+
 	infoJson, err := json.Marshal(info)
 	if err != nil {
 		return err
@@ -444,6 +498,14 @@ func (upload *s3Upload) WriteChunk(ctx context.Context, offset int64, src io.Rea
 
 	upload.info.Offset += bytesUploaded
 
+	// Keep the offset in the InfoStore up to date. It is only informational, since
+	// the offset is always calculated from the uploaded parts.
+	if store.InfoStore != nil && bytesUploaded > 0 {
+		if saveErr := store.InfoStore.SaveInfo(ctx, *upload.info); err == nil {
+			err = saveErr
+		}
+	}
+
 	return bytesUploaded, err
 }
 
@@ -506,17 +568,25 @@ func (upload *s3Upload) uploadParts(ctx context.Context, offset int64, src io.Re
 				defer upload.store.releaseUploadSemaphore()
 
 				t := time.Now()
-				uploadPartInput := &s3.UploadPartInput{
-					Bucket:     aws.String(store.Bucket),
-					Key:        store.keyWithPrefix(upload.objectId),
-					UploadId:   aws.String(upload.multipartId),
-					PartNumber: aws.Int32(part.number),
+				var err error
+				if store.PartialDownloads {
+					// The part object is only copied into the multipart upload once the
+					// upload is finished, so its ETag stays empty.
+					err = store.putPartObject(ctx, upload.objectId, part.number, partfile, part.size)
+				} else {
+					uploadPartInput := &s3.UploadPartInput{
+						Bucket:     aws.String(store.Bucket),
+						Key:        store.keyWithPrefix(upload.objectId),
+						UploadId:   aws.String(upload.multipartId),
+						PartNumber: aws.Int32(part.number),
+					}
+					var etag string
+					etag, err = upload.putPartForUpload(ctx, uploadPartInput, partfile, part.size)
+					if err == nil {
+						part.etag = etag
+					}
 				}
-				etag, err := upload.putPartForUpload(ctx, uploadPartInput, partfile, part.size)
 				store.observeRequestDuration(t, metricUploadPart)
-				if err == nil {
-					part.etag = etag
-				}
 
 				cerr := closePart()
 				if err != nil {
@@ -649,9 +719,27 @@ func (upload s3Upload) fetchInfo(ctx context.Context) (info handler.FileInfo, pa
 	var infoErr error
 	var partsErr error
 	var incompletePartSizeErr error
+	var partObjects []*s3Part
+	var partObjectsErr error
+
+	if store.PartialDownloads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Get the parts, which have not been copied into the multipart upload yet
+			partObjects, partObjectsErr = store.listPartObjects(ctx, upload.objectId)
+		}()
+	}
 
 	go func() {
 		defer wg.Done()
+
+		if store.InfoStore != nil {
+			info, infoErr = store.InfoStore.GetInfo(ctx, upload.objectId+"+"+upload.multipartId)
+			return
+		}
+
 		t := time.Now()
 
 		// Get file info stored in separate object
@@ -718,6 +806,18 @@ func (upload s3Upload) fetchInfo(ctx context.Context) (info handler.FileInfo, pa
 		return
 	}
 
+	if partObjectsErr != nil {
+		err = partObjectsErr
+		return
+	}
+
+	// Until the upload is finished, its data is stored in the part objects. Parts, which
+	// have already been copied into the multipart upload by an interrupted FinishUpload,
+	// are copied again.
+	if len(partObjects) > 0 {
+		parts = partObjects
+	}
+
 	// The offset is the sum of all part sizes and the size of the incomplete part file.
 	offset := incompletePartSize
 	for _, part := range parts {
@@ -732,10 +832,15 @@ func (upload s3Upload) fetchInfo(ctx context.Context) (info handler.FileInfo, pa
 func (upload s3Upload) GetReader(ctx context.Context) (io.ReadCloser, error) {
 	store := upload.store
 
+	key, err := upload.contentKey(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	// Attempt to get upload content
 	res, err := store.Service.GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(store.Bucket),
-		Key:    store.keyWithPrefix(upload.objectId),
+		Key:    key,
 	})
 	if err == nil {
 		// No error occurred, and we are able to stream the object
@@ -758,7 +863,11 @@ func (upload s3Upload) GetReader(ctx context.Context) (io.ReadCloser, error) {
 		MaxParts: aws.Int32(0),
 	})
 	if err == nil {
-		// The multipart upload still exists, which means we cannot download it yet
+		// The multipart upload still exists, which means the upload has not been
+		// finished yet. Its data can only be read if it is stored in part objects.
+		if store.PartialDownloads {
+			return upload.readParts(ctx, 0, -1)
+		}
 		return nil, errIncompleteUpload
 	}
 
@@ -776,9 +885,20 @@ func (upload s3Upload) GetReader(ctx context.Context) (io.ReadCloser, error) {
 func (upload s3Upload) Terminate(ctx context.Context) error {
 	store := upload.store
 
+	// The content of deduplicated uploads is shared and only removed together
+	// with the last reference.
+	var hash string
+	if store.DeduplicationPrefix != "" {
+		info, err := upload.GetInfo(ctx)
+		if err != nil {
+			return err
+		}
+		hash = info.Storage[storageKeyContentHash]
+	}
+
 	var wg sync.WaitGroup
 	wg.Add(2)
-	errCh := make(chan error, 4)
+	errCh := make(chan error, 6)
 
 	go func() {
 		defer wg.Done()
@@ -794,6 +914,33 @@ func (upload s3Upload) Terminate(ctx context.Context) error {
 		}
 	}()
 
+	if store.PartialDownloads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Delete the parts, which have not been copied into the multipart upload
+			parts, err := store.listPartObjects(ctx, upload.objectId)
+			if err == nil {
+				err = store.deletePartObjects(ctx, upload.objectId, parts)
+			}
+			if err != nil {
+				errCh <- err
+			}
+		}()
+	}
+
+	if store.InfoStore != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := store.InfoStore.DeleteInfo(ctx, upload.objectId+"+"+upload.multipartId); err != nil {
+				errCh <- err
+			}
+		}()
+	}
+
 	go func() {
 		defer wg.Done()
 
@@ -831,12 +978,16 @@ func (upload s3Upload) Terminate(ctx context.Context) error {
 	wg.Wait()
 
 	close(errCh)
-	errs := make([]error, 0, 4)
+	errs := make([]error, 0, 6)
 	for err := range errCh {
 		errs = append(errs, err)
 	}
 
-	return errors.Join(errs...)
+	if err := errors.Join(errs...); err != nil || hash == "" {
+		return err
+	}
+
+	return upload.releaseContent(ctx, hash)
 }
 
 func (upload s3Upload) FinishUpload(ctx context.Context) error {
@@ -873,6 +1024,12 @@ func (upload s3Upload) FinishUpload(ctx context.Context) error {
 
 	}
 
+	// Parts stored as separate objects must be copied into the multipart upload first.
+	copiedParts, err := upload.copyPartObjects(ctx, parts)
+	if err != nil {
+		return err
+	}
+
 	// Transform the []*s3.Part slice to a []*s3.CompletedPart slice for the next
 	// request.
 	completedParts := make([]types.CompletedPart, len(parts))
@@ -894,8 +1051,17 @@ func (upload s3Upload) FinishUpload(ctx context.Context) error {
 		},
 	})
 	store.observeRequestDuration(t, metricCompleteMultipartUpload)
+	if err != nil {
+		return err
+	}
 
-	return err
+	if len(copiedParts) > 0 {
+		if err := store.deletePartObjects(ctx, upload.objectId, copiedParts); err != nil {
+			return err
+		}
+	}
+
+	return upload.deduplicate(ctx)
 }
 
 func (upload *s3Upload) ConcatUploads(ctx context.Context, partialUploads []handler.Upload) error {
@@ -916,7 +1082,13 @@ func (upload *s3Upload) ConcatUploads(ctx context.Context, partialUploads []hand
 	// the files.
 	// So instead we have to download them and concat them on disk.
 	if hasSmallPart {
-		return upload.concatUsingDownload(ctx, partialUploads)
+		if err := upload.concatUsingDownload(ctx, partialUploads); err != nil {
+			return err
+		}
+
+		// The object has been uploaded without completing the multipart upload,
+		// so it must be deduplicated here.
+		return upload.deduplicate(ctx)
 	} else {
 		return upload.concatUsingMultipart(ctx, partialUploads)
 	}
@@ -936,9 +1108,14 @@ func (upload *s3Upload) concatUsingDownload(ctx context.Context, partialUploads
 	for _, partialUpload := range partialUploads {
 		partialS3Upload := partialUpload.(*s3Upload)
 
+		key, err := partialS3Upload.contentKey(ctx)
+		if err != nil {
+			return err
+		}
+
 		res, err := store.Service.GetObject(ctx, &s3.GetObjectInput{
 			Bucket: aws.String(store.Bucket),
-			Key:    store.keyWithPrefix(partialS3Upload.objectId),
+			Key:    key,
 		})
 		if err != nil {
 			return err
@@ -994,13 +1171,18 @@ func (upload *s3Upload) concatUsingMultipart(ctx context.Context, partialUploads
 		partNumber := int32(i + 1)
 		partialS3Upload := partialUpload.(*s3Upload)
 
+		key, err := partialS3Upload.contentKey(ctx)
+		if err != nil {
+			return err
+		}
+
 		eg.Go(func() error {
 			res, err := store.Service.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
 				Bucket:     aws.String(store.Bucket),
 				Key:        store.keyWithPrefix(upload.objectId),
 				UploadId:   aws.String(upload.multipartId),
 				PartNumber: aws.Int32(partNumber),
-				CopySource: aws.String(store.Bucket + "/" + *store.keyWithPrefix(partialS3Upload.objectId)),
+				CopySource: aws.String(store.Bucket + "/" + *key),
 			})
 			if err != nil {
 				return err
@@ -1035,6 +1217,26 @@ func (upload *s3Upload) DeclareLength(ctx context.Context, length int64) error {
 	return upload.writeInfo(ctx, info)
 }
 
+func (upload *s3Upload) UpdateMetaData(ctx context.Context, metaData handler.MetaData) error {
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+	info.MetaData = metaData
+
+	return upload.writeInfo(ctx, info)
+}
+
+func (upload *s3Upload) UpdateState(ctx context.Context, state handler.UploadState) error {
+	info, err := upload.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+	info.State = &state
+
+	return upload.writeInfo(ctx, info)
+}
+
 func (store S3Store) listAllParts(ctx context.Context, objectId string, multipartId string) (parts []*s3Part, err error) {
 	var partMarker *string
 	for {
@@ -19,9 +19,14 @@ func (store S3Store) AsServableUpload(upload handler.Upload) handler.ServableUpl
 }
 
 func (upload *s3Upload) ServeContent(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	key, err := upload.contentKey(ctx)
+	if err != nil {
+		return err
+	}
+
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(upload.store.Bucket),
-		Key:    upload.store.keyWithPrefix(upload.objectId),
+		Key:    key,
 	}
 
 	// Forward the Range, If-Match, If-None-Match, If-Unmodified-Since, If-Modified-Since headers if present
@@ -0,0 +1,139 @@
+package s3store
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/smithy-go"
+	smithytracing "github.com/aws/smithy-go/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NewTracerProvider adapts an OpenTelemetry tracer provider for use in the AWS SDK,
+// so that spans are created for every S3 API call. It can be assigned to
+// s3.Options.TracerProvider when creating the S3 client:
+//
+//	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+//		o.TracerProvider = s3store.NewTracerProvider(otel.GetTracerProvider())
+//	})
+//
+// The spans are children of the span contained in the context passed to the
+// store, e.g. the span for the current HTTP request.
+func NewTracerProvider(tp trace.TracerProvider) smithytracing.TracerProvider {
+	return tracerProvider{tp}
+}
+
+type tracerProvider struct {
+	tp trace.TracerProvider
+}
+
+func (p tracerProvider) Tracer(scope string, _ ...smithytracing.TracerOption) smithytracing.Tracer {
+	return tracer{p.tp.Tracer(scope)}
+}
+
+type tracer struct {
+	t trace.Tracer
+}
+
+func (t tracer) StartSpan(ctx context.Context, name string, opts ...smithytracing.SpanOption) (context.Context, smithytracing.Span) {
+	var options smithytracing.SpanOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	ctx, s := t.t.Start(ctx, name,
+		trace.WithSpanKind(convertSpanKind(options.Kind)),
+		trace.WithAttributes(convertProperties(options.Properties)...),
+	)
+
+	return ctx, span{name, s}
+}
+
+type span struct {
+	name string
+	s    trace.Span
+}
+
+func (s span) Name() string {
+	return s.name
+}
+
+func (s span) Context() smithytracing.SpanContext {
+	sc := s.s.SpanContext()
+	return smithytracing.SpanContext{
+		TraceID:  sc.TraceID().String(),
+		SpanID:   sc.SpanID().String(),
+		IsRemote: sc.IsRemote(),
+	}
+}
+
+func (s span) AddEvent(name string, opts ...smithytracing.EventOption) {
+	var options smithytracing.EventOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	s.s.AddEvent(name, trace.WithAttributes(convertProperties(options.Properties)...))
+}
+
+func (s span) SetStatus(status smithytracing.SpanStatus) {
+	switch status {
+	case smithytracing.SpanStatusOK:
+		s.s.SetStatus(codes.Ok, "")
+	case smithytracing.SpanStatusError:
+		s.s.SetStatus(codes.Error, "")
+	}
+}
+
+func (s span) SetProperty(k, v any) {
+	s.s.SetAttributes(convertProperty(k, v))
+}
+
+func (s span) End() {
+	s.s.End()
+}
+
+func convertSpanKind(kind smithytracing.SpanKind) trace.SpanKind {
+	switch kind {
+	case smithytracing.SpanKindClient:
+		return trace.SpanKindClient
+	case smithytracing.SpanKindServer:
+		return trace.SpanKindServer
+	case smithytracing.SpanKindProducer:
+		return trace.SpanKindProducer
+	case smithytracing.SpanKindConsumer:
+		return trace.SpanKindConsumer
+	default:
+		return trace.SpanKindInternal
+	}
+}
+
+func convertProperties(props smithy.Properties) []attribute.KeyValue {
+	values := props.Values()
+	attrs := make([]attribute.KeyValue, 0, len(values))
+	for k, v := range values {
+		attrs = append(attrs, convertProperty(k, v))
+	}
+
+	return attrs
+}
+
+func convertProperty(k, v any) attribute.KeyValue {
+	key := fmt.Sprint(k)
+	switch v := v.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	default:
+		return attribute.String(key, fmt.Sprint(v))
+	}
+}
@@ -0,0 +1,167 @@
+package sftpstore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/sync/semaphore"
+)
+
+// DialFunc opens a new connection to the SFTP server.
+type DialFunc func(ctx context.Context) (*sftp.Client, error)
+
+// SSHDialer returns a DialFunc, which connects to the SSH server at addr (in the form
+// host:port) and starts the SFTP subsystem. The config specifies the user, the
+// authentication methods, such as ssh.PublicKeys for key-based authentication, and
+// how the server's host key is verified.
+func SSHDialer(addr string, config *ssh.ClientConfig) DialFunc {
+	return func(ctx context.Context) (*sftp.Client, error) {
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+
+		sshConn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		sshClient := ssh.NewClient(sshConn, chans, reqs)
+
+		client, err := sftp.NewClient(sshClient)
+		if err != nil {
+			sshClient.Close()
+			return nil, err
+		}
+
+		// Closing the SFTP client only ends its session, so the SSH connection
+		// is closed once the session is over.
+		go func() {
+			client.Wait()
+			sshClient.Close()
+		}()
+
+		return client, nil
+	}
+}
+
+// Pool keeps connections to the SFTP server open, so they can be reused by
+// subsequent requests. Connections closed by the server are removed from the
+// pool automatically.
+type Pool struct {
+	dial DialFunc
+	sem  *semaphore.Weighted
+
+	mutex sync.Mutex
+	// conns contains all open connections, including the ones in use.
+	conns map[*sftp.Client]struct{}
+	// idle contains the open connections, which are not in use.
+	idle []*sftp.Client
+	// closed is set once the pool has been closed.
+	closed bool
+}
+
+// NewPool creates a pool, which uses dial to open connections. At most
+// maxConnections connections are open at the same time. Further requests wait
+// until a connection is returned to the pool.
+func NewPool(dial DialFunc, maxConnections int) *Pool {
+	return &Pool{
+		dial:  dial,
+		sem:   semaphore.NewWeighted(int64(max(maxConnections, 1))),
+		conns: make(map[*sftp.Client]struct{}),
+	}
+}
+
+// Get returns an idle connection or opens a new one. The connection must be
+// returned to the pool using Put once it is not needed anymore.
+func (pool *Pool) Get(ctx context.Context) (*sftp.Client, error) {
+	if err := pool.sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	pool.mutex.Lock()
+	if n := len(pool.idle); n > 0 {
+		client := pool.idle[n-1]
+		pool.idle = pool.idle[:n-1]
+		pool.mutex.Unlock()
+		return client, nil
+	}
+	pool.mutex.Unlock()
+
+	client, err := pool.dial(ctx)
+	if err != nil {
+		pool.sem.Release(1)
+		return nil, err
+	}
+
+	pool.mutex.Lock()
+	pool.conns[client] = struct{}{}
+	pool.mutex.Unlock()
+
+	go func() {
+		client.Wait()
+		pool.remove(client)
+	}()
+
+	return client, nil
+}
+
+// Put returns the connection to the pool. err is the result of the last operation
+// using the connection. If it indicates that the connection is broken, the connection
+// is closed instead of being reused.
+func (pool *Pool) Put(client *sftp.Client, err error) {
+	defer pool.sem.Release(1)
+
+	if errors.Is(err, sftp.ErrSSHFxConnectionLost) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) {
+		client.Close()
+		return
+	}
+
+	pool.mutex.Lock()
+	_, open := pool.conns[client]
+	closed := pool.closed
+	if open && !closed {
+		pool.idle = append(pool.idle, client)
+	}
+	pool.mutex.Unlock()
+
+	if open && closed {
+		client.Close()
+	}
+}
+
+// Close closes all idle connections. Connections in use are closed once they are
+// returned to the pool.
+func (pool *Pool) Close() error {
+	pool.mutex.Lock()
+	idle := pool.idle
+	pool.idle = nil
+	pool.closed = true
+	pool.mutex.Unlock()
+
+	var errs []error
+	for _, client := range idle {
+		errs = append(errs, client.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// remove forgets about a closed connection.
+func (pool *Pool) remove(client *sftp.Client) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+
+	delete(pool.conns, client)
+	for i, idle := range pool.idle {
+		if idle == client {
+			pool.idle = append(pool.idle[:i], pool.idle[i+1:]...)
+			break
+		}
+	}
+}
@@ -0,0 +1,462 @@
+// Package sftpstore provides a storage backend storing uploads on a remote SFTP server.
+//
+// SFTPStore is a storage backend used as a handler.DataStore in handler.NewHandler.
+// It lays out the uploads on the SFTP server in the same way as the filestore package
+// on the local disk: The `[id].info` files are used to store the fileinfo in JSON
+// format. The `[id]` files without an extension contain the raw binary data uploaded.
+// Files and directories are created with the SFTP server's default permissions.
+//
+// The connections to the SFTP server are managed by a Pool, which reuses them across
+// requests. SSHDialer connects to an SSH server using key-based or any other
+// authentication supported by golang.org/x/crypto/ssh:
+//
+//	signer, err := ssh.ParsePrivateKey(key)
+//	pool := sftpstore.NewPool(sftpstore.SSHDialer("sftp.example.com:22", &ssh.ClientConfig{
+//		User:            "tusd",
+//		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+//		HostKeyCallback: hostKeyCallback,
+//	}), 10)
+//
+//	composer := handler.NewStoreComposer()
+//	sftpstore.New("uploads", pool).UseIn(composer)
+//	memorylocker.New().UseIn(composer)
+//
+// Uploaded data is written, and downloaded data read, in blocks of 1MiB. A connection
+// is only taken from the pool for each block, so clients sending or receiving data
+// slowly do not keep connections from other requests.
+//
+// Concatenating uploads downloads the partial uploads' data and uploads it again,
+// since SFTP offers no way of copying files on the server.
+package sftpstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path"
+
+	"github.com/pkg/sftp"
+	"github.com/tus/tusd/v2/internal/storageinfo"
+	"github.com/tus/tusd/v2/internal/uid"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+const (
+	// StorageKeyPath is the key of the path of uploaded file in handler.FileInfo.Storage
+	StorageKeyPath = "Path"
+	// StorageKeyInfoPath is the key of the path of .info file in handler.FileInfo.Storage
+	StorageKeyInfoPath = "InfoPath"
+)
+
+// blockSize is the amount of data written or read using a single connection from
+// the pool before it is returned.
+const blockSize = 1024 * 1024
+
+// See the handler.DataStore interface for documentation about the different
+// methods.
+type SFTPStore struct {
+	// Path is the relative or absolute path on the SFTP server to store files in.
+	// Relative paths are resolved against the server's working directory, which
+	// usually is the user's home directory.
+	Path string
+	// Pool provides the connections to the SFTP server.
+	Pool *Pool
+}
+
+// New creates a new SFTP based storage backend, which stores the uploads in the
+// directory on the server, to which the pool connects. The directory is created
+// on demand.
+func New(path string, pool *Pool) SFTPStore {
+	return SFTPStore{
+		Path: path,
+		Pool: pool,
+	}
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// all possible extension to it.
+func (store SFTPStore) UseIn(composer *handler.StoreComposer) {
+	composer.UseCore(store)
+	composer.UseTerminater(store)
+	composer.UseConcater(store)
+	composer.UseLengthDeferrer(store)
+	composer.UseStateUpdater(store)
+}
+
+// withClient calls fn with a connection from the pool.
+func (store SFTPStore) withClient(ctx context.Context, fn func(client *sftp.Client) error) error {
+	client, err := store.Pool.Get(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = fn(client)
+	store.Pool.Put(client, err)
+	return err
+}
+
+func (store SFTPStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	if info.ID == "" {
+		info.ID = uid.Uid()
+	}
+
+	// The .info file's location can directly be deduced from the upload ID
+	infoPath := store.infoPath(info.ID)
+	// The binary file's location might be modified by the pre-create hook.
+	var binPath string
+	if info.Storage != nil && info.Storage[StorageKeyPath] != "" {
+		// Absolute paths get used as-is, while relative paths are joined to the
+		// storage path.
+		if path.IsAbs(info.Storage[StorageKeyPath]) {
+			binPath = info.Storage[StorageKeyPath]
+		} else {
+			binPath = path.Join(store.Path, info.Storage[StorageKeyPath])
+		}
+	} else {
+		binPath = store.defaultBinPath(info.ID)
+	}
+
+	info.Storage = storageinfo.Clone(info.Storage)
+	info.Storage["Type"] = "sftpstore"
+	info.Storage[StorageKeyPath] = binPath
+	info.Storage[StorageKeyInfoPath] = infoPath
+
+	upload := &sftpUpload{
+		store:    store,
+		info:     info,
+		infoPath: infoPath,
+		binPath:  binPath,
+	}
+
+	err := store.withClient(ctx, func(client *sftp.Client) error {
+		// Create binary file with no content. O_EXCL ensures that the data of an
+		// existing upload with the same ID is not truncated.
+		if err := createFile(client, binPath, os.O_EXCL, nil); err != nil {
+			return err
+		}
+
+		return upload.writeInfo(client)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+func (store SFTPStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	upload := &sftpUpload{
+		store:    store,
+		infoPath: store.infoPath(id),
+	}
+
+	err := store.withClient(ctx, func(client *sftp.Client) error {
+		file, err := client.Open(upload.infoPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		if err := json.NewDecoder(file).Decode(&upload.info); err != nil {
+			return err
+		}
+
+		upload.binPath = upload.info.Storage[StorageKeyPath]
+		if upload.binPath == "" {
+			upload.binPath = store.defaultBinPath(upload.info.ID)
+		}
+
+		stat, err := client.Stat(upload.binPath)
+		if err != nil {
+			return err
+		}
+
+		upload.info.Offset = stat.Size()
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// Interpret os.ErrNotExist as 404 Not Found
+			err = handler.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+func (store SFTPStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
+	return upload.(*sftpUpload)
+}
+
+func (store SFTPStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
+	return upload.(*sftpUpload)
+}
+
+func (store SFTPStore) AsConcatableUpload(upload handler.Upload) handler.ConcatableUpload {
+	return upload.(*sftpUpload)
+}
+
+func (store SFTPStore) AsStateUpdatableUpload(upload handler.Upload) handler.StateUpdatableUpload {
+	return upload.(*sftpUpload)
+}
+
+// defaultBinPath returns the path to the file storing the binary data, if it is
+// not customized using the pre-create hook.
+func (store SFTPStore) defaultBinPath(id string) string {
+	return path.Join(store.Path, id)
+}
+
+// infoPath returns the path to the .info file storing the file's info.
+func (store SFTPStore) infoPath(id string) string {
+	return path.Join(store.Path, id+".info")
+}
+
+type sftpUpload struct {
+	store SFTPStore
+	// info stores the current information about the upload
+	info handler.FileInfo
+	// infoPath is the path to the .info file
+	infoPath string
+	// binPath is the path to the binary file (which has no extension)
+	binPath string
+}
+
+func (upload *sftpUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
+	return upload.info, nil
+}
+
+func (upload *sftpUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	// The data is read from src without holding a connection, so slow clients
+	// cannot exhaust the pool. A connection is only taken for writing each block.
+	buf := make([]byte, blockSize)
+	var n int64
+	for {
+		read, readErr := io.ReadFull(src, buf)
+		if read > 0 {
+			err := upload.store.withClient(ctx, func(client *sftp.Client) error {
+				return writeAt(client, upload.binPath, buf[:read], offset+n)
+			})
+			if err != nil {
+				return n, err
+			}
+			n += int64(read)
+			upload.info.Offset += int64(read)
+		}
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return n, nil
+		}
+		if readErr != nil {
+			return n, readErr
+		}
+	}
+}
+
+func (upload *sftpUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	err := upload.store.withClient(ctx, func(client *sftp.Client) error {
+		_, err := client.Stat(upload.binPath)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &sftpReader{
+		ctx:    ctx,
+		upload: upload,
+	}, nil
+}
+
+func (upload *sftpUpload) Terminate(ctx context.Context) error {
+	return upload.store.withClient(ctx, func(client *sftp.Client) error {
+		// We ignore errors indicating that the files cannot be found because we want
+		// to delete them anyways.
+		err := client.Remove(upload.binPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		err = client.Remove(upload.infoPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		return nil
+	})
+}
+
+func (upload *sftpUpload) ConcatUploads(ctx context.Context, uploads []handler.Upload) error {
+	return upload.store.withClient(ctx, func(client *sftp.Client) (err error) {
+		file, err := client.OpenFile(upload.binPath, os.O_WRONLY)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			// Ensure that close error is propagated, if it occurs.
+			cerr := file.Close()
+			if err == nil {
+				err = cerr
+			}
+		}()
+
+		for _, partialUpload := range uploads {
+			if err := partialUpload.(*sftpUpload).appendTo(client, file); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (upload *sftpUpload) appendTo(client *sftp.Client, file *sftp.File) error {
+	src, err := client.Open(upload.binPath)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(file, src); err != nil {
+		src.Close()
+		return err
+	}
+
+	return src.Close()
+}
+
+func (upload *sftpUpload) DeclareLength(ctx context.Context, length int64) error {
+	upload.info.Size = length
+	upload.info.SizeIsDeferred = false
+	return upload.store.withClient(ctx, upload.writeInfo)
+}
+
+func (upload *sftpUpload) UpdateState(ctx context.Context, state handler.UploadState) error {
+	upload.info.State = &state
+	return upload.store.withClient(ctx, upload.writeInfo)
+}
+
+// writeInfo updates the entire information. Everything will be overwritten.
+func (upload *sftpUpload) writeInfo(client *sftp.Client) error {
+	data, err := json.Marshal(upload.info)
+	if err != nil {
+		return err
+	}
+	return createFile(client, upload.infoPath, os.O_TRUNC, data)
+}
+
+func (upload *sftpUpload) FinishUpload(ctx context.Context) error {
+	return nil
+}
+
+// sftpReader reads the upload's data in blocks. A connection is only taken from
+// the pool for reading each block, so slow clients cannot exhaust the pool.
+type sftpReader struct {
+	ctx    context.Context
+	upload *sftpUpload
+	// offset is the position in the file, from which the next block is read.
+	offset int64
+	// buf holds the last block read and data the part of it not yet consumed.
+	buf  []byte
+	data []byte
+	// err is returned once data is consumed.
+	err error
+}
+
+func (reader *sftpReader) Read(p []byte) (int, error) {
+	if len(reader.data) == 0 {
+		if reader.err != nil {
+			return 0, reader.err
+		}
+		reader.fill()
+	}
+
+	n := copy(p, reader.data)
+	reader.data = reader.data[n:]
+	if len(reader.data) == 0 && reader.err != nil {
+		return n, reader.err
+	}
+	return n, nil
+}
+
+// fill reads the next block from the file.
+func (reader *sftpReader) fill() {
+	if reader.buf == nil {
+		reader.buf = make([]byte, blockSize)
+	}
+
+	var n int
+	err := reader.upload.store.withClient(reader.ctx, func(client *sftp.Client) error {
+		file, err := client.Open(reader.upload.binPath)
+		if err != nil {
+			return err
+		}
+
+		n, err = file.ReadAt(reader.buf, reader.offset)
+		if err != nil && err != io.EOF {
+			file.Close()
+			return err
+		}
+		if cerr := file.Close(); cerr != nil {
+			return cerr
+		}
+		return err
+	})
+
+	reader.data = reader.buf[:n]
+	reader.offset += int64(n)
+	reader.err = err
+}
+
+func (reader *sftpReader) Close() error {
+	return nil
+}
+
+// writeAt writes data to the existing file at the offset.
+func writeAt(client *sftp.Client, p string, data []byte, offset int64) error {
+	file, err := client.OpenFile(p, os.O_WRONLY)
+	if err != nil {
+		return err
+	}
+
+	// Avoid the use of defer file.Close() here to ensure no errors are lost.
+	if _, err := file.WriteAt(data, offset); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// createFile creates the file with the content. If the corresponding directory does not exist,
+// it is created. flag is either os.O_TRUNC for replacing an existing file or os.O_EXCL
+// for failing if the file exists.
+func createFile(client *sftp.Client, p string, flag int, content []byte) error {
+	file, err := client.OpenFile(p, os.O_CREATE|os.O_WRONLY|flag)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+
+		// An upload ID containing slashes is mapped onto different directories,
+		// which are created if they are missing.
+		if err := client.MkdirAll(path.Dir(p)); err != nil {
+			return err
+		}
+
+		file, err = client.OpenFile(p, os.O_CREATE|os.O_WRONLY|flag)
+		if err != nil {
+			return err
+		}
+	}
+
+	if content != nil {
+		if _, err := file.Write(content); err != nil {
+			file.Close()
+			return err
+		}
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,476 @@
+package sftpstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Test interface implementation of SFTPStore
+var _ handler.DataStore = SFTPStore{}
+var _ handler.TerminaterDataStore = SFTPStore{}
+var _ handler.ConcaterDataStore = SFTPStore{}
+var _ handler.LengthDeferrerDataStore = SFTPStore{}
+var _ handler.StateUpdaterDataStore = SFTPStore{}
+
+// pipeDialer connects to an in-process SFTP server serving the directory.
+func pipeDialer(dir string) DialFunc {
+	return func(ctx context.Context) (*sftp.Client, error) {
+		clientConn, serverConn := net.Pipe()
+
+		server, err := sftp.NewServer(serverConn, sftp.WithServerWorkingDirectory(dir))
+		if err != nil {
+			return nil, err
+		}
+		go server.Serve()
+
+		return sftp.NewClientPipe(clientConn, clientConn)
+	}
+}
+
+func newStore(t *testing.T) (SFTPStore, string) {
+	dir := t.TempDir()
+	pool := NewPool(pipeDialer(dir), 2)
+	t.Cleanup(func() { pool.Close() })
+
+	return New("uploads", pool), dir
+}
+
+func TestSFTPStore(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, dir := newStore(t)
+
+	// Create new upload
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size: 42,
+		MetaData: map[string]string{
+			"hello": "world",
+		},
+	})
+	a.NoError(err)
+
+	// Check info without writing
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(42, info.Size)
+	a.EqualValues(0, info.Offset)
+	a.Equal(handler.MetaData{"hello": "world"}, info.MetaData)
+	a.Equal("sftpstore", info.Storage["Type"])
+	a.Equal("uploads/"+info.ID, info.Storage[StorageKeyPath])
+	a.Equal("uploads/"+info.ID+".info", info.Storage[StorageKeyInfoPath])
+
+	// The files are laid out like in filestore
+	a.FileExists(filepath.Join(dir, "uploads", info.ID))
+	a.FileExists(filepath.Join(dir, "uploads", info.ID+".info"))
+
+	// Write data to upload
+	bytesWritten, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello "))
+	a.NoError(err)
+	a.EqualValues(len("hello "), bytesWritten)
+
+	// Resume the upload
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(6, info.Offset)
+	a.Equal(handler.MetaData{"hello": "world"}, info.MetaData)
+
+	bytesWritten, err = upload.WriteChunk(ctx, 6, strings.NewReader("world"))
+	a.NoError(err)
+	a.EqualValues(len("world"), bytesWritten)
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(11, info.Offset)
+
+	// Read content
+	reader, err := upload.GetReader(ctx)
+	a.NoError(err)
+
+	content, err := io.ReadAll(reader)
+	a.NoError(err)
+	a.Equal("hello world", string(content))
+	a.NoError(reader.Close())
+
+	content, err = os.ReadFile(filepath.Join(dir, "uploads", info.ID))
+	a.NoError(err)
+	a.Equal("hello world", string(content))
+
+	a.NoError(upload.FinishUpload(ctx))
+
+	// Terminate upload
+	a.NoError(store.AsTerminatableUpload(upload).Terminate(ctx))
+
+	// Test if upload is deleted
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.Equal(nil, upload)
+	a.Equal(handler.ErrNotFound, err)
+}
+
+func TestCreateDirectories(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, dir := newStore(t)
+
+	// Upload IDs containing slashes are mapped onto directories
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		ID:   "hello/world/123",
+		Size: 5,
+	})
+	a.NoError(err)
+
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello"))
+	a.NoError(err)
+
+	content, err := os.ReadFile(filepath.Join(dir, "uploads", "hello", "world", "123"))
+	a.NoError(err)
+	a.Equal("hello", string(content))
+	a.FileExists(filepath.Join(dir, "uploads", "hello", "world", "123.info"))
+}
+
+func TestNotFound(t *testing.T) {
+	a := assert.New(t)
+	store, _ := newStore(t)
+
+	upload, err := store.GetUpload(context.Background(), "upload-that-does-not-exist")
+	a.Error(err)
+	a.Equal(handler.ErrNotFound, err)
+	a.Equal(nil, upload)
+}
+
+func TestExistingUpload(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, dir := newStore(t)
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{ID: "123", Size: 5})
+	a.NoError(err)
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello"))
+	a.NoError(err)
+
+	// Creating an upload with the same ID must not truncate the existing data.
+	_, err = store.NewUpload(ctx, handler.FileInfo{ID: "123", Size: 5})
+	a.Error(err)
+
+	content, err := os.ReadFile(filepath.Join(dir, "uploads", "123"))
+	a.NoError(err)
+	a.Equal("hello", string(content))
+}
+
+func TestConcatUploads(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _ := newStore(t)
+
+	var partialUploads []handler.Upload
+	for _, content := range []string{"abc", "def", "ghi"} {
+		upload, err := store.NewUpload(ctx, handler.FileInfo{
+			Size:      3,
+			IsPartial: true,
+		})
+		a.NoError(err)
+
+		_, err = upload.WriteChunk(ctx, 0, strings.NewReader(content))
+		a.NoError(err)
+
+		partialUploads = append(partialUploads, upload)
+	}
+
+	finalUpload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size:    9,
+		IsFinal: true,
+	})
+	a.NoError(err)
+
+	err = store.AsConcatableUpload(finalUpload).ConcatUploads(ctx, partialUploads)
+	a.NoError(err)
+
+	info, err := finalUpload.GetInfo(ctx)
+	a.NoError(err)
+
+	// Fetch the upload again to get the offset from the server
+	finalUpload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+
+	info, err = finalUpload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(9, info.Offset)
+
+	reader, err := finalUpload.GetReader(ctx)
+	a.NoError(err)
+	content, err := io.ReadAll(reader)
+	a.NoError(err)
+	a.Equal("abcdefghi", string(content))
+	a.NoError(reader.Close())
+}
+
+func TestDeclareLength(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _ := newStore(t)
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		Size:           0,
+		SizeIsDeferred: true,
+	})
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.True(info.SizeIsDeferred)
+
+	err = store.AsLengthDeclarableUpload(upload).DeclareLength(ctx, 100)
+	a.NoError(err)
+
+	// The length is persisted on the server
+	upload, err = store.GetUpload(ctx, info.ID)
+	a.NoError(err)
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(100, info.Size)
+	a.False(info.SizeIsDeferred)
+}
+
+func TestPreserveStorage(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _ := newStore(t)
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		ID:      "foo",
+		Storage: map[string]string{"Custom": "value"},
+	})
+	a.NoError(err)
+
+	upload, err = store.GetUpload(ctx, "foo")
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal("value", info.Storage["Custom"])
+	a.Equal("sftpstore", info.Storage["Type"])
+}
+
+func TestPool(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	dials := 0
+	dial := pipeDialer(dir)
+	pool := NewPool(func(ctx context.Context) (*sftp.Client, error) {
+		dials++
+		return dial(ctx)
+	}, 1)
+	defer pool.Close()
+
+	// Connections are reused
+	client, err := pool.Get(ctx)
+	a.NoError(err)
+	pool.Put(client, nil)
+
+	reused, err := pool.Get(ctx)
+	a.NoError(err)
+	a.Same(client, reused)
+	a.Equal(1, dials)
+
+	// Further requests wait until a connection is returned
+	canceledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = pool.Get(canceledCtx)
+	a.Equal(context.Canceled, err)
+
+	// Broken connections are not reused
+	pool.Put(reused, sftp.ErrSSHFxConnectionLost)
+
+	client, err = pool.Get(ctx)
+	a.NoError(err)
+	a.NotSame(reused, client)
+	a.Equal(2, dials)
+	pool.Put(client, nil)
+}
+
+func TestConnectionsPerBlock(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+	pool := NewPool(pipeDialer(dir), 1)
+	defer pool.Close()
+	store := New("uploads", pool)
+
+	// Data spanning multiple blocks is written and read entirely
+	content := bytes.Repeat([]byte("tus"), blockSize)
+	upload, err := store.NewUpload(ctx, handler.FileInfo{Size: int64(len(content)) + 3})
+	a.NoError(err)
+
+	n, err := upload.WriteChunk(ctx, 0, bytes.NewReader(content))
+	a.NoError(err)
+	a.EqualValues(len(content), n)
+
+	// An open reader does not hold a connection
+	reader, err := upload.GetReader(ctx)
+	a.NoError(err)
+	defer reader.Close()
+
+	// A write waiting for data does not hold a connection
+	src, srcWriter := io.Pipe()
+	written := make(chan int64)
+	go func() {
+		n, err := upload.WriteChunk(ctx, int64(len(content)), src)
+		a.NoError(err)
+		written <- n
+	}()
+	_, err = srcWriter.Write([]byte("end"))
+	a.NoError(err)
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	a.NoError(upload.(handler.StateUpdatableUpload).UpdateState(timeoutCtx, handler.UploadState{}))
+
+	srcWriter.Close()
+	a.EqualValues(3, <-written)
+
+	data, err := io.ReadAll(reader)
+	a.NoError(err)
+	a.Equal(append(content, "end"...), data)
+}
+
+func TestSSHDialer(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	a.NoError(err)
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	a.NoError(err)
+
+	_, userKey, err := ed25519.GenerateKey(rand.Reader)
+	a.NoError(err)
+	userSigner, err := ssh.NewSignerFromKey(userKey)
+	a.NoError(err)
+
+	addr := serveSSH(t, dir, hostSigner, userSigner.PublicKey())
+
+	pool := NewPool(SSHDialer(addr, &ssh.ClientConfig{
+		User:            "tusd",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(userSigner)},
+		HostKeyCallback: ssh.FixedHostKey(hostSigner.PublicKey()),
+	}), 1)
+	defer pool.Close()
+
+	store := New("uploads", pool)
+	upload, err := store.NewUpload(ctx, handler.FileInfo{ID: "foo", Size: 11})
+	a.NoError(err)
+
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.NoError(err)
+
+	content, err := os.ReadFile(filepath.Join(dir, "uploads", "foo"))
+	a.NoError(err)
+	a.Equal("hello world", string(content))
+
+	// Connections using an unknown key are rejected
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	a.NoError(err)
+	otherSigner, err := ssh.NewSignerFromKey(otherKey)
+	a.NoError(err)
+
+	_, err = SSHDialer(addr, &ssh.ClientConfig{
+		User:            "tusd",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(otherSigner)},
+		HostKeyCallback: ssh.FixedHostKey(hostSigner.PublicKey()),
+	})(ctx)
+	a.Error(err)
+}
+
+// serveSSH starts an in-process SSH server, which accepts the user key and provides
+// the SFTP subsystem for the directory. It returns the server's address.
+func serveSSH(t *testing.T, dir string, hostSigner ssh.Signer, userKey ssh.PublicKey) string {
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if !bytes.Equal(key.Marshal(), userKey.Marshal()) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, nil
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				_, chans, reqs, err := ssh.NewServerConn(conn, config)
+				if err != nil {
+					conn.Close()
+					return
+				}
+				go ssh.DiscardRequests(reqs)
+
+				for newChannel := range chans {
+					if newChannel.ChannelType() != "session" {
+						newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+						continue
+					}
+
+					channel, requests, err := newChannel.Accept()
+					if err != nil {
+						continue
+					}
+
+					go func() {
+						for req := range requests {
+							// The payload contains the subsystem's name prefixed by its length.
+							ok := req.Type == "subsystem" && len(req.Payload) > 4 && string(req.Payload[4:]) == "sftp"
+							req.Reply(ok, nil)
+							if !ok {
+								continue
+							}
+
+							server, err := sftp.NewServer(channel, sftp.WithServerWorkingDirectory(dir))
+							if err != nil {
+								channel.Close()
+								return
+							}
+							go func() {
+								server.Serve()
+								channel.Close()
+							}()
+						}
+					}()
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
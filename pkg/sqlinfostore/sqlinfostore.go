@@ -0,0 +1,272 @@
+// Package sqlinfostore provides a handler.InfoStore saving the information about
+// uploads in an SQL database.
+//
+// Data stores, such as filestore, s3store, gcsstore and azurestore, can use an
+// SQLInfoStore for persisting the uploads' FileInfo instead of their .info files
+// or objects. The upload data itself is still saved by the data store.
+//
+// Every upload is represented by a single row in the table, which contains the entire
+// FileInfo encoded as JSON in the info column. In addition, the offset, size,
+// creation and update time as well as the values of selected meta data keys are
+// stored in separate, indexed columns, so uploads can be queried directly using SQL,
+// for example to find unfinished uploads for cleaning up:
+//
+//	SELECT id FROM tusd_uploads WHERE "offset" < size AND updated_at < '2024-01-01'
+//
+// SQLite and PostgreSQL are supported. The database connection must be opened by the
+// caller using an appropriate driver, e.g. modernc.org/sqlite or
+// github.com/jackc/pgx/v5/stdlib, and Migrate must be called once before the store
+// is used.
+package sqlinfostore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Dialect specifies the SQL variant used by the database.
+type Dialect string
+
+const (
+	DialectSQLite   Dialect = "sqlite"
+	DialectPostgres Dialect = "postgres"
+)
+
+// DefaultTable is the name of the table used by New.
+const DefaultTable = "tusd_uploads"
+
+// sqliteTimeFormat is the format of the timestamps in SQLite databases, which do not
+// have a date type. It is understood by SQLite's date functions and sorts chronologically.
+const sqliteTimeFormat = "2006-01-02 15:04:05.000000-07:00"
+
+// metaDataColumnPrefix is prepended to the meta data keys to obtain their column names.
+const metaDataColumnPrefix = "meta_"
+
+var (
+	tableRegexp   = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	metaKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// See the handler.InfoStore interface for documentation about the different
+// methods.
+type SQLInfoStore struct {
+	// DB is the connection to the database.
+	DB *sql.DB
+	// Dialect specifies whether DB is an SQLite or PostgreSQL database.
+	Dialect Dialect
+	// Table is the name of the table storing the uploads. It may only contain
+	// letters, digits and underscores.
+	Table string
+	// MetaDataKeys are the meta data keys, whose values are stored in separate,
+	// indexed columns named meta_[key]. Keys may only contain letters, digits,
+	// underscores and hyphens. Missing columns are added by Migrate.
+	MetaDataKeys []string
+}
+
+// New creates a new SQL info store using the table DefaultTable.
+func New(db *sql.DB, dialect Dialect) *SQLInfoStore {
+	return &SQLInfoStore{
+		DB:      db,
+		Dialect: dialect,
+		Table:   DefaultTable,
+	}
+}
+
+// Migrate creates the table and its indexes, if they do not exist yet. Columns for
+// meta data keys, which have been added to MetaDataKeys since the table was created,
+// are added to the existing table.
+func (store *SQLInfoStore) Migrate(ctx context.Context) error {
+	if err := store.validate(); err != nil {
+		return err
+	}
+
+	timestampType := "TIMESTAMP"
+	if store.Dialect == DialectPostgres {
+		timestampType = "TIMESTAMPTZ"
+	}
+
+	table := quote(store.Table)
+	_, err := store.DB.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		"id" TEXT PRIMARY KEY,
+		"size" BIGINT NOT NULL,
+		"size_is_deferred" BOOLEAN NOT NULL,
+		"offset" BIGINT NOT NULL,
+		"is_partial" BOOLEAN NOT NULL,
+		"is_final" BOOLEAN NOT NULL,
+		"created_at" %s NOT NULL,
+		"updated_at" %s NOT NULL,
+		"info" TEXT NOT NULL
+	)`, table, timestampType, timestampType))
+	if err != nil {
+		return fmt.Errorf("sqlinfostore: failed to create table: %w", err)
+	}
+
+	columns, err := store.columns(ctx)
+	if err != nil {
+		return err
+	}
+
+	indexedColumns := []string{"offset", "size", "created_at", "updated_at"}
+	for _, key := range store.MetaDataKeys {
+		column := metaDataColumnPrefix + key
+		if !slices.Contains(columns, column) {
+			_, err := store.DB.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s TEXT`, table, quote(column)))
+			if err != nil {
+				return fmt.Errorf("sqlinfostore: failed to add column for meta data key %q: %w", key, err)
+			}
+		}
+		indexedColumns = append(indexedColumns, column)
+	}
+
+	for _, column := range indexedColumns {
+		index := quote(store.Table + "_" + column + "_idx")
+		_, err := store.DB.ExecContext(ctx, fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (%s)`, index, table, quote(column)))
+		if err != nil {
+			return fmt.Errorf("sqlinfostore: failed to create index on %s: %w", column, err)
+		}
+	}
+
+	return nil
+}
+
+func (store *SQLInfoStore) SaveInfo(ctx context.Context, info handler.FileInfo) error {
+	if err := store.validate(); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	var timestamp any = now
+	if store.Dialect == DialectSQLite {
+		timestamp = now.Format(sqliteTimeFormat)
+	}
+
+	columns := []string{"id", "size", "size_is_deferred", "offset", "is_partial", "is_final", "created_at", "updated_at", "info"}
+	values := []any{info.ID, info.Size, info.SizeIsDeferred, info.Offset, info.IsPartial, info.IsFinal, timestamp, timestamp, string(data)}
+	for _, key := range store.MetaDataKeys {
+		value, ok := info.MetaData[key]
+		columns = append(columns, metaDataColumnPrefix+key)
+		values = append(values, sql.NullString{String: value, Valid: ok})
+	}
+
+	placeholders := make([]string, len(columns))
+	updates := make([]string, 0, len(columns))
+	for i, column := range columns {
+		placeholders[i] = "?"
+		columns[i] = quote(column)
+		// The creation time is kept when the row is updated.
+		if column != "id" && column != "created_at" {
+			updates = append(updates, columns[i]+" = excluded."+columns[i])
+		}
+	}
+
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES (%s) ON CONFLICT ("id") DO UPDATE SET %s`,
+		quote(store.Table), strings.Join(columns, ", "), strings.Join(placeholders, ", "), strings.Join(updates, ", "))
+	if _, err := store.DB.ExecContext(ctx, store.rebind(query), values...); err != nil {
+		return fmt.Errorf("sqlinfostore: failed to save info: %w", err)
+	}
+
+	return nil
+}
+
+func (store *SQLInfoStore) GetInfo(ctx context.Context, id string) (handler.FileInfo, error) {
+	var info handler.FileInfo
+	if err := store.validate(); err != nil {
+		return info, err
+	}
+
+	var data string
+	query := fmt.Sprintf(`SELECT "info" FROM %s WHERE "id" = ?`, quote(store.Table))
+	err := store.DB.QueryRowContext(ctx, store.rebind(query), id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return info, handler.ErrNotFound
+	}
+	if err != nil {
+		return info, fmt.Errorf("sqlinfostore: failed to get info: %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(data), &info); err != nil {
+		return info, err
+	}
+
+	return info, nil
+}
+
+func (store *SQLInfoStore) DeleteInfo(ctx context.Context, id string) error {
+	if err := store.validate(); err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`DELETE FROM %s WHERE "id" = ?`, quote(store.Table))
+	if _, err := store.DB.ExecContext(ctx, store.rebind(query), id); err != nil {
+		return fmt.Errorf("sqlinfostore: failed to delete info: %w", err)
+	}
+
+	return nil
+}
+
+// columns returns the names of the table's columns.
+func (store *SQLInfoStore) columns(ctx context.Context) ([]string, error) {
+	rows, err := store.DB.QueryContext(ctx, fmt.Sprintf(`SELECT * FROM %s WHERE 1 = 0`, quote(store.Table)))
+	if err != nil {
+		return nil, fmt.Errorf("sqlinfostore: failed to query columns: %w", err)
+	}
+	defer rows.Close()
+
+	return rows.Columns()
+}
+
+// validate checks the configuration, as the table and column names cannot be passed
+// as query parameters.
+func (store *SQLInfoStore) validate() error {
+	if store.Dialect != DialectSQLite && store.Dialect != DialectPostgres {
+		return fmt.Errorf("sqlinfostore: unsupported dialect %q", store.Dialect)
+	}
+	if !tableRegexp.MatchString(store.Table) {
+		return fmt.Errorf("sqlinfostore: invalid table name %q", store.Table)
+	}
+	for _, key := range store.MetaDataKeys {
+		if !metaKeyRegexp.MatchString(key) {
+			return fmt.Errorf("sqlinfostore: invalid meta data key %q", key)
+		}
+	}
+	return nil
+}
+
+// rebind replaces the ? placeholders in the query with $1, $2, etc. for PostgreSQL.
+func (store *SQLInfoStore) rebind(query string) string {
+	if store.Dialect != DialectPostgres {
+		return query
+	}
+
+	var builder strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			builder.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// quote quotes the identifier, which must have been validated before.
+func quote(identifier string) string {
+	return `"` + identifier + `"`
+}
@@ -0,0 +1,189 @@
+package sqlinfostore
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+
+	"github.com/tus/tusd/v2/pkg/filestore"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Test interface implementation of SQLInfoStore
+var _ handler.InfoStore = &SQLInfoStore{}
+
+func newStore(t *testing.T, metaDataKeys ...string) *SQLInfoStore {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "tusd.db"))
+	assert.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	store := New(db, DialectSQLite)
+	store.MetaDataKeys = metaDataKeys
+	assert.NoError(t, store.Migrate(context.Background()))
+	return store
+}
+
+func TestSQLInfoStore(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store := newStore(t, "filename", "file-type")
+
+	info := handler.FileInfo{
+		ID:   "foo",
+		Size: 100,
+		MetaData: handler.MetaData{
+			"filename": "hello.txt",
+			"other":    "value",
+		},
+		Storage: map[string]string{
+			"Type": "filestore",
+		},
+	}
+	a.NoError(store.SaveInfo(ctx, info))
+
+	result, err := store.GetInfo(ctx, "foo")
+	a.NoError(err)
+	a.Equal(info, result)
+
+	var createdAt time.Time
+	var offset int64
+	var filename, filetype sql.NullString
+	row := store.DB.QueryRow(`SELECT "created_at", "offset", "meta_filename", "meta_file-type" FROM "tusd_uploads" WHERE "id" = 'foo'`)
+	a.NoError(row.Scan(&createdAt, &offset, &filename, &filetype))
+	a.EqualValues(0, offset)
+	a.Equal("hello.txt", filename.String)
+	a.False(filetype.Valid)
+
+	// Saving the info again updates the row, but keeps the creation time
+	info.Offset = 50
+	info.MetaData["file-type"] = "text/plain"
+	a.NoError(store.SaveInfo(ctx, info))
+
+	result, err = store.GetInfo(ctx, "foo")
+	a.NoError(err)
+	a.EqualValues(50, result.Offset)
+
+	var newCreatedAt, updatedAt time.Time
+	row = store.DB.QueryRow(`SELECT "created_at", "updated_at", "offset", "meta_file-type" FROM "tusd_uploads" WHERE "id" = 'foo'`)
+	a.NoError(row.Scan(&newCreatedAt, &updatedAt, &offset, &filetype))
+	a.True(createdAt.Equal(newCreatedAt))
+	a.False(updatedAt.Before(createdAt))
+	a.EqualValues(50, offset)
+	a.Equal("text/plain", filetype.String)
+
+	// Delete the info
+	a.NoError(store.DeleteInfo(ctx, "foo"))
+
+	_, err = store.GetInfo(ctx, "foo")
+	a.Equal(handler.ErrNotFound, err)
+
+	// Deleting missing info is not an error
+	a.NoError(store.DeleteInfo(ctx, "foo"))
+}
+
+func TestMigrateAddsColumns(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store := newStore(t)
+
+	a.NoError(store.SaveInfo(ctx, handler.FileInfo{
+		ID:       "foo",
+		MetaData: handler.MetaData{"filename": "hello.txt"},
+	}))
+
+	// Migrating again with additional meta data keys adds the columns
+	store.MetaDataKeys = []string{"filename"}
+	a.NoError(store.Migrate(ctx))
+	a.NoError(store.Migrate(ctx))
+
+	columns, err := store.columns(ctx)
+	a.NoError(err)
+	a.Contains(columns, "meta_filename")
+
+	result, err := store.GetInfo(ctx, "foo")
+	a.NoError(err)
+	a.Equal("hello.txt", result.MetaData["filename"])
+
+	var count int
+	a.NoError(store.DB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'index' AND name = 'tusd_uploads_meta_filename_idx'`).Scan(&count))
+	a.Equal(1, count)
+}
+
+func TestInvalidConfiguration(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	store := newStore(t)
+	store.Table = "uploads; DROP TABLE users"
+	a.ErrorContains(store.Migrate(ctx), "invalid table name")
+
+	store = newStore(t)
+	store.MetaDataKeys = []string{`name"`}
+	a.ErrorContains(store.SaveInfo(ctx, handler.FileInfo{ID: "foo"}), "invalid meta data key")
+
+	store = newStore(t)
+	store.Dialect = "mysql"
+	_, err := store.GetInfo(ctx, "foo")
+	a.ErrorContains(err, "unsupported dialect")
+}
+
+func TestRebind(t *testing.T) {
+	a := assert.New(t)
+
+	store := &SQLInfoStore{Dialect: DialectSQLite}
+	a.Equal(`SELECT * FROM t WHERE a = ? AND b = ?`, store.rebind(`SELECT * FROM t WHERE a = ? AND b = ?`))
+
+	store.Dialect = DialectPostgres
+	a.Equal(`SELECT * FROM t WHERE a = $1 AND b = $2`, store.rebind(`SELECT * FROM t WHERE a = ? AND b = ?`))
+}
+
+func TestFileStore(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	infoStore := newStore(t)
+
+	dir := t.TempDir()
+	store := filestore.New(dir)
+	store.InfoStore = infoStore
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		ID:   "foo",
+		Size: 11,
+	})
+	a.NoError(err)
+	a.NoFileExists(filepath.Join(dir, "foo.info"))
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.NotContains(info.Storage, filestore.StorageKeyInfoPath)
+
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello "))
+	a.NoError(err)
+
+	// The offset is kept up to date in the info store
+	info, err = infoStore.GetInfo(ctx, "foo")
+	a.NoError(err)
+	a.EqualValues(6, info.Offset)
+
+	upload, err = store.GetUpload(ctx, "foo")
+	a.NoError(err)
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(6, info.Offset)
+	a.EqualValues(11, info.Size)
+
+	a.NoError(store.AsTerminatableUpload(upload).Terminate(ctx))
+
+	_, err = infoStore.GetInfo(ctx, "foo")
+	a.Equal(handler.ErrNotFound, err)
+
+	_, err = store.GetUpload(ctx, "foo")
+	a.Equal(handler.ErrNotFound, err)
+}
@@ -0,0 +1,176 @@
+// Package sqlquotastore provides a quota store backed by an SQL database.
+//
+// SQLQuotaStore uses the database/sql package, so that any database with a
+// corresponding driver can be used. The driver must be imported by the
+// application. Since the reservations are kept in the database, the store can
+// be shared by multiple tusd instances. The table must be created before use,
+// either by calling CreateTable for SQLite and PostgreSQL or, for other databases,
+// with statements like the following (adjust the types to your database):
+//
+//	CREATE TABLE tusd_quota_reservations (
+//		id          VARCHAR(255) PRIMARY KEY,
+//		quota_key   VARCHAR(255) NOT NULL,
+//		size        BIGINT NOT NULL,
+//		used        BIGINT NOT NULL DEFAULT 0,
+//		quota_limit BIGINT NOT NULL
+//	);
+//	CREATE INDEX tusd_quota_reservations_key ON tusd_quota_reservations (quota_key);
+//
+// Reservations are checked and modified inside serializable transactions. Depending
+// on the database, concurrent reservations for the same quota can therefore fail
+// with a serialization error, in which case the client receives an error response
+// and may retry its request.
+package sqlquotastore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// SQLQuotaStore saves quota reservations in an SQL table.
+type SQLQuotaStore struct {
+	// DB is the database connection pool.
+	DB *sql.DB
+	// Table is the name of the table containing the reservations. Defaults to
+	// tusd_quota_reservations.
+	Table string
+	// DollarPlaceholders must be set to true for databases which use numbered
+	// placeholders ($1, $2, ...) instead of question marks, such as PostgreSQL.
+	DollarPlaceholders bool
+}
+
+// New creates a new SQL-based quota store using the given database connection pool.
+func New(db *sql.DB) SQLQuotaStore {
+	return SQLQuotaStore{
+		DB:    db,
+		Table: "tusd_quota_reservations",
+	}
+}
+
+// CreateTable creates the table and its index, if they do not exist yet. The
+// statements are supported by SQLite and PostgreSQL.
+func (store SQLQuotaStore) CreateTable(ctx context.Context) error {
+	_, err := store.DB.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+store.Table+` (
+		id          VARCHAR(255) PRIMARY KEY,
+		quota_key   VARCHAR(255) NOT NULL,
+		size        BIGINT NOT NULL,
+		used        BIGINT NOT NULL DEFAULT 0,
+		quota_limit BIGINT NOT NULL
+	)`)
+	if err != nil {
+		return err
+	}
+
+	_, err = store.DB.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS "+store.Table+"_key ON "+store.Table+" (quota_key)")
+	return err
+}
+
+// UseIn adds this quota store to the passed composer.
+func (store SQLQuotaStore) UseIn(composer *handler.StoreComposer) {
+	composer.UseQuotaStore(store)
+}
+
+func (store SQLQuotaStore) Reserve(ctx context.Context, key string, id string, size int64, limit int64) (err error) {
+	tx, err := store.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if limit > 0 {
+		var reserved int64
+		row := tx.QueryRowContext(ctx, store.query("SELECT COALESCE(SUM(size), 0) FROM "+store.Table+" WHERE quota_key = ? AND id <> ?"), key, id)
+		if err := row.Scan(&reserved); err != nil {
+			return err
+		}
+
+		if reserved+size > limit {
+			return handler.ErrQuotaExceeded
+		}
+	}
+
+	result, err := tx.ExecContext(ctx, store.query("UPDATE "+store.Table+" SET quota_key = ?, size = ?, quota_limit = ? WHERE id = ?"), key, size, limit, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		_, err = tx.ExecContext(ctx, store.query("INSERT INTO "+store.Table+" (id, quota_key, size, used, quota_limit) VALUES (?, ?, ?, 0, ?)"), id, key, size, limit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (store SQLQuotaStore) Use(ctx context.Context, id string, used int64) error {
+	_, err := store.DB.ExecContext(ctx, store.query("UPDATE "+store.Table+" SET used = ? WHERE id = ?"), used, id)
+	return err
+}
+
+func (store SQLQuotaStore) Release(ctx context.Context, id string) error {
+	_, err := store.DB.ExecContext(ctx, store.query("DELETE FROM "+store.Table+" WHERE id = ?"), id)
+	return err
+}
+
+func (store SQLQuotaStore) GetReservation(ctx context.Context, id string) (handler.QuotaReservation, bool, error) {
+	reservation := handler.QuotaReservation{ID: id}
+
+	row := store.DB.QueryRowContext(ctx, store.query("SELECT quota_key, size, used, quota_limit FROM "+store.Table+" WHERE id = ?"), id)
+	err := row.Scan(&reservation.Key, &reservation.Size, &reservation.Used, &reservation.Limit)
+	if errors.Is(err, sql.ErrNoRows) {
+		return handler.QuotaReservation{}, false, nil
+	}
+	if err != nil {
+		return handler.QuotaReservation{}, false, err
+	}
+
+	return reservation, true, nil
+}
+
+func (store SQLQuotaStore) GetUsage(ctx context.Context, key string) (handler.QuotaUsage, error) {
+	var usage handler.QuotaUsage
+
+	row := store.DB.QueryRowContext(ctx, store.query("SELECT COALESCE(SUM(size), 0), COALESCE(SUM(used), 0) FROM "+store.Table+" WHERE quota_key = ?"), key)
+	if err := row.Scan(&usage.Reserved, &usage.Used); err != nil {
+		return handler.QuotaUsage{}, err
+	}
+
+	return usage, nil
+}
+
+// query replaces the question mark placeholders in the query with numbered
+// placeholders, if the database requires them.
+func (store SQLQuotaStore) query(query string) string {
+	if !store.DollarPlaceholders {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,90 @@
+package sqlquotastore
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+var _ handler.QuotaStore = SQLQuotaStore{}
+
+func TestSQLQuotaStore(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "quota.db"))
+	a.NoError(err)
+	defer db.Close()
+
+	store := New(db)
+	a.NoError(store.CreateTable(ctx))
+	// Creating the table repeatedly has no effect
+	a.NoError(store.CreateTable(ctx))
+
+	a.NoError(store.Reserve(ctx, "tenant", "one", 60, 100))
+	a.NoError(store.Reserve(ctx, "tenant", "two", 40, 100))
+	a.NoError(store.Reserve(ctx, "other", "three", 80, 100))
+
+	// The quota is exhausted, so a reservation for a new upload fails ...
+	a.Equal(handler.ErrQuotaExceeded, store.Reserve(ctx, "tenant", "four", 1, 100))
+	// ... but an existing upload may shrink its reservation.
+	a.NoError(store.Reserve(ctx, "tenant", "two", 30, 100))
+	a.Equal(handler.ErrQuotaExceeded, store.Reserve(ctx, "tenant", "two", 50, 100))
+
+	a.NoError(store.Use(ctx, "one", 20))
+	a.NoError(store.Use(ctx, "unknown", 20))
+
+	reservation, ok, err := store.GetReservation(ctx, "one")
+	a.NoError(err)
+	a.True(ok)
+	a.Equal(handler.QuotaReservation{
+		Key:   "tenant",
+		ID:    "one",
+		Size:  60,
+		Used:  20,
+		Limit: 100,
+	}, reservation)
+
+	usage, err := store.GetUsage(ctx, "tenant")
+	a.NoError(err)
+	a.Equal(handler.QuotaUsage{Reserved: 90, Used: 20}, usage)
+
+	usage, err = store.GetUsage(ctx, "unknown")
+	a.NoError(err)
+	a.Equal(handler.QuotaUsage{}, usage)
+
+	a.NoError(store.Release(ctx, "one"))
+	_, ok, err = store.GetReservation(ctx, "one")
+	a.NoError(err)
+	a.False(ok)
+
+	a.NoError(store.Reserve(ctx, "tenant", "four", 70, 100))
+
+	// Without a limit, reservations are only tracked.
+	a.NoError(store.Reserve(ctx, "tenant", "five", 1000, 0))
+	usage, err = store.GetUsage(ctx, "tenant")
+	a.NoError(err)
+	a.Equal(handler.QuotaUsage{Reserved: 1100, Used: 0}, usage)
+
+	// The reservations are kept in the database
+	reservation, ok, err = New(db).GetReservation(ctx, "four")
+	a.NoError(err)
+	a.True(ok)
+	a.EqualValues(70, reservation.Size)
+}
+
+func TestQueryPlaceholders(t *testing.T) {
+	a := assert.New(t)
+
+	store := New(nil)
+	a.Equal("SELECT size FROM t WHERE quota_key = ? AND id <> ?", store.query("SELECT size FROM t WHERE quota_key = ? AND id <> ?"))
+
+	store.DollarPlaceholders = true
+	a.Equal("SELECT size FROM t WHERE quota_key = $1 AND id <> $2", store.query("SELECT size FROM t WHERE quota_key = ? AND id <> ?"))
+}
@@ -0,0 +1,477 @@
+// Package tieredstore provides a wrapper, which receives uploads in a staging storage
+// backend and moves them to a final storage backend once they are finished.
+//
+// Writing many small chunks directly to cloud storage can be slow, since every chunk
+// results in one or more requests to the provider. TieredStore accepts all data into the
+// staging data store, usually a filestore on local disk, and streams the completed upload
+// into the final data store, e.g. an s3store, in FinishUpload. Afterwards, the upload is
+// removed from the staging data store:
+//
+//	staging := handler.NewStoreComposer()
+//	filestore.New("/tmp/tusd-staging").UseIn(staging)
+//
+//	final := handler.NewStoreComposer()
+//	s3store.New("bucket", s3Client).UseIn(final)
+//
+//	composer := handler.NewStoreComposer()
+//	tieredstore.New(staging, final).UseIn(composer)
+//	memorylocker.New().UseIn(composer)
+//
+// When an upload is created, it is created in the final data store first and its ID is
+// used for the upload in the staging data store, so that the upload keeps its ID and
+// meta data when it is moved. Reads are served from whichever data store holds the
+// upload. The staging data store must use the upload ID passed to NewUpload, as
+// filestore does.
+//
+// If moving an upload fails, FinishUpload returns an error and the upload remains in the
+// staging data store. Since the handler does not call FinishUpload again for an upload,
+// which has received all data, the move is continued when the upload is fetched the next
+// time, e.g. when the client retries its last PATCH request or sends a HEAD request.
+// Until the move succeeds, fetching the upload fails.
+package tieredstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+	"golang.org/x/exp/slog"
+)
+
+// See the handler.DataStore interface for documentation about the different
+// methods.
+type TieredStore struct {
+	// Logger is used for reporting uploads, which could not be removed from the staging
+	// data store after they have been moved. Defaults to slog.Default().
+	Logger *slog.Logger
+
+	staging *handler.StoreComposer
+	final   *handler.StoreComposer
+}
+
+// New creates a new store, which receives uploads in the data store configured in the
+// staging composer and moves finished uploads to the data store in the final composer.
+// The staging data store must support the termination extension.
+func New(staging *handler.StoreComposer, final *handler.StoreComposer) *TieredStore {
+	return &TieredStore{
+		Logger:  slog.Default(),
+		staging: staging,
+		final:   final,
+	}
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// all extensions, which are supported by both wrapped data stores.
+func (store *TieredStore) UseIn(composer *handler.StoreComposer) {
+	composer.UseCore(store)
+	if store.final.UsesTerminater {
+		composer.UseTerminater(store)
+	}
+	composer.UseConcater(store)
+	if store.staging.UsesLengthDeferrer && store.final.UsesLengthDeferrer {
+		composer.UseLengthDeferrer(store)
+	}
+	if store.staging.UsesContentServer && store.final.UsesContentServer {
+		composer.UseContentServer(store)
+	}
+	if store.staging.UsesMetadataUpdater && store.final.UsesMetadataUpdater {
+		composer.UseMetadataUpdater(store)
+	}
+	if store.staging.UsesStateUpdater && store.final.UsesStateUpdater {
+		composer.UseStateUpdater(store)
+	}
+}
+
+func (store *TieredStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	// The storage information is meant for the staging data store, e.g. if it has been
+	// changed by the pre-create hook.
+	finalInfo := info
+	finalInfo.Storage = nil
+
+	final, err := store.final.Core.NewUpload(ctx, finalInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	finalInfo, err = final.GetInfo(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	info.ID = finalInfo.ID
+	info.Storage = maps.Clone(info.Storage)
+
+	staged, err := store.staging.Core.NewUpload(ctx, info)
+	if err != nil {
+		return nil, fmt.Errorf("tieredstore: unable to create upload in staging store: %w", err)
+	}
+
+	return &tieredUpload{
+		store:  store,
+		id:     finalInfo.ID,
+		staged: staged,
+		final:  final,
+	}, nil
+}
+
+func (store *TieredStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	upload := &tieredUpload{
+		store: store,
+		id:    id,
+	}
+
+	staged, err := store.staging.Core.GetUpload(ctx, id)
+	if err == nil {
+		upload.staged = staged
+		if err := upload.retryMove(ctx); err != nil {
+			return nil, err
+		}
+		return upload, nil
+	}
+	if !isNotFound(err) {
+		return nil, err
+	}
+
+	upload.final, err = store.final.Core.GetUpload(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+func (store *TieredStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
+	return upload.(*tieredUpload)
+}
+
+func (store *TieredStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
+	return upload.(*tieredUpload)
+}
+
+func (store *TieredStore) AsConcatableUpload(upload handler.Upload) handler.ConcatableUpload {
+	return upload.(*tieredUpload)
+}
+
+func (store *TieredStore) AsServableUpload(upload handler.Upload) handler.ServableUpload {
+	return upload.(*tieredUpload)
+}
+
+func (store *TieredStore) AsMetadataUpdatableUpload(upload handler.Upload) handler.MetadataUpdatableUpload {
+	return upload.(*tieredUpload)
+}
+
+func (store *TieredStore) AsStateUpdatableUpload(upload handler.Upload) handler.StateUpdatableUpload {
+	return upload.(*tieredUpload)
+}
+
+type tieredUpload struct {
+	store *TieredStore
+	id    string
+
+	// staged is the upload in the staging data store. It is nil once the upload has
+	// been moved.
+	staged handler.Upload
+	// final is the upload in the final data store. For staged uploads, it is only
+	// fetched when needed.
+	final handler.Upload
+}
+
+// finalUpload returns the upload in the final data store.
+func (upload *tieredUpload) finalUpload(ctx context.Context) (handler.Upload, error) {
+	if upload.final != nil {
+		return upload.final, nil
+	}
+
+	final, err := upload.store.final.Core.GetUpload(ctx, upload.id)
+	if err != nil {
+		return nil, err
+	}
+
+	upload.final = final
+	return final, nil
+}
+
+// moved is called when the staged upload cannot be found anymore, e.g. because it has
+// been moved by another request in the meantime.
+func (upload *tieredUpload) moved(ctx context.Context, err error) bool {
+	if !isNotFound(err) {
+		return false
+	}
+
+	if _, err := upload.finalUpload(ctx); err != nil {
+		return false
+	}
+
+	upload.staged = nil
+	return true
+}
+
+func (upload *tieredUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	if upload.staged == nil {
+		// Moved uploads are finished, so no data can be appended.
+		return 0, nil
+	}
+
+	return upload.staged.WriteChunk(ctx, offset, src)
+}
+
+func (upload *tieredUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
+	if upload.staged != nil {
+		info, err := upload.staged.GetInfo(ctx)
+		if err == nil || !upload.moved(ctx, err) {
+			return info, err
+		}
+	}
+
+	return upload.final.GetInfo(ctx)
+}
+
+func (upload *tieredUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	if upload.staged != nil {
+		reader, err := upload.staged.GetReader(ctx)
+		if err == nil || !upload.moved(ctx, err) {
+			return reader, err
+		}
+	}
+
+	return upload.final.GetReader(ctx)
+}
+
+func (upload *tieredUpload) FinishUpload(ctx context.Context) error {
+	if upload.staged == nil {
+		return nil
+	}
+
+	if err := upload.staged.FinishUpload(ctx); err != nil {
+		return err
+	}
+
+	return upload.move(ctx)
+}
+
+// retryMove moves the staged upload, if it has received all data. This only happens if
+// moving it in FinishUpload failed before.
+func (upload *tieredUpload) retryMove(ctx context.Context) error {
+	info, err := upload.staged.GetInfo(ctx)
+	if err != nil {
+		if upload.moved(ctx, err) {
+			return nil
+		}
+		return err
+	}
+
+	if info.SizeIsDeferred || info.Offset != info.Size {
+		return nil
+	}
+
+	return upload.move(ctx)
+}
+
+// move copies the staged upload's data into the final data store and removes the
+// staged upload afterwards. If the final upload already contains some data, e.g. from
+// a previous attempt, only the remaining data is copied.
+func (upload *tieredUpload) move(ctx context.Context) error {
+	store := upload.store
+
+	info, err := upload.staged.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	final, err := upload.finalUpload(ctx)
+	if err != nil {
+		return err
+	}
+
+	finalInfo, err := final.GetInfo(ctx)
+	if err != nil {
+		return err
+	}
+
+	if finalInfo.SizeIsDeferred {
+		if err := store.final.LengthDeferrer.AsLengthDeclarableUpload(final).DeclareLength(ctx, info.Size); err != nil {
+			return err
+		}
+	}
+
+	if finalInfo.Offset < info.Offset {
+		reader, err := upload.staged.GetReader(ctx)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+
+		if _, err := io.CopyN(io.Discard, reader, finalInfo.Offset); err != nil {
+			return err
+		}
+
+		remaining := info.Offset - finalInfo.Offset
+		n, err := final.WriteChunk(ctx, finalInfo.Offset, io.LimitReader(reader, remaining))
+		if err != nil {
+			return fmt.Errorf("tieredstore: unable to move upload %s: %w", info.ID, err)
+		}
+		if n != remaining {
+			return fmt.Errorf("tieredstore: only %d of %d bytes of upload %s moved", n, remaining, info.ID)
+		}
+	}
+
+	if info.State != nil && store.final.UsesStateUpdater {
+		if err := store.final.StateUpdater.AsStateUpdatableUpload(final).UpdateState(ctx, *info.State); err != nil {
+			return err
+		}
+	}
+
+	if err := final.FinishUpload(ctx); err != nil {
+		return err
+	}
+
+	upload.cleanUp(ctx)
+	return nil
+}
+
+// cleanUp removes the staged upload. Since the data is already stored in the final
+// data store, errors are only logged.
+func (upload *tieredUpload) cleanUp(ctx context.Context) {
+	staged := upload.staged
+	upload.staged = nil
+
+	if err := upload.store.staging.Terminater.AsTerminatableUpload(staged).Terminate(ctx); err != nil && !isNotFound(err) {
+		upload.store.Logger.Error("TieredStoreCleanUpError", "id", upload.id, "error", err)
+	}
+}
+
+func (upload *tieredUpload) Terminate(ctx context.Context) error {
+	store := upload.store
+
+	final, err := upload.finalUpload(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := store.final.Terminater.AsTerminatableUpload(final).Terminate(ctx); err != nil {
+		return err
+	}
+
+	if upload.staged != nil {
+		err := store.staging.Terminater.AsTerminatableUpload(upload.staged).Terminate(ctx)
+		if err != nil && !isNotFound(err) {
+			return err
+		}
+		upload.staged = nil
+	}
+
+	return nil
+}
+
+func (upload *tieredUpload) DeclareLength(ctx context.Context, length int64) error {
+	if upload.staged == nil {
+		return errors.New("tieredstore: cannot declare length of moved upload")
+	}
+
+	return upload.store.staging.LengthDeferrer.AsLengthDeclarableUpload(upload.staged).DeclareLength(ctx, length)
+}
+
+// ConcatUploads concatenates the partial uploads directly in the final data store, if
+// it supports concatenation and all partial uploads have been moved. Otherwise, the
+// partial uploads' data is streamed into the final upload.
+func (upload *tieredUpload) ConcatUploads(ctx context.Context, partialUploads []handler.Upload) error {
+	store := upload.store
+
+	final, err := upload.finalUpload(ctx)
+	if err != nil {
+		return err
+	}
+
+	finalUploads := make([]handler.Upload, 0, len(partialUploads))
+	for _, partialUpload := range partialUploads {
+		if partial := partialUpload.(*tieredUpload); partial.staged == nil {
+			finalUploads = append(finalUploads, partial.final)
+		}
+	}
+
+	if store.final.UsesConcater && len(finalUploads) == len(partialUploads) {
+		if err := store.final.Concater.AsConcatableUpload(final).ConcatUploads(ctx, finalUploads); err != nil {
+			return err
+		}
+	} else {
+		readers := make([]io.Reader, 0, len(partialUploads))
+		for _, partialUpload := range partialUploads {
+			reader, err := partialUpload.GetReader(ctx)
+			if err != nil {
+				return err
+			}
+			defer reader.Close()
+
+			readers = append(readers, reader)
+		}
+
+		if _, err := final.WriteChunk(ctx, 0, io.MultiReader(readers...)); err != nil {
+			return err
+		}
+
+		if err := final.FinishUpload(ctx); err != nil {
+			return err
+		}
+	}
+
+	if upload.staged != nil {
+		upload.cleanUp(ctx)
+	}
+	return nil
+}
+
+func (upload *tieredUpload) ServeContent(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	if upload.staged != nil {
+		return upload.store.staging.ContentServer.AsServableUpload(upload.staged).ServeContent(ctx, w, r)
+	}
+
+	return upload.store.final.ContentServer.AsServableUpload(upload.final).ServeContent(ctx, w, r)
+}
+
+// UpdateMetaData updates the meta data in both data stores, so that it remains
+// consistent when the upload is moved.
+func (upload *tieredUpload) UpdateMetaData(ctx context.Context, metaData handler.MetaData) error {
+	store := upload.store
+
+	if upload.staged != nil {
+		if err := store.staging.MetadataUpdater.AsMetadataUpdatableUpload(upload.staged).UpdateMetaData(ctx, metaData); err != nil {
+			return err
+		}
+	}
+
+	final, err := upload.finalUpload(ctx)
+	if err != nil {
+		return err
+	}
+
+	return store.final.MetadataUpdater.AsMetadataUpdatableUpload(final).UpdateMetaData(ctx, metaData)
+}
+
+// UpdateState saves the state in the data store holding the upload. The state of a
+// staged upload is copied to the final data store when the upload is moved.
+func (upload *tieredUpload) UpdateState(ctx context.Context, state handler.UploadState) error {
+	store := upload.store
+
+	if upload.staged != nil {
+		err := store.staging.StateUpdater.AsStateUpdatableUpload(upload.staged).UpdateState(ctx, state)
+		if err == nil || !upload.moved(ctx, err) {
+			return err
+		}
+	}
+
+	final, err := upload.finalUpload(ctx)
+	if err != nil {
+		return err
+	}
+
+	return store.final.StateUpdater.AsStateUpdatableUpload(final).UpdateState(ctx, state)
+}
+
+func isNotFound(err error) bool {
+	var tusErr handler.Error
+	return errors.As(err, &tusErr) && tusErr.ErrorCode == handler.ErrNotFound.ErrorCode
+}
@@ -0,0 +1,232 @@
+package tieredstore
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/tus/tusd/v2/pkg/handler"
+	"github.com/tus/tusd/v2/pkg/memorystore"
+)
+
+// Test interface implementations
+var _ handler.DataStore = &TieredStore{}
+var _ handler.TerminaterDataStore = &TieredStore{}
+var _ handler.ConcaterDataStore = &TieredStore{}
+var _ handler.LengthDeferrerDataStore = &TieredStore{}
+var _ handler.ContentServerDataStore = &TieredStore{}
+var _ handler.MetadataUpdaterDataStore = &TieredStore{}
+var _ handler.StateUpdaterDataStore = &TieredStore{}
+
+func newStore() (*TieredStore, *memorystore.MemoryStore, *memorystore.MemoryStore) {
+	stagingStore := memorystore.New()
+	staging := handler.NewStoreComposer()
+	stagingStore.UseIn(staging)
+
+	finalStore := memorystore.New()
+	final := handler.NewStoreComposer()
+	finalStore.UseIn(final)
+
+	return New(staging, final), stagingStore, finalStore
+}
+
+func readUpload(t *testing.T, upload handler.Upload) string {
+	reader, err := upload.GetReader(context.Background())
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func writeUpload(t *testing.T, store handler.DataStore, info handler.FileInfo, content string) handler.Upload {
+	ctx := context.Background()
+
+	upload, err := store.NewUpload(ctx, info)
+	assert.NoError(t, err)
+
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader(content))
+	assert.NoError(t, err)
+
+	assert.NoError(t, upload.FinishUpload(ctx))
+	return upload
+}
+
+func TestTieredStore(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, stagingStore, finalStore := newStore()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		ID:       "abc",
+		Size:     11,
+		MetaData: handler.MetaData{"foo": "bar"},
+	})
+	a.NoError(err)
+
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello"))
+	a.NoError(err)
+
+	// Data is received in the staging store.
+	a.EqualValues(5, stagingStore.Used())
+	a.EqualValues(0, finalStore.Used())
+
+	upload, err = store.GetUpload(ctx, "abc")
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(5, info.Offset)
+	a.Equal("hello", readUpload(t, upload))
+
+	err = store.AsMetadataUpdatableUpload(upload).UpdateMetaData(ctx, handler.MetaData{"foo": "baz"})
+	a.NoError(err)
+
+	// The state is kept in the staging store and moved with the upload.
+	state := handler.UploadState{Digest: &handler.DigestState{Offset: 5}}
+	err = store.AsStateUpdatableUpload(upload).UpdateState(ctx, state)
+	a.NoError(err)
+
+	_, err = upload.WriteChunk(ctx, 5, strings.NewReader(" world"))
+	a.NoError(err)
+
+	// Finished uploads are moved to the final store.
+	a.NoError(upload.FinishUpload(ctx))
+	a.EqualValues(0, stagingStore.Used())
+	a.EqualValues(11, finalStore.Used())
+
+	_, err = stagingStore.GetUpload(ctx, "abc")
+	a.Equal(handler.ErrNotFound, err)
+
+	upload, err = store.GetUpload(ctx, "abc")
+	a.NoError(err)
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal("abc", info.ID)
+	a.EqualValues(11, info.Size)
+	a.EqualValues(11, info.Offset)
+	a.Equal(handler.MetaData{"foo": "baz"}, info.MetaData)
+	a.Equal(&state, info.State)
+	a.Equal("hello world", readUpload(t, upload))
+
+	err = store.AsTerminatableUpload(upload).Terminate(ctx)
+	a.NoError(err)
+
+	_, err = store.GetUpload(ctx, "abc")
+	a.Equal(handler.ErrNotFound, err)
+}
+
+func TestFailedMove(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, stagingStore, finalStore := newStore()
+	finalStore.FailAfterBytes = 5
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{ID: "abc", Size: 11})
+	a.NoError(err)
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.NoError(err)
+
+	// The upload remains in the staging store.
+	a.ErrorIs(upload.FinishUpload(ctx), memorystore.ErrInjectedFailure)
+	a.EqualValues(11, stagingStore.Used())
+
+	// The move is retried when the upload is fetched again, since the handler does
+	// not finish it again.
+	_, err = store.GetUpload(ctx, "abc")
+	a.ErrorIs(err, memorystore.ErrInjectedFailure)
+	a.EqualValues(11, stagingStore.Used())
+
+	// The move continues with the remaining data.
+	finalStore.FailAfterBytes = 0
+	upload, err = store.GetUpload(ctx, "abc")
+	a.NoError(err)
+	a.EqualValues(0, stagingStore.Used())
+	a.Equal("hello world", readUpload(t, upload))
+
+	final, err := finalStore.GetUpload(ctx, "abc")
+	a.NoError(err)
+	a.Equal("hello world", readUpload(t, final))
+}
+
+func TestDeclareLength(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _, finalStore := newStore()
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{ID: "abc", SizeIsDeferred: true})
+	a.NoError(err)
+
+	a.NoError(store.AsLengthDeclarableUpload(upload).DeclareLength(ctx, 11))
+	_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello world"))
+	a.NoError(err)
+	a.NoError(upload.FinishUpload(ctx))
+
+	final, err := finalStore.GetUpload(ctx, "abc")
+	a.NoError(err)
+
+	info, err := final.GetInfo(ctx)
+	a.NoError(err)
+	a.False(info.SizeIsDeferred)
+	a.EqualValues(11, info.Size)
+	a.Equal("hello world", readUpload(t, final))
+}
+
+func TestConcatUploads(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, stagingStore, finalStore := newStore()
+
+	partialUploads := []handler.Upload{
+		writeUpload(t, store, handler.FileInfo{Size: 5, IsPartial: true}, "hello"),
+		writeUpload(t, store, handler.FileInfo{Size: 6, IsPartial: true}, " world"),
+	}
+
+	finalUpload, err := store.NewUpload(ctx, handler.FileInfo{ID: "final", Size: 11, IsFinal: true})
+	a.NoError(err)
+
+	err = store.AsConcatableUpload(finalUpload).ConcatUploads(ctx, partialUploads)
+	a.NoError(err)
+	a.Equal("hello world", readUpload(t, finalUpload))
+
+	_, err = stagingStore.GetUpload(ctx, "final")
+	a.Equal(handler.ErrNotFound, err)
+
+	final, err := finalStore.GetUpload(ctx, "final")
+	a.NoError(err)
+	a.Equal("hello world", readUpload(t, final))
+}
+
+func TestConcatStagedUploads(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _, finalStore := newStore()
+
+	// The partial uploads cannot be moved, so they are streamed from the staging store.
+	finalStore.FailAfterBytes = 1
+	var partialUploads []handler.Upload
+	for _, content := range []string{"hello", " world"} {
+		upload, err := store.NewUpload(ctx, handler.FileInfo{Size: int64(len(content)), IsPartial: true})
+		a.NoError(err)
+		_, err = upload.WriteChunk(ctx, 0, strings.NewReader(content))
+		a.NoError(err)
+		a.Error(upload.FinishUpload(ctx))
+
+		partialUploads = append(partialUploads, upload)
+	}
+	finalStore.FailAfterBytes = 0
+
+	finalUpload, err := store.NewUpload(ctx, handler.FileInfo{ID: "final", Size: 11, IsFinal: true})
+	a.NoError(err)
+
+	err = store.AsConcatableUpload(finalUpload).ConcatUploads(ctx, partialUploads)
+	a.NoError(err)
+
+	final, err := finalStore.GetUpload(ctx, "final")
+	a.NoError(err)
+	a.Equal("hello world", readUpload(t, final))
+}
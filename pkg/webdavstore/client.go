@@ -0,0 +1,273 @@
+package webdavstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// statusError is returned if the server responds with an unexpected status code.
+type statusError struct {
+	method string
+	path   string
+	code   int
+	status string
+}
+
+func (err *statusError) Error() string {
+	return fmt.Sprintf("webdavstore: %s %s failed: %s", err.method, err.path, err.status)
+}
+
+// isStatus checks whether the request failed with the status code.
+func isStatus(err error, code int) bool {
+	var statusErr *statusError
+	return errors.As(err, &statusErr) && statusErr.code == code
+}
+
+// resource describes a member of a collection listed using PROPFIND.
+type resource struct {
+	name string
+	size int64
+}
+
+// multistatus is the response to a PROPFIND request.
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Prop struct {
+				ContentLength string `xml:"DAV: getcontentlength"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<propfind xmlns="DAV:"><prop><getcontentlength/><resourcetype/></prop></propfind>`
+
+// sizedReader is a reader, whose length is known in advance. It is sent with a
+// Content-Length header instead of using chunked transfer encoding.
+type sizedReader struct {
+	io.Reader
+	size int64
+}
+
+// url returns the URL of the resource at the path relative to the endpoint.
+func (store *WebDAVStore) url(p string) *url.URL {
+	return store.Endpoint.JoinPath(p)
+}
+
+// do sends a request for the resource at the path. If the server does not respond
+// with a 2xx status code, a *statusError is returned and the response body is closed.
+func (store *WebDAVStore) do(ctx context.Context, method string, p string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, store.url(p).String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	if sized, ok := body.(*sizedReader); ok {
+		req.ContentLength = sized.size
+		if sized.size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if store.Username != "" || store.Password != "" {
+		req.SetBasicAuth(store.Username, store.Password)
+	}
+
+	client := store.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		// Drain the body, so the connection can be reused.
+		io.Copy(io.Discard, io.LimitReader(res.Body, 4096))
+		res.Body.Close()
+		return nil, &statusError{
+			method: method,
+			path:   p,
+			code:   res.StatusCode,
+			status: res.Status,
+		}
+	}
+
+	return res, nil
+}
+
+// send sends a request, whose response body is not needed.
+func (store *WebDAVStore) send(ctx context.Context, method string, p string, body io.Reader, header http.Header) error {
+	res, err := store.do(ctx, method, p, body, header)
+	if err != nil {
+		return err
+	}
+
+	io.Copy(io.Discard, res.Body)
+	return res.Body.Close()
+}
+
+// put stores the data at the path. Missing parent collections are created.
+func (store *WebDAVStore) put(ctx context.Context, p string, data []byte, header http.Header) error {
+	err := store.send(ctx, http.MethodPut, p, bytes.NewReader(data), header)
+	if isStatus(err, http.StatusConflict) {
+		if err := store.mkcolAll(ctx, path.Dir(p)); err != nil {
+			return err
+		}
+
+		err = store.send(ctx, http.MethodPut, p, bytes.NewReader(data), header)
+	}
+	return err
+}
+
+// get returns the content of the resource at the path.
+func (store *WebDAVStore) get(ctx context.Context, p string) (io.ReadCloser, error) {
+	res, err := store.do(ctx, http.MethodGet, p, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Body, nil
+}
+
+// size returns the length of the resource at the path.
+func (store *WebDAVStore) size(ctx context.Context, p string) (int64, error) {
+	res, err := store.do(ctx, http.MethodHead, p, nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	res.Body.Close()
+
+	if res.ContentLength < 0 {
+		return 0, fmt.Errorf("webdavstore: HEAD %s returned no Content-Length", p)
+	}
+
+	return res.ContentLength, nil
+}
+
+// list returns the files in the collection at the path.
+func (store *WebDAVStore) list(ctx context.Context, p string) ([]resource, error) {
+	res, err := store.do(ctx, "PROPFIND", p, strings.NewReader(propfindBody), http.Header{
+		"Depth":        []string{"1"},
+		"Content-Type": []string{"application/xml; charset=utf-8"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	var result multistatus
+	if err := xml.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+
+	var resources []resource
+	for _, response := range result.Responses {
+		href, err := url.Parse(response.Href)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, propstat := range response.Propstat {
+			prop := propstat.Prop
+			if !strings.Contains(propstat.Status, " 200 ") || prop.ResourceType.Collection != nil || prop.ContentLength == "" {
+				continue
+			}
+
+			size, err := strconv.ParseInt(prop.ContentLength, 10, 64)
+			if err != nil {
+				return nil, err
+			}
+
+			resources = append(resources, resource{
+				name: path.Base(href.Path),
+				size: size,
+			})
+		}
+	}
+
+	return resources, nil
+}
+
+// mkcolAll creates the collection at the path including all missing parents.
+func (store *WebDAVStore) mkcolAll(ctx context.Context, p string) error {
+	if p == "." || p == "/" || p == "" {
+		return nil
+	}
+
+	err := store.send(ctx, "MKCOL", p, nil, nil)
+	if isStatus(err, http.StatusConflict) {
+		if err := store.mkcolAll(ctx, path.Dir(p)); err != nil {
+			return err
+		}
+
+		err = store.send(ctx, "MKCOL", p, nil, nil)
+	}
+
+	// The collection exists already.
+	if isStatus(err, http.StatusMethodNotAllowed) {
+		return nil
+	}
+	return err
+}
+
+// transfer copies or moves the resource at src to dst, replacing existing resources.
+func (store *WebDAVStore) transfer(ctx context.Context, method string, src string, dst string) error {
+	return store.send(ctx, method, src, nil, http.Header{
+		"Destination": []string{store.url(dst).String()},
+		"Overwrite":   []string{"T"},
+	})
+}
+
+// delete removes the resource at the path. Missing resources are ignored.
+func (store *WebDAVStore) delete(ctx context.Context, p string) error {
+	err := store.send(ctx, http.MethodDelete, p, nil, nil)
+	if isStatus(err, http.StatusNotFound) {
+		return nil
+	}
+	return err
+}
+
+// supportsSabrePartialUpdate checks whether the server announces support for
+// SabreDAV's partial updates in the DAV header.
+func (store *WebDAVStore) supportsSabrePartialUpdate(ctx context.Context) (bool, error) {
+	res, err := store.do(ctx, http.MethodOptions, "", nil, nil)
+	if err != nil {
+		return false, err
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	for _, value := range res.Header.Values("DAV") {
+		classes := strings.Split(value, ",")
+		for i := range classes {
+			classes[i] = strings.TrimSpace(classes[i])
+		}
+		if slices.Contains(classes, "sabredav-partialupdate") {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
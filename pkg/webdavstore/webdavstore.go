@@ -0,0 +1,556 @@
+// Package webdavstore provides a storage backend storing uploads on a WebDAV server.
+//
+// WebDAVStore is a storage backend used as a handler.DataStore in handler.NewHandler.
+// It lays out the uploads on the server in the same way as the filestore package on
+// the local disk: The `[id].info` files are used to store the fileinfo in JSON format.
+// The `[id]` files without an extension contain the raw binary data uploaded.
+//
+// WebDAV itself offers no way of appending data to an existing file, so the data is
+// written using one of the following modes:
+//
+//   - WriteModeContentRange sends PUT requests with a Content-Range header, which
+//     update a part of the file. This is supported by Apache's mod_dav, for example.
+//     Servers, which do not support it, might replace the entire file instead, so
+//     this mode is never selected automatically.
+//   - WriteModeSabre sends PATCH requests with an X-Update-Range header as
+//     implemented by SabreDAV and servers based on it, such as Nextcloud.
+//   - WriteModeChunks stores every chunk as a separate file in the `[id].chunks`
+//     collection. Once the upload is finished, the chunks are combined into a single
+//     file, which is then moved to its final location using MOVE. This works with
+//     every WebDAV server, but requires transferring the data a second time.
+//
+// WriteModeAuto uses SabreDAV's partial updates, if the server announces them in the
+// DAV header of an OPTIONS response, and chunks otherwise. The mode used for an upload
+// is fixed once it has been created.
+//
+// The data is sent in requests of up to ChunkSize bytes, which are buffered in memory
+// before they are sent.
+package webdavstore
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"sync"
+
+	"github.com/tus/tusd/v2/internal/storageinfo"
+	"github.com/tus/tusd/v2/internal/uid"
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+const (
+	// StorageKeyPath is the key of the path of uploaded file in handler.FileInfo.Storage
+	StorageKeyPath = "Path"
+	// StorageKeyInfoPath is the key of the path of .info file in handler.FileInfo.Storage
+	StorageKeyInfoPath = "InfoPath"
+	// StorageKeyChunksPath is the key of the path of the collection containing the
+	// chunks in handler.FileInfo.Storage. It is only set for uploads using
+	// WriteModeChunks.
+	StorageKeyChunksPath = "ChunksPath"
+)
+
+// WriteMode determines how data is written to the server.
+type WriteMode string
+
+const (
+	WriteModeAuto         WriteMode = "auto"
+	WriteModeContentRange WriteMode = "content-range"
+	WriteModeSabre        WriteMode = "sabre"
+	WriteModeChunks       WriteMode = "chunks"
+)
+
+// DefaultChunkSize is the default maximum number of bytes sent in a single request.
+const DefaultChunkSize = 8 * 1024 * 1024
+
+// assembledName is the name of the combined file inside the chunks collection, before
+// it is moved to its final location.
+const assembledName = "assembled"
+
+// See the handler.DataStore interface for documentation about the different
+// methods.
+type WebDAVStore struct {
+	// Endpoint is the URL of the collection to store files in. Paths of the uploads'
+	// files are relative to this URL.
+	Endpoint *url.URL
+	// Username and Password are used for basic authentication, if set.
+	Username string
+	Password string
+	// Client is used for sending requests. If nil, http.DefaultClient is used.
+	Client *http.Client
+	// WriteMode determines how data is written to the server. See the package
+	// documentation for details.
+	WriteMode WriteMode
+	// ChunkSize is the maximum number of bytes sent in a single request.
+	ChunkSize int64
+
+	// detectedMode caches the mode detected for WriteModeAuto.
+	detectedMode WriteMode
+	detectMutex  sync.Mutex
+}
+
+// New creates a new WebDAV based storage backend, which stores the uploads in the
+// collection at the endpoint. The collection must exist.
+func New(endpoint *url.URL) *WebDAVStore {
+	return &WebDAVStore{
+		Endpoint:  endpoint,
+		WriteMode: WriteModeAuto,
+		ChunkSize: DefaultChunkSize,
+	}
+}
+
+// UseIn sets this store as the core data store in the passed composer and adds
+// all possible extension to it.
+func (store *WebDAVStore) UseIn(composer *handler.StoreComposer) {
+	composer.UseCore(store)
+	composer.UseTerminater(store)
+	composer.UseConcater(store)
+	composer.UseLengthDeferrer(store)
+	composer.UseStateUpdater(store)
+}
+
+// writeMode returns the mode for new uploads. For WriteModeAuto, the server's
+// capabilities are detected once.
+func (store *WebDAVStore) writeMode(ctx context.Context) (WriteMode, error) {
+	if store.WriteMode != WriteModeAuto && store.WriteMode != "" {
+		return store.WriteMode, nil
+	}
+
+	store.detectMutex.Lock()
+	defer store.detectMutex.Unlock()
+
+	if store.detectedMode == "" {
+		sabre, err := store.supportsSabrePartialUpdate(ctx)
+		if err != nil {
+			return "", err
+		}
+
+		store.detectedMode = WriteModeChunks
+		if sabre {
+			store.detectedMode = WriteModeSabre
+		}
+	}
+
+	return store.detectedMode, nil
+}
+
+func (store *WebDAVStore) NewUpload(ctx context.Context, info handler.FileInfo) (handler.Upload, error) {
+	if info.ID == "" {
+		info.ID = uid.Uid()
+	}
+
+	mode, err := store.writeMode(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	infoPath := info.ID + ".info"
+	// The binary file's location might be modified by the pre-create hook.
+	binPath := info.ID
+	if info.Storage != nil && info.Storage[StorageKeyPath] != "" {
+		binPath = info.Storage[StorageKeyPath]
+	}
+
+	info.Storage = storageinfo.Clone(info.Storage)
+	info.Storage["Type"] = "webdavstore"
+	info.Storage[StorageKeyPath] = binPath
+	info.Storage[StorageKeyInfoPath] = infoPath
+
+	upload := &webdavUpload{
+		store:    store,
+		info:     info,
+		infoPath: infoPath,
+		binPath:  binPath,
+	}
+
+	if mode == WriteModeChunks {
+		upload.chunksPath = info.ID + ".chunks"
+		upload.info.Storage[StorageKeyChunksPath] = upload.chunksPath
+
+		if err := store.mkcolAll(ctx, upload.chunksPath); err != nil {
+			return nil, err
+		}
+
+		// The binary file is only created once the upload is finished, but its
+		// collection must exist for moving it there.
+		if dir := path.Dir(binPath); dir != path.Dir(upload.chunksPath) {
+			if err := store.mkcolAll(ctx, dir); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		// Create binary file with no content
+		if err := store.put(ctx, binPath, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := upload.writeInfo(ctx); err != nil {
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+func (store *WebDAVStore) GetUpload(ctx context.Context, id string) (handler.Upload, error) {
+	upload := &webdavUpload{
+		store:    store,
+		infoPath: id + ".info",
+	}
+
+	body, err := store.get(ctx, upload.infoPath)
+	if err != nil {
+		if isStatus(err, http.StatusNotFound) {
+			// Interpret 404 Not Found as handler.ErrNotFound
+			err = handler.ErrNotFound
+		}
+		return nil, err
+	}
+	defer body.Close()
+
+	if err := json.NewDecoder(body).Decode(&upload.info); err != nil {
+		return nil, err
+	}
+
+	upload.binPath = upload.info.Storage[StorageKeyPath]
+	if upload.binPath == "" {
+		upload.binPath = id
+	}
+	upload.chunksPath = upload.info.Storage[StorageKeyChunksPath]
+
+	if upload.chunksPath != "" {
+		chunks, err := upload.chunks(ctx)
+		if err == nil {
+			for _, chunk := range chunks {
+				upload.info.Offset += chunk.size
+			}
+			return upload, nil
+		}
+
+		// Once the upload is finished, the chunks are removed.
+		if !isStatus(err, http.StatusNotFound) {
+			return nil, err
+		}
+	}
+
+	upload.info.Offset, err = store.size(ctx, upload.binPath)
+	if err != nil {
+		if isStatus(err, http.StatusNotFound) {
+			err = handler.ErrNotFound
+		}
+		return nil, err
+	}
+
+	return upload, nil
+}
+
+func (store *WebDAVStore) AsTerminatableUpload(upload handler.Upload) handler.TerminatableUpload {
+	return upload.(*webdavUpload)
+}
+
+func (store *WebDAVStore) AsLengthDeclarableUpload(upload handler.Upload) handler.LengthDeclarableUpload {
+	return upload.(*webdavUpload)
+}
+
+func (store *WebDAVStore) AsConcatableUpload(upload handler.Upload) handler.ConcatableUpload {
+	return upload.(*webdavUpload)
+}
+
+func (store *WebDAVStore) AsStateUpdatableUpload(upload handler.Upload) handler.StateUpdatableUpload {
+	return upload.(*webdavUpload)
+}
+
+type webdavUpload struct {
+	store *WebDAVStore
+	// info stores the current information about the upload
+	info handler.FileInfo
+	// infoPath is the path to the .info file
+	infoPath string
+	// binPath is the path to the binary file (which has no extension)
+	binPath string
+	// chunksPath is the path to the collection containing the chunks. It is empty
+	// unless the upload uses WriteModeChunks.
+	chunksPath string
+}
+
+// chunk describes a chunk of an upload using WriteModeChunks.
+type chunk struct {
+	offset int64
+	size   int64
+}
+
+// chunkPath returns the path of the chunk starting at the offset.
+func (upload *webdavUpload) chunkPath(offset int64) string {
+	return path.Join(upload.chunksPath, fmt.Sprintf("%020d", offset))
+}
+
+// chunks returns the consecutive chunks of the upload, starting at offset 0.
+func (upload *webdavUpload) chunks(ctx context.Context) ([]chunk, error) {
+	resources, err := upload.store.list(ctx, upload.chunksPath)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make([]chunk, 0, len(resources))
+	for _, resource := range resources {
+		offset, err := strconv.ParseInt(resource.name, 10, 64)
+		if err != nil || resource.size == 0 {
+			continue
+		}
+
+		chunks = append(chunks, chunk{offset: offset, size: resource.size})
+	}
+	slices.SortFunc(chunks, func(a, b chunk) int {
+		return cmp.Compare(a.offset, b.offset)
+	})
+
+	// Chunks after a gap are never read, since they cannot be written by tusd.
+	var offset int64
+	for i, chunk := range chunks {
+		if chunk.offset != offset {
+			return chunks[:i], nil
+		}
+		offset += chunk.size
+	}
+
+	return chunks, nil
+}
+
+func (upload *webdavUpload) GetInfo(ctx context.Context) (handler.FileInfo, error) {
+	return upload.info, nil
+}
+
+func (upload *webdavUpload) WriteChunk(ctx context.Context, offset int64, src io.Reader) (int64, error) {
+	chunkSize := upload.store.ChunkSize
+	if chunkSize <= 0 {
+		chunkSize = DefaultChunkSize
+	}
+
+	buf := make([]byte, chunkSize)
+	var n int64
+	for {
+		// Data read before an error is still written, so the client does not
+		// have to send it again.
+		read, readErr := io.ReadFull(src, buf)
+		if read > 0 {
+			if err := upload.write(ctx, offset+n, buf[:read]); err != nil {
+				return n, err
+			}
+
+			n += int64(read)
+			upload.info.Offset += int64(read)
+		}
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			return n, nil
+		}
+		if readErr != nil {
+			return n, readErr
+		}
+	}
+}
+
+// write stores the data at the offset using the upload's write mode.
+func (upload *webdavUpload) write(ctx context.Context, offset int64, data []byte) error {
+	store := upload.store
+	if upload.chunksPath != "" {
+		return store.put(ctx, upload.chunkPath(offset), data, nil)
+	}
+
+	byteRange := fmt.Sprintf("%d-%d", offset, offset+int64(len(data))-1)
+	if store.WriteMode == WriteModeContentRange {
+		return store.put(ctx, upload.binPath, data, http.Header{
+			"Content-Range": []string{"bytes " + byteRange + "/*"},
+		})
+	}
+
+	return store.send(ctx, http.MethodPatch, upload.binPath, bytes.NewReader(data), http.Header{
+		"Content-Type":   []string{"application/x-sabredav-partialupdate"},
+		"X-Update-Range": []string{"bytes=" + byteRange},
+	})
+}
+
+func (upload *webdavUpload) GetReader(ctx context.Context) (io.ReadCloser, error) {
+	body, err := upload.store.get(ctx, upload.binPath)
+	if err == nil || upload.chunksPath == "" || !isStatus(err, http.StatusNotFound) {
+		return body, err
+	}
+
+	// The chunks of unfinished uploads are read one after another.
+	chunks, err := upload.chunks(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &chunkReader{
+		ctx:    ctx,
+		upload: upload,
+		chunks: chunks,
+	}, nil
+}
+
+func (upload *webdavUpload) Terminate(ctx context.Context) error {
+	store := upload.store
+
+	// Missing files are ignored because we want to delete them anyways.
+	if err := store.delete(ctx, upload.binPath); err != nil {
+		return err
+	}
+
+	if upload.chunksPath != "" {
+		if err := store.delete(ctx, upload.chunksPath); err != nil {
+			return err
+		}
+	}
+
+	return store.delete(ctx, upload.infoPath)
+}
+
+// ConcatUploads copies the partial uploads' files into the chunks collection on
+// the server, if the upload uses chunks. Otherwise, their data is written using
+// partial updates.
+func (upload *webdavUpload) ConcatUploads(ctx context.Context, uploads []handler.Upload) error {
+	for _, partialUpload := range uploads {
+		partial := partialUpload.(*webdavUpload)
+
+		if upload.chunksPath != "" {
+			if err := upload.store.transfer(ctx, "COPY", partial.binPath, upload.chunkPath(upload.info.Offset)); err != nil {
+				return err
+			}
+
+			upload.info.Offset += partial.info.Offset
+			continue
+		}
+
+		src, err := partial.GetReader(ctx)
+		if err != nil {
+			return err
+		}
+
+		_, err = upload.WriteChunk(ctx, upload.info.Offset, src)
+		src.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	// The handler does not finish concatenated uploads, so the chunks must be
+	// combined here.
+	return upload.FinishUpload(ctx)
+}
+
+func (upload *webdavUpload) DeclareLength(ctx context.Context, length int64) error {
+	upload.info.Size = length
+	upload.info.SizeIsDeferred = false
+	return upload.writeInfo(ctx)
+}
+
+func (upload *webdavUpload) UpdateState(ctx context.Context, state handler.UploadState) error {
+	upload.info.State = &state
+	return upload.writeInfo(ctx)
+}
+
+// writeInfo updates the entire information. Everything will be overwritten.
+func (upload *webdavUpload) writeInfo(ctx context.Context) error {
+	data, err := json.Marshal(upload.info)
+	if err != nil {
+		return err
+	}
+	return upload.store.put(ctx, upload.infoPath, data, nil)
+}
+
+// FinishUpload combines the chunks into a single file inside the chunks collection,
+// which is then moved to its final location.
+func (upload *webdavUpload) FinishUpload(ctx context.Context) error {
+	if upload.chunksPath == "" {
+		return nil
+	}
+
+	store := upload.store
+	chunks, err := upload.chunks(ctx)
+	if err != nil {
+		if isStatus(err, http.StatusNotFound) {
+			// The upload has been finished before.
+			return nil
+		}
+		return err
+	}
+
+	var size int64
+	for _, chunk := range chunks {
+		size += chunk.size
+	}
+
+	reader := &chunkReader{
+		ctx:    ctx,
+		upload: upload,
+		chunks: chunks,
+	}
+	defer reader.Close()
+
+	assembledPath := path.Join(upload.chunksPath, assembledName)
+	res, err := store.do(ctx, http.MethodPut, assembledPath, &sizedReader{reader, size}, nil)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	if err := store.transfer(ctx, "MOVE", assembledPath, upload.binPath); err != nil {
+		return err
+	}
+
+	return store.delete(ctx, upload.chunksPath)
+}
+
+// chunkReader reads the chunks one after another.
+type chunkReader struct {
+	ctx     context.Context
+	upload  *webdavUpload
+	chunks  []chunk
+	current io.ReadCloser
+}
+
+func (reader *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if reader.current == nil {
+			if len(reader.chunks) == 0 {
+				return 0, io.EOF
+			}
+
+			body, err := reader.upload.store.get(reader.ctx, reader.upload.chunkPath(reader.chunks[0].offset))
+			if err != nil {
+				return 0, err
+			}
+			reader.current = body
+			reader.chunks = reader.chunks[1:]
+		}
+
+		n, err := reader.current.Read(p)
+		if err == io.EOF {
+			reader.current.Close()
+			reader.current = nil
+			err = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (reader *chunkReader) Close() error {
+	if reader.current == nil {
+		return nil
+	}
+
+	err := reader.current.Close()
+	reader.current = nil
+	return err
+}
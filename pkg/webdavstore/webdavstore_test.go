@@ -0,0 +1,330 @@
+package webdavstore
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/webdav"
+
+	"github.com/tus/tusd/v2/pkg/handler"
+)
+
+// Test interface implementation of WebDAVStore
+var _ handler.DataStore = &WebDAVStore{}
+var _ handler.TerminaterDataStore = &WebDAVStore{}
+var _ handler.ConcaterDataStore = &WebDAVStore{}
+var _ handler.LengthDeferrerDataStore = &WebDAVStore{}
+var _ handler.StateUpdaterDataStore = &WebDAVStore{}
+
+// testServer is an in-process WebDAV server, which optionally supports partial updates.
+type testServer struct {
+	dir    string
+	sabre  bool
+	webdav *webdav.Handler
+
+	mutex   sync.Mutex
+	methods map[string]int
+}
+
+func (server *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	server.methods[r.Method]++
+	server.mutex.Unlock()
+
+	switch {
+	case r.Method == http.MethodOptions && server.sabre:
+		w.Header().Set("DAV", "1, 2, sabredav-partialupdate")
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPatch && server.sabre:
+		server.writeRange(w, r, strings.TrimPrefix(r.Header.Get("X-Update-Range"), "bytes="))
+	case r.Method == http.MethodPut && r.Header.Get("Content-Range") != "":
+		byteRange := strings.TrimPrefix(r.Header.Get("Content-Range"), "bytes ")
+		server.writeRange(w, r, strings.TrimSuffix(byteRange, "/*"))
+	default:
+		server.webdav.ServeHTTP(w, r)
+	}
+}
+
+// writeRange writes the request body at the start of the range into the existing file.
+func (server *testServer) writeRange(w http.ResponseWriter, r *http.Request, byteRange string) {
+	var start, end int64
+	if _, err := fmt.Sscanf(byteRange, "%d-%d", &start, &end); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	file, err := os.OpenFile(filepath.Join(server.dir, filepath.FromSlash(r.URL.Path)), os.O_WRONLY, 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil || int64(len(data)) != end-start+1 {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := file.WriteAt(data, start); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newStore(t *testing.T, mode WriteMode, sabre bool) (*WebDAVStore, *testServer) {
+	dir := t.TempDir()
+	server := &testServer{
+		dir:   dir,
+		sabre: sabre,
+		webdav: &webdav.Handler{
+			FileSystem: webdav.Dir(dir),
+			LockSystem: webdav.NewMemLS(),
+		},
+		methods: make(map[string]int),
+	}
+
+	httpServer := httptest.NewServer(server)
+	t.Cleanup(httpServer.Close)
+
+	endpoint, err := url.Parse(httpServer.URL)
+	assert.NoError(t, err)
+
+	store := New(endpoint)
+	store.WriteMode = mode
+	store.ChunkSize = 4
+	return store, server
+}
+
+func readAll(t *testing.T, reader io.ReadCloser, err error) string {
+	assert.NoError(t, err)
+	defer reader.Close()
+
+	content, err := io.ReadAll(reader)
+	assert.NoError(t, err)
+	return string(content)
+}
+
+func TestWebDAVStore(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		mode   WriteMode
+		sabre  bool
+		method string
+	}{
+		{"chunks", WriteModeChunks, false, http.MethodPut},
+		{"sabre", WriteModeAuto, true, http.MethodPatch},
+		{"content-range", WriteModeContentRange, false, http.MethodPut},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			a := assert.New(t)
+			ctx := context.Background()
+			store, server := newStore(t, test.mode, test.sabre)
+
+			// Create new upload
+			upload, err := store.NewUpload(ctx, handler.FileInfo{
+				ID:   "foo",
+				Size: 11,
+				MetaData: map[string]string{
+					"hello": "world",
+				},
+			})
+			a.NoError(err)
+
+			info, err := upload.GetInfo(ctx)
+			a.NoError(err)
+			a.EqualValues(0, info.Offset)
+			a.Equal("webdavstore", info.Storage["Type"])
+			a.Equal("foo", info.Storage[StorageKeyPath])
+			a.Equal("foo.info", info.Storage[StorageKeyInfoPath])
+			a.FileExists(filepath.Join(server.dir, "foo.info"))
+
+			// Write data in requests of up to ChunkSize bytes
+			n, err := upload.WriteChunk(ctx, 0, strings.NewReader("hello "))
+			a.NoError(err)
+			a.EqualValues(6, n)
+
+			// Resume the upload
+			upload, err = store.GetUpload(ctx, "foo")
+			a.NoError(err)
+
+			info, err = upload.GetInfo(ctx)
+			a.NoError(err)
+			a.EqualValues(6, info.Offset)
+			a.Equal(handler.MetaData{"hello": "world"}, info.MetaData)
+
+			// Unfinished uploads can be read
+			reader, err := upload.GetReader(ctx)
+			a.Equal("hello ", readAll(t, reader, err))
+
+			n, err = upload.WriteChunk(ctx, 6, strings.NewReader("world"))
+			a.NoError(err)
+			a.EqualValues(5, n)
+			a.Positive(server.methods[test.method])
+
+			a.NoError(upload.FinishUpload(ctx))
+
+			content, err := os.ReadFile(filepath.Join(server.dir, "foo"))
+			a.NoError(err)
+			a.Equal("hello world", string(content))
+			a.NoDirExists(filepath.Join(server.dir, "foo.chunks"))
+
+			upload, err = store.GetUpload(ctx, "foo")
+			a.NoError(err)
+
+			info, err = upload.GetInfo(ctx)
+			a.NoError(err)
+			a.EqualValues(11, info.Offset)
+
+			reader, err = upload.GetReader(ctx)
+			a.Equal("hello world", readAll(t, reader, err))
+
+			// Terminate upload
+			a.NoError(store.AsTerminatableUpload(upload).Terminate(ctx))
+
+			_, err = store.GetUpload(ctx, "foo")
+			a.Equal(handler.ErrNotFound, err)
+			a.NoFileExists(filepath.Join(server.dir, "foo"))
+			a.NoFileExists(filepath.Join(server.dir, "foo.info"))
+		})
+	}
+}
+
+func TestAutoDetection(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+
+	// Servers without partial updates use chunks
+	store, server := newStore(t, WriteModeAuto, false)
+	upload, err := store.NewUpload(ctx, handler.FileInfo{ID: "foo"})
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.Equal("foo.chunks", info.Storage[StorageKeyChunksPath])
+	a.DirExists(filepath.Join(server.dir, "foo.chunks"))
+
+	store, _ = newStore(t, WriteModeAuto, true)
+	upload, err = store.NewUpload(ctx, handler.FileInfo{ID: "foo"})
+	a.NoError(err)
+
+	info, err = upload.GetInfo(ctx)
+	a.NoError(err)
+	a.NotContains(info.Storage, StorageKeyChunksPath)
+}
+
+func TestCreateDirectories(t *testing.T) {
+	for _, mode := range []WriteMode{WriteModeChunks, WriteModeContentRange} {
+		t.Run(string(mode), func(t *testing.T) {
+			a := assert.New(t)
+			ctx := context.Background()
+			store, server := newStore(t, mode, false)
+
+			// Upload IDs containing slashes are mapped onto collections
+			upload, err := store.NewUpload(ctx, handler.FileInfo{
+				ID:   "hello/world/123",
+				Size: 5,
+			})
+			a.NoError(err)
+
+			_, err = upload.WriteChunk(ctx, 0, strings.NewReader("hello"))
+			a.NoError(err)
+			a.NoError(upload.FinishUpload(ctx))
+
+			content, err := os.ReadFile(filepath.Join(server.dir, "hello", "world", "123"))
+			a.NoError(err)
+			a.Equal("hello", string(content))
+			a.FileExists(filepath.Join(server.dir, "hello", "world", "123.info"))
+		})
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	a := assert.New(t)
+	store, _ := newStore(t, WriteModeChunks, false)
+
+	upload, err := store.GetUpload(context.Background(), "upload-that-does-not-exist")
+	a.Equal(handler.ErrNotFound, err)
+	a.Equal(nil, upload)
+}
+
+func TestConcatUploads(t *testing.T) {
+	for _, mode := range []WriteMode{WriteModeChunks, WriteModeContentRange} {
+		t.Run(string(mode), func(t *testing.T) {
+			a := assert.New(t)
+			ctx := context.Background()
+			store, server := newStore(t, mode, false)
+
+			var partialUploads []handler.Upload
+			for _, content := range []string{"abcde", "fgh", "ij"} {
+				upload, err := store.NewUpload(ctx, handler.FileInfo{
+					Size:      int64(len(content)),
+					IsPartial: true,
+				})
+				a.NoError(err)
+
+				_, err = upload.WriteChunk(ctx, 0, strings.NewReader(content))
+				a.NoError(err)
+				a.NoError(upload.FinishUpload(ctx))
+
+				partialUploads = append(partialUploads, upload)
+			}
+
+			finalUpload, err := store.NewUpload(ctx, handler.FileInfo{
+				ID:      "final",
+				Size:    10,
+				IsFinal: true,
+			})
+			a.NoError(err)
+
+			err = store.AsConcatableUpload(finalUpload).ConcatUploads(ctx, partialUploads)
+			a.NoError(err)
+
+			content, err := os.ReadFile(filepath.Join(server.dir, "final"))
+			a.NoError(err)
+			a.Equal("abcdefghij", string(content))
+
+			finalUpload, err = store.GetUpload(ctx, "final")
+			a.NoError(err)
+
+			info, err := finalUpload.GetInfo(ctx)
+			a.NoError(err)
+			a.EqualValues(10, info.Offset)
+		})
+	}
+}
+
+func TestDeclareLength(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.Background()
+	store, _ := newStore(t, WriteModeChunks, false)
+
+	upload, err := store.NewUpload(ctx, handler.FileInfo{
+		ID:             "foo",
+		SizeIsDeferred: true,
+	})
+	a.NoError(err)
+
+	err = store.AsLengthDeclarableUpload(upload).DeclareLength(ctx, 100)
+	a.NoError(err)
+
+	// The length is persisted on the server
+	upload, err = store.GetUpload(ctx, "foo")
+	a.NoError(err)
+
+	info, err := upload.GetInfo(ctx)
+	a.NoError(err)
+	a.EqualValues(100, info.Size)
+	a.False(info.SizeIsDeferred)
+}